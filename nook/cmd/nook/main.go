@@ -0,0 +1,437 @@
+//go:build !test
+
+// Code coverage for main is ignored for now. TODO: Add integration tests for main entrypoint.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jbweber/homelab/nook/internal/api"
+	"github.com/jbweber/homelab/nook/internal/client"
+	"github.com/jbweber/homelab/nook/internal/config"
+	"github.com/jbweber/homelab/nook/internal/server"
+	"github.com/spf13/cobra"
+)
+
+func main() {
+	var rootCmd = &cobra.Command{
+		Use:   "nook",
+		Short: "Nook is a metadata service for cloud-init",
+		Long:  `Nook provides metadata endpoints for cloud-init and allows management of machines, networks, and SSH keys.`,
+	}
+	defaultServer := client.DefaultServerURL
+	if env := os.Getenv(client.ServerURLEnv); env != "" {
+		defaultServer = env
+	}
+	rootCmd.PersistentFlags().String("server", defaultServer, "URL of the nook server the CLI talks to (also $"+client.ServerURLEnv+")")
+	rootCmd.PersistentFlags().String("api-key", os.Getenv(config.APIKeyEnv), "API key: required by the server on /api/v0 and admin endpoints when set, sent by the CLI (also $"+config.APIKeyEnv+")")
+
+	var serverCmd = &cobra.Command{
+		Use:   "server",
+		Short: "Start the nook web service",
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg := config.NewConfig()
+			cfg.DBPath, _ = cmd.Flags().GetString("db-path")
+			cfg.Port, _ = cmd.Flags().GetString("port")
+			cfg.APIKey, _ = cmd.Flags().GetString("api-key")
+			cfg.SeedFile, _ = cmd.Flags().GetString("seed-file")
+			cfg.SlowRequestThreshold, _ = cmd.Flags().GetDuration("slow-request-threshold")
+			cfg.MaxConcurrentRequests, _ = cmd.Flags().GetInt("max-concurrent-requests")
+			cfg.SSHKeyEncryptionKey, _ = cmd.Flags().GetString("ssh-key-encryption-key")
+			cfg.DebugQueryCount, _ = cmd.Flags().GetBool("debug-query-count")
+			cfg.StrictJSON, _ = cmd.Flags().GetBool("strict-json")
+			cfg.AutoMigrate, _ = cmd.Flags().GetBool("auto-migrate")
+			cfg.Domain, _ = cmd.Flags().GetString("domain")
+			cfg.EnforceMetadataSubnet, _ = cmd.Flags().GetBool("enforce-metadata-subnet")
+			cfg.NetworkConfigUserAgent, _ = cmd.Flags().GetString("network-config-user-agent")
+			cfg.WarnDuplicateHostnames, _ = cmd.Flags().GetBool("warn-duplicate-hostnames")
+			cfg.NegativeCacheTTL, _ = cmd.Flags().GetDuration("negative-cache-ttl")
+			cfg.ShutdownTimeout, _ = cmd.Flags().GetDuration("shutdown-timeout")
+			cfg.TrustedProxies, _ = cmd.Flags().GetStringSlice("trusted-proxies")
+			cfg.VendorDataFile, _ = cmd.Flags().GetString("vendor-data-file")
+			headers, _ := cmd.Flags().GetStringArray("response-header")
+			for _, header := range headers {
+				name, value, ok := strings.Cut(header, ":")
+				if !ok {
+					log.Fatalf("Invalid --response-header %q: expected \"Name: value\"", header)
+				}
+				if cfg.ResponseHeaders == nil {
+					cfg.ResponseHeaders = make(map[string]string)
+				}
+				cfg.ResponseHeaders[strings.TrimSpace(name)] = strings.TrimSpace(value)
+			}
+			runServer(cfg)
+		},
+	}
+	serverCmd.Flags().String("db-path", "~/nook/data/nook.db", "Path to the database file")
+	serverCmd.Flags().String("port", "8080", "Port to run the server on")
+	serverCmd.Flags().Duration("slow-request-threshold", time.Second, "Log a warning for requests slower than this (0 disables)")
+	serverCmd.Flags().Int("max-concurrent-requests", config.DefaultMaxConcurrentRequests, "Maximum requests handled at once; excess requests get 503 (0 disables)")
+	serverCmd.Flags().String("seed-file", "", "JSON/YAML inventory to import on startup when the database is empty")
+	serverCmd.Flags().StringSlice("trusted-proxies", nil, "Comma-separated CIDRs of reverse proxies whose X-Forwarded-For is honored (ignored from everyone else)")
+	serverCmd.Flags().String("vendor-data-file", "", "File served as /vendor-data to machines without their own vendor_data (read once at startup)")
+	serverCmd.Flags().Bool("enforce-metadata-subnet", false, "Refuse metadata requests whose source address is outside the machine's network subnet")
+	serverCmd.Flags().String("network-config-user-agent", "", "Serve /network-config only to User-Agents starting with this prefix (e.g. Cloud-Init)")
+	serverCmd.Flags().Duration("shutdown-timeout", config.DefaultShutdownTimeout, "How long in-flight requests get to finish on SIGINT/SIGTERM")
+	serverCmd.Flags().Duration("negative-cache-ttl", 0, "Cache metadata lookups from unknown IPs for this long (0 disables)")
+	serverCmd.Flags().StringArray("response-header", nil, "Static \"Name: value\" header added to every response (repeatable)")
+	serverCmd.Flags().Bool("warn-duplicate-hostnames", false, "Log a warning at startup for each hostname shared by more than one machine")
+	serverCmd.Flags().String("domain", "", "DNS domain appended to hostnames in meta-data (e.g. lab.example.com)")
+	serverCmd.Flags().Bool("auto-migrate", true, "Apply pending database migrations at startup (when false, an outdated schema fails startup)")
+	serverCmd.Flags().Bool("strict-json", false, "Reject request bodies with unknown JSON fields (400 naming the field)")
+	serverCmd.Flags().Bool("debug-query-count", false, "Report the number of SQL queries each request ran in the X-Query-Count header")
+	serverCmd.Flags().String("ssh-key-encryption-key", "", "Base64 AES key (16, 24 or 32 bytes) to encrypt SSH keys at rest (plaintext when empty)")
+
+	var addCmd = &cobra.Command{
+		Use:   "add",
+		Short: "Add resources to the nook service",
+	}
+
+	var deleteCmd = &cobra.Command{
+		Use:   "delete",
+		Short: "Delete resources from the nook service",
+	}
+
+	var addMachineCmd = &cobra.Command{
+		Use:   "machine",
+		Short: "Add a machine",
+		Run: func(cmd *cobra.Command, args []string) {
+			name, _ := cmd.Flags().GetString("name")
+			hostname, _ := cmd.Flags().GetString("hostname")
+			ipv4, _ := cmd.Flags().GetString("ipv4")
+			addMachine(newClient(cmd), name, hostname, ipv4)
+		},
+	}
+	addMachineCmd.Flags().String("name", "", "Machine name (required)")
+	addMachineCmd.Flags().String("hostname", "", "Machine hostname (required)")
+	addMachineCmd.Flags().String("ipv4", "", "Machine IPv4 address (required)")
+	if err := addMachineCmd.MarkFlagRequired("name"); err != nil {
+		log.Fatal(err)
+	}
+	if err := addMachineCmd.MarkFlagRequired("hostname"); err != nil {
+		log.Fatal(err)
+	}
+	if err := addMachineCmd.MarkFlagRequired("ipv4"); err != nil {
+		log.Fatal(err)
+	}
+
+	var addNetworkCmd = &cobra.Command{
+		Use:   "network",
+		Short: "Add a network",
+		Run: func(cmd *cobra.Command, args []string) {
+			name, _ := cmd.Flags().GetString("name")
+			addNetwork(newClient(cmd), name)
+		},
+	}
+	addNetworkCmd.Flags().String("name", "", "Network name (required)")
+	if err := addNetworkCmd.MarkFlagRequired("name"); err != nil {
+		log.Fatal(err)
+	}
+
+	var addSSHKeyCmd = &cobra.Command{
+		Use:   "ssh-key",
+		Short: "Add an SSH key",
+		Run: func(cmd *cobra.Command, args []string) {
+			machineID, _ := cmd.Flags().GetInt64("machine-id")
+			if fromURL, _ := cmd.Flags().GetString("from-url"); fromURL != "" {
+				addSSHKeysFromURL(newClient(cmd), machineID, fromURL)
+				return
+			}
+			keyText, _ := cmd.Flags().GetString("key-text")
+			addSSHKey(newClient(cmd), machineID, keyText)
+		},
+	}
+	addSSHKeyCmd.Flags().Int64("machine-id", 0, "Machine ID (required)")
+	addSSHKeyCmd.Flags().String("key-text", "", "SSH key text")
+	addSSHKeyCmd.Flags().String("from-url", "", "Fetch keys from a URL such as https://github.com/<user>.keys and add each one")
+	if err := addSSHKeyCmd.MarkFlagRequired("machine-id"); err != nil {
+		log.Fatal(err)
+	}
+	addSSHKeyCmd.MarkFlagsOneRequired("key-text", "from-url")
+	addSSHKeyCmd.MarkFlagsMutuallyExclusive("key-text", "from-url")
+
+	var deleteMachineCmd = &cobra.Command{
+		Use:   "machine",
+		Short: "Delete a machine",
+		Run: func(cmd *cobra.Command, args []string) {
+			id, _ := cmd.Flags().GetInt64("id")
+			deleteMachine(newClient(cmd), id)
+		},
+	}
+	deleteMachineCmd.Flags().Int64("id", 0, "Machine ID (required)")
+	if err := deleteMachineCmd.MarkFlagRequired("id"); err != nil {
+		log.Fatal(err)
+	}
+
+	var deleteNetworkCmd = &cobra.Command{
+		Use:   "network",
+		Short: "Delete a network",
+		Run: func(cmd *cobra.Command, args []string) {
+			name, _ := cmd.Flags().GetString("name")
+			deleteNetwork(newClient(cmd), name)
+		},
+	}
+	deleteNetworkCmd.Flags().String("name", "", "Network name (required)")
+	if err := deleteNetworkCmd.MarkFlagRequired("name"); err != nil {
+		log.Fatal(err)
+	}
+
+	var deleteSSHKeyCmd = &cobra.Command{
+		Use:   "ssh-key",
+		Short: "Delete an SSH key",
+		Run: func(cmd *cobra.Command, args []string) {
+			id, _ := cmd.Flags().GetInt64("id")
+			deleteSSHKey(newClient(cmd), id)
+		},
+	}
+	deleteSSHKeyCmd.Flags().Int64("id", 0, "SSH key ID (required)")
+	if err := deleteSSHKeyCmd.MarkFlagRequired("id"); err != nil {
+		log.Fatal(err)
+	}
+
+	var exportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "Write a full backup of the server's inventory as JSON",
+		Run: func(cmd *cobra.Command, args []string) {
+			output, _ := cmd.Flags().GetString("output")
+			exportBackup(newClient(cmd), output)
+		},
+	}
+	exportCmd.Flags().StringP("output", "o", "", "File to write the backup to (default stdout)")
+
+	var importCmd = &cobra.Command{
+		Use:   "import <file>",
+		Short: "Restore a backup written by export into an empty server",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			importBackup(newClient(cmd), args[0])
+		},
+	}
+
+	addCmd.AddCommand(addMachineCmd)
+	addCmd.AddCommand(addNetworkCmd)
+	addCmd.AddCommand(addSSHKeyCmd)
+	deleteCmd.AddCommand(deleteMachineCmd)
+	deleteCmd.AddCommand(deleteNetworkCmd)
+	deleteCmd.AddCommand(deleteSSHKeyCmd)
+	rootCmd.AddCommand(serverCmd)
+	rootCmd.AddCommand(addCmd)
+	rootCmd.AddCommand(deleteCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(importCmd)
+
+	if err := rootCmd.Execute(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func runServer(cfg *config.Config) {
+	if err := cfg.ValidateResponseHeaders(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	// Initialize database
+	db, err := cfg.InitializeDatabase()
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	proxies, err := cfg.TrustedProxyNets()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	// Structured JSON logs; the standard log package is routed through it too
+	logger := api.NewLogger(os.Stdout)
+	slog.SetDefault(logger)
+
+	// Setup router; requests get 503 until startup work below has finished
+	readiness := api.NewReadiness()
+	r := chi.NewRouter()
+	instrumentation := api.NewInstrumentation()
+	r.Use(middleware.RequestID)
+	r.Use(api.TrustProxies(proxies))
+	r.Use(api.RequestLogger(logger))
+	r.Use(middleware.Recoverer)
+	r.Use(instrumentation.Middleware)
+	r.Use(api.ResponseHeaders(cfg.ResponseHeaders))
+	r.Use(readiness.Middleware)
+	r.Use(api.ConcurrencyLimit(cfg.MaxConcurrentRequests))
+	r.Use(api.SlowRequestLogger(logger, cfg.SlowRequestThreshold))
+	if cfg.DebugQueryCount {
+		r.Use(api.QueryCount)
+	}
+
+	// Register API routes
+	nookAPI, err := api.NewAPIWithConfig(db, cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize API: %v", err)
+	}
+	if cfg.WarnDuplicateHostnames {
+		if err := nookAPI.LogDuplicateHostnames(); err != nil {
+			log.Printf("%v", err)
+		}
+	}
+	nookAPI.SetLogger(logger)
+	nookAPI.RegisterRoutes(r)
+	instrumentation.Register(nookAPI.InventoryCollector())
+	r.Handle("/metrics", instrumentation.Handler())
+
+	// Health check endpoint
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := fmt.Fprintln(w, "Nook web service is running!"); err != nil {
+			log.Printf("failed to write response: %v", err)
+		}
+	})
+
+	// Stop accepting requests on Ctrl-C or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ln, err := net.Listen("tcp", ":"+cfg.Port)
+	if err != nil {
+		log.Fatalf("Failed to listen on :%s: %v", cfg.Port, err)
+	}
+	fmt.Printf("Starting Nook web service on :%s...\n", cfg.Port)
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.Run(ctx, &http.Server{Handler: r}, ln, cfg.ShutdownTimeout)
+	}()
+
+	// Seed initial inventory on first boot
+	if cfg.SeedFile != "" {
+		seeded, err := nookAPI.SeedFromFile(cfg.SeedFile)
+		if err != nil {
+			log.Fatalf("Failed to seed database from %s: %v", cfg.SeedFile, err)
+		}
+		if seeded {
+			log.Printf("Seeded database from %s", cfg.SeedFile)
+		} else {
+			log.Printf("Database already populated, skipping seed file %s", cfg.SeedFile)
+		}
+	}
+
+	readiness.MarkReady()
+
+	err = <-serverErr
+	if closeErr := db.Close(); closeErr != nil {
+		log.Printf("Warning: failed to close database: %v", closeErr)
+	}
+	if err != nil {
+		log.Fatalf("Server failed: %v", err)
+	}
+	log.Printf("Server stopped")
+}
+
+// newClient builds an API client for the --server URL, exiting if it is invalid.
+func newClient(cmd *cobra.Command) *client.Client {
+	server, _ := cmd.Flags().GetString("server")
+	c, err := client.New(server, &http.Client{Timeout: 30 * time.Second})
+	if err != nil {
+		log.Fatalf("Invalid --server: %v", err)
+	}
+	apiKey, _ := cmd.Flags().GetString("api-key")
+	c.SetAPIKey(apiKey)
+	return c
+}
+
+func exportBackup(c *client.Client, output string) {
+	out := os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			log.Fatalf("Failed to create %s: %v", output, err)
+		}
+		defer func() {
+			if err := f.Close(); err != nil {
+				log.Fatalf("Failed to write %s: %v", output, err)
+			}
+		}()
+		out = f
+	}
+	if err := c.Export(context.Background(), out); err != nil {
+		log.Fatalf("Failed to export backup: %v", err)
+	}
+}
+
+func importBackup(c *client.Client, path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("Failed to open %s: %v", path, err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	if err := c.Import(context.Background(), f); err != nil {
+		log.Fatalf("Failed to import backup: %v", err)
+	}
+	fmt.Println("Backup imported successfully")
+}
+
+func addMachine(c *client.Client, name, hostname, ipv4 string) {
+	if err := c.AddMachine(context.Background(), name, hostname, ipv4); err != nil {
+		log.Fatalf("Failed to add machine: %v", err)
+	}
+	fmt.Println("Machine added successfully")
+}
+
+func addNetwork(c *client.Client, name string) {
+	if err := c.AddNetwork(context.Background(), name); err != nil {
+		log.Fatalf("Failed to add network: %v", err)
+	}
+	fmt.Println("Network added successfully")
+}
+
+func addSSHKey(c *client.Client, machineID int64, keyText string) {
+	if err := c.AddSSHKey(context.Background(), machineID, keyText); err != nil {
+		log.Fatalf("Failed to add SSH key: %v", err)
+	}
+	fmt.Println("SSH key added successfully")
+}
+
+func addSSHKeysFromURL(c *client.Client, machineID int64, sourceURL string) {
+	result, err := c.ImportSSHKeysFromURL(context.Background(), sourceURL, machineID)
+	if err != nil {
+		log.Fatalf("Failed to import SSH keys: %v", err)
+	}
+	for _, failure := range result.Failures {
+		fmt.Printf("Skipped key %q: %v\n", failure.Key, failure.Err)
+	}
+	fmt.Printf("Added %d of %d SSH keys from %s\n", len(result.Added), len(result.Added)+len(result.Failures), sourceURL)
+	if len(result.Failures) > 0 {
+		os.Exit(1)
+	}
+}
+
+func deleteMachine(c *client.Client, id int64) {
+	if err := c.DeleteMachine(context.Background(), id); err != nil {
+		log.Fatalf("Failed to delete machine: %v", err)
+	}
+	fmt.Println("Machine deleted successfully")
+}
+
+func deleteNetwork(c *client.Client, name string) {
+	if err := c.DeleteNetwork(context.Background(), name); err != nil {
+		log.Fatalf("Failed to delete network: %v", err)
+	}
+	fmt.Println("Network deleted successfully")
+}
+
+func deleteSSHKey(c *client.Client, id int64) {
+	if err := c.DeleteSSHKey(context.Background(), id); err != nil {
+		log.Fatalf("Failed to delete SSH key: %v", err)
+	}
+	fmt.Println("SSH key deleted successfully")
+}
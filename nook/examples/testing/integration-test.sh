@@ -1,7 +1,9 @@
 #!/bin/bash
 
 # Nook Integration Test Script
-# This script validates that Nook service is working correctly
+# This script validates that Nook service is working correctly. The metadata
+# checks send X-Forwarded-For, so start the server with --trusted-proxies
+# covering this host (e.g. 127.0.0.1/32).
 
 set -e
 
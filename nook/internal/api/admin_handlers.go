@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/jbweber/homelab/nook/internal/config"
+	"github.com/jbweber/homelab/nook/internal/domain"
+)
+
+// AdminStore defines the datastore interface for admin handlers
+type AdminStore interface {
+	GetMachineByIPv4(ctx context.Context, ipv4 string) (*Machine, error)
+	GetMachineByIPv6(ctx context.Context, ipv6 string) (*Machine, error)
+	GetNetwork(ctx context.Context, id int64) (domain.Network, error)
+	CheckConsistency(ctx context.Context) (*ConsistencyReport, error)
+	ReconcileLeases(ctx context.Context) (*ReconcileReport, error)
+}
+
+// Admin groups operator-only handlers. These bypass the client IP checks used by
+// the metadata endpoints, so they must only be mounted behind RequireAPIKey.
+type Admin struct {
+	store AdminStore
+	cfg   *config.Config
+}
+
+// NewAdmin creates a new Admin instance with the given store and running configuration.
+func NewAdmin(store AdminStore, cfg *config.Config) *Admin {
+	return &Admin{store: store, cfg: cfg}
+}
+
+// MetaDataHandler handles GET /admin/meta-data?ip=<addr>.
+//
+// Renders the NoCloud meta-data exactly as the machine at the given IP would receive it.
+func (ad *Admin) MetaDataHandler(w http.ResponseWriter, r *http.Request) {
+	ip := r.URL.Query().Get("ip")
+	if ip == "" {
+		http.Error(w, "ip query parameter is required", http.StatusBadRequest)
+		return
+	}
+	if net.ParseIP(ip) == nil {
+		http.Error(w, "invalid IP address format", http.StatusBadRequest)
+		return
+	}
+
+	machine, err := machineByClientIP(r.Context(), ad.store, ip)
+	if err != nil {
+		log.Printf("failed to lookup machine by IP %s: %v", ip, err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if machine == nil {
+		http.Error(w, "machine not found", http.StatusNotFound)
+		return
+	}
+
+	subnet, err := machineSubnet(r.Context(), ad.store.GetNetwork, machine)
+	if err != nil {
+		log.Printf("failed to lookup network for machine %d: %v", machine.ID, err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/yaml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte(renderNoCloudMetaData(machine, subnet, ad.cfg.Domain))); err != nil {
+		log.Printf("failed to write admin meta-data response: %v", err)
+	}
+}
+
+// ConsistencyHandler handles GET /admin/consistency.
+//
+// Runs every database consistency check and returns the problems found. The
+// response is 200 whether or not issues were found; see the report's "ok" field.
+func (ad *Admin) ConsistencyHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := ad.store.CheckConsistency(r.Context())
+	if err != nil {
+		log.Printf("failed to check consistency: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Printf("failed to encode consistency report: %v", err)
+	}
+}
+
+// ReconcileHandler handles POST /admin/reconcile.
+//
+// Repairs drift between machines and their IP leases and reports each action
+// taken. Running it again on a reconciled database reports no actions.
+func (ad *Admin) ReconcileHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := ad.store.ReconcileLeases(r.Context())
+	if err != nil {
+		log.Printf("failed to reconcile leases: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("reconcile completed with %d actions", len(report.Actions))
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Printf("failed to encode reconcile report: %v", err)
+	}
+}
+
+// ConfigHandler handles GET /admin/config.
+//
+// Returns the effective service configuration with secrets redacted.
+func (ad *Admin) ConfigHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ad.cfg.Redacted()); err != nil {
+		log.Printf("failed to encode config response: %v", err)
+	}
+}
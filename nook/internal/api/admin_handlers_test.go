@@ -0,0 +1,306 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jbweber/homelab/nook/internal/config"
+	"github.com/jbweber/homelab/nook/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupAdminTestRouter creates a router backed by a real database with the given API key configured
+func setupAdminTestRouter(t *testing.T, apiKey string) *chi.Mux {
+	t.Helper()
+
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "admin_test")
+	t.Cleanup(cleanup)
+
+	_, err := db.Exec("INSERT INTO machines (name, hostname, ipv4) VALUES (?, ?, ?)",
+		"test-machine", "test-host", "192.168.1.50")
+	if err != nil {
+		t.Fatalf("Failed to insert test machine: %v", err)
+	}
+
+	cfg := config.NewConfig()
+	cfg.APIKey = apiKey
+
+	r := chi.NewRouter()
+	api, err := NewAPIWithConfig(db, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create API: %v", err)
+	}
+	api.RegisterRoutes(r)
+	return r
+}
+
+func TestAdminMetaDataHandler_MatchesIPScopedMetaData(t *testing.T) {
+	r := setupAdminTestRouter(t, "secret")
+
+	// Meta-data as the machine itself would see it
+	req := httptest.NewRequest("GET", "/meta-data", nil)
+	req.RemoteAddr = "192.168.1.50:12345"
+	direct := httptest.NewRecorder()
+	r.ServeHTTP(direct, req)
+	assert.Equal(t, http.StatusOK, direct.Code)
+
+	// Same machine rendered through the admin endpoint from an unrelated address
+	req = httptest.NewRequest("GET", "/admin/meta-data?ip=192.168.1.50", nil)
+	req.RemoteAddr = "203.0.113.99:12345"
+	req.Header.Set("Authorization", "Bearer secret")
+	admin := httptest.NewRecorder()
+	r.ServeHTTP(admin, req)
+
+	assert.Equal(t, http.StatusOK, admin.Code)
+	assert.Equal(t, direct.Header().Get("Content-Type"), admin.Header().Get("Content-Type"))
+	assert.Equal(t, direct.Body.String(), admin.Body.String())
+}
+
+func TestAdminMetaDataHandler_Errors(t *testing.T) {
+	r := setupAdminTestRouter(t, "secret")
+
+	tests := []struct {
+		name     string
+		url      string
+		expected int
+	}{
+		{"MissingIP", "/admin/meta-data", http.StatusBadRequest},
+		{"InvalidIP", "/admin/meta-data?ip=not-an-ip", http.StatusBadRequest},
+		{"UnknownIP", "/admin/meta-data?ip=192.168.1.99", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			req.Header.Set("Authorization", "Bearer secret")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.expected, w.Code)
+		})
+	}
+}
+
+func TestAdminMetaDataHandler_RequiresAPIKey(t *testing.T) {
+	r := setupAdminTestRouter(t, "secret")
+
+	tests := []struct {
+		name          string
+		authorization string
+	}{
+		{"MissingHeader", ""},
+		{"WrongKey", "Bearer wrong"},
+		{"WrongScheme", "Basic secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/admin/meta-data?ip=192.168.1.50", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+			assert.NotContains(t, w.Body.String(), "test-host")
+		})
+	}
+}
+
+func TestAdminMetaDataHandler_DisabledWithoutAPIKey(t *testing.T) {
+	r := setupAdminTestRouter(t, "")
+
+	req := httptest.NewRequest("GET", "/admin/meta-data?ip=192.168.1.50", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestAdminConsistencyHandler_Clean(t *testing.T) {
+	r := setupAdminTestRouter(t, "secret")
+
+	req := httptest.NewRequest("GET", "/admin/consistency", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var report ConsistencyReport
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+	assert.True(t, report.OK)
+	assert.Empty(t, report.Issues)
+}
+
+func TestAdminConsistencyHandler_ReportsIssues(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "admin_consistency_test")
+	t.Cleanup(cleanup)
+
+	// Orphans can only be created with foreign keys disabled, which is per connection
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to get connection: %v", err)
+	}
+	seed := []string{
+		"PRAGMA foreign_keys = OFF",
+		"INSERT INTO networks (id, name, bridge, subnet, gateway, dns_servers, description) VALUES (1, 'lab', 'br0', '192.168.1.0/24', '192.168.1.1', '', '')",
+		"INSERT INTO dhcp_ranges (network_id, start_ip, end_ip) VALUES (1, '192.168.1.100', '192.168.1.150')",
+		"INSERT INTO dhcp_ranges (network_id, start_ip, end_ip) VALUES (1, '192.168.1.140', '192.168.1.200')",
+		"INSERT INTO machines (id, name, hostname, ipv4, network_id) VALUES (1, 'stray', 'stray', '10.0.0.5', 1)",
+		"INSERT INTO machines (id, name, hostname, ipv4, network_id) VALUES (2, 'drifted', 'drifted', '192.168.1.20', 1)",
+		"INSERT INTO ip_address_leases (machine_id, network_id, ip_address) VALUES (2, 1, '192.168.1.21')",
+		"INSERT INTO ip_address_leases (machine_id, network_id, ip_address) VALUES (998, 1, '192.168.1.99')",
+		"INSERT INTO ssh_keys (machine_id, key_text) VALUES (999, 'ssh-ed25519 AAAA orphan')",
+		"PRAGMA foreign_keys = ON",
+	}
+	for _, stmt := range seed {
+		if _, err := conn.ExecContext(context.Background(), stmt); err != nil {
+			t.Fatalf("Failed to seed %q: %v", stmt, err)
+		}
+	}
+	if err := conn.Close(); err != nil {
+		t.Fatalf("Failed to release connection: %v", err)
+	}
+
+	cfg := config.NewConfig()
+	cfg.APIKey = "secret"
+	r := chi.NewRouter()
+	api, err := NewAPIWithConfig(db, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create API: %v", err)
+	}
+	api.RegisterRoutes(r)
+
+	req := httptest.NewRequest("GET", "/admin/consistency", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var report ConsistencyReport
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+	assert.False(t, report.OK)
+
+	found := make(map[string]int)
+	for _, issue := range report.Issues {
+		found[issue.Check]++
+	}
+	assert.Equal(t, 1, found[CheckOrphanedSSHKey], "issues: %+v", report.Issues)
+	assert.Equal(t, 1, found[CheckOrphanedLease], "issues: %+v", report.Issues)
+	assert.Equal(t, 1, found[CheckMachineOutsideSubnet], "issues: %+v", report.Issues)
+	assert.Equal(t, 1, found[CheckLeaseIPMismatch], "issues: %+v", report.Issues)
+	assert.Equal(t, 1, found[CheckOverlappingDHCPRanges], "issues: %+v", report.Issues)
+}
+
+func TestAdminConsistencyHandler_RequiresAPIKey(t *testing.T) {
+	r := setupAdminTestRouter(t, "secret")
+
+	req := httptest.NewRequest("GET", "/admin/consistency", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestAdminReconcileHandler_RepairsLeases(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "admin_reconcile_test")
+	t.Cleanup(cleanup)
+
+	// The orphaned lease can only be created with foreign keys disabled, which is per connection
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to get connection: %v", err)
+	}
+	seed := []string{
+		"PRAGMA foreign_keys = OFF",
+		"INSERT INTO networks (id, name, bridge, subnet, gateway, dns_servers, description) VALUES (1, 'lab', 'br0', '192.168.1.0/24', '192.168.1.1', '', '')",
+		"INSERT INTO machines (id, name, hostname, ipv4, network_id) VALUES (1, 'unleased', 'unleased', '192.168.1.20', 1)",
+		"INSERT INTO machines (id, name, hostname, ipv4, network_id) VALUES (2, 'leased', 'leased', '192.168.1.21', 1)",
+		"INSERT INTO ip_address_leases (machine_id, network_id, ip_address) VALUES (2, 1, '192.168.1.21')",
+		"INSERT INTO ip_address_leases (machine_id, network_id, ip_address) VALUES (998, 1, '192.168.1.99')",
+		"PRAGMA foreign_keys = ON",
+	}
+	for _, stmt := range seed {
+		if _, err := conn.ExecContext(context.Background(), stmt); err != nil {
+			t.Fatalf("Failed to seed %q: %v", stmt, err)
+		}
+	}
+	if err := conn.Close(); err != nil {
+		t.Fatalf("Failed to release connection: %v", err)
+	}
+
+	cfg := config.NewConfig()
+	cfg.APIKey = "secret"
+	r := chi.NewRouter()
+	api, err := NewAPIWithConfig(db, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create API: %v", err)
+	}
+	api.RegisterRoutes(r)
+
+	reconcile := func() ReconcileReport {
+		req := httptest.NewRequest("POST", "/admin/reconcile", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var report ReconcileReport
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+		return report
+	}
+
+	report := reconcile()
+	found := make(map[string]int)
+	for _, action := range report.Actions {
+		found[action.Action]++
+	}
+	assert.Equal(t, 1, found[ReconcileLeaseCreated], "actions: %+v", report.Actions)
+	assert.Equal(t, 1, found[ReconcileLeaseRemoved], "actions: %+v", report.Actions)
+	assert.Len(t, report.Actions, 2)
+
+	var machineID int64
+	err = db.QueryRow("SELECT machine_id FROM ip_address_leases WHERE ip_address = '192.168.1.20'").Scan(&machineID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), machineID)
+
+	var orphans int
+	err = db.QueryRow("SELECT COUNT(*) FROM ip_address_leases WHERE machine_id = 998").Scan(&orphans)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, orphans)
+
+	// A second run has nothing left to do
+	assert.Empty(t, reconcile().Actions)
+}
+
+func TestAdminReconcileHandler_RequiresAPIKey(t *testing.T) {
+	r := setupAdminTestRouter(t, "secret")
+
+	req := httptest.NewRequest("POST", "/admin/reconcile", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestAdminConfigHandler_RedactsAPIKey(t *testing.T) {
+	r := setupAdminTestRouter(t, "secret")
+
+	req := httptest.NewRequest("GET", "/admin/config", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "secret")
+
+	var cfg map[string]interface{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&cfg))
+	assert.Equal(t, config.RedactedPlaceholder, cfg["api_key"])
+	assert.Equal(t, "8080", cfg["port"])
+	assert.Contains(t, cfg, "db_path")
+	assert.Contains(t, cfg, "seed_file")
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jbweber/homelab/nook/internal/domain"
+)
+
+// CheckConsistency implements AdminStore interface
+func (a *API) CheckConsistency(ctx context.Context) (*ConsistencyReport, error) {
+
+	machines, err := a.machineRepo.FindAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list machines: %w", err)
+	}
+	networks, err := a.networkRepo.FindAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list networks: %w", err)
+	}
+	keys, err := a.sshKeyRepo.FindAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list SSH keys: %w", err)
+	}
+	leases, err := a.ipLeaseRepo.FindAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list IP leases: %w", err)
+	}
+	ranges, err := a.dhcpRangeRepo.FindAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list DHCP ranges: %w", err)
+	}
+
+	machinesByID := make(map[int64]domain.Machine, len(machines))
+	for _, m := range machines {
+		machinesByID[m.ID] = m
+	}
+	networksByID := make(map[int64]domain.Network, len(networks))
+	for _, n := range networks {
+		networksByID[n.ID] = n
+	}
+
+	issues := []ConsistencyIssue{}
+	issues = append(issues, checkOrphanedSSHKeys(keys, machinesByID)...)
+	issues = append(issues, checkOrphanedLeases(leases, machinesByID, networksByID)...)
+	issues = append(issues, checkMachineSubnets(machines, networksByID)...)
+	issues = append(issues, checkLeaseMachineIPs(leases, machinesByID)...)
+	issues = append(issues, checkOverlappingDHCPRanges(ranges)...)
+
+	return &ConsistencyReport{OK: len(issues) == 0, Issues: issues}, nil
+}
+
+// ReconcileLeases implements AdminStore interface. It removes leases whose
+// machine no longer exists and creates the missing lease for every
+// network-managed machine with an IPv4 but no lease on its network. Machines
+// whose address is leased elsewhere, or which already lease a different address
+// on the network, are skipped and reported rather than changed.
+func (a *API) ReconcileLeases(ctx context.Context) (*ReconcileReport, error) {
+
+	machines, err := a.machineRepo.FindAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list machines: %w", err)
+	}
+	leases, err := a.ipLeaseRepo.FindAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list IP leases: %w", err)
+	}
+
+	machinesByID := make(map[int64]domain.Machine, len(machines))
+	for _, m := range machines {
+		machinesByID[m.ID] = m
+	}
+
+	report := &ReconcileReport{Actions: []ReconcileAction{}}
+	leasesByIP := make(map[string]domain.IPAddressLease, len(leases))
+	type machineNetwork struct{ machineID, networkID int64 }
+	leasesByMachine := make(map[machineNetwork]domain.IPAddressLease, len(leases))
+	for _, lease := range leases {
+		if _, ok := machinesByID[lease.MachineID]; !ok {
+			if err := a.ipLeaseRepo.DeleteByID(ctx, lease.ID); err != nil {
+				return nil, fmt.Errorf("failed to remove lease %d: %w", lease.ID, err)
+			}
+			report.Actions = append(report.Actions, ReconcileAction{
+				Action:  ReconcileLeaseRemoved,
+				Message: fmt.Sprintf("removed lease %d (%s) for missing machine %d", lease.ID, lease.IPAddress, lease.MachineID),
+			})
+			continue
+		}
+		leasesByIP[lease.IPAddress] = lease
+		leasesByMachine[machineNetwork{lease.MachineID, lease.NetworkID}] = lease
+	}
+
+	for _, machine := range machines {
+		if machine.NetworkID == nil || machine.IPv4 == "" {
+			continue
+		}
+		if existing, ok := leasesByMachine[machineNetwork{machine.ID, *machine.NetworkID}]; ok {
+			if existing.IPAddress != machine.IPv4 {
+				report.Actions = append(report.Actions, ReconcileAction{
+					Action:  ReconcileSkipped,
+					Message: fmt.Sprintf("machine %d (%s) has IP %s but leases %s on network %d", machine.ID, machine.Name, machine.IPv4, existing.IPAddress, *machine.NetworkID),
+				})
+			}
+			continue
+		}
+		if holder, ok := leasesByIP[machine.IPv4]; ok {
+			report.Actions = append(report.Actions, ReconcileAction{
+				Action:  ReconcileSkipped,
+				Message: fmt.Sprintf("machine %d (%s) has IP %s, already leased to machine %d", machine.ID, machine.Name, machine.IPv4, holder.MachineID),
+			})
+			continue
+		}
+
+		lease, err := a.ipLeaseRepo.Save(ctx, domain.IPAddressLease{
+			MachineID: machine.ID,
+			NetworkID: *machine.NetworkID,
+			IPAddress: machine.IPv4,
+			LeaseTime: "infinite",
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create lease for machine %d: %w", machine.ID, err)
+		}
+		leasesByIP[lease.IPAddress] = lease
+		report.Actions = append(report.Actions, ReconcileAction{
+			Action:  ReconcileLeaseCreated,
+			Message: fmt.Sprintf("created lease %d (%s) for machine %d (%s) on network %d", lease.ID, lease.IPAddress, machine.ID, machine.Name, lease.NetworkID),
+		})
+	}
+
+	return report, nil
+}
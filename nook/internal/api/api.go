@@ -5,10 +5,15 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"log/slog"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/jbweber/homelab/nook/internal/config"
+	"github.com/jbweber/homelab/nook/internal/domain"
 	"github.com/jbweber/homelab/nook/internal/repository"
 )
 
@@ -19,17 +24,64 @@ type API struct {
 	networkRepo   repository.NetworkRepository
 	dhcpRangeRepo repository.DHCPRangeRepository
 	ipLeaseRepo   repository.IPLeaseRepository
+	settingsRepo  repository.SettingsRepository // nil when built from repositories alone
+	keyGroupRepo  repository.KeyGroupRepository // nil when built from repositories alone
+	cfg           *config.Config
+	proxies       []*net.IPNet // Trusted reverse proxies, parsed from cfg
+	vendorData    string       // Global vendor-data, read from cfg.VendorDataFile
+	db            *sql.DB      // nil when built from repositories alone
+	logger        *slog.Logger
 }
 
 // NewAPI creates a new API instance with repositories initialized from the datastore
 func NewAPI(db *sql.DB) *API {
+	// The default configuration has no encryption key, so this cannot fail
+	api, _ := NewAPIWithConfig(db, config.NewConfig())
+	return api
+}
+
+// NewAPIWithConfig creates a new API instance using the given service configuration.
+// SSH keys are encrypted at rest when the configuration carries an encryption key.
+func NewAPIWithConfig(db *sql.DB, cfg *config.Config) (*API, error) {
+	encryptionKey, err := cfg.SSHKeyEncryptionKeyBytes()
+	if err != nil {
+		return nil, err
+	}
+	sshKeyRepo := repository.NewSSHKeyRepository(db)
+	if encryptionKey != nil {
+		if sshKeyRepo, err = repository.NewEncryptedSSHKeyRepository(db, encryptionKey); err != nil {
+			return nil, err
+		}
+	}
+
+	proxies, err := cfg.TrustedProxyNets()
+	if err != nil {
+		return nil, err
+	}
+	vendorData, err := cfg.VendorData()
+	if err != nil {
+		return nil, err
+	}
+
+	machineRepo := repository.NewMachineRepository(db)
+	if cfg.NegativeCacheTTL > 0 {
+		machineRepo = repository.NewNegativeCachingMachineRepository(machineRepo, cfg.NegativeCacheTTL)
+	}
+
 	return &API{
-		machineRepo:   repository.NewMachineRepository(db),
-		sshKeyRepo:    repository.NewSSHKeyRepository(db),
+		machineRepo:   machineRepo,
+		sshKeyRepo:    sshKeyRepo,
 		networkRepo:   repository.NewNetworkRepository(db),
 		dhcpRangeRepo: repository.NewDHCPRangeRepository(db),
 		ipLeaseRepo:   repository.NewIPLeaseRepository(db),
-	}
+		settingsRepo:  repository.NewSettingsRepository(db),
+		keyGroupRepo:  repository.NewKeyGroupRepository(db, sshKeyRepo),
+		cfg:           cfg,
+		proxies:       proxies,
+		vendorData:    vendorData,
+		db:            db,
+		logger:        slog.Default(),
+	}, nil
 }
 
 // NewAPIWithRepos creates a new API instance with specific repositories for testing
@@ -40,45 +92,156 @@ func NewAPIWithRepos(machineRepo repository.MachineRepository, sshKeyRepo reposi
 		networkRepo:   networkRepo,
 		dhcpRangeRepo: dhcpRangeRepo,
 		ipLeaseRepo:   ipLeaseRepo,
+		cfg:           config.NewConfig(),
+		logger:        slog.Default(),
 	}
 }
 
+// SetLogger replaces the structured logger handlers write to (slog.Default
+// unless set). Call it before RegisterRoutes.
+func (a *API) SetLogger(logger *slog.Logger) {
+	a.logger = logger
+}
+
 // RegisterRoutes registers all API endpoints to the given chi router.
 func (a *API) RegisterRoutes(r chi.Router) {
+	r = r.With(strictJSON(a.cfg.StrictJSON), TrustProxies(a.proxies), RequireManagementAPIKey(a.cfg.APIKey))
+
+	r.Get("/healthz", a.healthzHandler)
 
 	// Metadata endpoints group
 	meta := NewMetaData(a)
-	r.Get("/meta-data", meta.NoCloudMetaDataHandler)
-	r.Get("/user-data", a.noCloudUserDataHandler)
+	meta.enforceSubnet = a.cfg.EnforceMetadataSubnet
+	meta.dnsDomain = a.cfg.Domain
+	r.With(conditionalGET).Get("/meta-data", meta.NoCloudMetaDataHandler)
+	r.Get("/meta-data/", meta.MetaDataDirectoryHandler)
+	r.Get("/meta-data/{key}", meta.MetaDataKeyHandler)
+	for _, prefix := range []string{EC2MetaDataPrefix, EC2LatestMetaDataPrefix} {
+		r.Get(prefix, meta.EC2MetaDataDirectoryHandler)
+		r.Get(prefix+"/", meta.EC2MetaDataDirectoryHandler)
+		r.Get(prefix+"/{key}", meta.EC2MetaDataKeyHandler)
+	}
+	r.With(conditionalGET).Get("/user-data", a.noCloudUserDataHandler)
 	r.Get("/vendor-data", a.noCloudVendorDataHandler)
+	r.Get("/network-config", a.noCloudNetworkConfigHandler)
+	// The seed archive looks machines up by ID, not client IP, so it is operator-only
+	r.With(RequireAPIKey(a.cfg.APIKey)).Get("/seed.tar.gz", a.noCloudSeedArchiveHandler)
 
 	// Machines endpoints group
 	machines := NewMachines(a)
+	machines.dnsDomain = a.cfg.Domain
+	machines.logger = a.logger
+	machineKeys := NewSSHKeys(a)
+	leases := NewLeases(a)
 	r.Route("/api/v0/machines", func(r chi.Router) {
 		r.Get("/", machines.ListMachinesHandler)
 		r.Post("/", machines.CreateMachineHandler)
+		r.Post("/bulk", machines.BulkCreateMachinesHandler)
 		r.Get("/{id}", machines.GetMachineHandler)
+		r.Get("/{id}/network-config", machines.GetMachineNetworkConfigHandler)
+		r.Get("/{id}/delete-preview", machines.MachineDeletePreviewHandler)
+		r.Get("/{id}/detail", machines.MachineDetailHandler)
+		r.Post("/{id}/disable", machines.DisableMachineMetadataHandler)
+		r.Post("/{id}/enable", machines.EnableMachineMetadataHandler)
+		r.Post("/{id}/pin", machines.PinMachineIPHandler)
+		r.Get("/{id}/leases", leases.ListMachineLeasesHandler)
+		r.Get("/{id}/ssh-keys", machineKeys.MachineSSHKeysHandler)
+		r.Post("/{id}/ssh-keys", machineKeys.CreateMachineSSHKeyHandler)
+		r.Delete("/{id}/ssh-keys", machineKeys.DeleteMachineSSHKeysHandler)
+		r.Delete("/{id}/ssh-keys/{keyId}", machineKeys.DeleteMachineSSHKeyHandler)
 		r.Delete("/{id}", machines.DeleteMachineHandler)
 		r.Get("/name/{name}", machines.GetMachineByNameHandler)
+		r.Get("/name/{name}/meta-data", machines.GetMachineMetaDataByNameHandler)
 		r.Get("/ipv4/{ipv4}", machines.GetMachineByIPv4Handler)
 		r.Patch("/{id}", machines.UpdateMachineHandler)
+		r.Put("/{id}", machines.ReplaceMachineHandler)
 	})
 
 	// Networks endpoints group
 	networks := NewNetworks(a)
+	networks.dnsDomain = a.cfg.Domain
 	r.Route("/api/v0/networks", func(r chi.Router) {
 		r.Get("/", networks.NetworksHandler)
 		r.Post("/", networks.CreateNetworkHandler)
 		r.Get("/{id}", networks.GetNetworkHandler)
 		r.Patch("/{id}", networks.UpdateNetworkHandler)
+		r.Post("/{id}/rename", networks.RenameNetworkHandler)
 		r.Delete("/{id}", networks.DeleteNetworkHandler)
 		r.Get("/{id}/dhcp", networks.GetNetworkDHCPRangesHandler)
 		r.Post("/{id}/dhcp", networks.CreateDHCPRangeHandler)
+		r.Post("/{id}/dhcp/bulk", networks.BulkCreateDHCPRangesHandler)
+		r.Delete("/{id}/dhcp/{rangeId}", networks.DeleteNetworkDHCPRangeHandler)
+		r.Get("/{id}/tags", networks.GetNetworkTagsHandler)
+		r.Put("/{id}/tags", networks.SetNetworkTagsHandler)
+		r.Get("/{id}/reservations", networks.GetMACReservationsHandler)
+		r.Post("/{id}/reservations", networks.CreateMACReservationHandler)
+		r.Delete("/{id}/reservations/{reservationId}", networks.DeleteMACReservationHandler)
+		r.Get("/{id}/dnsmasq", networks.DnsmasqConfigHandler)
+		r.Get("/{id}/metadata", networks.NetworkMetadataHandler)
+		r.Get("/{id}/layout", networks.NetworkLayoutHandler)
+		r.Get("/{id}/leases", leases.ListNetworkLeasesHandler)
+		r.Post("/{id}/reserve", networks.ReserveIPAddressesHandler)
+		r.Delete("/{id}/reserve/{token}", networks.ReleaseIPReservationsHandler)
+		r.Post("/{id}/migrate", networks.MigrateNetworkHandler)
 		r.Delete("/dhcp/{rangeId}", networks.DeleteDHCPRangeHandler)
 	})
 
+	// Message of the day
+	motd := NewMOTD(a)
+	r.Get("/api/v0/motd", motd.GetMOTDHandler)
+	r.Put("/api/v0/motd", motd.SetMOTDHandler)
+
+	// Metadata key catalog
+	r.Get("/api/v0/meta-data/keys", meta.MetaDataKeysHandler)
+
+	// Capabilities
+	capabilities := NewCapabilities(a, a.cfg)
+	r.Get("/api/v0/capabilities", capabilities.CapabilitiesHandler)
+
+	// Metrics endpoints group
+	metrics := NewMetrics(a)
+	r.Route("/api/v0/metrics", func(r chi.Router) {
+		r.Get("/inventory", metrics.InventoryHandler)
+	})
+
+	// IP usage audit
+	ipUsage := NewIPUsage(a)
+	r.Get("/api/v0/ip-usage", ipUsage.ListIPUsageHandler)
+
+	// IP leases
+	r.Get("/api/v0/leases", leases.ListLeasesHandler)
+
+	// Inventory import and full backup
+	inventoryImport := NewInventoryImport(a)
+	r.Post("/api/v0/import", inventoryImport.ImportHandler)
+	r.Get("/api/v0/export", NewBackups(a).ExportHandler)
+
+	// Key groups endpoints group
+	keyGroups := NewKeyGroups(a)
+	r.Route("/api/v0/key-groups", func(r chi.Router) {
+		r.Get("/", keyGroups.ListKeyGroupsHandler)
+		r.Post("/", keyGroups.CreateKeyGroupHandler)
+		r.Delete("/{id}", keyGroups.DeleteKeyGroupHandler)
+		r.Get("/{id}/keys", keyGroups.ListKeyGroupKeysHandler)
+		r.Post("/{id}/keys", keyGroups.AddKeyGroupKeyHandler)
+		r.Delete("/{id}/keys/{keyId}", keyGroups.DeleteKeyGroupKeyHandler)
+		r.Get("/{id}/members", keyGroups.ListKeyGroupMembersHandler)
+		r.Put("/{id}/members/{machineId}", keyGroups.AddKeyGroupMemberHandler)
+		r.Delete("/{id}/members/{machineId}", keyGroups.RemoveKeyGroupMemberHandler)
+	})
+
 	// SSH keys endpoints group - registered by the SSH keys module
 	RegisterSSHKeysRoutes(r, a)
+
+	// Admin endpoints group - always gated by the API key
+	admin := NewAdmin(a, a.cfg)
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(RequireAPIKey(a.cfg.APIKey))
+		r.Get("/meta-data", admin.MetaDataHandler)
+		r.Get("/consistency", admin.ConsistencyHandler)
+		r.Post("/reconcile", admin.ReconcileHandler)
+		r.Get("/config", admin.ConfigHandler)
+	})
 }
 func (a *API) noCloudUserDataHandler(w http.ResponseWriter, r *http.Request) {
 	ip, err := extractClientIP(r)
@@ -95,35 +258,44 @@ func (a *API) noCloudUserDataHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	machine, err := a.machineRepo.FindByIPv4(context.Background(), ip)
+	motd, err := a.GetMOTD(r.Context())
+	if err != nil {
+		log.Printf("failed to get motd: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	machine, err := a.machineByUserDataIP(r.Context(), ip)
 	var userData string
 
+	if err == nil && machine.MetadataDisabled {
+		log.Printf("metadata disabled for machine %d, refusing user-data for IP %s", machine.ID, ip)
+		http.Error(w, "machine not found", http.StatusNotFound)
+		return
+	}
+	if err == nil && a.cfg.EnforceMetadataSubnet && !enforceMachineSubnet(w, r, a.GetNetwork, machine.ID, machine.NetworkID) {
+		return
+	}
+
 	if err != nil || machine.ID == 0 {
 		// Machine not found - provide basic user data without machine-specific config
 		log.Printf("machine not found for IP %s, providing basic user data", ip)
 		userData = `#cloud-config
 manage_etc_hosts: true
-`
+` + renderMOTDWriteFiles(motd)
+	} else if machine.UserData != "" {
+		// Stored user-data is served as is in place of the generated cloud-config
+		userData = machine.UserData
 	} else {
 		// Machine found - get SSH keys and build full user data
-		keys, err := a.sshKeyRepo.FindByMachineID(context.Background(), machine.ID)
+		keys, err := a.authorizedKeys(r.Context(), machine.ID)
 		if err != nil {
-			log.Printf("failed to list SSH keys for machine %d: %v", machine.ID, err)
+			log.Printf("%v", err)
 			http.Error(w, "internal server error", http.StatusInternalServerError)
 			return
 		}
 
-		userData = fmt.Sprintf(`#cloud-config
-hostname: %s
-manage_etc_hosts: true
-`, machine.Hostname)
-
-		if len(keys) > 0 {
-			userData += "ssh_authorized_keys:\n"
-			for _, key := range keys {
-				userData += fmt.Sprintf("  - %s\n", key.KeyText)
-			}
-		}
+		userData = renderNoCloudUserData(machine.Hostname, keys, machine.RunCmd, motd)
 	}
 
 	w.Header().Set("Content-Type", "text/yaml")
@@ -133,28 +305,67 @@ manage_etc_hosts: true
 	}
 }
 
-// noCloudVendorDataHandler serves NoCloud-compatible vendor-data
-func (a *API) noCloudVendorDataHandler(w http.ResponseWriter, r *http.Request) {
-	// For now, serve empty vendor-data
-	w.Header().Set("Content-Type", "text/yaml")
-	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write([]byte("")); err != nil {
-		log.Printf("failed to write vendor data: %v", err)
+// machineByUserDataIP finds the machine owning the client address, using
+// the IPv6 column when the request arrived over IPv6.
+func (a *API) machineByUserDataIP(ctx context.Context, ip string) (domain.Machine, error) {
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		return a.machineRepo.FindByIPv6(ctx, parsed.String())
+	}
+	return a.machineRepo.FindByIPv4(ctx, ip)
+}
+
+// renderNoCloudUserData renders the #cloud-config user-data for a known machine.
+// runcmd entries are double-quoted scalars so shell syntax stays valid YAML.
+func renderNoCloudUserData(hostname string, keys []domain.SSHKey, runcmd []string, motd string) string {
+	userData := fmt.Sprintf(`#cloud-config
+hostname: %s
+manage_etc_hosts: true
+`, hostname)
+
+	if len(keys) > 0 {
+		userData += "ssh_authorized_keys:\n"
+		for _, key := range keys {
+			userData += fmt.Sprintf("  - %s\n", key.KeyText)
+		}
+	}
+	if len(runcmd) > 0 {
+		userData += "runcmd:\n"
+		for _, cmd := range runcmd {
+			userData += fmt.Sprintf("  - %s\n", strconv.Quote(cmd))
+		}
 	}
+	return userData + renderMOTDWriteFiles(motd)
 }
 
-// noCloudNetworkConfigHandler serves NoCloud-compatible network-config
-func (a *API) noCloudNetworkConfigHandler(w http.ResponseWriter, r *http.Request) {
-	// For now, serve a basic network config
-	networkConfig := `version: 2
-ethernets:
-  eth0:
-	dhcp4: true
-`
+// renderMOTDWriteFiles renders a write_files entry installing motd as /etc/motd,
+// or "" when no MOTD is set. The content is a double-quoted scalar so any text
+// stays valid YAML.
+func renderMOTDWriteFiles(motd string) string {
+	if motd == "" {
+		return ""
+	}
+	if !strings.HasSuffix(motd, "\n") {
+		motd += "\n"
+	}
+	return fmt.Sprintf("write_files:\n  - path: /etc/motd\n    content: %s\n", strconv.Quote(motd))
+}
+
+// noCloudVendorDataHandler serves NoCloud-compatible vendor-data: the requesting
+// machine's own when it has some, otherwise the global vendor-data file, otherwise
+// nothing.
+func (a *API) noCloudVendorDataHandler(w http.ResponseWriter, r *http.Request) {
+	vendorData := a.vendorData
+	if ip, err := extractClientIP(r); err == nil {
+		machine, err := a.machineByUserDataIP(r.Context(), ip)
+		if err == nil && !machine.MetadataDisabled && machine.VendorData != "" {
+			vendorData = machine.VendorData
+		}
+	}
+
 	w.Header().Set("Content-Type", "text/yaml")
 	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write([]byte(networkConfig)); err != nil {
-		log.Printf("failed to write network config: %v", err)
+	if _, err := w.Write([]byte(vendorData)); err != nil {
+		log.Printf("failed to write vendor data: %v", err)
 	}
 }
 
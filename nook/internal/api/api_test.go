@@ -6,11 +6,15 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/jbweber/homelab/nook/internal/config"
 	"github.com/jbweber/homelab/nook/internal/domain"
 	"github.com/jbweber/homelab/nook/internal/migrations"
 	"github.com/jbweber/homelab/nook/internal/repository"
@@ -20,6 +24,11 @@ import (
 	_ "modernc.org/sqlite"
 )
 
+// intPtr returns a pointer to the given int
+func intPtr(i int) *int {
+	return &i
+}
+
 // stringPtr returns a pointer to the given string
 func stringPtr(s string) *string {
 	return &s
@@ -141,6 +150,42 @@ func TestCreateMachine(t *testing.T) {
 	assert.NotZero(t, response.ID)
 }
 
+func TestCreateMachine_AvailabilityZone(t *testing.T) {
+	r := setupTestAPI(t)
+
+	body := `{"name":"zoned","hostname":"zoned-host","ipv4":"192.168.1.120","availability_zone":"rack-a"}`
+	req := httptest.NewRequest("POST", "/api/v0/machines", bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var created MachineResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	assert.Equal(t, "rack-a", created.AvailabilityZone)
+
+	// The zone is published in NoCloud meta-data
+	req = httptest.NewRequest("GET", "/meta-data", nil)
+	req.RemoteAddr = "192.168.1.120:12345"
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "availability-zone: rack-a\n")
+
+	// Updating without availability_zone leaves it unchanged
+	body = `{"name":"zoned","hostname":"renamed-host"}`
+	req = httptest.NewRequest("PATCH", "/api/v0/machines/"+strconv.FormatInt(created.ID, 10), bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var updated MachineResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&updated))
+	assert.Equal(t, "rack-a", updated.AvailabilityZone)
+	assert.Equal(t, "renamed-host", updated.Hostname)
+}
+
 func TestCreateMachine_InvalidJSON(t *testing.T) {
 	r := setupTestAPI(t)
 
@@ -191,6 +236,27 @@ func TestCreateMachine_InvalidIPv4(t *testing.T) {
 	assert.Contains(t, w.Body.String(), "Invalid IPv4 address format")
 }
 
+func TestCreateMachine_IPv6InIPv4Field(t *testing.T) {
+	r := setupTestAPI(t)
+
+	reqBody := CreateMachineRequest{
+		Name:     "test-machine",
+		Hostname: "test-host",
+		IPv4:     stringPtr("2001:db8::10"),
+	}
+	body, _ := json.Marshal(reqBody)
+
+	req := httptest.NewRequest("POST", "/api/v0/machines", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "expected IPv4 but got IPv6 address")
+	assert.NotContains(t, w.Body.String(), "Invalid IPv4 address format")
+}
+
 func TestGetMachine_NotFound(t *testing.T) {
 	r := setupTestAPI(t)
 
@@ -302,8 +368,7 @@ func TestNoCloudMetaDataHandler_XForwardedFor(t *testing.T) {
 	assert.Equal(t, http.StatusCreated, w.Code)
 
 	// Now call meta-data with X-Forwarded-For
-	req2 := httptest.NewRequest("GET", "/meta-data", nil)
-	req2.Header.Set("X-Forwarded-For", "192.168.1.222")
+	req2 := viaTrustedProxy(httptest.NewRequest("GET", "/meta-data", nil), "192.168.1.222")
 	w2 := httptest.NewRecorder()
 	r.ServeHTTP(w2, req2)
 	assert.Equal(t, http.StatusOK, w2.Code)
@@ -313,13 +378,13 @@ func TestNoCloudMetaDataHandler_XForwardedFor(t *testing.T) {
 
 func TestNoCloudMetaDataHandler_LookupError(t *testing.T) {
 	r := setupTestAPI(t)
-	// Simulate an invalid IP format - should return 400 Bad Request due to IP validation
-	req := httptest.NewRequest("GET", "/meta-data", nil)
-	req.Header.Set("X-Forwarded-For", "invalid-ip")
+	// A garbage X-Forwarded-For is ignored in favor of the proxy's own address,
+	// which owns no machine
+	req := viaTrustedProxy(httptest.NewRequest("GET", "/meta-data", nil), "invalid-ip")
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
-	assert.Equal(t, http.StatusBadRequest, w.Code)
-	assert.Contains(t, w.Body.String(), "invalid IP address format")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "machine not found")
 }
 
 func TestNetworksHandler(t *testing.T) {
@@ -367,6 +432,46 @@ func TestCreateMachine_DuplicateName(t *testing.T) {
 	assert.Contains(t, w2.Body.String(), "IPv4 address already exists")
 }
 
+func TestCreateMachine_ConflictIdentifiesExisting(t *testing.T) {
+	r := setupTestAPI(t)
+
+	create := func(req CreateMachineRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(req)
+		httpReq := httptest.NewRequest("POST", "/api/v0/machines", bytes.NewReader(body))
+		httpReq.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httpReq)
+		return w
+	}
+
+	w := create(CreateMachineRequest{Name: "original", Hostname: "original", IPv4: stringPtr("192.168.1.150")})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var original MachineResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&original))
+	location := "/api/v0/machines/" + strconv.FormatInt(original.ID, 10)
+
+	tests := []struct {
+		name    string
+		req     CreateMachineRequest
+		message string
+	}{
+		{"duplicate name", CreateMachineRequest{Name: "original", Hostname: "other", IPv4: stringPtr("192.168.1.151")}, "name already exists"},
+		{"duplicate IP", CreateMachineRequest{Name: "other", Hostname: "other", IPv4: stringPtr("192.168.1.150")}, "IPv4 address already exists"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := create(tt.req)
+			require.Equal(t, http.StatusConflict, w.Code)
+			assert.Equal(t, location, w.Header().Get("Location"))
+
+			var conflict ConflictResponse
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&conflict))
+			assert.Equal(t, original.ID, conflict.ExistingID)
+			assert.Contains(t, conflict.Error, tt.message)
+		})
+	}
+}
+
 func TestDeleteMachine_InvalidID(t *testing.T) {
 	r := setupTestAPI(t)
 	req := httptest.NewRequest("DELETE", "/api/v0/machines/invalid", nil)
@@ -514,6 +619,366 @@ func TestListMachines_NonEmpty(t *testing.T) {
 	assert.True(t, found2, "machine2 not found in response")
 }
 
+func TestListMachines_NDJSON(t *testing.T) {
+	r := setupTestAPI(t)
+
+	// Create a handful of machines
+	const count = 5
+	for i := 1; i <= count; i++ {
+		reqBody := CreateMachineRequest{
+			Name:     "ndjson" + strconv.Itoa(i),
+			Hostname: "ndjson-host" + strconv.Itoa(i),
+			IPv4:     stringPtr("192.168.1." + strconv.Itoa(10+i)),
+		}
+		body, _ := json.Marshal(reqBody)
+		req := httptest.NewRequest("POST", "/api/v0/machines", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusCreated, w.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/api/v0/machines?format=ndjson", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+
+	// Every line must decode on its own
+	lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+	assert.Len(t, lines, count)
+	for _, line := range lines {
+		var m MachineResponse
+		require.NoError(t, json.Unmarshal([]byte(line), &m), "line %q", line)
+		assert.True(t, strings.HasPrefix(m.Name, "ndjson"))
+		assert.NotNil(t, m.IPv4)
+	}
+}
+
+func TestListMachines_ExpandLease(t *testing.T) {
+	r := setupTestAPI(t)
+
+	// Network with a DHCP range for dynamic allocation
+	netBody := `{"Name":"lease-net","Bridge":"br0","Subnet":"192.168.60.0/24","Gateway":"192.168.60.1"}`
+	req := httptest.NewRequest("POST", "/api/v0/networks", strings.NewReader(netBody))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var network domain.Network
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&network))
+
+	rangeBody := `{"StartIP":"192.168.60.100","EndIP":"192.168.60.110","LeaseTime":"12h"}`
+	req = httptest.NewRequest("POST", "/api/v0/networks/"+strconv.FormatInt(network.ID, 10)+"/dhcp", strings.NewReader(rangeBody))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	for _, reqBody := range []CreateMachineRequest{
+		{Name: "static", Hostname: "static", IPv4: stringPtr("192.168.60.10")},
+		{Name: "leased", Hostname: "leased", NetworkID: &network.ID},
+	} {
+		body, _ := json.Marshal(reqBody)
+		req := httptest.NewRequest("POST", "/api/v0/machines", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/api/v0/machines?expand=lease", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response []MachineWithLeaseResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	require.Len(t, response, 2)
+
+	byName := make(map[string]MachineWithLeaseResponse)
+	for _, m := range response {
+		byName[m.Name] = m
+	}
+
+	static := byName["static"]
+	assert.Equal(t, "static", static.Assignment)
+	assert.Nil(t, static.Lease)
+
+	leased := byName["leased"]
+	assert.Equal(t, "leased", leased.Assignment)
+	require.NotNil(t, leased.Lease)
+	assert.Equal(t, network.ID, leased.Lease.NetworkID)
+	assert.Equal(t, *leased.IPv4, leased.Lease.IPAddress)
+	assert.NotEmpty(t, leased.Lease.LeaseTime)
+}
+
+func TestLeaseExpiry(t *testing.T) {
+	expires := leaseExpiry(MachineLease{LeaseTime: "24h", CreatedAt: "2025-09-01T10:00:00Z"})
+	require.NotNil(t, expires)
+	assert.Equal(t, "2025-09-02T10:00:00Z", *expires)
+
+	expires = leaseExpiry(MachineLease{LeaseTime: "12h", CreatedAt: "2025-09-01 10:00:00"})
+	require.NotNil(t, expires)
+	assert.Equal(t, "2025-09-01T22:00:00Z", *expires)
+
+	assert.Nil(t, leaseExpiry(MachineLease{LeaseTime: "infinite", CreatedAt: "2025-09-01T10:00:00Z"}))
+}
+
+func TestListMachines_NDJSONStreamsInBatches(t *testing.T) {
+	api, cleanup := setupIntegrationTestAPI(t)
+	defer cleanup()
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+	ctx := context.Background()
+
+	const count = ndjsonBatchSize + 5
+	for i := range count {
+		_, err := api.machineRepo.Save(ctx, domain.Machine{Name: "stream-" + strconv.Itoa(i), Hostname: "stream", IPv4: "10.8." + strconv.Itoa(i/200) + "." + strconv.Itoa(i%200+1)})
+		require.NoError(t, err)
+	}
+
+	req := httptest.NewRequest("GET", "/api/v0/machines?format=ndjson&fields=id", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, strconv.Itoa(count), w.Header().Get("X-Total-Count"))
+	assert.True(t, w.Flushed, "lines are flushed as they are written")
+
+	// Every machine appears once, in ID order, across the batch boundary
+	lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+	require.Len(t, lines, count)
+	var last int64
+	for _, line := range lines {
+		var m struct {
+			ID int64 `json:"id"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(line), &m))
+		assert.Greater(t, m.ID, last)
+		last = m.ID
+	}
+}
+
+func TestListMachines_UnsupportedFormat(t *testing.T) {
+	r := setupTestAPI(t)
+	req := httptest.NewRequest("GET", "/api/v0/machines?format=xml", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestListMachines_Pagination(t *testing.T) {
+	api, cleanup := setupIntegrationTestAPI(t)
+	defer cleanup()
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+	ctx := context.Background()
+
+	for i := range 5 {
+		_, err := api.machineRepo.Save(ctx, domain.Machine{Name: "page-" + strconv.Itoa(i), Hostname: "page", IPv4: "10.9.0." + strconv.Itoa(i+1)})
+		require.NoError(t, err)
+	}
+
+	list := func(query string) ([]MachineResponse, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest("GET", "/api/v0/machines"+query, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var machines []MachineResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&machines))
+		return machines, w
+	}
+	names := func(machines []MachineResponse) []string {
+		var result []string
+		for _, m := range machines {
+			result = append(result, m.Name)
+		}
+		return result
+	}
+
+	first, w := list("?limit=2")
+	assert.Equal(t, []string{"page-0", "page-1"}, names(first))
+	assert.Equal(t, "5", w.Header().Get("X-Total-Count"))
+
+	middle, w := list("?limit=2&offset=2")
+	assert.Equal(t, []string{"page-2", "page-3"}, names(middle))
+	assert.Equal(t, "5", w.Header().Get("X-Total-Count"))
+
+	// Past the end is an empty array, not null
+	past, w := list("?limit=2&offset=10")
+	assert.NotNil(t, past)
+	assert.Empty(t, past)
+	assert.Equal(t, "5", w.Header().Get("X-Total-Count"))
+
+	// The hostname filter applies before paging
+	filtered, w := list("?hostname=page&limit=3&offset=3")
+	assert.Equal(t, []string{"page-3", "page-4"}, names(filtered))
+	assert.Equal(t, "5", w.Header().Get("X-Total-Count"))
+
+	all, _ := list("")
+	assert.Len(t, all, 5)
+
+	for _, query := range []string{"?limit=0", "?limit=1001", "?limit=abc", "?offset=-1"} {
+		req := httptest.NewRequest("GET", "/api/v0/machines"+query, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestListMachines_ByNetwork(t *testing.T) {
+	api, cleanup := setupIntegrationTestAPI(t)
+	defer cleanup()
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+	ctx := context.Background()
+
+	lab, err := api.networkRepo.Save(ctx, domain.Network{Name: "lab", Bridge: "br0", Subnet: "10.10.0.0/24"})
+	require.NoError(t, err)
+	prod, err := api.networkRepo.Save(ctx, domain.Network{Name: "prod", Bridge: "br1", Subnet: "10.20.0.0/24"})
+	require.NoError(t, err)
+	empty, err := api.networkRepo.Save(ctx, domain.Network{Name: "empty", Bridge: "br2", Subnet: "10.30.0.0/24"})
+	require.NoError(t, err)
+	for _, m := range []domain.Machine{
+		{Name: "lab-1", Hostname: "lab-1", IPv4: "10.10.0.5", NetworkID: &lab.ID},
+		{Name: "prod-1", Hostname: "prod-1", IPv4: "10.20.0.5", NetworkID: &prod.ID},
+		{Name: "lab-2", Hostname: "lab-2", IPv4: "10.10.0.6", NetworkID: &lab.ID},
+		{Name: "static", Hostname: "static", IPv4: "10.40.0.5"},
+	} {
+		_, err := api.machineRepo.Save(ctx, m)
+		require.NoError(t, err)
+	}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/v0/machines"+query, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("?network_id=" + strconv.FormatInt(lab.ID, 10))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var machines []MachineResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&machines))
+	require.Len(t, machines, 2)
+	assert.Equal(t, "lab-1", machines[0].Name)
+	assert.Equal(t, "lab-2", machines[1].Name)
+	assert.Equal(t, "2", w.Header().Get("X-Total-Count"))
+
+	// A network without machines is an empty list
+	w = get("?network_id=" + strconv.FormatInt(empty.ID, 10))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, "[]", w.Body.String())
+
+	assert.Equal(t, http.StatusBadRequest, get("?network_id=abc").Code)
+	assert.Equal(t, http.StatusNotFound, get("?network_id=999").Code)
+}
+
+func TestBulkCreateMachinesHandler(t *testing.T) {
+	api, cleanup := setupIntegrationTestAPI(t)
+	defer cleanup()
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+	ctx := context.Background()
+
+	network, err := api.networkRepo.Save(ctx, domain.Network{Name: "rack", Bridge: "br0", Subnet: "10.50.0.0/24"})
+	require.NoError(t, err)
+	_, err = api.dhcpRangeRepo.Save(ctx, domain.DHCPRange{NetworkID: network.ID, StartIP: "10.50.0.10", EndIP: "10.50.0.20", LeaseTime: "24h"})
+	require.NoError(t, err)
+	networkID := strconv.FormatInt(network.ID, 10)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/v0/machines/bulk", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	machineCount := func() int {
+		count, err := api.machineRepo.Count(ctx)
+		require.NoError(t, err)
+		return count
+	}
+	bulkError := func(w *httptest.ResponseRecorder) BulkCreateErrorResponse {
+		var resp BulkCreateErrorResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		return resp
+	}
+
+	w := post(`[
+		{"name":"rack-1","hostname":"rack-1","network_id":` + networkID + `},
+		{"name":"rack-2","hostname":"rack-2","network_id":` + networkID + `},
+		{"name":"rack-static","hostname":"rack-static","ipv4":"10.60.0.5","mtu":9000}
+	]`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created []MachineResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	require.Len(t, created, 3)
+	assert.Equal(t, stringPtr("10.50.0.10"), created[0].IPv4)
+	assert.Equal(t, stringPtr("10.50.0.11"), created[1].IPv4)
+	assert.Equal(t, 9000, created[2].MTU)
+	assert.Equal(t, 3, machineCount())
+
+	// A name repeated mid-batch fails the whole batch
+	w = post(`[
+		{"name":"batch-a","hostname":"a","ipv4":"10.60.0.10"},
+		{"name":"batch-b","hostname":"b","network_id":` + networkID + `},
+		{"name":"batch-a","hostname":"c","ipv4":"10.60.0.12"}
+	]`)
+	require.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, 2, bulkError(w).Index)
+	assert.Equal(t, 3, machineCount())
+
+	// So does one colliding with an existing machine
+	w = post(`[
+		{"name":"batch-a","hostname":"a","ipv4":"10.60.0.10"},
+		{"name":"rack-1","hostname":"b","ipv4":"10.60.0.11"}
+	]`)
+	require.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, 1, bulkError(w).Index)
+	assert.Equal(t, 3, machineCount())
+
+	w = post(`[{"name":"ok","hostname":"ok","ipv4":"10.60.0.20"},{"name":"bad","hostname":"bad","ipv4":"not-an-ip"}]`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	resp := bulkError(w)
+	assert.Equal(t, 1, resp.Index)
+	assert.Equal(t, "Invalid IPv4 address format", resp.Error)
+
+	assert.Equal(t, http.StatusBadRequest, post(`[]`).Code)
+	assert.Equal(t, http.StatusBadRequest, post(`{"name":"not-an-array"}`).Code)
+	assert.Equal(t, 3, machineCount())
+}
+
+func TestListMachines_UnpagedReturnsEveryMachine(t *testing.T) {
+	api, cleanup := setupIntegrationTestAPI(t)
+	defer cleanup()
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+	ctx := context.Background()
+
+	const count = defaultMachinePageSize + 20
+	for i := range count {
+		_, err := api.machineRepo.Save(ctx, domain.Machine{Name: "vm-" + strconv.Itoa(i), Hostname: "vm", IPv4: "10.9." + strconv.Itoa(i/200) + "." + strconv.Itoa(i%200+1)})
+		require.NoError(t, err)
+	}
+
+	for _, query := range []string{"", "?format=ndjson"} {
+		req := httptest.NewRequest("GET", "/api/v0/machines"+query, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, strconv.Itoa(count), w.Header().Get("X-Total-Count"), query)
+
+		var listed int
+		if query == "" {
+			var machines []MachineResponse
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&machines))
+			listed = len(machines)
+		} else {
+			listed = strings.Count(w.Body.String(), "\n")
+		}
+		assert.Equal(t, count, listed, "no limit or offset means no paging (%q)", query)
+	}
+}
+
 func TestGetMachineHandler_Valid(t *testing.T) {
 	r := setupTestAPI(t)
 	// Create a machine
@@ -651,6 +1116,16 @@ func TestUpdateMachineHandler_InvalidIPv4(t *testing.T) {
 	r.ServeHTTP(patchW, patchReq)
 	assert.Equal(t, http.StatusBadRequest, patchW.Code)
 	assert.Contains(t, patchW.Body.String(), "Invalid IPv4 address format")
+
+	// Update with an IPv6 address in the IPv4 field
+	updateBody.IPv4 = stringPtr("fe80::1")
+	updateJSON, _ = json.Marshal(updateBody)
+	patchReq = httptest.NewRequest("PATCH", "/api/v0/machines/"+strconv.Itoa(int(created.ID)), bytes.NewReader(updateJSON))
+	patchReq.Header.Set("Content-Type", "application/json")
+	patchW = httptest.NewRecorder()
+	r.ServeHTTP(patchW, patchReq)
+	assert.Equal(t, http.StatusBadRequest, patchW.Code)
+	assert.Contains(t, patchW.Body.String(), "expected IPv4 but got IPv6 address")
 }
 
 func TestUpdateMachineHandler_MissingFields(t *testing.T) {
@@ -695,14 +1170,346 @@ func TestUpdateMachineHandler_NotFound(t *testing.T) {
 	assert.Equal(t, http.StatusNotFound, patchW.Code)
 }
 
+func TestUpdateMachineHandler_PartialPatch(t *testing.T) {
+	r := setupTestAPI(t)
+	body, _ := json.Marshal(CreateMachineRequest{
+		Name:             "partial-machine",
+		Hostname:         "partial-host",
+		IPv4:             stringPtr("192.168.1.170"),
+		AvailabilityZone: stringPtr("rack-1"),
+	})
+	req := httptest.NewRequest("POST", "/api/v0/machines", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created MachineResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+
+	// Only ipv4 is sent; everything else must be left alone
+	patchReq := httptest.NewRequest("PATCH", "/api/v0/machines/"+strconv.Itoa(int(created.ID)), strings.NewReader(`{"ipv4":"192.168.1.171"}`))
+	patchReq.Header.Set("Content-Type", "application/json")
+	patchW := httptest.NewRecorder()
+	r.ServeHTTP(patchW, patchReq)
+	require.Equal(t, http.StatusOK, patchW.Code, patchW.Body.String())
+	var updated MachineResponse
+	require.NoError(t, json.NewDecoder(patchW.Body).Decode(&updated))
+	assert.Equal(t, stringPtr("192.168.1.171"), updated.IPv4)
+	assert.Equal(t, "partial-host", updated.Hostname)
+	assert.Equal(t, "partial-machine", updated.Name)
+	assert.Equal(t, "rack-1", updated.AvailabilityZone)
+
+	// A supplied but empty hostname is still rejected
+	patchReq = httptest.NewRequest("PATCH", "/api/v0/machines/"+strconv.Itoa(int(created.ID)), strings.NewReader(`{"hostname":""}`))
+	patchReq.Header.Set("Content-Type", "application/json")
+	patchW = httptest.NewRecorder()
+	r.ServeHTTP(patchW, patchReq)
+	assert.Equal(t, http.StatusBadRequest, patchW.Code)
+}
+
+func TestMachineIPv6(t *testing.T) {
+	r := setupTestAPI(t)
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/v0/machines", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// Stored in canonical form
+	w := post(`{"name":"v6-machine","hostname":"v6-host","ipv4":"192.168.1.190","ipv6":"2001:DB8:0::0010"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created MachineResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	assert.Equal(t, "2001:db8::10", created.IPv6)
+
+	assert.Equal(t, http.StatusBadRequest, post(`{"name":"bad","hostname":"bad","ipv6":"192.168.1.191"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, post(`{"name":"bad","hostname":"bad","ipv6":"not-an-ip"}`).Code)
+	assert.Equal(t, http.StatusConflict, post(`{"name":"dup","hostname":"dup","ipv6":"2001:db8::10"}`).Code)
+
+	// A request over IPv6 is matched on the IPv6 address
+	req := httptest.NewRequest("GET", "/meta-data", nil)
+	req.RemoteAddr = "[2001:db8::10]:40000"
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "local-ipv4: 192.168.1.190\n")
+	assert.Contains(t, w.Body.String(), "local-ipv6: 2001:db8::10\n")
+
+	// IPv4 requests still find the machine
+	req = httptest.NewRequest("GET", "/meta-data", nil)
+	req.RemoteAddr = "192.168.1.190:40000"
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "local-ipv6: 2001:db8::10\n")
+
+	// An empty ipv6 removes it
+	patchReq := httptest.NewRequest("PATCH", "/api/v0/machines/"+strconv.Itoa(int(created.ID)), strings.NewReader(`{"ipv6":""}`))
+	patchReq.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, patchReq)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var updated MachineResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&updated))
+	assert.Empty(t, updated.IPv6)
+
+	req = httptest.NewRequest("GET", "/meta-data", nil)
+	req.RemoteAddr = "[2001:db8::10]:40000"
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestMachineUserData(t *testing.T) {
+	r := setupTestAPI(t)
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	userData := func() string {
+		req := httptest.NewRequest("GET", "/user-data", nil)
+		req.RemoteAddr = "192.168.1.195:40000"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		return w.Body.String()
+	}
+
+	script := "#!/bin/sh\necho provisioned\n"
+	w := send("POST", "/api/v0/machines", `{"name":"ud-machine","hostname":"ud-host","ipv4":"192.168.1.195","user_data":"#!/bin/sh\necho provisioned\n"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created MachineResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	assert.Equal(t, script, created.UserData)
+
+	// Stored user-data is served verbatim
+	assert.Equal(t, script, userData())
+
+	// Unrecognized headers are rejected
+	assert.Equal(t, http.StatusBadRequest, send("POST", "/api/v0/machines", `{"name":"bad","hostname":"bad","user_data":"echo hi"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, send("POST", "/api/v0/machines", `{"name":"bad","hostname":"bad","vendor_data":"echo hi"}`).Code)
+	path := "/api/v0/machines/" + strconv.Itoa(int(created.ID))
+	assert.Equal(t, http.StatusBadRequest, send("PATCH", path, `{"user_data":"packages: [vim]"}`).Code)
+
+	w = send("PATCH", path, `{"user_data":"#cloud-boothook\necho early\n"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "#cloud-boothook\necho early\n", userData())
+
+	// Clearing it falls back to the generated cloud-config
+	w = send("PATCH", path, `{"user_data":""}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	generated := userData()
+	assert.True(t, strings.HasPrefix(generated, "#cloud-config\n"))
+	assert.Contains(t, generated, "hostname: ud-host")
+}
+
+func TestReplaceMachineHandler(t *testing.T) {
+	r := setupTestAPI(t)
+	body, _ := json.Marshal(CreateMachineRequest{
+		Name:             "replace-machine",
+		Hostname:         "replace-host",
+		IPv4:             stringPtr("192.168.1.180"),
+		AvailabilityZone: stringPtr("rack-2"),
+		MTU:              intPtr(9000),
+	})
+	req := httptest.NewRequest("POST", "/api/v0/machines", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created MachineResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	path := "/api/v0/machines/" + strconv.Itoa(int(created.ID))
+
+	// Omitted optional fields reset to their defaults
+	putReq := httptest.NewRequest("PUT", path, strings.NewReader(`{"name":"replaced","hostname":"replaced-host","ipv4":"192.168.1.181"}`))
+	putReq.Header.Set("Content-Type", "application/json")
+	putW := httptest.NewRecorder()
+	r.ServeHTTP(putW, putReq)
+	require.Equal(t, http.StatusOK, putW.Code, putW.Body.String())
+	var replaced MachineResponse
+	require.NoError(t, json.NewDecoder(putW.Body).Decode(&replaced))
+	assert.Equal(t, created.ID, replaced.ID)
+	assert.Equal(t, "replaced", replaced.Name)
+	assert.Equal(t, "replaced-host", replaced.Hostname)
+	assert.Equal(t, stringPtr("192.168.1.181"), replaced.IPv4)
+	assert.Empty(t, replaced.AvailabilityZone)
+	assert.Zero(t, replaced.MTU)
+
+	// A full replacement needs every required field
+	putReq = httptest.NewRequest("PUT", path, strings.NewReader(`{"name":"replaced","ipv4":"192.168.1.181"}`))
+	putReq.Header.Set("Content-Type", "application/json")
+	putW = httptest.NewRecorder()
+	r.ServeHTTP(putW, putReq)
+	assert.Equal(t, http.StatusBadRequest, putW.Code)
+
+	putReq = httptest.NewRequest("PUT", path, strings.NewReader(`{"name":"replaced","hostname":"replaced-host"}`))
+	putReq.Header.Set("Content-Type", "application/json")
+	putW = httptest.NewRecorder()
+	r.ServeHTTP(putW, putReq)
+	assert.Equal(t, http.StatusBadRequest, putW.Code)
+	assert.Contains(t, putW.Body.String(), "IPv4 is required")
+
+	putReq = httptest.NewRequest("PUT", "/api/v0/machines/99999", strings.NewReader(`{"name":"x","hostname":"y","ipv4":"192.168.1.182"}`))
+	putReq.Header.Set("Content-Type", "application/json")
+	putW = httptest.NewRecorder()
+	r.ServeHTTP(putW, putReq)
+	assert.Equal(t, http.StatusNotFound, putW.Code)
+}
+
+func TestUpdateMachineHandler_MoveNetwork(t *testing.T) {
+	api, cleanup := setupIntegrationTestAPI(t)
+	defer cleanup()
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+	ctx := context.Background()
+
+	saveNetwork := func(name, subnet, start, end string) domain.Network {
+		n, err := api.networkRepo.Save(ctx, domain.Network{Name: name, Bridge: "br-" + name, Subnet: subnet})
+		require.NoError(t, err)
+		_, err = api.dhcpRangeRepo.Save(ctx, domain.DHCPRange{NetworkID: n.ID, StartIP: start, EndIP: end, LeaseTime: "24h"})
+		require.NoError(t, err)
+		return n
+	}
+	netA := saveNetwork("a", "10.1.0.0/24", "10.1.0.10", "10.1.0.20")
+	netB := saveNetwork("b", "10.2.0.0/24", "10.2.0.10", "10.2.0.20")
+	full := saveNetwork("full", "10.3.0.0/24", "10.3.0.10", "10.3.0.10")
+	_, err := api.CreateMachine(context.Background(), Machine{Name: "filler", Hostname: "filler", NetworkID: &full.ID})
+	require.NoError(t, err)
+
+	patch := func(id int64, body string) (*httptest.ResponseRecorder, MachineResponse) {
+		req := httptest.NewRequest("PATCH", "/api/v0/machines/"+strconv.FormatInt(id, 10), strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var resp MachineResponse
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		}
+		return w, resp
+	}
+	leaseNetworks := func(id int64) []int64 {
+		leases, err := api.ipLeaseRepo.FindByMachineID(ctx, id)
+		require.NoError(t, err)
+		var networks []int64
+		for _, l := range leases {
+			networks = append(networks, l.NetworkID)
+		}
+		return networks
+	}
+
+	// Dynamic to dynamic: the old lease is released and a new one taken
+	dynamic, err := api.CreateMachine(context.Background(), Machine{Name: "dynamic", Hostname: "dynamic", NetworkID: &netA.ID})
+	require.NoError(t, err)
+	w, moved := patch(dynamic.ID, `{"network_id":`+strconv.FormatInt(netB.ID, 10)+`}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NotNil(t, moved.NetworkID)
+	assert.Equal(t, netB.ID, *moved.NetworkID)
+	assert.Equal(t, stringPtr("10.2.0.10"), moved.IPv4)
+	assert.Equal(t, []int64{netB.ID}, leaseNetworks(dynamic.ID))
+	assert.Equal(t, "dynamic", moved.Hostname)
+
+	// Dynamic to static: a static address on the new network holds no lease
+	w, moved = patch(dynamic.ID, `{"network_id":`+strconv.FormatInt(netA.ID, 10)+`,"ipv4":"10.1.0.200"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, stringPtr("10.1.0.200"), moved.IPv4)
+	assert.Empty(t, leaseNetworks(dynamic.ID))
+
+	// Static to dynamic: a machine without a network is leased an address
+	static, err := api.CreateMachine(context.Background(), Machine{Name: "static", Hostname: "static", IPv4: "192.168.9.9"})
+	require.NoError(t, err)
+	w, moved = patch(static.ID, `{"network_id":`+strconv.FormatInt(netB.ID, 10)+`}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, stringPtr("10.2.0.10"), moved.IPv4) // Released by the move above
+	assert.Equal(t, []int64{netB.ID}, leaseNetworks(static.ID))
+
+	// A static address outside the new network is rejected
+	w, _ = patch(static.ID, `{"network_id":`+strconv.FormatInt(netA.ID, 10)+`,"ipv4":"10.2.0.99"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// No room on the new network: 409 and the machine stays put
+	w, _ = patch(static.ID, `{"network_id":`+strconv.FormatInt(full.ID, 10)+`}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	unchanged, err := api.GetMachine(context.Background(), static.ID)
+	require.NoError(t, err)
+	assert.Equal(t, netB.ID, *unchanged.NetworkID)
+	assert.Equal(t, "10.2.0.10", unchanged.IPv4)
+	assert.Equal(t, []int64{netB.ID}, leaseNetworks(static.ID))
+
+	w, _ = patch(static.ID, `{"network_id":99999}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestPinMachineIPHandler(t *testing.T) {
+	api, cleanup := setupIntegrationTestAPI(t)
+	defer cleanup()
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+	ctx := context.Background()
+
+	network, _ := seedLeasedDHCPRange(t, api.networkRepo, api.dhcpRangeRepo, api.machineRepo, api.ipLeaseRepo)
+	leased, err := api.machineRepo.FindByName(ctx, "leased")
+	require.NoError(t, err)
+	leases, err := api.ipLeaseRepo.FindByMachineID(ctx, leased.ID)
+	require.NoError(t, err)
+	require.Len(t, leases, 1)
+	leasedIP := leases[0].IPAddress
+
+	pin := func(id int64, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/v0/machines/"+strconv.FormatInt(id, 10)+"/pin"+query, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := pin(leased.ID, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var pinned MachineResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&pinned))
+	assert.Equal(t, stringPtr(leasedIP), pinned.IPv4)
+	assert.Nil(t, pinned.NetworkID)
+
+	// The lease is gone and the address is held statically
+	leases, err = api.ipLeaseRepo.FindByMachineID(ctx, leased.ID)
+	require.NoError(t, err)
+	assert.Empty(t, leases)
+	stored, err := api.machineRepo.FindByID(ctx, leased.ID)
+	require.NoError(t, err)
+	assert.Equal(t, leasedIP, stored.IPv4)
+
+	// Nothing left to pin
+	assert.Equal(t, http.StatusConflict, pin(leased.ID, "").Code)
+	assert.Equal(t, http.StatusNotFound, pin(99999, "").Code)
+
+	// keep_network leaves the machine on its network
+	kept, err := api.machineRepo.Save(ctx, domain.Machine{Name: "kept", Hostname: "kept", NetworkID: &network.ID})
+	require.NoError(t, err)
+	_, err = api.ipLeaseRepo.AllocateIPAddress(ctx, kept.ID, network.ID)
+	require.NoError(t, err)
+	w = pin(kept.ID, "?keep_network=true")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&pinned))
+	require.NotNil(t, pinned.NetworkID)
+	assert.Equal(t, network.ID, *pinned.NetworkID)
+	leases, err = api.ipLeaseRepo.FindByMachineID(ctx, kept.ID)
+	require.NoError(t, err)
+	assert.Empty(t, leases)
+}
+
 func TestNoCloudNetworkConfigHandler(t *testing.T) {
-	// Create a simple API instance for the handler
-	api := &API{}
+	// Unknown machines fall back to DHCP
+	r := setupTestAPI(t)
 
 	req := httptest.NewRequest("GET", "/network-config", nil)
+	req.RemoteAddr = "192.0.2.10:12345"
 	w := httptest.NewRecorder()
 
-	api.noCloudNetworkConfigHandler(w, req)
+	r.ServeHTTP(w, req)
 
 	// Check response
 	if w.Code != http.StatusOK {
@@ -718,13 +1525,389 @@ func TestNoCloudNetworkConfigHandler(t *testing.T) {
 	expectedContent := `version: 2
 ethernets:
   eth0:
-	dhcp4: true
+    dhcp4: true
 `
 	if body != expectedContent {
 		t.Errorf("Unexpected network config body:\nexpected:\n%s\ngot:\n%s", expectedContent, body)
 	}
 }
 
+func TestNoCloudNetworkConfigHandler_UserAgentGate(t *testing.T) {
+	api, cleanup := setupIntegrationTestAPI(t)
+	defer cleanup()
+	api.cfg.NetworkConfigUserAgent = "Cloud-Init"
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+
+	for ua, expected := range map[string]int{
+		"Cloud-Init/23.4.4": http.StatusOK,
+		"cloud-init/24.1":   http.StatusOK,
+		"curl/8.5.0":        http.StatusNotFound,
+		"":                  http.StatusNotFound,
+	} {
+		req := httptest.NewRequest("GET", "/network-config", nil)
+		req.RemoteAddr = "192.0.2.10:12345"
+		if ua != "" {
+			req.Header.Set("User-Agent", ua)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != expected {
+			t.Errorf("User-Agent %q: expected status %d, got %d", ua, expected, w.Code)
+		}
+	}
+}
+
+func TestGetMachineNetworkConfigHandler(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestGetMachineNetworkConfigHandler")
+	defer cleanup()
+
+	networkRepo := repository.NewNetworkRepository(db)
+	savedNetwork, err := networkRepo.Save(context.Background(), domain.Network{
+		Name: "lab", Bridge: "br0", Subnet: "192.168.70.0/24",
+		Gateway: "192.168.70.1", DNSServers: "1.1.1.1, 9.9.9.9",
+	})
+	require.NoError(t, err)
+	machine, err := repository.NewMachineRepository(db).Save(context.Background(), domain.Machine{
+		Name: "netcfg", Hostname: "netcfg", IPv4: "192.168.70.20", NetworkID: &savedNetwork.ID,
+	})
+	require.NoError(t, err)
+
+	r := chi.NewRouter()
+	NewAPI(db).RegisterRoutes(r)
+
+	// By id, from an unrelated client address
+	req := httptest.NewRequest("GET", "/api/v0/machines/"+strconv.FormatInt(machine.ID, 10)+"/network-config", nil)
+	req.RemoteAddr = "203.0.113.5:12345"
+	byID := httptest.NewRecorder()
+	r.ServeHTTP(byID, req)
+	require.Equal(t, http.StatusOK, byID.Code)
+
+	expected := `version: 2
+ethernets:
+  eth0:
+    dhcp4: false
+    addresses:
+      - 192.168.70.20/24
+    gateway4: 192.168.70.1
+    nameservers:
+      addresses:
+        - 1.1.1.1
+        - 9.9.9.9
+`
+	assert.Equal(t, expected, byID.Body.String())
+
+	// Must match what the machine itself receives
+	req = httptest.NewRequest("GET", "/network-config", nil)
+	req.RemoteAddr = "192.168.70.20:12345"
+	byIP := httptest.NewRecorder()
+	r.ServeHTTP(byIP, req)
+	require.Equal(t, http.StatusOK, byIP.Code)
+	assert.Equal(t, byIP.Body.String(), byID.Body.String())
+
+	// Unknown machine
+	req = httptest.NewRequest("GET", "/api/v0/machines/99999/network-config", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestNetworkConfig_MTU(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestNetworkConfig_MTU")
+	defer cleanup()
+
+	r := chi.NewRouter()
+	NewAPI(db).RegisterRoutes(r)
+
+	post := func(path string, body interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", path, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	networkConfig := func(ip string) string {
+		req := httptest.NewRequest("GET", "/network-config", nil)
+		req.RemoteAddr = ip + ":12345"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		return w.Body.String()
+	}
+
+	// Out-of-range MTUs are rejected for networks and machines
+	w := post("/api/v0/networks", domain.Network{Name: "tiny", Bridge: "br1", Subnet: "192.168.71.0/24", MTU: 100})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "mtu must be between 576 and 9216")
+	w = post("/api/v0/machines", CreateMachineRequest{Name: "huge", Hostname: "huge", IPv4: stringPtr("192.168.72.5"), MTU: intPtr(9217)})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = post("/api/v0/networks", domain.Network{Name: "jumbo", Bridge: "br0", Subnet: "192.168.70.0/24", Gateway: "192.168.70.1", MTU: 9000})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var network domain.Network
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&network))
+	assert.Equal(t, 9000, network.MTU)
+
+	// Machines inherit the network's MTU
+	w = post("/api/v0/machines", CreateMachineRequest{Name: "inherit", Hostname: "inherit", IPv4: stringPtr("192.168.70.20"), NetworkID: &network.ID})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Equal(t, `version: 2
+ethernets:
+  eth0:
+    dhcp4: false
+    mtu: 9000
+    addresses:
+      - 192.168.70.20/24
+    gateway4: 192.168.70.1
+`, networkConfig("192.168.70.20"))
+
+	// A per-machine override wins
+	w = post("/api/v0/machines", CreateMachineRequest{Name: "override", Hostname: "override", IPv4: stringPtr("192.168.70.21"), NetworkID: &network.ID, MTU: intPtr(1500)})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created MachineResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	assert.Equal(t, 1500, created.MTU)
+	assert.Contains(t, networkConfig("192.168.70.21"), "    mtu: 1500\n")
+}
+
+func TestUserData_RunCmd(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestUserData_RunCmd")
+	defer cleanup()
+
+	r := chi.NewRouter()
+	NewAPI(db).RegisterRoutes(r)
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	userData := func(ip string) string {
+		req := httptest.NewRequest("GET", "/user-data", nil)
+		req.RemoteAddr = ip + ":12345"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		return w.Body.String()
+	}
+
+	// Anything but an array of non-empty strings is rejected
+	for _, runcmd := range []string{`"echo hi"`, `[1, 2]`, `{"cmd": "echo hi"}`, `["echo hi", ""]`} {
+		w := send("POST", "/api/v0/machines", `{"name": "bad", "hostname": "bad", "ipv4": "192.168.73.9", "runcmd": `+runcmd+`}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code, runcmd)
+		assert.Contains(t, w.Body.String(), "runcmd", runcmd)
+	}
+
+	w := send("POST", "/api/v0/machines", `{"name": "web", "hostname": "web", "ipv4": "192.168.73.10",
+		"runcmd": ["apt-get update", "systemctl enable --now nginx", "echo \"ready: yes\" > /tmp/state"]}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created MachineResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	assert.Equal(t, []string{"apt-get update", "systemctl enable --now nginx", `echo "ready: yes" > /tmp/state`}, created.RunCmd)
+
+	assert.Equal(t, `#cloud-config
+hostname: web
+manage_etc_hosts: true
+runcmd:
+  - "apt-get update"
+  - "systemctl enable --now nginx"
+  - "echo \"ready: yes\" > /tmp/state"
+`, userData("192.168.73.10"))
+
+	// Updates replace the list; null clears it
+	path := "/api/v0/machines/" + strconv.FormatInt(created.ID, 10)
+	w = send("PATCH", path, `{"name": "web", "hostname": "web", "runcmd": ["reboot"]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, userData("192.168.73.10"), "runcmd:\n  - \"reboot\"\n")
+
+	w = send("PATCH", path, `{"name": "web", "hostname": "web", "runcmd": null}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NotContains(t, userData("192.168.73.10"), "runcmd:")
+}
+
+func TestListMachinesByHostname(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestListMachinesByHostname")
+	defer cleanup()
+
+	machineRepo := repository.NewMachineRepository(db)
+	for _, m := range []domain.Machine{
+		{Name: "web-a", Hostname: "web", IPv4: "192.168.74.10"},
+		{Name: "web-b", Hostname: "WEB", IPv4: "192.168.74.11"},
+		{Name: "db", Hostname: "db", IPv4: "192.168.74.12"},
+	} {
+		_, err := machineRepo.Save(context.Background(), m)
+		require.NoError(t, err)
+	}
+
+	api := NewAPI(db)
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+
+	list := func(query string) []string {
+		req := httptest.NewRequest("GET", "/api/v0/machines"+query, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		var machines []MachineResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&machines))
+		var names []string
+		for _, m := range machines {
+			names = append(names, m.Name)
+		}
+		return names
+	}
+
+	assert.ElementsMatch(t, []string{"web-a", "web-b"}, list("?hostname=web"))
+	assert.Equal(t, []string{"db"}, list("?hostname=db"))
+	assert.Empty(t, list("?hostname=missing"))
+	assert.Len(t, list(""), 3)
+
+	duplicates, err := api.DuplicateHostnames()
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"web": {"web-a", "web-b"}}, duplicates)
+}
+
+func TestMachinesFieldSelection(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestMachinesFieldSelection")
+	defer cleanup()
+
+	saved, err := repository.NewMachineRepository(db).Save(context.Background(), domain.Machine{
+		Name: "web", Hostname: "web-host", IPv4: "192.168.75.10", AvailabilityZone: "rack-a",
+	})
+	require.NoError(t, err)
+
+	r := chi.NewRouter()
+	NewAPI(db).RegisterRoutes(r)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	byID := "/api/v0/machines/" + strconv.FormatInt(saved.ID, 10)
+
+	// A subset returns exactly those keys
+	w := get("/api/v0/machines?fields=id,ipv4")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var list []map[string]any
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&list))
+	assert.Equal(t, []map[string]any{{"id": float64(saved.ID), "ipv4": "192.168.75.10"}}, list)
+
+	w = get(byID + "?fields=hostname")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var one map[string]any
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&one))
+	assert.Equal(t, map[string]any{"hostname": "web-host"}, one)
+
+	// Without fields the full object is returned
+	w = get(byID)
+	require.Equal(t, http.StatusOK, w.Code)
+	one = nil
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&one))
+	for _, key := range []string{"id", "name", "hostname", "ipv4", "availability_zone", "metadata_enabled"} {
+		assert.Contains(t, one, key)
+	}
+
+	// Unknown field names are rejected
+	for _, path := range []string{"/api/v0/machines?fields=id,secret", byID + "?fields=secret", "/api/v0/machines?fields=id&expand=lease"} {
+		w = get(path)
+		assert.Equal(t, http.StatusBadRequest, w.Code, path)
+	}
+	assert.Contains(t, get(byID+"?fields=secret").Body.String(), `unknown field \"secret\"`)
+}
+
+func TestGetMachineMetaDataByNameHandler(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestGetMachineMetaDataByNameHandler")
+	defer cleanup()
+
+	_, err := repository.NewMachineRepository(db).Save(context.Background(), domain.Machine{
+		Name: "metadebug", Hostname: "metadebug-host", IPv4: "192.168.71.20", AvailabilityZone: "rack-a",
+	})
+	require.NoError(t, err)
+
+	r := chi.NewRouter()
+	NewAPI(db).RegisterRoutes(r)
+
+	// By name, from an unrelated client address
+	req := httptest.NewRequest("GET", "/api/v0/machines/name/metadebug/meta-data", nil)
+	req.RemoteAddr = "203.0.113.5:12345"
+	byName := httptest.NewRecorder()
+	r.ServeHTTP(byName, req)
+	require.Equal(t, http.StatusOK, byName.Code)
+	assert.Contains(t, byName.Body.String(), "hostname: metadebug-host\n")
+
+	// Must match what the machine itself receives
+	req = httptest.NewRequest("GET", "/meta-data", nil)
+	req.RemoteAddr = "192.168.71.20:12345"
+	byIP := httptest.NewRecorder()
+	r.ServeHTTP(byIP, req)
+	require.Equal(t, http.StatusOK, byIP.Code)
+	assert.Equal(t, byIP.Body.String(), byName.Body.String())
+
+	// Unknown machine
+	req = httptest.NewRequest("GET", "/api/v0/machines/name/missing/meta-data", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestMachineMetadataDisableEnable(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestMachineMetadataDisableEnable")
+	defer cleanup()
+
+	machine, err := repository.NewMachineRepository(db).Save(context.Background(), domain.Machine{
+		Name: "isolated", Hostname: "isolated", IPv4: "192.168.72.20",
+	})
+	require.NoError(t, err)
+
+	r := chi.NewRouter()
+	NewAPI(db).RegisterRoutes(r)
+
+	fetch := func(path string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = "192.168.72.20:12345"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	toggle := func(action string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/v0/machines/"+strconv.FormatInt(machine.ID, 10)+"/"+action, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, fetch("/meta-data"))
+
+	w := toggle("disable")
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp MachineResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.False(t, resp.MetadataEnabled)
+
+	assert.Equal(t, http.StatusNotFound, fetch("/meta-data"))
+	assert.Equal(t, http.StatusNotFound, fetch("/user-data"))
+	assert.Equal(t, http.StatusNotFound, fetch("/network-config"))
+
+	w = toggle("enable")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.True(t, resp.MetadataEnabled)
+
+	assert.Equal(t, http.StatusOK, fetch("/meta-data"))
+	assert.Equal(t, http.StatusOK, fetch("/user-data"))
+
+	// Unknown machine
+	req := httptest.NewRequest("POST", "/api/v0/machines/99999/disable", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
 func TestAPI_noCloudUserDataHandler_WithMachineAndSSHKeys(t *testing.T) {
 	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestAPI_noCloudUserDataHandler_WithMachineAndSSHKeys")
 	defer cleanup()
@@ -757,7 +1940,7 @@ func TestAPI_noCloudUserDataHandler_WithMachineAndSSHKeys(t *testing.T) {
 	api := NewAPIWithRepos(machineRepo, sshKeyRepo, networkRepo, dhcpRangeRepo, ipLeaseRepo)
 
 	req := httptest.NewRequest("GET", "/user-data", nil)
-	req.Header.Set("X-Forwarded-For", "192.168.1.100")
+	req.RemoteAddr = "192.168.1.100:12345"
 	w := httptest.NewRecorder()
 
 	api.noCloudUserDataHandler(w, req)
@@ -793,7 +1976,7 @@ func TestAPI_noCloudUserDataHandler_MachineNotFound(t *testing.T) {
 	api := NewAPIWithRepos(machineRepo, sshKeyRepo, networkRepo, dhcpRangeRepo, ipLeaseRepo)
 
 	req := httptest.NewRequest("GET", "/user-data", nil)
-	req.Header.Set("X-Forwarded-For", "192.168.1.100") // Non-existent machine
+	req.RemoteAddr = "192.168.1.100:12345" // Non-existent machine
 	w := httptest.NewRecorder()
 
 	api.noCloudUserDataHandler(w, req)
@@ -837,7 +2020,7 @@ func TestAPI_noCloudVendorDataHandler_WithMachine(t *testing.T) {
 	api := NewAPIWithRepos(machineRepo, sshKeyRepo, networkRepo, dhcpRangeRepo, ipLeaseRepo)
 
 	req := httptest.NewRequest("GET", "/vendor-data", nil)
-	req.Header.Set("X-Forwarded-For", "192.168.1.100")
+	req.RemoteAddr = "192.168.1.100:12345"
 	w := httptest.NewRecorder()
 
 	api.noCloudVendorDataHandler(w, req)
@@ -852,3 +2035,283 @@ func TestAPI_noCloudVendorDataHandler_WithMachine(t *testing.T) {
 		t.Errorf("Expected Content-Type 'text/yaml', got '%s'", contentType)
 	}
 }
+
+func TestAPI_noCloudVendorDataHandler_Precedence(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestAPI_noCloudVendorDataHandler_Precedence")
+	defer cleanup()
+
+	vendorFile := filepath.Join(t.TempDir(), "vendor-data.yaml")
+	require.NoError(t, os.WriteFile(vendorFile, []byte("#cloud-config\npackages: [htop]\n"), 0o600))
+	cfg := config.NewConfig()
+	cfg.VendorDataFile = vendorFile
+	api, err := NewAPIWithConfig(db, cfg)
+	require.NoError(t, err)
+
+	// The file is cached at startup
+	require.NoError(t, os.Remove(vendorFile))
+
+	_, err = api.CreateMachine(context.Background(), Machine{Name: "own", Hostname: "own", IPv4: "192.168.1.100", VendorData: "#cloud-config\npackages: [vim]\n"})
+	require.NoError(t, err)
+	_, err = api.CreateMachine(context.Background(), Machine{Name: "global", Hostname: "global", IPv4: "192.168.1.101"})
+	require.NoError(t, err)
+
+	vendorData := func(a *API, remoteAddr string) string {
+		req := httptest.NewRequest("GET", "/vendor-data", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		a.noCloudVendorDataHandler(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		return w.Body.String()
+	}
+
+	// A machine's own vendor-data wins over the global file
+	assert.Equal(t, "#cloud-config\npackages: [vim]\n", vendorData(api, "192.168.1.100:12345"))
+	// Machines without their own, and unknown addresses, get the global file
+	assert.Equal(t, "#cloud-config\npackages: [htop]\n", vendorData(api, "192.168.1.101:12345"))
+	assert.Equal(t, "#cloud-config\npackages: [htop]\n", vendorData(api, "192.168.1.200:12345"))
+
+	// Without a global file there is nothing to serve
+	assert.Empty(t, vendorData(NewAPI(db), "192.168.1.101:12345"))
+
+	// A missing file fails startup
+	_, err = NewAPIWithConfig(db, cfg)
+	assert.Error(t, err)
+}
+
+func TestDeleteSSHKeysByFingerprint(t *testing.T) {
+	r := setupTestAPI(t)
+
+	createMachine := func(name, ip string) int64 {
+		body, _ := json.Marshal(CreateMachineRequest{Name: name, Hostname: name, IPv4: stringPtr(ip)})
+		req := httptest.NewRequest("POST", "/api/v0/machines", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusCreated, w.Code)
+		var m MachineResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&m))
+		return m.ID
+	}
+	addKey := func(machineID int64, keyText string) {
+		body, _ := json.Marshal(map[string]interface{}{"machine_id": machineID, "key_text": keyText})
+		req := httptest.NewRequest("POST", "/api/v0/ssh-keys", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusCreated, w.Code)
+	}
+
+	web := createMachine("web", "192.168.1.10")
+	db := createMachine("db", "192.168.1.11")
+	addKey(web, testEd25519Key)
+	// Same key with a different comment still has the same fingerprint
+	addKey(db, strings.Replace(testEd25519Key, "alice@lab", "alice@laptop", 1))
+	addKey(db, testRSAKey)
+
+	req := httptest.NewRequest("DELETE", "/api/v0/ssh-keys?fingerprint="+url.QueryEscape(testEd25519Fingerprint), nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp map[string]int
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, 2, resp["deleted"])
+
+	req = httptest.NewRequest("GET", "/api/v0/ssh-keys", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var remaining []SSHKeyResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&remaining))
+	require.Len(t, remaining, 1)
+	assert.Equal(t, db, remaining[0].MachineID)
+	assert.Contains(t, remaining[0].KeyText, "bob@lab")
+}
+
+func TestMachineDeletePreview(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestMachineDeletePreview")
+	defer cleanup()
+
+	networkRepo := repository.NewNetworkRepository(db)
+	dhcpRepo := repository.NewDHCPRangeRepository(db)
+	machineRepo := repository.NewMachineRepository(db)
+	sshKeyRepo := repository.NewSSHKeyRepository(db)
+	ipLeaseRepo := repository.NewIPLeaseRepository(db)
+	ctx := context.Background()
+
+	seedLeasedDHCPRange(t, networkRepo, dhcpRepo, machineRepo, ipLeaseRepo)
+	leased, err := machineRepo.FindByName(ctx, "leased")
+	require.NoError(t, err)
+	_, err = sshKeyRepo.CreateForMachine(ctx, leased.ID, "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIkey1")
+	require.NoError(t, err)
+	_, err = sshKeyRepo.CreateForMachine(ctx, leased.ID, "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIkey2")
+	require.NoError(t, err)
+
+	bare, err := machineRepo.Save(ctx, domain.Machine{Name: "bare", Hostname: "bare", IPv4: "10.0.0.5"})
+	require.NoError(t, err)
+
+	r := chi.NewRouter()
+	NewAPIWithRepos(machineRepo, sshKeyRepo, networkRepo, dhcpRepo, ipLeaseRepo).RegisterRoutes(r)
+
+	preview := func(id int64) MachineDeletePreview {
+		req := httptest.NewRequest("GET", "/api/v0/machines/"+strconv.FormatInt(id, 10)+"/delete-preview", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		var p MachineDeletePreview
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&p))
+		return p
+	}
+
+	p := preview(leased.ID)
+	assert.Equal(t, leased.ID, p.MachineID)
+	assert.Equal(t, 2, p.SSHKeys)
+	assert.Equal(t, 1, p.Leases)
+	assert.True(t, p.IPFreed)
+
+	p = preview(bare.ID)
+	assert.Equal(t, 0, p.SSHKeys)
+	assert.Equal(t, 0, p.Leases)
+	assert.True(t, p.IPFreed)
+	assert.Equal(t, "10.0.0.5", p.IPv4)
+
+	// Previewing deletes nothing
+	keys, err := sshKeyRepo.FindByMachineID(ctx, leased.ID)
+	require.NoError(t, err)
+	assert.Len(t, keys, 2)
+
+	req := httptest.NewRequest("GET", "/api/v0/machines/99999/delete-preview", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestMachineDetail(t *testing.T) {
+	api, cleanup := setupIntegrationTestAPI(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	network, dhcpRange := seedLeasedDHCPRange(t, api.networkRepo, api.dhcpRangeRepo, api.machineRepo, api.ipLeaseRepo)
+	leased, err := api.machineRepo.FindByName(ctx, "leased")
+	require.NoError(t, err)
+	key, err := api.sshKeyRepo.CreateForMachine(ctx, leased.ID, testEd25519Key)
+	require.NoError(t, err)
+	group, err := api.keyGroupRepo.Save(ctx, domain.KeyGroup{Name: "ops"})
+	require.NoError(t, err)
+	require.NoError(t, api.keyGroupRepo.AddMember(ctx, group.ID, leased.ID))
+
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+
+	req := httptest.NewRequest("GET", "/api/v0/machines/"+strconv.FormatInt(leased.ID, 10)+"/detail", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var detail MachineDetailResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&detail))
+	assert.Equal(t, leased.ID, detail.ID)
+	assert.Equal(t, "leased", detail.Name)
+	require.NotNil(t, detail.Network)
+	assert.Equal(t, network.ID, detail.Network.ID)
+	assert.Equal(t, "192.168.1.0/24", detail.Network.Subnet)
+	require.NotNil(t, detail.DHCPRange)
+	assert.Equal(t, dhcpRange.ID, detail.DHCPRange.ID)
+	require.Len(t, detail.SSHKeys, 1)
+	assert.Equal(t, key.ID, detail.SSHKeys[0].ID)
+	require.Len(t, detail.KeyGroups, 1)
+	assert.Equal(t, "ops", detail.KeyGroups[0].Name)
+	require.NotNil(t, detail.Lease)
+	assert.Equal(t, "192.168.1.100", detail.Lease.IPAddress)
+	assert.NotNil(t, detail.Lease.ExpiresAt)
+
+	req = httptest.NewRequest("GET", "/api/v0/machines/99999/detail", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestCreateMachine_StaticIPWithNetwork(t *testing.T) {
+	r := setupTestAPI(t)
+
+	req := httptest.NewRequest("POST", "/api/v0/networks", bytes.NewBufferString(`{"Name":"lab","Bridge":"br0","Subnet":"192.168.10.0/24"}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var network domain.Network
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&network))
+
+	create := func(name, ip string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(CreateMachineRequest{Name: name, Hostname: name, IPv4: stringPtr(ip), NetworkID: &network.ID})
+		req := httptest.NewRequest("POST", "/api/v0/machines", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// In-subnet pairing is accepted and keeps both fields
+	w = create("inside", "192.168.10.5")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created MachineResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	assert.Equal(t, "192.168.10.5", *created.IPv4)
+	require.NotNil(t, created.NetworkID)
+	assert.Equal(t, network.ID, *created.NetworkID)
+
+	// Out-of-subnet pairing is rejected
+	w = create("outside", "10.0.0.5")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "outside network lab subnet 192.168.10.0/24")
+
+	// Moving a networked machine to an address outside its subnet is rejected too
+	req = httptest.NewRequest("PATCH", "/api/v0/machines/"+strconv.FormatInt(created.ID, 10),
+		bytes.NewBufferString(`{"name":"inside","hostname":"inside","ipv4":"10.0.0.6"}`))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestStrictJSON_UnknownFields(t *testing.T) {
+	body := `{"name":"typo","hostname":"typo","ipv4":"192.168.1.60","hostnme":"typo"}`
+
+	tests := []struct {
+		name   string
+		strict bool
+		code   int
+	}{
+		{"strict rejects unknown field", true, http.StatusBadRequest},
+		{"lax ignores unknown field", false, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestStrictJSON_UnknownFields_"+strconv.FormatBool(tt.strict))
+			defer cleanup()
+
+			cfg := config.NewConfig()
+			cfg.StrictJSON = tt.strict
+			api, err := NewAPIWithConfig(db, cfg)
+			require.NoError(t, err)
+			r := chi.NewRouter()
+			api.RegisterRoutes(r)
+
+			req := httptest.NewRequest("POST", "/api/v0/machines", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			require.Equal(t, tt.code, w.Code, w.Body.String())
+			if tt.strict {
+				assert.Contains(t, w.Body.String(), `unknown field \"hostnme\"`)
+			}
+
+			// Networks use the same decoding
+			req = httptest.NewRequest("POST", "/api/v0/networks", strings.NewReader(`{"Name":"lab","Bridge":"br0","Subnet":"10.0.0.0/24","Gatway":"10.0.0.1"}`))
+			w = httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if tt.strict {
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+				assert.Contains(t, w.Body.String(), `unknown field "Gatway"`)
+			} else {
+				assert.Equal(t, http.StatusCreated, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// managementAPIPrefix is the path prefix of the management endpoints
+const managementAPIPrefix = "/api/v0/"
+
+// RequireAPIKey returns middleware that only lets requests through when they carry
+// an "Authorization: Bearer <apiKey>" header. If apiKey is empty the protected
+// routes are disabled entirely and every request is rejected with 403.
+func RequireAPIKey(apiKey string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if apiKey == "" {
+				http.Error(w, "endpoint disabled: no API key configured", http.StatusForbidden)
+				return
+			}
+			if !hasAPIKey(r, apiKey) {
+				writeUnauthorized(w)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireManagementAPIKey returns middleware that requires an "Authorization:
+// Bearer <apiKey>" header on management API (/api/v0/...) requests only, so the
+// metadata endpoints stay open for cloud-init. If apiKey is empty authentication
+// is disabled and every request passes.
+func RequireManagementAPIKey(apiKey string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if apiKey == "" {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isManagementPath(r.URL.Path) && !hasAPIKey(r, apiKey) {
+				writeUnauthorized(w)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isManagementPath reports whether path belongs to the management API
+func isManagementPath(path string) bool {
+	return path == strings.TrimSuffix(managementAPIPrefix, "/") || strings.HasPrefix(path, managementAPIPrefix)
+}
+
+// hasAPIKey reports whether r carries apiKey as its bearer token
+func hasAPIKey(r *http.Request, apiKey string) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(apiKey)) == 1
+}
+
+func writeUnauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="nook"`)
+	http.Error(w, "unauthorized", http.StatusUnauthorized)
+}
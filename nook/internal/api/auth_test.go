@@ -0,0 +1,85 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jbweber/homelab/nook/internal/config"
+	"github.com/jbweber/homelab/nook/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupAuthTestRouter(t *testing.T, name, apiKey string) http.Handler {
+	t.Helper()
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, name)
+	t.Cleanup(cleanup)
+
+	_, err := db.Exec("INSERT INTO machines (name, hostname, ipv4) VALUES (?, ?, ?)", "test-machine", "test-host", "192.168.1.50")
+	require.NoError(t, err)
+
+	cfg := config.NewConfig()
+	cfg.APIKey = apiKey
+	api, err := NewAPIWithConfig(db, cfg)
+	require.NoError(t, err)
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+	return r
+}
+
+func serveAuthRequest(r http.Handler, path, authorization string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	req.RemoteAddr = "192.168.1.50:12345"
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRequireManagementAPIKey_Authorized(t *testing.T) {
+	r := setupAuthTestRouter(t, "TestRequireManagementAPIKey_Authorized", "secret")
+
+	for _, path := range []string{"/api/v0/machines", "/api/v0/networks", "/api/v0/ssh-keys", "/api/v0/capabilities"} {
+		w := serveAuthRequest(r, path, "Bearer secret")
+		assert.Equal(t, http.StatusOK, w.Code, path)
+	}
+}
+
+func TestRequireManagementAPIKey_Unauthorized(t *testing.T) {
+	r := setupAuthTestRouter(t, "TestRequireManagementAPIKey_Unauthorized", "secret")
+
+	tests := []struct {
+		name          string
+		authorization string
+	}{
+		{"MissingHeader", ""},
+		{"WrongKey", "Bearer wrong"},
+		{"WrongScheme", "Basic secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveAuthRequest(r, "/api/v0/machines", tt.authorization)
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+			assert.Equal(t, `Bearer realm="nook"`, w.Header().Get("WWW-Authenticate"))
+		})
+	}
+
+	// Metadata endpoints stay open for cloud-init
+	for _, path := range []string{"/meta-data", "/user-data", "/vendor-data", "/healthz"} {
+		w := serveAuthRequest(r, path, "")
+		assert.Equal(t, http.StatusOK, w.Code, path)
+	}
+}
+
+func TestRequireManagementAPIKey_Disabled(t *testing.T) {
+	r := setupAuthTestRouter(t, "TestRequireManagementAPIKey_Disabled", "")
+
+	w := serveAuthRequest(r, "/api/v0/machines", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAuthRequest(r, "/meta-data", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,297 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jbweber/homelab/nook/internal/domain"
+	"github.com/jbweber/homelab/nook/internal/repository"
+)
+
+// BackupFormat marks a full backup document. POST /api/v0/import restores bodies
+// carrying it instead of treating them as an Inventory.
+const BackupFormat = "nook-backup"
+
+// Backup is a full, ID-preserving copy of every inventory table: networks and
+// their tags, DHCP ranges, MAC and IP reservations, machines, SSH keys, leases,
+// key groups with their keys and members, and settings such as the MOTD.
+// SchemaVersion is the database migration version it was taken at; it is only
+// restored into a database at the same version. Creation timestamps of MAC
+// reservations and key groups are not kept.
+type Backup struct {
+	Format          string                 `json:"format"`
+	SchemaVersion   int64                  `json:"schema_version"`
+	Networks        []BackupNetwork        `json:"networks"`
+	NetworkTags     []BackupNetworkTag     `json:"network_tags"`
+	DHCPRanges      []BackupDHCPRange      `json:"dhcp_ranges"`
+	MACReservations []BackupMACReservation `json:"mac_reservations"`
+	IPReservations  []BackupIPReservation  `json:"ip_reservations"`
+	Machines        []BackupMachine        `json:"machines"`
+	SSHKeys         []BackupSSHKey         `json:"ssh_keys"`
+	Leases          []BackupLease          `json:"leases"`
+	KeyGroups       []BackupKeyGroup       `json:"key_groups"`
+	KeyGroupKeys    []BackupKeyGroupKey    `json:"key_group_keys"`
+	KeyGroupMembers []BackupKeyGroupMember `json:"key_group_members"`
+	Settings        map[string]string      `json:"settings"`
+}
+
+// BackupNetwork is a network row in a Backup
+type BackupNetwork struct {
+	ID                 int64  `json:"id"`
+	Name               string `json:"name"`
+	Bridge             string `json:"bridge"`
+	Subnet             string `json:"subnet"`
+	Gateway            string `json:"gateway"`
+	DNSServers         string `json:"dns_servers"`
+	DNSForwarders      string `json:"dns_forwarders"`
+	Description        string `json:"description"`
+	AllocationStrategy string `json:"allocation_strategy"`
+	MTU                int    `json:"mtu"`
+}
+
+// BackupNetworkTag is a network tag row in a Backup
+type BackupNetworkTag struct {
+	NetworkID int64  `json:"network_id"`
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+}
+
+// BackupDHCPRange is a DHCP range row in a Backup
+type BackupDHCPRange struct {
+	ID        int64  `json:"id"`
+	NetworkID int64  `json:"network_id"`
+	StartIP   string `json:"start_ip"`
+	EndIP     string `json:"end_ip"`
+	LeaseTime string `json:"lease_time"`
+}
+
+// BackupMACReservation is a MAC reservation row in a Backup
+type BackupMACReservation struct {
+	ID        int64  `json:"id"`
+	NetworkID int64  `json:"network_id"`
+	MAC       string `json:"mac"`
+	IPAddress string `json:"ip_address"`
+	Hostname  string `json:"hostname"`
+}
+
+// BackupIPReservation is an IP reservation row in a Backup
+type BackupIPReservation struct {
+	ID        int64  `json:"id"`
+	NetworkID int64  `json:"network_id"`
+	IPAddress string `json:"ip_address"`
+	Token     string `json:"token"`
+	CreatedAt string `json:"created_at"`
+}
+
+// BackupMachine is a machine row in a Backup
+type BackupMachine struct {
+	ID               int64    `json:"id"`
+	Name             string   `json:"name"`
+	Hostname         string   `json:"hostname"`
+	IPv4             string   `json:"ipv4"`
+	IPv6             string   `json:"ipv6"`
+	NetworkID        *int64   `json:"network_id"`
+	AvailabilityZone string   `json:"availability_zone"`
+	MetadataEnabled  bool     `json:"metadata_enabled"`
+	MTU              int      `json:"mtu"`
+	RunCmd           []string `json:"runcmd"`
+	UserData         string   `json:"user_data"`
+	VendorData       string   `json:"vendor_data"`
+}
+
+// BackupSSHKey is an SSH key row in a Backup. KeyText is always plaintext, even
+// when keys are encrypted at rest.
+type BackupSSHKey struct {
+	ID        int64  `json:"id"`
+	MachineID int64  `json:"machine_id"`
+	KeyText   string `json:"key_text"`
+}
+
+// BackupLease is an IP address lease row in a Backup
+type BackupLease struct {
+	ID        int64  `json:"id"`
+	MachineID int64  `json:"machine_id"`
+	NetworkID int64  `json:"network_id"`
+	IPAddress string `json:"ip_address"`
+	LeaseTime string `json:"lease_time"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// BackupKeyGroup is a key group row in a Backup
+type BackupKeyGroup struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// BackupKeyGroupKey is a key group SSH key row in a Backup
+type BackupKeyGroupKey struct {
+	ID      int64  `json:"id"`
+	GroupID int64  `json:"group_id"`
+	KeyText string `json:"key_text"`
+}
+
+// BackupKeyGroupMember is a key group membership row in a Backup
+type BackupKeyGroupMember struct {
+	GroupID   int64 `json:"group_id"`
+	MachineID int64 `json:"machine_id"`
+}
+
+// ExportBackup implements BackupStore interface. Every table is read in one
+// transaction, so the backup is consistent even while the API is in use.
+func (a *API) ExportBackup(ctx context.Context) (*Backup, error) {
+	if a.db == nil {
+		return nil, fmt.Errorf("export unavailable without a database handle")
+	}
+
+	version, err := a.SchemaVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := repository.NewSnapshotRepository(a.db, a.sshKeyRepo).Take(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	backup := &Backup{
+		Format:          BackupFormat,
+		SchemaVersion:   version,
+		Networks:        []BackupNetwork{},
+		NetworkTags:     []BackupNetworkTag{},
+		DHCPRanges:      []BackupDHCPRange{},
+		MACReservations: []BackupMACReservation{},
+		IPReservations:  []BackupIPReservation{},
+		Machines:        []BackupMachine{},
+		SSHKeys:         []BackupSSHKey{},
+		Leases:          []BackupLease{},
+		KeyGroups:       []BackupKeyGroup{},
+		KeyGroupKeys:    []BackupKeyGroupKey{},
+		KeyGroupMembers: []BackupKeyGroupMember{},
+		Settings:        snapshot.Settings,
+	}
+	for _, n := range snapshot.Networks {
+		backup.Networks = append(backup.Networks, BackupNetwork{
+			ID: n.ID, Name: n.Name, Bridge: n.Bridge, Subnet: n.Subnet, Gateway: n.Gateway,
+			DNSServers: n.DNSServers, DNSForwarders: n.DNSForwarders, Description: n.Description,
+			AllocationStrategy: n.AllocationStrategy, MTU: n.MTU,
+		})
+	}
+	for _, t := range snapshot.NetworkTags {
+		backup.NetworkTags = append(backup.NetworkTags, BackupNetworkTag{NetworkID: t.NetworkID, Key: t.Key, Value: t.Value})
+	}
+	for _, d := range snapshot.DHCPRanges {
+		backup.DHCPRanges = append(backup.DHCPRanges, BackupDHCPRange{
+			ID: d.ID, NetworkID: d.NetworkID, StartIP: d.StartIP, EndIP: d.EndIP, LeaseTime: d.LeaseTime,
+		})
+	}
+	for _, m := range snapshot.MACReservations {
+		backup.MACReservations = append(backup.MACReservations, BackupMACReservation{
+			ID: m.ID, NetworkID: m.NetworkID, MAC: m.MAC, IPAddress: m.IPAddress, Hostname: m.Hostname,
+		})
+	}
+	for _, res := range snapshot.IPReservations {
+		backup.IPReservations = append(backup.IPReservations, BackupIPReservation{
+			ID: res.ID, NetworkID: res.NetworkID, IPAddress: res.IPAddress, Token: res.Token, CreatedAt: res.CreatedAt,
+		})
+	}
+	for _, m := range snapshot.Machines {
+		backup.Machines = append(backup.Machines, BackupMachine{
+			ID: m.ID, Name: m.Name, Hostname: m.Hostname, IPv4: m.IPv4, IPv6: m.IPv6, NetworkID: m.NetworkID,
+			AvailabilityZone: m.AvailabilityZone, MetadataEnabled: !m.MetadataDisabled, MTU: m.MTU, RunCmd: m.RunCmd,
+			UserData: m.UserData, VendorData: m.VendorData,
+		})
+	}
+	for _, k := range snapshot.SSHKeys {
+		backup.SSHKeys = append(backup.SSHKeys, BackupSSHKey{ID: k.ID, MachineID: k.MachineID, KeyText: k.KeyText})
+	}
+	for _, l := range snapshot.Leases {
+		backup.Leases = append(backup.Leases, BackupLease{
+			ID: l.ID, MachineID: l.MachineID, NetworkID: l.NetworkID, IPAddress: l.IPAddress,
+			LeaseTime: l.LeaseTime, CreatedAt: l.CreatedAt, UpdatedAt: l.UpdatedAt,
+		})
+	}
+	for _, g := range snapshot.KeyGroups {
+		backup.KeyGroups = append(backup.KeyGroups, BackupKeyGroup{ID: g.ID, Name: g.Name})
+	}
+	for _, k := range snapshot.KeyGroupKeys {
+		backup.KeyGroupKeys = append(backup.KeyGroupKeys, BackupKeyGroupKey{ID: k.ID, GroupID: k.GroupID, KeyText: k.KeyText})
+	}
+	for _, m := range snapshot.KeyGroupMembers {
+		backup.KeyGroupMembers = append(backup.KeyGroupMembers, BackupKeyGroupMember{GroupID: m.GroupID, MachineID: m.MachineID})
+	}
+	return backup, nil
+}
+
+// RestoreBackup implements BackupStore interface. The database must be empty;
+// everything in b is written in one transaction or not at all.
+func (a *API) RestoreBackup(ctx context.Context, b *Backup) (*ImportResult, error) {
+	if a.db == nil {
+		return nil, fmt.Errorf("restore unavailable without a database handle")
+	}
+
+	snapshot := repository.Snapshot{Settings: b.Settings}
+	for _, n := range b.Networks {
+		snapshot.Networks = append(snapshot.Networks, domain.Network{
+			ID: n.ID, Name: n.Name, Bridge: n.Bridge, Subnet: n.Subnet, Gateway: n.Gateway,
+			DNSServers: n.DNSServers, DNSForwarders: n.DNSForwarders, Description: n.Description,
+			AllocationStrategy: n.AllocationStrategy, MTU: n.MTU,
+		})
+	}
+	for _, t := range b.NetworkTags {
+		snapshot.NetworkTags = append(snapshot.NetworkTags, repository.NetworkTag{NetworkID: t.NetworkID, Key: t.Key, Value: t.Value})
+	}
+	for _, d := range b.DHCPRanges {
+		snapshot.DHCPRanges = append(snapshot.DHCPRanges, domain.DHCPRange{
+			ID: d.ID, NetworkID: d.NetworkID, StartIP: d.StartIP, EndIP: d.EndIP, LeaseTime: d.LeaseTime,
+		})
+	}
+	for _, m := range b.MACReservations {
+		snapshot.MACReservations = append(snapshot.MACReservations, domain.MACReservation{
+			ID: m.ID, NetworkID: m.NetworkID, MAC: m.MAC, IPAddress: m.IPAddress, Hostname: m.Hostname,
+		})
+	}
+	for _, res := range b.IPReservations {
+		snapshot.IPReservations = append(snapshot.IPReservations, domain.IPReservation{
+			ID: res.ID, NetworkID: res.NetworkID, IPAddress: res.IPAddress, Token: res.Token, CreatedAt: res.CreatedAt,
+		})
+	}
+	for _, m := range b.Machines {
+		snapshot.Machines = append(snapshot.Machines, domain.Machine{
+			ID: m.ID, Name: m.Name, Hostname: m.Hostname, IPv4: m.IPv4, IPv6: m.IPv6, NetworkID: m.NetworkID,
+			AvailabilityZone: m.AvailabilityZone, MetadataDisabled: !m.MetadataEnabled, MTU: m.MTU, RunCmd: m.RunCmd,
+			UserData: m.UserData, VendorData: m.VendorData,
+		})
+	}
+	for _, k := range b.SSHKeys {
+		snapshot.SSHKeys = append(snapshot.SSHKeys, domain.SSHKey{ID: k.ID, MachineID: k.MachineID, KeyText: k.KeyText})
+	}
+	for _, l := range b.Leases {
+		snapshot.Leases = append(snapshot.Leases, domain.IPAddressLease{
+			ID: l.ID, MachineID: l.MachineID, NetworkID: l.NetworkID, IPAddress: l.IPAddress,
+			LeaseTime: l.LeaseTime, CreatedAt: l.CreatedAt, UpdatedAt: l.UpdatedAt,
+		})
+	}
+	for _, g := range b.KeyGroups {
+		snapshot.KeyGroups = append(snapshot.KeyGroups, domain.KeyGroup{ID: g.ID, Name: g.Name})
+	}
+	for _, k := range b.KeyGroupKeys {
+		snapshot.KeyGroupKeys = append(snapshot.KeyGroupKeys, domain.KeyGroupKey{ID: k.ID, GroupID: k.GroupID, KeyText: k.KeyText})
+	}
+	for _, m := range b.KeyGroupMembers {
+		snapshot.KeyGroupMembers = append(snapshot.KeyGroupMembers, repository.KeyGroupMember{GroupID: m.GroupID, MachineID: m.MachineID})
+	}
+
+	if err := repository.NewSnapshotRepository(a.db, a.sshKeyRepo).Restore(ctx, snapshot); err != nil {
+		return nil, err
+	}
+	// Restored machines may have been cached as missing
+	a.machineRepo.Invalidate()
+
+	return &ImportResult{
+		Networks:   len(b.Networks),
+		DHCPRanges: len(b.DHCPRanges),
+		Machines:   len(b.Machines),
+		SSHKeys:    len(b.SSHKeys),
+		Leases:     len(b.Leases),
+	}, nil
+}
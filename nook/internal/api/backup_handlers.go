@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/jbweber/homelab/nook/internal/repository"
+)
+
+// BackupStore defines the datastore interface for backup export and restore
+type BackupStore interface {
+	SchemaVersion(ctx context.Context) (int64, error)
+	ExportBackup(ctx context.Context) (*Backup, error)
+	RestoreBackup(ctx context.Context, b *Backup) (*ImportResult, error)
+}
+
+// Backups groups the full backup and restore handlers
+type Backups struct {
+	store BackupStore
+}
+
+// NewBackups creates a new Backups instance with the given store.
+func NewBackups(store BackupStore) *Backups {
+	return &Backups{store: store}
+}
+
+// ExportHandler handles GET /api/v0/export, returning every machine, network, DHCP
+// range, SSH key and lease as a Backup document.
+func (b *Backups) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	backup, err := b.store.ExportBackup(r.Context())
+	if err != nil {
+		log.Printf("failed to export backup: %v", err)
+		http.Error(w, "failed to export backup", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(backup); err != nil {
+		log.Printf("failed to encode backup: %v", err)
+	}
+}
+
+// RestoreHandler handles POST /api/v0/import for bodies in BackupFormat. The
+// backup must match the database's schema version (400) and the database must
+// hold no inventory yet (409); on success every row is recreated with its
+// original ID and the counts are returned (201).
+func (b *Backups) RestoreHandler(w http.ResponseWriter, r *http.Request) {
+	var backup Backup
+	if err := decodeJSONBody(r, &backup); err != nil {
+		http.Error(w, jsonErrorMessage(err, "invalid JSON"), http.StatusBadRequest)
+		return
+	}
+	if r.URL.Query().Get("dry_run") == "true" {
+		http.Error(w, "dry_run is not supported for backups", http.StatusBadRequest)
+		return
+	}
+
+	version, err := b.store.SchemaVersion(r.Context())
+	if err != nil {
+		log.Printf("failed to read schema version: %v", err)
+		http.Error(w, "failed to restore backup", http.StatusInternalServerError)
+		return
+	}
+	if backup.SchemaVersion != version {
+		http.Error(w, fmt.Sprintf("backup schema version %d does not match database schema version %d", backup.SchemaVersion, version), http.StatusBadRequest)
+		return
+	}
+
+	result, err := b.store.RestoreBackup(r.Context(), &backup)
+	switch {
+	case errors.Is(err, repository.ErrDuplicate):
+		http.Error(w, "database is not empty", http.StatusConflict)
+		return
+	case errors.Is(err, repository.ErrInvalidEntity), errors.Is(err, repository.ErrNotFound):
+		http.Error(w, fmt.Sprintf("invalid backup: %v", err), http.StatusBadRequest)
+		return
+	case err != nil:
+		log.Printf("failed to restore backup: %v", err)
+		http.Error(w, "failed to restore backup", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(ImportResponse{Problems: []string{}, Result: result}); err != nil {
+		log.Printf("failed to encode import response: %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jbweber/homelab/nook/internal/domain"
+	"github.com/jbweber/homelab/nook/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupBackupTestRouter(t *testing.T, name string) (*API, http.Handler) {
+	t.Helper()
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, name)
+	t.Cleanup(cleanup)
+	api := NewAPI(db)
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+	return api, r
+}
+
+func exportBackup(t *testing.T, r http.Handler) Backup {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v0/export", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var backup Backup
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&backup))
+	return backup
+}
+
+func postBackup(t *testing.T, r http.Handler, backup Backup) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := json.Marshal(backup)
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/api/v0/import", bytes.NewReader(body)))
+	return w
+}
+
+func TestBackups_RoundTrip(t *testing.T) {
+	source, sourceRouter := setupBackupTestRouter(t, "TestBackups_RoundTrip_source")
+	_, err := source.ImportInventory(context.Background(), &Inventory{
+		Networks: []InventoryNetwork{{
+			Name: "lab", Bridge: "br-lab", Subnet: "192.168.60.0/24", Gateway: "192.168.60.1",
+			DHCPRanges: []InventoryDHCPRange{{StartIP: "192.168.60.100", EndIP: "192.168.60.120"}},
+		}},
+		Machines: []InventoryMachine{
+			{Name: "static", Hostname: "static", IPv4: "192.168.60.10", Network: "lab", SSHKeys: []string{testEd25519Key}, RunCmd: []string{"echo hi"}},
+			{Name: "dynamic", Hostname: "dynamic", Network: "lab"},
+		},
+	})
+	require.NoError(t, err)
+
+	// Fill every table that is not part of an inventory
+	networks, err := source.ListNetworks(context.Background())
+	require.NoError(t, err)
+	networkID := networks[0].ID
+	machine, err := source.GetMachineByName(context.Background(), "static")
+	require.NoError(t, err)
+	require.NoError(t, source.SetNetworkTags(context.Background(), networkID, map[string]string{"env": "lab"}))
+	_, err = source.CreateMACReservation(context.Background(), domain.MACReservation{NetworkID: networkID, MAC: "52:54:00:12:34:56", IPAddress: "192.168.60.50", Hostname: "printer"})
+	require.NoError(t, err)
+	_, err = source.ReserveIPAddresses(context.Background(), networkID, 2)
+	require.NoError(t, err)
+	group, err := source.CreateKeyGroup(context.Background(), "admins")
+	require.NoError(t, err)
+	_, err = source.AddKeyGroupKey(context.Background(), group.ID, testEd25519Key)
+	require.NoError(t, err)
+	require.NoError(t, source.AddKeyGroupMember(context.Background(), group.ID, machine.ID))
+	require.NoError(t, source.SetMOTD(context.Background(), "Welcome to the lab"))
+
+	backup := exportBackup(t, sourceRouter)
+	assert.Equal(t, BackupFormat, backup.Format)
+	assert.Equal(t, expectedSchemaVersion(), backup.SchemaVersion)
+	assert.Len(t, backup.Networks, 1)
+	assert.Len(t, backup.NetworkTags, 1)
+	assert.Len(t, backup.DHCPRanges, 1)
+	assert.Len(t, backup.MACReservations, 1)
+	assert.Len(t, backup.IPReservations, 2)
+	assert.Len(t, backup.Machines, 2)
+	assert.Len(t, backup.SSHKeys, 1)
+	assert.Len(t, backup.Leases, 1)
+	assert.Len(t, backup.KeyGroups, 1)
+	assert.Len(t, backup.KeyGroupKeys, 1)
+	assert.Equal(t, []BackupKeyGroupMember{{GroupID: group.ID, MachineID: machine.ID}}, backup.KeyGroupMembers)
+	assert.Equal(t, map[string]string{"motd": "Welcome to the lab"}, backup.Settings)
+
+	_, targetRouter := setupBackupTestRouter(t, "TestBackups_RoundTrip_target")
+	w := postBackup(t, targetRouter, backup)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var resp ImportResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	require.NotNil(t, resp.Result)
+	assert.Equal(t, ImportResult{Networks: 1, DHCPRanges: 1, Machines: 2, SSHKeys: 1, Leases: 1}, *resp.Result)
+
+	// The restored database exports exactly what was backed up
+	assert.Equal(t, backup, exportBackup(t, targetRouter))
+
+	// Restoring over existing data is refused
+	w = postBackup(t, targetRouter, backup)
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestBackups_Restore_SchemaVersionMismatch(t *testing.T) {
+	_, r := setupBackupTestRouter(t, "TestBackups_Restore_SchemaVersionMismatch")
+
+	backup := Backup{Format: BackupFormat, SchemaVersion: expectedSchemaVersion() + 1}
+	w := postBackup(t, r, backup)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), fmt.Sprintf("backup schema version %d", backup.SchemaVersion))
+}
+
+func TestBackups_Restore_InvalidBackup(t *testing.T) {
+	api, r := setupBackupTestRouter(t, "TestBackups_Restore_InvalidBackup")
+
+	backup := Backup{
+		Format:        BackupFormat,
+		SchemaVersion: expectedSchemaVersion(),
+		Networks:      []BackupNetwork{{ID: 1, Name: "lab", Bridge: "br-lab", Subnet: "192.168.60.0/24"}},
+		DHCPRanges:    []BackupDHCPRange{{ID: 1, NetworkID: 1, StartIP: "10.0.0.1", EndIP: "10.0.0.9", LeaseTime: "24h"}},
+	}
+	w := postBackup(t, r, backup)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid backup")
+
+	// Nothing was written
+	networks, err := api.ListNetworks(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, networks)
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/jbweber/homelab/nook/internal/config"
+)
+
+// CapabilitiesStore defines the datastore interface for the capabilities handler
+type CapabilitiesStore interface {
+	SchemaVersion(ctx context.Context) (int64, error)
+}
+
+// Capabilities reports which optional features this deployment supports
+type Capabilities struct {
+	store CapabilitiesStore
+	cfg   *config.Config
+}
+
+// NewCapabilities creates a new Capabilities instance with the given store and configuration.
+func NewCapabilities(store CapabilitiesStore, cfg *config.Config) *Capabilities {
+	return &Capabilities{store: store, cfg: cfg}
+}
+
+// CapabilitiesResponse is the body of GET /api/v0/capabilities
+type CapabilitiesResponse struct {
+	SchemaVersion int64           `json:"schema_version"`
+	Features      map[string]bool `json:"features"`
+}
+
+// schemaFeatures maps features to the migration version that introduced them
+var schemaFeatures = []struct {
+	name    string
+	version int64
+}{
+	{"network_tags", 11},
+	{"availability_zone", 12},
+	{"mac_reservations", 13},
+	{"allocation_strategy", 14},
+	{"metadata_toggle", 15},
+	{"motd", 16},
+	{"mtu", 17},
+	{"key_groups", 18},
+	{"dns_forwarders", 19},
+	{"runcmd", 20},
+	{"ip_reservations", 21},
+	{"ipv6", 22},
+	{"user_data", 23},
+	{"vendor_data", 24},
+}
+
+// features computes the feature flags for a schema version and configuration.
+func features(schemaVersion int64, cfg *config.Config) map[string]bool {
+	flags := map[string]bool{
+		"admin_api":                   cfg.APIKey != "",
+		"ssh_key_encryption":          cfg.SSHKeyEncryptionKey != "",
+		"strict_json":                 cfg.StrictJSON,
+		"metadata_subnet_enforcement": cfg.EnforceMetadataSubnet,
+		"network_config_ua_gate":      cfg.NetworkConfigUserAgent != "",
+	}
+	for _, f := range schemaFeatures {
+		flags[f.name] = schemaVersion >= f.version
+	}
+	return flags
+}
+
+// CapabilitiesHandler handles GET /api/v0/capabilities and returns the applied
+// schema version with a map of feature flags derived from it and the configuration.
+func (c *Capabilities) CapabilitiesHandler(w http.ResponseWriter, r *http.Request) {
+	version, err := c.store.SchemaVersion(r.Context())
+	if err != nil {
+		log.Printf("failed to get schema version: %v", err)
+		http.Error(w, "failed to get schema version", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(CapabilitiesResponse{SchemaVersion: version, Features: features(version, c.cfg)}); err != nil {
+		log.Printf("failed to encode capabilities response: %v", err)
+	}
+}
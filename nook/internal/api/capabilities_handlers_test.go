@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jbweber/homelab/nook/internal/config"
+	"github.com/jbweber/homelab/nook/internal/migrations"
+	"github.com/jbweber/homelab/nook/internal/testutil"
+)
+
+func getCapabilities(t *testing.T, api *API) CapabilitiesResponse {
+	t.Helper()
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+	req := httptest.NewRequest("GET", "/api/v0/capabilities", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp CapabilitiesResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	return resp
+}
+
+func TestCapabilitiesHandler(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestCapabilitiesHandler")
+	defer cleanup()
+
+	cfg := config.NewConfig()
+	cfg.APIKey = "secret"
+	cfg.StrictJSON = true
+	api, err := NewAPIWithConfig(db, cfg)
+	require.NoError(t, err)
+
+	resp := getCapabilities(t, api)
+	all := migrations.GetInitialMigrations()
+	assert.Equal(t, all[len(all)-1].Version, resp.SchemaVersion)
+	for _, feature := range []string{"network_tags", "availability_zone", "mac_reservations", "allocation_strategy", "metadata_toggle", "ipv6", "admin_api", "strict_json"} {
+		assert.True(t, resp.Features[feature], feature)
+	}
+	assert.False(t, resp.Features["ssh_key_encryption"])
+}
+
+func TestCapabilitiesHandler_OlderSchema(t *testing.T) {
+	db, cleanup := testutil.SetupTestDB(t, "TestCapabilitiesHandler_OlderSchema")
+	defer cleanup()
+
+	// Apply migrations only up to version 12
+	migrator := migrations.NewMigrator(db)
+	for _, migration := range migrations.GetInitialMigrations() {
+		if migration.Version <= 12 {
+			migrator.AddMigration(migration)
+		}
+	}
+	require.NoError(t, migrator.RunMigrations())
+
+	resp := getCapabilities(t, NewAPI(db))
+	assert.Equal(t, int64(12), resp.SchemaVersion)
+	assert.True(t, resp.Features["network_tags"])
+	assert.True(t, resp.Features["availability_zone"])
+	assert.False(t, resp.Features["mac_reservations"])
+	assert.False(t, resp.Features["metadata_toggle"])
+	assert.False(t, resp.Features["ipv6"])
+	assert.False(t, resp.Features["admin_api"])
+}
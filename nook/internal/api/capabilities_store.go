@@ -0,0 +1,16 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jbweber/homelab/nook/internal/migrations"
+)
+
+// SchemaVersion implements CapabilitiesStore interface
+func (a *API) SchemaVersion(ctx context.Context) (int64, error) {
+	if a.db == nil {
+		return 0, fmt.Errorf("schema version unavailable without a database handle")
+	}
+	return migrations.NewMigrator(a.db).GetCurrentVersion()
+}
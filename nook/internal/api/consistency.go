@@ -0,0 +1,148 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+
+	"github.com/jbweber/homelab/nook/internal/domain"
+)
+
+// Consistency check names reported in ConsistencyIssue.Check
+const (
+	CheckOrphanedSSHKey        = "orphaned_ssh_key"
+	CheckOrphanedLease         = "orphaned_lease"
+	CheckMachineOutsideSubnet  = "machine_outside_subnet"
+	CheckLeaseIPMismatch       = "lease_ip_mismatch"
+	CheckOverlappingDHCPRanges = "overlapping_dhcp_ranges"
+)
+
+// ConsistencyIssue describes a single problem found by a consistency check
+type ConsistencyIssue struct {
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+// ConsistencyReport is the result of running every consistency check
+type ConsistencyReport struct {
+	OK     bool               `json:"ok"`
+	Issues []ConsistencyIssue `json:"issues"`
+}
+
+// checkOrphanedSSHKeys reports SSH keys whose machine no longer exists.
+func checkOrphanedSSHKeys(keys []domain.SSHKey, machines map[int64]domain.Machine) []ConsistencyIssue {
+	var issues []ConsistencyIssue
+	for _, key := range keys {
+		if _, ok := machines[key.MachineID]; !ok {
+			issues = append(issues, ConsistencyIssue{
+				Check:   CheckOrphanedSSHKey,
+				Message: fmt.Sprintf("ssh key %d references missing machine %d", key.ID, key.MachineID),
+			})
+		}
+	}
+	return issues
+}
+
+// checkOrphanedLeases reports leases whose machine or network no longer exists.
+func checkOrphanedLeases(leases []domain.IPAddressLease, machines map[int64]domain.Machine, networks map[int64]domain.Network) []ConsistencyIssue {
+	var issues []ConsistencyIssue
+	for _, lease := range leases {
+		if _, ok := machines[lease.MachineID]; !ok {
+			issues = append(issues, ConsistencyIssue{
+				Check:   CheckOrphanedLease,
+				Message: fmt.Sprintf("lease %d (%s) references missing machine %d", lease.ID, lease.IPAddress, lease.MachineID),
+			})
+		}
+		if _, ok := networks[lease.NetworkID]; !ok {
+			issues = append(issues, ConsistencyIssue{
+				Check:   CheckOrphanedLease,
+				Message: fmt.Sprintf("lease %d (%s) references missing network %d", lease.ID, lease.IPAddress, lease.NetworkID),
+			})
+		}
+	}
+	return issues
+}
+
+// checkMachineSubnets reports machines whose IPv4 falls outside their network's subnet.
+func checkMachineSubnets(machines []domain.Machine, networks map[int64]domain.Network) []ConsistencyIssue {
+	var issues []ConsistencyIssue
+	for _, machine := range machines {
+		if machine.NetworkID == nil || machine.IPv4 == "" {
+			continue
+		}
+		network, ok := networks[*machine.NetworkID]
+		if !ok {
+			issues = append(issues, ConsistencyIssue{
+				Check:   CheckMachineOutsideSubnet,
+				Message: fmt.Sprintf("machine %d (%s) references missing network %d", machine.ID, machine.Name, *machine.NetworkID),
+			})
+			continue
+		}
+		_, subnet, err := net.ParseCIDR(network.Subnet)
+		if err != nil {
+			issues = append(issues, ConsistencyIssue{
+				Check:   CheckMachineOutsideSubnet,
+				Message: fmt.Sprintf("network %d (%s) has invalid subnet %q", network.ID, network.Name, network.Subnet),
+			})
+			continue
+		}
+		if ip := net.ParseIP(machine.IPv4); ip == nil || !subnet.Contains(ip) {
+			issues = append(issues, ConsistencyIssue{
+				Check:   CheckMachineOutsideSubnet,
+				Message: fmt.Sprintf("machine %d (%s) has IP %s outside network %s subnet %s", machine.ID, machine.Name, machine.IPv4, network.Name, network.Subnet),
+			})
+		}
+	}
+	return issues
+}
+
+// checkLeaseMachineIPs reports leases whose address differs from the leasing machine's IPv4.
+func checkLeaseMachineIPs(leases []domain.IPAddressLease, machines map[int64]domain.Machine) []ConsistencyIssue {
+	var issues []ConsistencyIssue
+	for _, lease := range leases {
+		machine, ok := machines[lease.MachineID]
+		if !ok {
+			// Reported by checkOrphanedLeases
+			continue
+		}
+		if machine.IPv4 != lease.IPAddress {
+			issues = append(issues, ConsistencyIssue{
+				Check:   CheckLeaseIPMismatch,
+				Message: fmt.Sprintf("lease %d holds %s but machine %d (%s) has IP %s", lease.ID, lease.IPAddress, machine.ID, machine.Name, machine.IPv4),
+			})
+		}
+	}
+	return issues
+}
+
+// checkOverlappingDHCPRanges reports pairs of DHCP ranges on the same network that overlap.
+func checkOverlappingDHCPRanges(ranges []domain.DHCPRange) []ConsistencyIssue {
+	var issues []ConsistencyIssue
+	for i := 0; i < len(ranges); i++ {
+		for j := i + 1; j < len(ranges); j++ {
+			a, b := ranges[i], ranges[j]
+			if a.NetworkID != b.NetworkID {
+				continue
+			}
+			if dhcpRangesOverlap(a, b) {
+				issues = append(issues, ConsistencyIssue{
+					Check: CheckOverlappingDHCPRanges,
+					Message: fmt.Sprintf("DHCP ranges %d (%s-%s) and %d (%s-%s) on network %d overlap",
+						a.ID, a.StartIP, a.EndIP, b.ID, b.StartIP, b.EndIP, a.NetworkID),
+				})
+			}
+		}
+	}
+	return issues
+}
+
+// dhcpRangesOverlap reports whether two IPv4 ranges share at least one address.
+// Ranges with unparseable bounds are treated as non-overlapping.
+func dhcpRangesOverlap(a, b domain.DHCPRange) bool {
+	aStart, aEnd := net.ParseIP(a.StartIP).To4(), net.ParseIP(a.EndIP).To4()
+	bStart, bEnd := net.ParseIP(b.StartIP).To4(), net.ParseIP(b.EndIP).To4()
+	if aStart == nil || aEnd == nil || bStart == nil || bEnd == nil {
+		return false
+	}
+	return bytes.Compare(aStart, bEnd) <= 0 && bytes.Compare(bStart, aEnd) <= 0
+}
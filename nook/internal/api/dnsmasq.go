@@ -0,0 +1,51 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/jbweber/homelab/nook/internal/domain"
+)
+
+// renderDnsmasqConfig renders a dnsmasq configuration fragment for a network: one
+// dhcp-range per DHCP range, router and DNS options, a server line per upstream
+// DNS forwarder, and a dhcp-host line per MAC reservation. Output is deterministic for a given input so it can be diffed.
+func renderDnsmasqConfig(network domain.Network, ranges []domain.DHCPRange, reservations []domain.MACReservation) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# nook: network %s (%s)\n", network.Name, network.Subnet)
+
+	netmask := ""
+	if _, subnet, err := net.ParseCIDR(network.Subnet); err == nil {
+		netmask = net.IP(subnet.Mask).String()
+	}
+	for _, r := range ranges {
+		fields := []string{r.StartIP, r.EndIP}
+		if netmask != "" {
+			fields = append(fields, netmask)
+		}
+		if r.LeaseTime != "" {
+			fields = append(fields, r.LeaseTime)
+		}
+		fmt.Fprintf(&b, "dhcp-range=%s\n", strings.Join(fields, ","))
+	}
+
+	if network.Gateway != "" {
+		fmt.Fprintf(&b, "dhcp-option=option:router,%s\n", network.Gateway)
+	}
+	if dns := splitDNSServers(network.DNSServers); len(dns) > 0 {
+		fmt.Fprintf(&b, "dhcp-option=option:dns-server,%s\n", strings.Join(dns, ","))
+	}
+	for _, forwarder := range splitDNSServers(network.DNSForwarders) {
+		fmt.Fprintf(&b, "server=%s\n", forwarder)
+	}
+
+	for _, res := range reservations {
+		if res.Hostname != "" {
+			fmt.Fprintf(&b, "dhcp-host=%s,%s,%s\n", res.MAC, res.IPAddress, res.Hostname)
+		} else {
+			fmt.Fprintf(&b, "dhcp-host=%s,%s\n", res.MAC, res.IPAddress)
+		}
+	}
+	return b.String()
+}
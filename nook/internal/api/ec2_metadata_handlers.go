@@ -0,0 +1,49 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// EC2MetaDataPrefix is the dated path EC2 IMDS clients request meta-data under
+const EC2MetaDataPrefix = "/2021-01-03/meta-data"
+
+// EC2LatestMetaDataPrefix is the undated alias of EC2MetaDataPrefix that
+// cloud-init and most tools request by default. Both serve the same handlers.
+const EC2LatestMetaDataPrefix = "/latest/meta-data"
+
+// EC2MetaDataDirectoryHandler handles GET /2021-01-03/meta-data/ (and its
+// /latest alias) with the newline-delimited listing IMDS clients read first:
+// the metaDataKeys marked EC2. Each has the same meaning as under /meta-data/
+// and is rendered by MetaDataKeyHandler, so a machine sees the same values
+// through both.
+func (m *MetaData) EC2MetaDataDirectoryHandler(w http.ResponseWriter, r *http.Request) {
+	var dir strings.Builder
+	for _, key := range metaDataKeys {
+		if key.EC2 {
+			dir.WriteString(key.Name + "\n")
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte(dir.String())); err != nil {
+		log.Printf("failed to write EC2 meta-data directory response: %v", err)
+	}
+}
+
+// EC2MetaDataKeyHandler handles GET /2021-01-03/meta-data/{key} (and its /latest
+// alias) for the keys in the EC2 listing, looking the machine up by client IP.
+// Other keys get 404.
+func (m *MetaData) EC2MetaDataKeyHandler(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "key")
+	if !slices.ContainsFunc(metaDataKeys, func(k MetaDataKey) bool { return k.EC2 && k.Name == key }) {
+		log.Printf("unknown EC2 metadata key requested: %s", key)
+		http.Error(w, "unknown metadata key", http.StatusNotFound)
+		return
+	}
+	m.MetaDataKeyHandler(w, r)
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jbweber/homelab/nook/internal/config"
+	"github.com/jbweber/homelab/nook/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupEC2TestRouter(t *testing.T, name string, cfg *config.Config) (http.Handler, int64) {
+	t.Helper()
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, name)
+	t.Cleanup(cleanup)
+
+	res, err := db.Exec("INSERT INTO machines (name, hostname, ipv4) VALUES (?, ?, ?)", "web", "web01", "192.168.1.50")
+	require.NoError(t, err)
+	id, err := res.LastInsertId()
+	require.NoError(t, err)
+
+	api, err := NewAPIWithConfig(db, cfg)
+	require.NoError(t, err)
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+	return r, id
+}
+
+func getFrom(r http.Handler, path, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	req.RemoteAddr = remoteAddr
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestEC2MetaDataDirectoryHandler(t *testing.T) {
+	r, _ := setupEC2TestRouter(t, "TestEC2MetaDataDirectoryHandler", config.NewConfig())
+
+	for _, path := range []string{"/2021-01-03/meta-data/", "/2021-01-03/meta-data", "/latest/meta-data/", "/latest/meta-data"} {
+		w := getFrom(r, path, "192.168.1.50:12345")
+		require.Equal(t, http.StatusOK, w.Code, path)
+		assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Equal(t, "instance-id\nhostname\nlocal-hostname\nlocal-ipv4\n", w.Body.String())
+	}
+}
+
+func TestEC2MetaDataKeyHandler(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.Domain = "lab.example.com"
+	r, id := setupEC2TestRouter(t, "TestEC2MetaDataKeyHandler", cfg)
+
+	tests := map[string]string{
+		"instance-id":    InstanceID(id),
+		"hostname":       "web01.lab.example.com",
+		"local-hostname": "web01.lab.example.com",
+		"local-ipv4":     "192.168.1.50",
+	}
+	for key, want := range tests {
+		t.Run(key, func(t *testing.T) {
+			w := getFrom(r, "/2021-01-03/meta-data/"+key, "192.168.1.50:12345")
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, want+"\n", w.Body.String())
+		})
+	}
+
+	t.Run("LatestAlias", func(t *testing.T) {
+		for key := range tests {
+			dated := getFrom(r, "/2021-01-03/meta-data/"+key, "192.168.1.50:12345")
+			latest := getFrom(r, "/latest/meta-data/"+key, "192.168.1.50:12345")
+			require.Equal(t, http.StatusOK, latest.Code, key)
+			assert.Equal(t, dated.Body.String(), latest.Body.String(), key)
+		}
+		w := getFrom(r, "/latest/meta-data/subnet-cidr", "192.168.1.50:12345")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("UnknownMachine", func(t *testing.T) {
+		w := getFrom(r, "/2021-01-03/meta-data/instance-id", "203.0.113.9:12345")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "machine not found")
+	})
+
+	t.Run("UnlistedKey", func(t *testing.T) {
+		// Served under /meta-data/ but not part of the EC2 listing
+		w := getFrom(r, "/2021-01-03/meta-data/subnet-cidr", "192.168.1.50:12345")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "unknown metadata key")
+	})
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditionalGET_MetadataEndpoints(t *testing.T) {
+	r := setupTestAPI(t)
+	req := httptest.NewRequest("POST", "/api/v0/machines", strings.NewReader(`{"name":"etag-machine","hostname":"etag-host","ipv4":"192.168.1.150"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	get := func(path, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = "192.168.1.150:40000"
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, path := range []string{"/meta-data", "/user-data"} {
+		t.Run(path, func(t *testing.T) {
+			first := get(path, "")
+			require.Equal(t, http.StatusOK, first.Code)
+			etag := first.Header().Get("ETag")
+			require.NotEmpty(t, etag)
+			assert.NotEmpty(t, first.Body.String())
+
+			// Unchanged state renders the same tag
+			assert.Equal(t, etag, get(path, "").Header().Get("ETag"))
+
+			w := get(path, etag)
+			assert.Equal(t, http.StatusNotModified, w.Code)
+			assert.Empty(t, w.Body.String())
+			assert.Equal(t, etag, w.Header().Get("ETag"))
+
+			// A weak or listed validator matches too; a stale one does not
+			assert.Equal(t, http.StatusNotModified, get(path, `"stale", W/`+etag).Code)
+			assert.Equal(t, http.StatusOK, get(path, `"stale"`).Code)
+		})
+	}
+
+	// A change to the machine changes the tag
+	etag := get("/meta-data", "").Header().Get("ETag")
+	patch := httptest.NewRequest("PATCH", "/api/v0/machines/1", strings.NewReader(`{"hostname":"renamed"}`))
+	patch.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, patch)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, http.StatusOK, get("/meta-data", etag).Code)
+}
+
+func TestConditionalGET_ErrorsAreNotTagged(t *testing.T) {
+	r := setupTestAPI(t)
+	req := httptest.NewRequest("GET", "/meta-data", nil)
+	req.RemoteAddr = "192.168.1.250:40000"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, w.Header().Get("ETag"))
+}
+
+func TestEtagMatches(t *testing.T) {
+	etag := `"42"`
+	assert.True(t, etagMatches(`"42"`, etag))
+	assert.True(t, etagMatches(`W/"42"`, etag))
+	assert.True(t, etagMatches(`"1", "42"`, etag))
+	assert.True(t, etagMatches(`*`, etag))
+	assert.False(t, etagMatches(``, etag))
+	assert.False(t, etagMatches(`"4"`, etag))
+}
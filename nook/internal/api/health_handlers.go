@@ -0,0 +1,67 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/jbweber/homelab/nook/internal/migrations"
+)
+
+// HealthResponse is the body of GET /healthz
+type HealthResponse struct {
+	Status                string `json:"status"` // "ok" or "unavailable"
+	SchemaVersion         int64  `json:"schema_version"`
+	ExpectedSchemaVersion int64  `json:"expected_schema_version"`
+	Error                 string `json:"error,omitempty"` // What failed when unavailable
+}
+
+// expectedSchemaVersion returns the version of the newest registered migration
+func expectedSchemaVersion() int64 {
+	var latest int64
+	for _, migration := range migrations.GetInitialMigrations() {
+		latest = max(latest, migration.Version)
+	}
+	return latest
+}
+
+// healthzHandler handles GET /healthz for liveness and readiness probes. It
+// returns 200 when the database answers a ping and its schema is at the
+// version this binary expects, otherwise 503 with the failure in the body.
+func (a *API) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	resp := HealthResponse{Status: "ok", ExpectedSchemaVersion: expectedSchemaVersion()}
+	if err := a.checkHealth(r.Context(), &resp); err != nil {
+		log.Printf("health check failed: %v", err)
+		resp.Status = "unavailable"
+		resp.Error = err.Error()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if resp.Error != "" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("failed to encode health response: %v", err)
+	}
+}
+
+// checkHealth pings the database and records its schema version in resp
+func (a *API) checkHealth(ctx context.Context, resp *HealthResponse) error {
+	if a.db == nil {
+		return fmt.Errorf("no database handle")
+	}
+	if err := a.db.Ping(); err != nil {
+		return fmt.Errorf("database ping failed: %w", err)
+	}
+	version, err := a.SchemaVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	resp.SchemaVersion = version
+	if version != resp.ExpectedSchemaVersion {
+		return fmt.Errorf("schema version %d, expected %d", version, resp.ExpectedSchemaVersion)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jbweber/homelab/nook/internal/migrations"
+	"github.com/jbweber/homelab/nook/internal/testutil"
+)
+
+func getHealthz(t *testing.T, api *API) (int, HealthResponse) {
+	t.Helper()
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+	req := httptest.NewRequest("GET", "/healthz", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var resp HealthResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	return w.Code, resp
+}
+
+func TestHealthzHandler_Healthy(t *testing.T) {
+	api, cleanup := setupIntegrationTestAPI(t)
+	defer cleanup()
+
+	code, resp := getHealthz(t, api)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", resp.Status)
+	all := migrations.GetInitialMigrations()
+	assert.Equal(t, all[len(all)-1].Version, resp.SchemaVersion)
+	assert.Equal(t, resp.SchemaVersion, resp.ExpectedSchemaVersion)
+	assert.Empty(t, resp.Error)
+}
+
+func TestHealthzHandler_ClosedDatabase(t *testing.T) {
+	api, cleanup := setupIntegrationTestAPI(t)
+	defer cleanup()
+	require.NoError(t, api.db.Close())
+
+	code, resp := getHealthz(t, api)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "unavailable", resp.Status)
+	assert.Contains(t, resp.Error, "database ping failed")
+}
+
+func TestHealthzHandler_StaleSchema(t *testing.T) {
+	db, cleanup := testutil.SetupTestDB(t, "TestHealthzHandler_StaleSchema")
+	defer cleanup()
+
+	migrator := migrations.NewMigrator(db)
+	for _, migration := range migrations.GetInitialMigrations() {
+		if migration.Version <= 12 {
+			migrator.AddMigration(migration)
+		}
+	}
+	require.NoError(t, migrator.RunMigrations())
+
+	code, resp := getHealthz(t, NewAPI(db))
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, int64(12), resp.SchemaVersion)
+	assert.Contains(t, resp.Error, "expected")
+}
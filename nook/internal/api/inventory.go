@@ -0,0 +1,318 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/jbweber/homelab/nook/internal/domain"
+	"github.com/jbweber/homelab/nook/internal/repository"
+	"gopkg.in/yaml.v3"
+)
+
+// Inventory is a portable description of networks, machines and their SSH keys.
+// Machines reference networks by name so a file can be written by hand.
+type Inventory struct {
+	Networks []InventoryNetwork `json:"networks" yaml:"networks"`
+	Machines []InventoryMachine `json:"machines" yaml:"machines"`
+}
+
+// InventoryNetwork describes a network and its DHCP ranges
+type InventoryNetwork struct {
+	Name               string               `json:"name" yaml:"name"`
+	Bridge             string               `json:"bridge" yaml:"bridge"`
+	Subnet             string               `json:"subnet" yaml:"subnet"`
+	Gateway            string               `json:"gateway,omitempty" yaml:"gateway,omitempty"`
+	DNSServers         string               `json:"dns_servers,omitempty" yaml:"dns_servers,omitempty"`
+	DNSForwarders      string               `json:"dns_forwarders,omitempty" yaml:"dns_forwarders,omitempty"`
+	Description        string               `json:"description,omitempty" yaml:"description,omitempty"`
+	AllocationStrategy string               `json:"allocation_strategy,omitempty" yaml:"allocation_strategy,omitempty"` // "lowest" (default) or "random"
+	MTU                int                  `json:"mtu,omitempty" yaml:"mtu,omitempty"`
+	DHCPRanges         []InventoryDHCPRange `json:"dhcp_ranges,omitempty" yaml:"dhcp_ranges,omitempty"`
+}
+
+// InventoryDHCPRange describes a DHCP range within an inventory network
+type InventoryDHCPRange struct {
+	StartIP   string `json:"start_ip" yaml:"start_ip"`
+	EndIP     string `json:"end_ip" yaml:"end_ip"`
+	LeaseTime string `json:"lease_time,omitempty" yaml:"lease_time,omitempty"`
+}
+
+// InventoryMachine describes a machine. Either IPv4 is set for a static address,
+// or Network names the network to allocate an address from.
+type InventoryMachine struct {
+	Name             string   `json:"name" yaml:"name"`
+	Hostname         string   `json:"hostname" yaml:"hostname"`
+	IPv4             string   `json:"ipv4,omitempty" yaml:"ipv4,omitempty"`
+	Network          string   `json:"network,omitempty" yaml:"network,omitempty"`
+	AvailabilityZone string   `json:"availability_zone,omitempty" yaml:"availability_zone,omitempty"`
+	MTU              int      `json:"mtu,omitempty" yaml:"mtu,omitempty"` // Overrides the network's MTU
+	SSHKeys          []string `json:"ssh_keys,omitempty" yaml:"ssh_keys,omitempty"`
+	RunCmd           []string `json:"runcmd,omitempty" yaml:"runcmd,omitempty"`
+}
+
+// ImportResult counts what an inventory import or backup restore created
+type ImportResult struct {
+	Networks   int `json:"networks"`
+	DHCPRanges int `json:"dhcp_ranges"`
+	Machines   int `json:"machines"`
+	SSHKeys    int `json:"ssh_keys"`
+	Leases     int `json:"leases,omitempty"` // Only set by a backup restore
+}
+
+// LoadInventoryFile reads an inventory from a JSON or YAML file, chosen by extension.
+func LoadInventoryFile(path string) (*Inventory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inventory file: %w", err)
+	}
+
+	var inv Inventory
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &inv); err != nil {
+			return nil, fmt.Errorf("failed to parse YAML inventory: %w", err)
+		}
+	default:
+		if err := json.Unmarshal(data, &inv); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON inventory: %w", err)
+		}
+	}
+	return &inv, nil
+}
+
+// ImportInventory creates the networks, DHCP ranges, machines and SSH keys described
+// by inv, in dependency order and in a single transaction: either everything is
+// created or nothing is.
+func (a *API) ImportInventory(ctx context.Context, inv *Inventory) (*ImportResult, error) {
+	if a.db == nil {
+		return nil, fmt.Errorf("import unavailable without a database handle")
+	}
+
+	result := &ImportResult{}
+	networks := make([]repository.InventoryNetwork, 0, len(inv.Networks))
+	for _, n := range inv.Networks {
+		network := repository.InventoryNetwork{Network: domain.Network{
+			Name:               n.Name,
+			Bridge:             n.Bridge,
+			Subnet:             n.Subnet,
+			Gateway:            n.Gateway,
+			DNSServers:         n.DNSServers,
+			DNSForwarders:      n.DNSForwarders,
+			Description:        n.Description,
+			AllocationStrategy: n.AllocationStrategy,
+			MTU:                n.MTU,
+		}}
+		for _, r := range n.DHCPRanges {
+			leaseTime := r.LeaseTime
+			if leaseTime == "" {
+				leaseTime = "24h"
+			}
+			network.DHCPRanges = append(network.DHCPRanges, domain.DHCPRange{StartIP: r.StartIP, EndIP: r.EndIP, LeaseTime: leaseTime})
+		}
+		networks = append(networks, network)
+		result.Networks++
+		result.DHCPRanges += len(n.DHCPRanges)
+	}
+
+	machines := make([]repository.InventoryMachine, 0, len(inv.Machines))
+	for _, m := range inv.Machines {
+		for _, key := range m.SSHKeys {
+			if err := validateSSHPublicKey(key); err != nil {
+				return nil, fmt.Errorf("invalid SSH key for machine %q: %w", m.Name, err)
+			}
+		}
+		machines = append(machines, repository.InventoryMachine{
+			Machine: domain.Machine{Name: m.Name, Hostname: m.Hostname, IPv4: m.IPv4, AvailabilityZone: m.AvailabilityZone, MTU: m.MTU, RunCmd: m.RunCmd},
+			Network: m.Network,
+			SSHKeys: m.SSHKeys,
+		})
+		result.Machines++
+		result.SSHKeys += len(m.SSHKeys)
+	}
+
+	if err := repository.NewInventoryRepository(a.db, a.sshKeyRepo).Import(ctx, networks, machines); err != nil {
+		return nil, err
+	}
+	// Imported machines may have been cached as missing
+	a.machineRepo.Invalidate()
+	return result, nil
+}
+
+// ValidateInventory runs every check an import depends on without writing
+// anything: required fields, name and IPv4 uniqueness against the file and the
+// database, subnet containment, network references and SSH key encoding. It
+// returns one message per problem; an empty result means the import should succeed.
+func (a *API) ValidateInventory(ctx context.Context, inv *Inventory) ([]string, error) {
+	problems := []string{}
+	addf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	subnets := make(map[string]*net.IPNet, len(inv.Networks))
+	for i, n := range inv.Networks {
+		label := fmt.Sprintf("network %d (%q)", i, n.Name)
+		if n.Name == "" {
+			addf("%s: name is required", label)
+		} else if _, dup := subnets[n.Name]; dup {
+			addf("%s: name is repeated in the import", label)
+		} else if _, err := a.networkRepo.FindByName(ctx, n.Name); err == nil {
+			addf("%s: a network with this name already exists", label)
+		} else if !errors.Is(err, repository.ErrNotFound) {
+			return nil, fmt.Errorf("failed to look up network %q: %w", n.Name, err)
+		}
+		if !domain.ValidBridgeName(n.Bridge) {
+			addf("%s: bridge %q is not a valid interface name", label, n.Bridge)
+		}
+		if !domain.ValidAllocationStrategy(n.AllocationStrategy) {
+			addf("%s: unknown allocation_strategy %q", label, n.AllocationStrategy)
+		}
+		if !domain.ValidMTU(n.MTU) {
+			addf("%s: mtu must be between %d and %d", label, domain.MinMTU, domain.MaxMTU)
+		}
+
+		_, subnet, err := net.ParseCIDR(n.Subnet)
+		if err != nil {
+			addf("%s: subnet %q is not a valid CIDR", label, n.Subnet)
+		} else {
+			if n.Gateway != "" && !subnet.Contains(net.ParseIP(n.Gateway)) {
+				addf("%s: gateway %s is outside subnet %s", label, n.Gateway, n.Subnet)
+			}
+			ranges := make([]domain.DHCPRange, len(n.DHCPRanges))
+			for j, r := range n.DHCPRanges {
+				ranges[j] = domain.DHCPRange{StartIP: r.StartIP, EndIP: r.EndIP}
+			}
+			for _, p := range validateDHCPRangeBatch(domain.Network{Subnet: n.Subnet}, nil, ranges) {
+				addf("%s: DHCP %s", label, p)
+			}
+		}
+		if n.Name != "" {
+			subnets[n.Name] = subnet
+		}
+	}
+
+	names := make(map[string]bool, len(inv.Machines))
+	ips := make(map[string]string, len(inv.Machines))
+	for i, m := range inv.Machines {
+		label := fmt.Sprintf("machine %d (%q)", i, m.Name)
+		if m.Name == "" {
+			addf("%s: name is required", label)
+		} else if names[m.Name] {
+			addf("%s: name is repeated in the import", label)
+		} else if _, err := a.machineRepo.FindByName(ctx, m.Name); err == nil {
+			addf("%s: a machine with this name already exists", label)
+		} else if !errors.Is(err, repository.ErrNotFound) {
+			return nil, fmt.Errorf("failed to look up machine %q: %w", m.Name, err)
+		}
+		names[m.Name] = true
+		if m.Hostname == "" {
+			addf("%s: hostname is required", label)
+		}
+		if !domain.ValidMTU(m.MTU) {
+			addf("%s: mtu must be between %d and %d", label, domain.MinMTU, domain.MaxMTU)
+		}
+		if slices.Contains(m.RunCmd, "") {
+			addf("%s: runcmd entries must not be empty", label)
+		}
+
+		var subnet *net.IPNet
+		if m.Network != "" {
+			var inFile bool
+			if subnet, inFile = subnets[m.Network]; !inFile {
+				existing, err := a.networkRepo.FindByName(ctx, m.Network)
+				switch {
+				case errors.Is(err, repository.ErrNotFound):
+					addf("%s: references unknown network %q", label, m.Network)
+				case err != nil:
+					return nil, fmt.Errorf("failed to look up network %q: %w", m.Network, err)
+				default:
+					_, subnet, _ = net.ParseCIDR(existing.Subnet)
+				}
+			}
+		}
+
+		switch {
+		case m.IPv4 == "" && m.Network == "":
+			addf("%s: either ipv4 or network is required", label)
+		case m.IPv4 == "":
+			// Allocated from the network at import time
+		case net.ParseIP(m.IPv4).To4() == nil:
+			addf("%s: ipv4 %q is not a valid IPv4 address", label, m.IPv4)
+		default:
+			if other, dup := ips[m.IPv4]; dup {
+				addf("%s: ipv4 %s is also assigned to %q in the import", label, m.IPv4, other)
+			} else if existing, err := a.machineRepo.FindByIPv4(ctx, m.IPv4); err == nil {
+				addf("%s: ipv4 %s is already used by machine %q", label, m.IPv4, existing.Name)
+			} else if !errors.Is(err, repository.ErrNotFound) {
+				return nil, fmt.Errorf("failed to look up IPv4 %s: %w", m.IPv4, err)
+			}
+			ips[m.IPv4] = m.Name
+			if subnet != nil && !subnet.Contains(net.ParseIP(m.IPv4)) {
+				addf("%s: ipv4 %s is outside network %q (%s)", label, m.IPv4, m.Network, subnet)
+			}
+		}
+
+		for j, key := range m.SSHKeys {
+			if err := validateSSHPublicKey(key); err != nil {
+				addf("%s: ssh_keys[%d]: %v", label, j, err)
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+// SeedFromFile imports the inventory at path, but only when no networks, machines or
+// SSH keys exist yet. It reports whether seeding took place. The inventory is
+// validated as a dry-run import would be, and then imported in one transaction,
+// so a bad seed file leaves the database empty.
+func (a *API) SeedFromFile(path string) (bool, error) {
+	empty, err := a.isInventoryEmpty()
+	if err != nil {
+		return false, err
+	}
+	if !empty {
+		return false, nil
+	}
+
+	inv, err := LoadInventoryFile(path)
+	if err != nil {
+		return false, err
+	}
+	problems, err := a.ValidateInventory(context.Background(), inv)
+	if err != nil {
+		return false, err
+	}
+	if len(problems) > 0 {
+		return false, fmt.Errorf("invalid seed file %s: %s", path, strings.Join(problems, "; "))
+	}
+	if _, err := a.ImportInventory(context.Background(), inv); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// isInventoryEmpty reports whether the networks, machines and SSH keys tables are all empty.
+func (a *API) isInventoryEmpty() (bool, error) {
+	ctx := context.Background()
+
+	networks, err := a.networkRepo.FindAll(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to list networks: %w", err)
+	}
+	machines, err := a.machineRepo.FindAll(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to list machines: %w", err)
+	}
+	keys, err := a.sshKeyRepo.FindAll(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to list SSH keys: %w", err)
+	}
+	return len(networks) == 0 && len(machines) == 0 && len(keys) == 0, nil
+}
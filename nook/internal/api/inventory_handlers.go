@@ -0,0 +1,95 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+)
+
+// InventoryStore defines the datastore interface for the inventory import handler
+type InventoryStore interface {
+	ValidateInventory(ctx context.Context, inv *Inventory) ([]string, error)
+	ImportInventory(ctx context.Context, inv *Inventory) (*ImportResult, error)
+	BackupStore
+}
+
+// InventoryImport groups handlers for bulk inventory import
+type InventoryImport struct {
+	store   InventoryStore
+	backups *Backups // Restores bodies in BackupFormat
+}
+
+// NewInventoryImport creates a new InventoryImport instance with the given store.
+func NewInventoryImport(store InventoryStore) *InventoryImport {
+	return &InventoryImport{store: store, backups: NewBackups(store)}
+}
+
+// ImportResponse reports the outcome of POST /api/v0/import. Problems lists every
+// validation failure; Result is set only when the import was written.
+type ImportResponse struct {
+	DryRun   bool          `json:"dry_run"`
+	Problems []string      `json:"problems"`
+	Result   *ImportResult `json:"result,omitempty"`
+}
+
+// ImportHandler handles POST /api/v0/import with an Inventory JSON body. The whole
+// inventory is validated first and nothing is written if any problem is found
+// (400). With ?dry_run=true the validation result is returned (200) and nothing is
+// ever written. A body whose "format" is BackupFormat is restored as a full backup
+// instead; see Backups.RestoreHandler.
+func (i *InventoryImport) ImportHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	var envelope struct {
+		Format string `json:"format"`
+	}
+	if json.Unmarshal(body, &envelope) == nil && envelope.Format == BackupFormat {
+		i.backups.RestoreHandler(w, r)
+		return
+	}
+
+	var inv Inventory
+	if err := decodeJSONBody(r, &inv); err != nil {
+		http.Error(w, jsonErrorMessage(err, "invalid JSON"), http.StatusBadRequest)
+		return
+	}
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	problems, err := i.store.ValidateInventory(r.Context(), &inv)
+	if err != nil {
+		log.Printf("failed to validate inventory: %v", err)
+		http.Error(w, "failed to validate inventory", http.StatusInternalServerError)
+		return
+	}
+
+	response := ImportResponse{DryRun: dryRun, Problems: problems}
+	status := http.StatusOK
+	switch {
+	case dryRun:
+	case len(problems) > 0:
+		status = http.StatusBadRequest
+	default:
+		result, err := i.store.ImportInventory(r.Context(), &inv)
+		if err != nil {
+			log.Printf("failed to import inventory: %v", err)
+			http.Error(w, "failed to import inventory", http.StatusInternalServerError)
+			return
+		}
+		response.Result = result
+		status = http.StatusCreated
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("failed to encode import response: %v", err)
+	}
+}
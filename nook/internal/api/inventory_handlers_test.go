@@ -0,0 +1,110 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func postImport(t *testing.T, r http.Handler, path string, inv Inventory) (int, ImportResponse) {
+	t.Helper()
+	body, err := json.Marshal(inv)
+	require.NoError(t, err)
+	req := httptest.NewRequest("POST", path, bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var resp ImportResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp), "status %d", w.Code)
+	return w.Code, resp
+}
+
+func TestImportHandler_DryRunClean(t *testing.T) {
+	api, cleanup := setupIntegrationTestAPI(t)
+	defer cleanup()
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+
+	inv := Inventory{
+		Networks: []InventoryNetwork{{
+			Name: "lab", Bridge: "br-lab", Subnet: "192.168.60.0/24", Gateway: "192.168.60.1",
+			DHCPRanges: []InventoryDHCPRange{{StartIP: "192.168.60.100", EndIP: "192.168.60.120"}},
+		}},
+		Machines: []InventoryMachine{
+			{Name: "static", Hostname: "static", IPv4: "192.168.60.10", Network: "lab", SSHKeys: []string{testEd25519Key}},
+			{Name: "dynamic", Hostname: "dynamic", Network: "lab"},
+		},
+	}
+
+	code, resp := postImport(t, r, "/api/v0/import?dry_run=true", inv)
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, resp.DryRun)
+	assert.Empty(t, resp.Problems)
+	assert.Nil(t, resp.Result)
+
+	// Nothing was written
+	networks, err := api.ListNetworks(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, networks)
+	machine, err := api.GetMachineByName(context.Background(), "static")
+	require.NoError(t, err)
+	assert.Nil(t, machine)
+
+	// The same inventory then imports for real
+	code, resp = postImport(t, r, "/api/v0/import", inv)
+	assert.Equal(t, http.StatusCreated, code)
+	require.NotNil(t, resp.Result)
+	assert.Equal(t, ImportResult{Networks: 1, DHCPRanges: 1, Machines: 2, SSHKeys: 1}, *resp.Result)
+}
+
+func TestImportHandler_DryRunConflicts(t *testing.T) {
+	api, cleanup := setupIntegrationTestAPI(t)
+	defer cleanup()
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+
+	_, err := api.db.Exec("INSERT INTO machines (name, hostname, ipv4) VALUES (?, ?, ?)", "existing", "existing", "192.168.60.5")
+	require.NoError(t, err)
+
+	inv := Inventory{
+		Networks: []InventoryNetwork{{
+			Name: "lab", Bridge: "br-lab", Subnet: "192.168.60.0/24",
+			DHCPRanges: []InventoryDHCPRange{{StartIP: "192.168.61.1", EndIP: "192.168.61.10"}},
+		}},
+		Machines: []InventoryMachine{
+			{Name: "existing", Hostname: "dup-name", IPv4: "192.168.60.20"},
+			{Name: "taken-ip", Hostname: "taken-ip", IPv4: "192.168.60.5"},
+			{Name: "twin-a", Hostname: "twin-a", IPv4: "192.168.60.30"},
+			{Name: "twin-b", Hostname: "twin-b", IPv4: "192.168.60.30"},
+			{Name: "outside", Hostname: "outside", IPv4: "10.0.0.5", Network: "lab"},
+			{Name: "lost", Hostname: "lost", Network: "missing"},
+			{Name: "bad-key", Hostname: "bad-key", IPv4: "192.168.60.40", SSHKeys: []string{"ssh-ed25519 not-base64!"}},
+		},
+	}
+
+	code, resp := postImport(t, r, "/api/v0/import?dry_run=true", inv)
+	assert.Equal(t, http.StatusOK, code)
+	require.Len(t, resp.Problems, 7, "%v", resp.Problems)
+	assert.Contains(t, resp.Problems[0], "outside subnet")
+	assert.Contains(t, resp.Problems[1], "a machine with this name already exists")
+	assert.Contains(t, resp.Problems[2], `already used by machine "existing"`)
+	assert.Contains(t, resp.Problems[3], `also assigned to "twin-a"`)
+	assert.Contains(t, resp.Problems[4], `outside network "lab"`)
+	assert.Contains(t, resp.Problems[5], `unknown network "missing"`)
+	assert.Contains(t, resp.Problems[6], "ssh_keys[0]")
+
+	// Without dry_run the problems are reported and nothing is written
+	code, resp = postImport(t, r, "/api/v0/import", inv)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Len(t, resp.Problems, 7)
+	networks, err := api.ListNetworks(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, networks)
+}
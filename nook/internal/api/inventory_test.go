@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jbweber/homelab/nook/internal/domain"
+	"github.com/jbweber/homelab/nook/internal/repository"
+	"github.com/jbweber/homelab/nook/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const seedYAML = `networks:
+  - name: lab
+    bridge: br0
+    subnet: 192.168.50.0/24
+    gateway: 192.168.50.1
+    dhcp_ranges:
+      - start_ip: 192.168.50.100
+        end_ip: 192.168.50.110
+machines:
+  - name: static
+    hostname: static.lab
+    ipv4: 192.168.50.10
+    ssh_keys:
+      - ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIANouT6bm3M64JS2lG6+nCXap4+kVrib1kbW45BbBuuK static@lab
+  - name: dynamic
+    hostname: dynamic.lab
+    network: lab
+`
+
+func writeSeedFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestSeedFromFile_EmptyDatabase(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestSeedFromFile_EmptyDatabase")
+	defer cleanup()
+	api := NewAPI(db)
+
+	seeded, err := api.SeedFromFile(writeSeedFile(t, "seed.yaml", seedYAML))
+	require.NoError(t, err)
+	assert.True(t, seeded)
+
+	networks, err := api.ListNetworks(context.Background())
+	require.NoError(t, err)
+	require.Len(t, networks, 1)
+	assert.Equal(t, "lab", networks[0].Name)
+
+	ranges, err := api.GetDHCPRanges(context.Background(), networks[0].ID)
+	require.NoError(t, err)
+	assert.Len(t, ranges, 1)
+
+	static, err := api.GetMachineByName(context.Background(), "static")
+	require.NoError(t, err)
+	require.NotNil(t, static)
+	assert.Equal(t, "192.168.50.10", static.IPv4)
+
+	// Machines referencing a network get an address allocated from its DHCP range
+	dynamic, err := api.GetMachineByName(context.Background(), "dynamic")
+	require.NoError(t, err)
+	require.NotNil(t, dynamic)
+	assert.Equal(t, "192.168.50.100", dynamic.IPv4)
+
+	keys, err := api.ListAllSSHKeys(context.Background())
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, static.ID, keys[0].MachineID)
+}
+
+func TestSeedFromFile_JSON(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestSeedFromFile_JSON")
+	defer cleanup()
+	api := NewAPI(db)
+
+	seed := `{"machines": [{"name": "json", "hostname": "json.lab", "ipv4": "10.0.0.5"}]}`
+	seeded, err := api.SeedFromFile(writeSeedFile(t, "seed.json", seed))
+	require.NoError(t, err)
+	assert.True(t, seeded)
+
+	machine, err := api.GetMachineByName(context.Background(), "json")
+	require.NoError(t, err)
+	require.NotNil(t, machine)
+	assert.Equal(t, "10.0.0.5", machine.IPv4)
+}
+
+func TestSeedFromFile_SkipsPopulatedDatabase(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestSeedFromFile_SkipsPopulatedDatabase")
+	defer cleanup()
+	api := NewAPI(db)
+
+	_, err := repository.NewMachineRepository(db).Save(context.Background(), domain.Machine{
+		Name: "existing", Hostname: "existing", IPv4: "10.0.0.1",
+	})
+	require.NoError(t, err)
+
+	seeded, err := api.SeedFromFile(writeSeedFile(t, "seed.yaml", seedYAML))
+	require.NoError(t, err)
+	assert.False(t, seeded)
+
+	machines, err := api.ListMachines(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, machines, 1)
+	networks, err := api.ListNetworks(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, networks)
+}
+
+func TestSeedFromFile_UnknownNetwork(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestSeedFromFile_UnknownNetwork")
+	defer cleanup()
+	api := NewAPI(db)
+
+	seed := `{"machines": [{"name": "lost", "hostname": "lost", "network": "nowhere"}]}`
+	_, err := api.SeedFromFile(writeSeedFile(t, "seed.json", seed))
+	assert.Error(t, err)
+}
+
+func TestSeedFromFile_FailureLeavesDatabaseEmpty(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestSeedFromFile_FailureLeavesDatabaseEmpty")
+	defer cleanup()
+	api := NewAPI(db)
+
+	// Valid, but the range only holds one of the two dynamic machines
+	seed := `{
+		"networks": [{"name": "tiny", "bridge": "br0", "subnet": "10.1.0.0/24", "dhcp_ranges": [{"start_ip": "10.1.0.10", "end_ip": "10.1.0.10"}]}],
+		"machines": [
+			{"name": "first", "hostname": "first", "network": "tiny"},
+			{"name": "second", "hostname": "second", "network": "tiny"}
+		]
+	}`
+	seeded, err := api.SeedFromFile(writeSeedFile(t, "seed.json", seed))
+	require.ErrorIs(t, err, repository.ErrInsufficientCapacity)
+	assert.False(t, seeded)
+
+	empty, err := api.isInventoryEmpty()
+	require.NoError(t, err)
+	assert.True(t, empty, "a failed seed must not leave a partial inventory behind")
+
+	// A fixed seed file applies on the next start
+	seeded, err = api.SeedFromFile(writeSeedFile(t, "seed.yaml", seedYAML))
+	require.NoError(t, err)
+	assert.True(t, seeded)
+}
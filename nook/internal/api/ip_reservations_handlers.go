@@ -0,0 +1,89 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jbweber/homelab/nook/internal/repository"
+)
+
+// maxReserveCount bounds a single reservation batch
+const maxReserveCount = 256
+
+// IPReservationResponse is a batch of addresses reserved together
+type IPReservationResponse struct {
+	Token     string   `json:"token"`
+	NetworkID int64    `json:"network_id"`
+	Addresses []string `json:"addresses"`
+}
+
+// ReserveIPAddressesHandler handles POST /api/v0/networks/{id}/reserve?count=N.
+// It reserves N free addresses from the network's DHCP ranges in one transaction
+// and returns them with the token that releases them. Reserved addresses are
+// skipped by allocation until released. If fewer than N are free it returns 409
+// and reserves nothing.
+func (n *Networks) ReserveIPAddressesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid network ID", http.StatusBadRequest)
+		return
+	}
+	count, err := strconv.Atoi(r.URL.Query().Get("count"))
+	if err != nil || count < 1 || count > maxReserveCount {
+		http.Error(w, fmt.Sprintf("count must be between 1 and %d", maxReserveCount), http.StatusBadRequest)
+		return
+	}
+	if _, err := n.store.GetNetwork(r.Context(), id); err != nil {
+		http.Error(w, "network not found", http.StatusNotFound)
+		return
+	}
+
+	reservations, err := n.store.ReserveIPAddresses(r.Context(), id, count)
+	if err != nil {
+		if errors.Is(err, repository.ErrInsufficientCapacity) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		log.Printf("failed to reserve %d addresses on network %d: %v", count, id, err)
+		http.Error(w, "failed to reserve addresses", http.StatusInternalServerError)
+		return
+	}
+
+	response := IPReservationResponse{NetworkID: id, Addresses: make([]string, len(reservations))}
+	for i, res := range reservations {
+		response.Token = res.Token
+		response.Addresses[i] = res.IPAddress
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("failed to encode reservation response: %v", err)
+	}
+}
+
+// ReleaseIPReservationsHandler handles DELETE /api/v0/networks/{id}/reserve/{token}
+// and returns the batch's addresses to the pool.
+func (n *Networks) ReleaseIPReservationsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid network ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := n.store.ReleaseIPReservations(r.Context(), id, chi.URLParam(r, "token")); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "reservation not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("failed to release reservations on network %d: %v", id, err)
+		http.Error(w, "failed to release reservations", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
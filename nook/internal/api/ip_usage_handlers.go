@@ -0,0 +1,61 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/jbweber/homelab/nook/internal/domain"
+)
+
+// IPUsageStore defines the datastore interface for the IP usage handler
+type IPUsageStore interface {
+	ListIPUsage(ctx context.Context) ([]domain.IPUsage, error)
+}
+
+// IPUsage groups handlers for deployment-wide IP auditing
+type IPUsage struct {
+	store IPUsageStore
+}
+
+// NewIPUsage creates a new IPUsage instance with the given store.
+func NewIPUsage(store IPUsageStore) *IPUsage {
+	return &IPUsage{store: store}
+}
+
+// IPUsageResponse is one in-use address in the GET /api/v0/ip-usage listing
+type IPUsageResponse struct {
+	IP          string `json:"ip"`
+	Source      string `json:"source"` // "static" or "lease"
+	MachineID   int64  `json:"machine_id"`
+	MachineName string `json:"machine_name"`
+	NetworkID   *int64 `json:"network_id,omitempty"`
+}
+
+// ListIPUsageHandler handles GET /api/v0/ip-usage and lists every address held by
+// a machine, statically or through a lease, sorted by IP.
+func (u *IPUsage) ListIPUsageHandler(w http.ResponseWriter, r *http.Request) {
+	usage, err := u.store.ListIPUsage(r.Context())
+	if err != nil {
+		log.Printf("failed to list IP usage: %v", err)
+		http.Error(w, "failed to list IP usage", http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]IPUsageResponse, len(usage))
+	for i, entry := range usage {
+		response[i] = IPUsageResponse{
+			IP:          entry.IPAddress,
+			Source:      entry.Source,
+			MachineID:   entry.MachineID,
+			MachineName: entry.MachineName,
+			NetworkID:   entry.NetworkID,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("failed to encode IP usage response: %v", err)
+	}
+}
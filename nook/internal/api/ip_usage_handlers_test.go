@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jbweber/homelab/nook/internal/domain"
+	"github.com/jbweber/homelab/nook/internal/repository"
+	"github.com/jbweber/homelab/nook/internal/testutil"
+)
+
+func TestIPUsage_ListIPUsageHandler(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestIPUsage_ListIPUsageHandler")
+	defer cleanup()
+
+	api := NewAPI(db)
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+
+	ctx := context.Background()
+	network, err := repository.NewNetworkRepository(db).Save(ctx, domain.Network{Name: "lab", Bridge: "br0", Subnet: "192.168.1.0/24"})
+	require.NoError(t, err)
+	_, err = repository.NewDHCPRangeRepository(db).Save(ctx, domain.DHCPRange{NetworkID: network.ID, StartIP: "192.168.1.100", EndIP: "192.168.1.110", LeaseTime: "24h"})
+	require.NoError(t, err)
+
+	// Static machines, named so text ordering would differ from numeric ordering
+	for name, ip := range map[string]string{"ten": "10.0.0.10", "nine": "10.0.0.9"} {
+		_, err := api.CreateMachine(context.Background(), Machine{Name: name, Hostname: name, IPv4: ip})
+		require.NoError(t, err)
+	}
+	leased, err := api.CreateMachine(context.Background(), Machine{Name: "leased", Hostname: "leased", NetworkID: &network.ID})
+	require.NoError(t, err)
+	require.Equal(t, "192.168.1.100", leased.IPv4)
+
+	req := httptest.NewRequest("GET", "/api/v0/ip-usage", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var usage []IPUsageResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&usage))
+	require.Len(t, usage, 3, "a leased machine's address is listed once")
+
+	assert.Equal(t, "10.0.0.9", usage[0].IP)
+	assert.Equal(t, "static", usage[0].Source)
+	assert.Equal(t, "nine", usage[0].MachineName)
+	assert.Nil(t, usage[0].NetworkID)
+
+	assert.Equal(t, "10.0.0.10", usage[1].IP)
+	assert.Equal(t, "static", usage[1].Source)
+	assert.Equal(t, "ten", usage[1].MachineName)
+
+	assert.Equal(t, "192.168.1.100", usage[2].IP)
+	assert.Equal(t, "lease", usage[2].Source)
+	assert.Equal(t, leased.ID, usage[2].MachineID)
+	require.NotNil(t, usage[2].NetworkID)
+	assert.Equal(t, network.ID, *usage[2].NetworkID)
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+type strictJSONKey struct{}
+
+// strictJSON returns middleware that marks requests for strict body decoding, in
+// which decodeJSONBody rejects unknown fields instead of silently ignoring them.
+func strictJSON(strict bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !strict {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), strictJSONKey{}, true)))
+		})
+	}
+}
+
+// decodeJSONBody decodes the request body into v, rejecting unknown fields when
+// the request was marked strict.
+func decodeJSONBody(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	if strict, _ := r.Context().Value(strictJSONKey{}).(bool); strict {
+		decoder.DisallowUnknownFields()
+	}
+	return decoder.Decode(v)
+}
+
+// jsonErrorMessage returns the client-facing message for a body decode error:
+// the offending field name for unknown fields, fallback for anything else.
+func jsonErrorMessage(err error, fallback string) string {
+	if msg := err.Error(); strings.HasPrefix(msg, "json: unknown field ") {
+		return strings.TrimPrefix(msg, "json: ")
+	}
+	return fallback
+}
@@ -0,0 +1,248 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/jbweber/homelab/nook/internal/domain"
+	"github.com/jbweber/homelab/nook/internal/repository"
+)
+
+// KeyGroupsStore defines the datastore interface for key group handlers
+type KeyGroupsStore interface {
+	ListKeyGroups(ctx context.Context) ([]domain.KeyGroup, error)
+	CreateKeyGroup(ctx context.Context, name string) (domain.KeyGroup, error)
+	DeleteKeyGroup(ctx context.Context, id int64) error
+	ListKeyGroupKeys(ctx context.Context, groupID int64) ([]domain.KeyGroupKey, error)
+	AddKeyGroupKey(ctx context.Context, groupID int64, keyText string) (domain.KeyGroupKey, error)
+	DeleteKeyGroupKey(ctx context.Context, groupID, keyID int64) error
+	ListKeyGroupMembers(ctx context.Context, groupID int64) ([]int64, error)
+	AddKeyGroupMember(ctx context.Context, groupID, machineID int64) error
+	RemoveKeyGroupMember(ctx context.Context, groupID, machineID int64) error
+}
+
+// KeyGroups groups handlers for SSH key groups, whose keys are installed on
+// every member machine alongside its own keys.
+type KeyGroups struct {
+	store KeyGroupsStore
+}
+
+// NewKeyGroups creates a new KeyGroups instance with the given store.
+func NewKeyGroups(store KeyGroupsStore) *KeyGroups {
+	return &KeyGroups{store: store}
+}
+
+// KeyGroupResponse is the JSON representation of a key group
+type KeyGroupResponse struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// KeyGroupKeyResponse is the JSON representation of a key in a group
+type KeyGroupKeyResponse struct {
+	ID      int64  `json:"id"`
+	GroupID int64  `json:"group_id"`
+	KeyText string `json:"key_text"`
+}
+
+// KeyGroupMembersResponse lists the machines in a key group
+type KeyGroupMembersResponse struct {
+	MachineIDs []int64 `json:"machine_ids"`
+}
+
+// writeKeyGroupError maps repository errors to HTTP status codes
+func writeKeyGroupError(w http.ResponseWriter, err error, action string) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.Is(err, repository.ErrDuplicate):
+		http.Error(w, "a key group with this name already exists", http.StatusConflict)
+	case errors.Is(err, repository.ErrInvalidEntity):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("failed to %s: %v", action, err)
+		http.Error(w, "failed to "+action, http.StatusInternalServerError)
+	}
+}
+
+// parseIDParam parses a numeric chi URL parameter, writing a 400 if it is invalid.
+func parseIDParam(w http.ResponseWriter, r *http.Request, name, label string) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, name), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid "+label, http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+func writeKeyGroupJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("failed to encode key group response: %v", err)
+	}
+}
+
+// ListKeyGroupsHandler handles GET /api/v0/key-groups
+func (k *KeyGroups) ListKeyGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	groups, err := k.store.ListKeyGroups(r.Context())
+	if err != nil {
+		writeKeyGroupError(w, err, "list key groups")
+		return
+	}
+	response := make([]KeyGroupResponse, len(groups))
+	for i, g := range groups {
+		response[i] = KeyGroupResponse{ID: g.ID, Name: g.Name}
+	}
+	writeKeyGroupJSON(w, http.StatusOK, response)
+}
+
+// CreateKeyGroupHandler handles POST /api/v0/key-groups with body {"name": "..."}
+func (k *KeyGroups) CreateKeyGroupHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := decodeJSONBody(r, &req); err != nil {
+		http.Error(w, jsonErrorMessage(err, "invalid JSON"), http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+
+	group, err := k.store.CreateKeyGroup(r.Context(), req.Name)
+	if err != nil {
+		writeKeyGroupError(w, err, "create key group")
+		return
+	}
+	writeKeyGroupJSON(w, http.StatusCreated, KeyGroupResponse{ID: group.ID, Name: group.Name})
+}
+
+// DeleteKeyGroupHandler handles DELETE /api/v0/key-groups/{id}
+func (k *KeyGroups) DeleteKeyGroupHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r, "id", "key group ID")
+	if !ok {
+		return
+	}
+	if err := k.store.DeleteKeyGroup(r.Context(), id); err != nil {
+		writeKeyGroupError(w, err, "delete key group")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListKeyGroupKeysHandler handles GET /api/v0/key-groups/{id}/keys
+func (k *KeyGroups) ListKeyGroupKeysHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r, "id", "key group ID")
+	if !ok {
+		return
+	}
+	keys, err := k.store.ListKeyGroupKeys(r.Context(), id)
+	if err != nil {
+		writeKeyGroupError(w, err, "list group keys")
+		return
+	}
+	response := make([]KeyGroupKeyResponse, len(keys))
+	for i, key := range keys {
+		response[i] = KeyGroupKeyResponse{ID: key.ID, GroupID: key.GroupID, KeyText: key.KeyText}
+	}
+	writeKeyGroupJSON(w, http.StatusOK, response)
+}
+
+// AddKeyGroupKeyHandler handles POST /api/v0/key-groups/{id}/keys with body {"key_text": "..."}
+func (k *KeyGroups) AddKeyGroupKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r, "id", "key group ID")
+	if !ok {
+		return
+	}
+	var req struct {
+		KeyText string `json:"key_text"`
+	}
+	if err := decodeJSONBody(r, &req); err != nil {
+		http.Error(w, jsonErrorMessage(err, "invalid JSON"), http.StatusBadRequest)
+		return
+	}
+	if req.KeyText == "" {
+		http.Error(w, "key_text is required", http.StatusBadRequest)
+		return
+	}
+
+	key, err := k.store.AddKeyGroupKey(r.Context(), id, req.KeyText)
+	if err != nil {
+		writeKeyGroupError(w, err, "add group key")
+		return
+	}
+	writeKeyGroupJSON(w, http.StatusCreated, KeyGroupKeyResponse{ID: key.ID, GroupID: key.GroupID, KeyText: key.KeyText})
+}
+
+// DeleteKeyGroupKeyHandler handles DELETE /api/v0/key-groups/{id}/keys/{keyId}
+func (k *KeyGroups) DeleteKeyGroupKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r, "id", "key group ID")
+	if !ok {
+		return
+	}
+	keyID, ok := parseIDParam(w, r, "keyId", "key ID")
+	if !ok {
+		return
+	}
+	if err := k.store.DeleteKeyGroupKey(r.Context(), id, keyID); err != nil {
+		writeKeyGroupError(w, err, "delete group key")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListKeyGroupMembersHandler handles GET /api/v0/key-groups/{id}/members
+func (k *KeyGroups) ListKeyGroupMembersHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r, "id", "key group ID")
+	if !ok {
+		return
+	}
+	members, err := k.store.ListKeyGroupMembers(r.Context(), id)
+	if err != nil {
+		writeKeyGroupError(w, err, "list group members")
+		return
+	}
+	writeKeyGroupJSON(w, http.StatusOK, KeyGroupMembersResponse{MachineIDs: members})
+}
+
+// AddKeyGroupMemberHandler handles PUT /api/v0/key-groups/{id}/members/{machineId}
+func (k *KeyGroups) AddKeyGroupMemberHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r, "id", "key group ID")
+	if !ok {
+		return
+	}
+	machineID, ok := parseIDParam(w, r, "machineId", "machine ID")
+	if !ok {
+		return
+	}
+	if err := k.store.AddKeyGroupMember(r.Context(), id, machineID); err != nil {
+		writeKeyGroupError(w, err, "add group member")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveKeyGroupMemberHandler handles DELETE /api/v0/key-groups/{id}/members/{machineId}
+func (k *KeyGroups) RemoveKeyGroupMemberHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r, "id", "key group ID")
+	if !ok {
+		return
+	}
+	machineID, ok := parseIDParam(w, r, "machineId", "machine ID")
+	if !ok {
+		return
+	}
+	if err := k.store.RemoveKeyGroupMember(r.Context(), id, machineID); err != nil {
+		writeKeyGroupError(w, err, "remove group member")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
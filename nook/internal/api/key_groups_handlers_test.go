@@ -0,0 +1,98 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyGroups_UserDataIncludesGroupKeys(t *testing.T) {
+	api, cleanup := setupIntegrationTestAPI(t)
+	defer cleanup()
+
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+
+	do := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			require.NoError(t, json.NewEncoder(&buf).Encode(body))
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	res, err := api.db.Exec("INSERT INTO machines (name, hostname, ipv4) VALUES (?, ?, ?)",
+		"group-member", "group-member", "192.168.1.80")
+	require.NoError(t, err)
+	machineID, _ := res.LastInsertId()
+	_, err = api.db.Exec("INSERT INTO machines (name, hostname, ipv4) VALUES (?, ?, ?)",
+		"outsider", "outsider", "192.168.1.81")
+	require.NoError(t, err)
+
+	// The machine's own key, also shared by the group under another comment
+	_, err = api.sshKeyRepo.CreateForMachine(t.Context(), machineID, testEd25519Key)
+	require.NoError(t, err)
+
+	w := do("POST", "/api/v0/key-groups", map[string]string{"name": "ops"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var group KeyGroupResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&group))
+
+	w = do("POST", "/api/v0/key-groups", map[string]string{"name": "ops"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	groupPath := fmt.Sprintf("/api/v0/key-groups/%d", group.ID)
+	sharedKey := strings.Replace(testEd25519Key, "alice@lab", "ops-shared", 1)
+	w = do("POST", groupPath+"/keys", map[string]string{"key_text": sharedKey})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	w = do("POST", groupPath+"/keys", map[string]string{"key_text": "ssh-rsa AAAAB3NzaC1yc2E ops@lab"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	w = do("PUT", fmt.Sprintf("%s/members/%d", groupPath, machineID), nil)
+	require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+	w = do("PUT", groupPath+"/members/9999", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = do("GET", groupPath+"/members", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, fmt.Sprintf(`{"machine_ids": [%d]}`, machineID), w.Body.String())
+
+	userData := func(ip string) string {
+		req := httptest.NewRequest("GET", "/user-data", nil)
+		req.RemoteAddr = ip + ":12345"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		return w.Body.String()
+	}
+
+	// Members get their own keys plus the group's, with the shared key listed once
+	member := userData("192.168.1.80")
+	assert.Contains(t, member, "alice@lab")
+	assert.Contains(t, member, "ops@lab")
+	assert.NotContains(t, member, "ops-shared")
+
+	// Non-members are unaffected
+	assert.NotContains(t, userData("192.168.1.81"), "ops@lab")
+
+	// Removing the membership stops delivery
+	w = do("DELETE", fmt.Sprintf("%s/members/%d", groupPath, machineID), nil)
+	require.Equal(t, http.StatusNoContent, w.Code)
+	assert.NotContains(t, userData("192.168.1.80"), "ops@lab")
+
+	w = do("DELETE", groupPath, nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = do("GET", groupPath+"/keys", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jbweber/homelab/nook/internal/domain"
+	"github.com/jbweber/homelab/nook/internal/repository"
+)
+
+// keyGroups returns the key group repository, or an error wrapping
+// repository.ErrOperationNotSupported when the API was built without one.
+func (a *API) keyGroups() (repository.KeyGroupRepository, error) {
+	if a.keyGroupRepo == nil {
+		return nil, fmt.Errorf("key groups: %w", repository.ErrOperationNotSupported)
+	}
+	return a.keyGroupRepo, nil
+}
+
+// ListKeyGroups implements KeyGroupsStore interface
+func (a *API) ListKeyGroups(ctx context.Context) ([]domain.KeyGroup, error) {
+	repo, err := a.keyGroups()
+	if err != nil {
+		return nil, err
+	}
+	return repo.FindAll(ctx)
+}
+
+// CreateKeyGroup implements KeyGroupsStore interface
+func (a *API) CreateKeyGroup(ctx context.Context, name string) (domain.KeyGroup, error) {
+	repo, err := a.keyGroups()
+	if err != nil {
+		return domain.KeyGroup{}, err
+	}
+	return repo.Save(ctx, domain.KeyGroup{Name: name})
+}
+
+// DeleteKeyGroup implements KeyGroupsStore interface
+func (a *API) DeleteKeyGroup(ctx context.Context, id int64) error {
+	repo, err := a.keyGroups()
+	if err != nil {
+		return err
+	}
+	return repo.DeleteByID(ctx, id)
+}
+
+// ListKeyGroupKeys implements KeyGroupsStore interface
+func (a *API) ListKeyGroupKeys(ctx context.Context, groupID int64) ([]domain.KeyGroupKey, error) {
+	repo, err := a.keyGroups()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := repo.FindByID(ctx, groupID); err != nil {
+		return nil, err
+	}
+	return repo.FindKeys(ctx, groupID)
+}
+
+// AddKeyGroupKey implements KeyGroupsStore interface
+func (a *API) AddKeyGroupKey(ctx context.Context, groupID int64, keyText string) (domain.KeyGroupKey, error) {
+	repo, err := a.keyGroups()
+	if err != nil {
+		return domain.KeyGroupKey{}, err
+	}
+	return repo.AddKey(ctx, groupID, keyText)
+}
+
+// DeleteKeyGroupKey implements KeyGroupsStore interface
+func (a *API) DeleteKeyGroupKey(ctx context.Context, groupID, keyID int64) error {
+	repo, err := a.keyGroups()
+	if err != nil {
+		return err
+	}
+	return repo.DeleteKey(ctx, groupID, keyID)
+}
+
+// ListKeyGroupMembers implements KeyGroupsStore interface
+func (a *API) ListKeyGroupMembers(ctx context.Context, groupID int64) ([]int64, error) {
+	repo, err := a.keyGroups()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := repo.FindByID(ctx, groupID); err != nil {
+		return nil, err
+	}
+	return repo.FindMemberIDs(ctx, groupID)
+}
+
+// AddKeyGroupMember implements KeyGroupsStore interface
+func (a *API) AddKeyGroupMember(ctx context.Context, groupID, machineID int64) error {
+	repo, err := a.keyGroups()
+	if err != nil {
+		return err
+	}
+	return repo.AddMember(ctx, groupID, machineID)
+}
+
+// RemoveKeyGroupMember implements KeyGroupsStore interface
+func (a *API) RemoveKeyGroupMember(ctx context.Context, groupID, machineID int64) error {
+	repo, err := a.keyGroups()
+	if err != nil {
+		return err
+	}
+	return repo.RemoveMember(ctx, groupID, machineID)
+}
+
+// authorizedKeys returns the keys to install on a machine: its own keys followed
+// by those of every group it belongs to, without duplicates. Keys are compared
+// by fingerprint so the same key under a different comment is listed once.
+func (a *API) authorizedKeys(ctx context.Context, machineID int64) ([]domain.SSHKey, error) {
+	keys, err := a.sshKeyRepo.FindByMachineID(ctx, machineID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list SSH keys for machine %d: %w", machineID, err)
+	}
+	if a.keyGroupRepo != nil {
+		groupKeys, err := a.keyGroupRepo.FindKeysForMachine(ctx, machineID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list group keys for machine %d: %w", machineID, err)
+		}
+		for _, k := range groupKeys {
+			keys = append(keys, domain.SSHKey{MachineID: machineID, KeyText: k.KeyText})
+		}
+	}
+	return uniqueSSHKeys(keys), nil
+}
+
+// uniqueSSHKeys drops repeated keys, keeping the first occurrence. Keys that parse
+// are compared by fingerprint, others by their trimmed text.
+func uniqueSSHKeys(keys []domain.SSHKey) []domain.SSHKey {
+	seen := make(map[string]bool, len(keys))
+	unique := make([]domain.SSHKey, 0, len(keys))
+	for _, k := range keys {
+		id := strings.TrimSpace(k.KeyText)
+		if _, fp, err := sshKeyFingerprint(k.KeyText); err == nil {
+			id = fp
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, k)
+	}
+	return unique
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/jbweber/homelab/nook/internal/domain"
+)
+
+// LeasesStore defines the datastore interface for the IP lease handlers
+type LeasesStore interface {
+	ListIPLeases(ctx context.Context) ([]domain.IPAddressLease, error)
+	ListNetworkIPLeases(ctx context.Context, networkID int64) ([]domain.IPAddressLease, error)
+	ListMachineIPLeases(ctx context.Context, machineID int64) ([]domain.IPAddressLease, error)
+	GetNetwork(ctx context.Context, id int64) (domain.Network, error)
+	GetMachine(ctx context.Context, id int64) (*Machine, error)
+}
+
+// Leases groups read-only handlers for inspecting IP leases
+type Leases struct {
+	store LeasesStore
+}
+
+// NewLeases creates a new Leases instance with the given store.
+func NewLeases(store LeasesStore) *Leases {
+	return &Leases{store: store}
+}
+
+// LeaseResponse is one IP lease as returned by the lease listing endpoints
+type LeaseResponse struct {
+	ID        int64  `json:"id"`
+	MachineID int64  `json:"machine_id"`
+	NetworkID int64  `json:"network_id"`
+	IPAddress string `json:"ip_address"`
+	LeaseTime string `json:"lease_time"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// ListLeasesHandler handles GET /api/v0/leases and lists every IP lease.
+func (l *Leases) ListLeasesHandler(w http.ResponseWriter, r *http.Request) {
+	leases, err := l.store.ListIPLeases(r.Context())
+	if err != nil {
+		log.Printf("failed to list IP leases: %v", err)
+		http.Error(w, "failed to list IP leases", http.StatusInternalServerError)
+		return
+	}
+	writeLeases(w, leases)
+}
+
+// ListNetworkLeasesHandler handles GET /api/v0/networks/{id}/leases and lists
+// the leases allocated from one network. It returns 404 if the network does
+// not exist.
+func (l *Leases) ListNetworkLeasesHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r, "id", "network ID")
+	if !ok {
+		return
+	}
+	if _, err := l.store.GetNetwork(r.Context(), id); err != nil {
+		log.Printf("failed to get network: %v", err)
+		http.Error(w, "network not found", http.StatusNotFound)
+		return
+	}
+
+	leases, err := l.store.ListNetworkIPLeases(r.Context(), id)
+	if err != nil {
+		log.Printf("failed to list leases for network %d: %v", id, err)
+		http.Error(w, "failed to list IP leases", http.StatusInternalServerError)
+		return
+	}
+	writeLeases(w, leases)
+}
+
+// ListMachineLeasesHandler handles GET /api/v0/machines/{id}/leases and lists
+// the leases held by one machine. It returns 404 if the machine does not exist.
+func (l *Leases) ListMachineLeasesHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDParam(w, r, "id", "machine ID")
+	if !ok {
+		return
+	}
+	machine, err := l.store.GetMachine(r.Context(), id)
+	if err != nil {
+		log.Printf("failed to get machine %d: %v", id, err)
+		http.Error(w, "failed to get machine", http.StatusInternalServerError)
+		return
+	}
+	if machine == nil {
+		http.Error(w, "machine not found", http.StatusNotFound)
+		return
+	}
+
+	leases, err := l.store.ListMachineIPLeases(r.Context(), id)
+	if err != nil {
+		log.Printf("failed to list leases for machine %d: %v", id, err)
+		http.Error(w, "failed to list IP leases", http.StatusInternalServerError)
+		return
+	}
+	writeLeases(w, leases)
+}
+
+func writeLeases(w http.ResponseWriter, leases []domain.IPAddressLease) {
+	response := make([]LeaseResponse, len(leases))
+	for i, lease := range leases {
+		response[i] = LeaseResponse{
+			ID:        lease.ID,
+			MachineID: lease.MachineID,
+			NetworkID: lease.NetworkID,
+			IPAddress: lease.IPAddress,
+			LeaseTime: lease.LeaseTime,
+			CreatedAt: lease.CreatedAt,
+			UpdatedAt: lease.UpdatedAt,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("failed to encode IP leases response: %v", err)
+	}
+}
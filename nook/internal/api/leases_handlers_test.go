@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jbweber/homelab/nook/internal/domain"
+	"github.com/jbweber/homelab/nook/internal/repository"
+	"github.com/jbweber/homelab/nook/internal/testutil"
+)
+
+func TestLeases_ListHandlers(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestLeases_ListHandlers")
+	defer cleanup()
+
+	api := NewAPI(db)
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+
+	get := func(path string) (int, []LeaseResponse) {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			return w.Code, nil
+		}
+		var leases []LeaseResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&leases))
+		return w.Code, leases
+	}
+
+	ctx := context.Background()
+	network, err := repository.NewNetworkRepository(db).Save(ctx, domain.Network{Name: "lab", Bridge: "br0", Subnet: "192.168.1.0/24"})
+	require.NoError(t, err)
+	_, err = repository.NewDHCPRangeRepository(db).Save(ctx, domain.DHCPRange{NetworkID: network.ID, StartIP: "192.168.1.100", EndIP: "192.168.1.110", LeaseTime: "24h"})
+	require.NoError(t, err)
+	static, err := api.CreateMachine(context.Background(), Machine{Name: "static", Hostname: "static", IPv4: "10.0.0.5"})
+	require.NoError(t, err)
+	networkPath := "/api/v0/networks/" + strconv.FormatInt(network.ID, 10) + "/leases"
+	staticPath := "/api/v0/machines/" + strconv.FormatInt(static.ID, 10) + "/leases"
+
+	t.Run("empty", func(t *testing.T) {
+		for _, path := range []string{"/api/v0/leases", networkPath, staticPath} {
+			code, leases := get(path)
+			require.Equal(t, http.StatusOK, code, path)
+			assert.NotNil(t, leases, "%s should encode an empty array, not null", path)
+			assert.Empty(t, leases, path)
+		}
+	})
+
+	leased, err := api.CreateMachine(context.Background(), Machine{Name: "leased", Hostname: "leased", NetworkID: &network.ID})
+	require.NoError(t, err)
+
+	t.Run("populated", func(t *testing.T) {
+		code, all := get("/api/v0/leases")
+		require.Equal(t, http.StatusOK, code)
+		require.Len(t, all, 1)
+		lease := all[0]
+		assert.Equal(t, leased.ID, lease.MachineID)
+		assert.Equal(t, network.ID, lease.NetworkID)
+		assert.Equal(t, "192.168.1.100", lease.IPAddress)
+		assert.NotEmpty(t, lease.CreatedAt)
+		assert.NotEmpty(t, lease.UpdatedAt)
+
+		code, byNetwork := get(networkPath)
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, all, byNetwork)
+
+		code, byMachine := get("/api/v0/machines/" + strconv.FormatInt(leased.ID, 10) + "/leases")
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, all, byMachine)
+
+		code, byStatic := get(staticPath)
+		require.Equal(t, http.StatusOK, code)
+		assert.Empty(t, byStatic)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		code, _ := get("/api/v0/networks/9999/leases")
+		assert.Equal(t, http.StatusNotFound, code)
+		code, _ = get("/api/v0/machines/9999/leases")
+		assert.Equal(t, http.StatusNotFound, code)
+		code, _ = get("/api/v0/machines/abc/leases")
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+}
@@ -0,0 +1,22 @@
+package api
+
+import (
+	"context"
+
+	"github.com/jbweber/homelab/nook/internal/domain"
+)
+
+// ListIPLeases implements LeasesStore interface
+func (a *API) ListIPLeases(ctx context.Context) ([]domain.IPAddressLease, error) {
+	return a.ipLeaseRepo.FindAll(ctx)
+}
+
+// ListNetworkIPLeases implements LeasesStore interface
+func (a *API) ListNetworkIPLeases(ctx context.Context, networkID int64) ([]domain.IPAddressLease, error) {
+	return a.ipLeaseRepo.FindByNetworkID(ctx, networkID)
+}
+
+// ListMachineIPLeases implements LeasesStore interface
+func (a *API) ListMachineIPLeases(ctx context.Context, machineID int64) ([]domain.IPAddressLease, error) {
+	return a.ipLeaseRepo.FindByMachineID(ctx, machineID)
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jbweber/homelab/nook/internal/testutil"
+)
+
+// logLines decodes each JSON log line written to buf
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line), "log line %q is not JSON", scanner.Text())
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestRequestLogger(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestRequestLogger")
+	defer cleanup()
+
+	var buf bytes.Buffer
+	logger := NewLogger(&buf)
+
+	api := NewAPI(db)
+	api.SetLogger(logger)
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(RequestLogger(logger))
+	api.RegisterRoutes(r)
+
+	req := httptest.NewRequest("POST", "/api/v0/machines", bytes.NewBufferString(`{"name":"web","hostname":"web","ipv4":"10.0.0.5"}`))
+	req.RemoteAddr = "192.0.2.7:4321"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	lines := logLines(t, &buf)
+	require.Len(t, lines, 2, "a handler event and the request line")
+
+	created, request := lines[0], lines[1]
+	assert.Equal(t, "created machine", created["msg"])
+	assert.NotEmpty(t, created["request_id"])
+
+	assert.Equal(t, "request", request["msg"])
+	assert.Equal(t, created["request_id"], request["request_id"], "handler and request lines share the request ID")
+	assert.Equal(t, "POST", request["method"])
+	assert.Equal(t, "/api/v0/machines", request["path"])
+	assert.Equal(t, float64(http.StatusCreated), request["status"])
+	assert.Equal(t, "192.0.2.7", request["client_ip"])
+	assert.Contains(t, request, "duration_ms")
+}
+
+func TestRequestLogger_DefaultStatus(t *testing.T) {
+	var buf bytes.Buffer
+	handler := RequestLogger(NewLogger(&buf))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	lines := logLines(t, &buf)
+	require.Len(t, lines, 1)
+	assert.Equal(t, float64(http.StatusOK), lines[0]["status"])
+	assert.NotContains(t, lines[0], "request_id", "no request ID without the RequestID middleware")
+}
+
+func TestRequestLogger_TrustedProxy(t *testing.T) {
+	_, proxy, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	r := chi.NewRouter()
+	r.Use(TrustProxies([]*net.IPNet{proxy}))
+	r.Use(RequestLogger(NewLogger(&buf)))
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.2:4321"
+	req.Header.Set("X-Forwarded-For", "192.0.2.7")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := logLines(t, &buf)
+	require.Len(t, lines, 1)
+	assert.Equal(t, "192.0.2.7", lines[0]["client_ip"], "the forwarded client is logged, not the proxy")
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/jbweber/homelab/nook/internal/domain"
+	"github.com/jbweber/homelab/nook/internal/repository"
+)
+
+// maxBulkMachines caps how many machines one bulk create may carry
+const maxBulkMachines = 1000
+
+// BulkCreateErrorResponse is returned when a bulk create fails, naming the
+// position of the offending machine in the request array.
+type BulkCreateErrorResponse struct {
+	Error string `json:"error"`
+	Index int    `json:"index"`
+}
+
+// writeBulkCreateError writes a BulkCreateErrorResponse with the given status
+func (m *Machines) writeBulkCreateError(w http.ResponseWriter, status, index int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(BulkCreateErrorResponse{Error: msg, Index: index}); err != nil {
+		m.logger.Error("failed to encode error response", "error", err)
+	}
+}
+
+// BulkCreateMachinesHandler handles POST /api/v0/machines/bulk.
+//
+// Request: JSON array of create bodies. The batch is all or nothing: every
+// machine is validated as by create, then all are created in one transaction.
+// Returns 400 for invalid input and 409 for a name or address already taken
+// (by an existing machine or earlier in the batch) or a network without a free
+// address, with the index of the offending machine in the body.
+// Response: 201 Created with the created machines in request order.
+func (m *Machines) BulkCreateMachinesHandler(w http.ResponseWriter, r *http.Request) {
+	var reqs []CreateMachineRequest
+	if err := decodeJSONBody(r, &reqs); err != nil {
+		m.writeMachineError(w, http.StatusBadRequest, jsonErrorMessage(err, "Invalid JSON: expected an array of machines"))
+		return
+	}
+	if len(reqs) == 0 {
+		m.writeMachineError(w, http.StatusBadRequest, "At least one machine is required")
+		return
+	}
+	if len(reqs) > maxBulkMachines {
+		m.writeMachineError(w, http.StatusBadRequest, fmt.Sprintf("At most %d machines may be created at once", maxBulkMachines))
+		return
+	}
+
+	machines := make([]Machine, len(reqs))
+	seen := make(map[string]int) // Names and addresses claimed earlier in the batch
+	for i, req := range reqs {
+		machine, status, msg := m.bulkMachine(r.Context(), req)
+		if msg == "" {
+			keys := []string{"name " + machine.Name}
+			if machine.IPv4 != "" {
+				keys = append(keys, "IPv4 address "+machine.IPv4)
+			}
+			if machine.IPv6 != "" {
+				keys = append(keys, "IPv6 address "+machine.IPv6)
+			}
+			for _, key := range keys {
+				if first, dup := seen[key]; dup {
+					status, msg = http.StatusConflict, fmt.Sprintf("Duplicate %s, also given at index %d", key, first)
+					break
+				}
+				seen[key] = i
+			}
+		}
+		if msg != "" {
+			m.writeBulkCreateError(w, status, i, msg)
+			return
+		}
+		machines[i] = machine
+	}
+
+	created, err := m.store.CreateMachines(r.Context(), machines)
+	if err != nil {
+		var itemErr *repository.BatchItemError
+		switch {
+		case errors.As(err, &itemErr) && errors.Is(err, repository.ErrDuplicate):
+			m.writeBulkCreateError(w, http.StatusConflict, itemErr.Index, itemErr.Err.Error())
+		case errors.As(err, &itemErr) && errors.Is(err, repository.ErrInsufficientCapacity):
+			m.writeBulkCreateError(w, http.StatusConflict, itemErr.Index, itemErr.Err.Error())
+		case errors.As(err, &itemErr) && errors.Is(err, repository.ErrInvalidEntity):
+			m.writeBulkCreateError(w, http.StatusBadRequest, itemErr.Index, itemErr.Err.Error())
+		default:
+			m.logger.ErrorContext(r.Context(), "failed to create machine batch", "error", err)
+			m.writeMachineError(w, http.StatusInternalServerError, "Failed to create machines")
+		}
+		return
+	}
+
+	response := make([]MachineResponse, len(created))
+	for i, machine := range created {
+		response[i] = newMachineResponse(machine)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		m.logger.ErrorContext(r.Context(), "failed to encode bulk create response", "error", err)
+	}
+}
+
+// bulkMachine validates one create body of a bulk request the same way as
+// create and builds the machine. On failure it returns the status and a
+// user-facing message; the message is "" when the body is valid.
+func (m *Machines) bulkMachine(ctx context.Context, req CreateMachineRequest) (Machine, int, string) {
+	if req.Name == "" || req.Hostname == "" {
+		return Machine{}, http.StatusBadRequest, "Name and Hostname are required"
+	}
+	machine := Machine{Name: req.Name, Hostname: req.Hostname, NetworkID: req.NetworkID}
+	if req.AvailabilityZone != nil {
+		machine.AvailabilityZone = *req.AvailabilityZone
+	}
+	if req.MTU != nil {
+		if !domain.ValidMTU(*req.MTU) {
+			return Machine{}, http.StatusBadRequest, fmt.Sprintf("MTU must be between %d and %d", domain.MinMTU, domain.MaxMTU)
+		}
+		machine.MTU = *req.MTU
+	}
+	runCmd, msg := decodeRunCmdRequest(req.RunCmd)
+	if msg != "" {
+		return Machine{}, http.StatusBadRequest, msg
+	}
+	machine.RunCmd = runCmd
+	if req.UserData != nil {
+		if msg := userDataValidationError("user_data", *req.UserData); msg != "" {
+			return Machine{}, http.StatusBadRequest, msg
+		}
+		machine.UserData = *req.UserData
+	}
+	if req.VendorData != nil {
+		if msg := userDataValidationError("vendor_data", *req.VendorData); msg != "" {
+			return Machine{}, http.StatusBadRequest, msg
+		}
+		machine.VendorData = *req.VendorData
+	}
+
+	switch {
+	case req.IPv4 != nil:
+		if msg := ipv4ValidationError(*req.IPv4); msg != "" {
+			return Machine{}, http.StatusBadRequest, msg
+		}
+		if req.NetworkID != nil {
+			if msg := m.ipInNetworkError(ctx, *req.NetworkID, *req.IPv4); msg != "" {
+				return Machine{}, http.StatusBadRequest, msg
+			}
+		}
+		if existing, _ := m.store.GetMachineByIPv4(ctx, *req.IPv4); existing != nil {
+			return Machine{}, http.StatusConflict, "A machine with this IPv4 address already exists"
+		}
+		machine.IPv4 = *req.IPv4
+	case req.NetworkID != nil:
+		if _, err := m.store.GetNetwork(ctx, *req.NetworkID); err != nil {
+			return Machine{}, http.StatusBadRequest, fmt.Sprintf("Network %d not found", *req.NetworkID)
+		}
+	default:
+		return Machine{}, http.StatusBadRequest, "IPv4 or network_id is required"
+	}
+
+	if req.IPv6 != nil && *req.IPv6 != "" {
+		if msg := ipv6ValidationError(*req.IPv6); msg != "" {
+			return Machine{}, http.StatusBadRequest, msg
+		}
+		machine.IPv6 = net.ParseIP(*req.IPv6).String()
+		if existing, _ := m.store.GetMachineByIPv6(ctx, machine.IPv6); existing != nil {
+			return Machine{}, http.StatusConflict, "A machine with this IPv6 address already exists"
+		}
+	}
+
+	if existing, _ := m.store.GetMachineByName(ctx, machine.Name); existing != nil {
+		return Machine{}, http.StatusConflict, "A machine with this name already exists"
+	}
+	return machine, 0, ""
+}
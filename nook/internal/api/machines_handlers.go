@@ -1,87 +1,507 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/jbweber/homelab/nook/internal/domain"
+	"github.com/jbweber/homelab/nook/internal/repository"
 )
 
 // Machine represents a virtual machine in the system
 type Machine struct {
-	ID        int64  // Unique identifier
-	Name      string // Machine name
-	Hostname  string // Machine hostname
-	IPv4      string // IPv4 address
-	NetworkID *int64 // Network ID for dynamic IP allocation (optional)
+	ID               int64    // Unique identifier
+	Name             string   // Machine name
+	Hostname         string   // Machine hostname
+	IPv4             string   // IPv4 address
+	IPv6             string   // IPv6 address (optional)
+	NetworkID        *int64   // Network ID for dynamic IP allocation (optional)
+	AvailabilityZone string   // Placement availability zone (optional)
+	MetadataDisabled bool     // Metadata endpoints return 404 for this machine while set
+	MTU              int      // Interface MTU override (0 inherits the network's)
+	RunCmd           []string // Commands for the cloud-init runcmd block (optional)
+	UserData         string   // User-data served verbatim (optional; empty generates cloud-config)
+	VendorData       string   // Vendor-data (optional; empty falls back to the global vendor-data)
 }
 
 // MachinesStore defines the datastore interface for machine handlers
 type MachinesStore interface {
-	ListMachines() ([]Machine, error)
-	CreateMachine(Machine) (Machine, error)
-	GetMachine(id int64) (*Machine, error)
-	DeleteMachine(id int64) error
-	GetMachineByName(name string) (*Machine, error)
-	GetMachineByIPv4(ipv4 string) (*Machine, error)
-	AllocateIPAddress(machineID, networkID int64) (string, error)
-	DeallocateIPAddress(machineID, networkID int64) error
+	ListMachines(ctx context.Context) ([]Machine, error)
+	ListMachinesPage(ctx context.Context, limit, offset int) ([]Machine, int, error)
+	ListMachinesAfter(ctx context.Context, afterID int64, limit int) ([]Machine, error)
+	ListNetworkMachines(ctx context.Context, networkID int64) ([]Machine, error)
+	CreateMachine(ctx context.Context, m Machine) (Machine, error)
+	GetMachine(ctx context.Context, id int64) (*Machine, error)
+	DeleteMachine(ctx context.Context, id int64) error
+	GetMachineByName(ctx context.Context, name string) (*Machine, error)
+	GetMachineByIPv4(ctx context.Context, ipv4 string) (*Machine, error)
+	GetMachineByIPv6(ctx context.Context, ipv6 string) (*Machine, error)
+	AllocateIPAddress(ctx context.Context, machineID, networkID int64) (string, error)
+	DeallocateIPAddress(ctx context.Context, machineID, networkID int64) error
+	ListMachineLeases(ctx context.Context) (map[int64]MachineLease, error)
+	RenderNetworkConfig(ctx context.Context, machine *Machine) (string, error)
+	PreviewMachineDelete(ctx context.Context, id int64) (*MachineDeletePreview, error)
+	GetMachineDetail(ctx context.Context, id int64) (*MachineDetail, error)
+	SetMachineMetadataEnabled(ctx context.Context, id int64, enabled bool) (*Machine, error)
+	PinMachineIP(ctx context.Context, id int64, keepNetwork bool) (*Machine, error)
+	MoveMachineNetwork(ctx context.Context, m Machine, fromNetworkID *int64) (Machine, error)
+	CreateMachines(ctx context.Context, machines []Machine) ([]Machine, error)
+	GetNetwork(ctx context.Context, id int64) (domain.Network, error)
+}
+
+// MachineDeletePreview lists what deleting a machine would remove or release
+type MachineDeletePreview struct {
+	MachineID int64  `json:"machine_id"`
+	SSHKeys   int    `json:"ssh_keys"`
+	Leases    int    `json:"leases"`
+	IPFreed   bool   `json:"ip_freed"`
+	IPv4      string `json:"ipv4,omitempty"`
+}
+
+// MachineDetail is a machine together with everything that refers to it
+type MachineDetail struct {
+	Machine   Machine
+	Network   *domain.Network   // nil when the machine has no network
+	DHCPRange *domain.DHCPRange // Range containing the leased address, nil when not leased from a range
+	SSHKeys   []SSHKey
+	KeyGroups []domain.KeyGroup
+	Lease     *MachineLease // nil for static assignments
+}
+
+// MachineDetailResponse is the JSON representation of a MachineDetail. Network
+// and DHCP range use the same shape as the networks endpoints.
+type MachineDetailResponse struct {
+	MachineResponse
+	Network   *domain.Network       `json:"network"`
+	DHCPRange *domain.DHCPRange     `json:"dhcp_range"`
+	SSHKeys   []SSHKeyResponse      `json:"ssh_keys"`
+	KeyGroups []KeyGroupResponse    `json:"key_groups"`
+	Lease     *MachineLeaseResponse `json:"lease"`
+}
+
+// MachineLease describes the IP lease backing a network-managed machine's address
+type MachineLease struct {
+	NetworkID int64
+	IPAddress string
+	LeaseTime string // Lease duration (e.g., "24h", "infinite")
+	CreatedAt string
 }
 
 // Machines groups machine handlers for testability
 type Machines struct {
-	store MachinesStore
+	store     MachinesStore
+	dnsDomain string       // Domain qualifying hostnames in rendered meta-data
+	logger    *slog.Logger // Structured logger for handler errors and events
 }
 
 func NewMachines(store MachinesStore) *Machines {
-	return &Machines{store: store}
+	return &Machines{store: store, logger: slog.Default()}
 }
 
 type CreateMachineRequest struct {
-	Name      string  `json:"name"`
-	Hostname  string  `json:"hostname"`
-	IPv4      *string `json:"ipv4,omitempty"`       // Optional: for static IP assignment
-	NetworkID *int64  `json:"network_id,omitempty"` // Optional: if provided, allocate IP from this network
+	Name             string  `json:"name"`
+	Hostname         string  `json:"hostname"`
+	IPv4             *string `json:"ipv4,omitempty"`              // Optional: for static IP assignment
+	IPv6             *string `json:"ipv6,omitempty"`              // Optional: static IPv6 address
+	NetworkID        *int64  `json:"network_id,omitempty"`        // Optional: if provided, allocate IP from this network
+	AvailabilityZone *string `json:"availability_zone,omitempty"` // Optional: placement availability zone
+	MTU              *int    `json:"mtu,omitempty"`               // Optional: interface MTU override, 0 to inherit the network's
+	// Optional: JSON array of commands for cloud-init runcmd; kept raw so a
+	// wrong type gets a specific error instead of a generic decode failure
+	RunCmd     json.RawMessage `json:"runcmd,omitempty"`
+	UserData   *string         `json:"user_data,omitempty"`   // Optional: user-data served verbatim instead of generated cloud-config
+	VendorData *string         `json:"vendor_data,omitempty"` // Optional: vendor-data served in place of the global vendor-data
 }
 
 type MachineResponse struct {
-	ID        int64   `json:"id"`
-	Name      string  `json:"name"`
-	Hostname  string  `json:"hostname"`
-	IPv4      *string `json:"ipv4,omitempty"`
-	NetworkID *int64  `json:"network_id,omitempty"`
+	ID               int64    `json:"id"`
+	Name             string   `json:"name"`
+	Hostname         string   `json:"hostname"`
+	IPv4             *string  `json:"ipv4,omitempty"`
+	IPv6             string   `json:"ipv6,omitempty"`
+	NetworkID        *int64   `json:"network_id,omitempty"`
+	AvailabilityZone string   `json:"availability_zone,omitempty"`
+	MetadataEnabled  bool     `json:"metadata_enabled"`
+	MTU              int      `json:"mtu,omitempty"`
+	RunCmd           []string `json:"runcmd,omitempty"`
+	UserData         string   `json:"user_data,omitempty"`
+	VendorData       string   `json:"vendor_data,omitempty"`
+}
+
+// newMachineResponse converts a Machine to its JSON representation
+func newMachineResponse(machine Machine) MachineResponse {
+	return MachineResponse{
+		ID:               machine.ID,
+		Name:             machine.Name,
+		Hostname:         machine.Hostname,
+		IPv4:             &machine.IPv4,
+		IPv6:             machine.IPv6,
+		NetworkID:        machine.NetworkID,
+		AvailabilityZone: machine.AvailabilityZone,
+		MetadataEnabled:  !machine.MetadataDisabled,
+		MTU:              machine.MTU,
+		RunCmd:           machine.RunCmd,
+		UserData:         machine.UserData,
+		VendorData:       machine.VendorData,
+	}
+}
+
+// machineResponseFields lists the JSON field names of MachineResponse, the set
+// accepted by ?fields=
+var machineResponseFields = jsonFieldNames(reflect.TypeOf(MachineResponse{}))
+
+// jsonFieldNames returns the JSON names of a struct type's tagged fields
+func jsonFieldNames(t reflect.Type) []string {
+	var names []string
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// parseMachineFields parses a ?fields=id,ipv4 selection. It returns nil when the
+// parameter is absent, meaning all fields, and an error naming any unknown field.
+func parseMachineFields(r *http.Request) ([]string, error) {
+	param := r.URL.Query().Get("fields")
+	if param == "" {
+		return nil, nil
+	}
+	var fields []string
+	for field := range strings.SplitSeq(param, ",") {
+		field = strings.TrimSpace(field)
+		if !slices.Contains(machineResponseFields, field) {
+			return nil, fmt.Errorf("unknown field %q: expected one of %s", field, strings.Join(machineResponseFields, ", "))
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// selectMachineFields renders a machine as its JSON response, or as only the
+// selected fields when fields is non-nil. Empty optional fields stay omitted.
+func selectMachineFields(machine Machine, fields []string) (any, error) {
+	response := newMachineResponse(machine)
+	if fields == nil {
+		return response, nil
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	selected := make(map[string]json.RawMessage, len(fields))
+	for _, field := range fields {
+		if value, ok := all[field]; ok {
+			selected[field] = value
+		}
+	}
+	return selected, nil
+}
+
+// MachineLeaseResponse is the lease annotation returned by ?expand=lease
+type MachineLeaseResponse struct {
+	NetworkID int64   `json:"network_id"`
+	IPAddress string  `json:"ip_address"`
+	LeaseTime string  `json:"lease_time"`
+	CreatedAt string  `json:"created_at"`
+	ExpiresAt *string `json:"expires_at"` // nil for infinite leases
+}
+
+// MachineWithLeaseResponse is a machine annotated with how its address is assigned
+type MachineWithLeaseResponse struct {
+	MachineResponse
+	Assignment string                `json:"assignment"` // "static" or "leased"
+	Lease      *MachineLeaseResponse `json:"lease"`      // nil for static assignments
 }
 
 type ErrorResponse struct {
 	Error string `json:"error"`
 }
 
+// ConflictResponse is returned with 409 when a create collides with an existing
+// machine, identifying it so clients can act without another lookup.
+type ConflictResponse struct {
+	Error      string `json:"error"`
+	ExistingID int64  `json:"existing_id"`
+}
+
+// writeMachineConflict writes a 409 naming the existing machine in the body and
+// the Location header.
+func (m *Machines) writeMachineConflict(w http.ResponseWriter, existing *Machine, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/v0/machines/"+strconv.FormatInt(existing.ID, 10))
+	w.WriteHeader(http.StatusConflict)
+	if err := json.NewEncoder(w).Encode(ConflictResponse{Error: msg, ExistingID: existing.ID}); err != nil {
+		m.logger.Error("failed to encode conflict response", "error", err)
+	}
+}
+
+const (
+	defaultMachinePageSize = 100
+	maxMachinePageSize     = 1000
+)
+
+// parsePagination parses ?limit= and ?offset=. paged is false when neither is
+// given; otherwise limit defaults to defaultMachinePageSize.
+func parsePagination(r *http.Request) (limit, offset int, paged bool, err error) {
+	query := r.URL.Query()
+	if !query.Has("limit") && !query.Has("offset") {
+		return 0, 0, false, nil
+	}
+	limit = defaultMachinePageSize
+	if param := query.Get("limit"); param != "" {
+		if limit, err = strconv.Atoi(param); err != nil || limit < 1 || limit > maxMachinePageSize {
+			return 0, 0, false, fmt.Errorf("limit must be between 1 and %d", maxMachinePageSize)
+		}
+	}
+	if param := query.Get("offset"); param != "" {
+		if offset, err = strconv.Atoi(param); err != nil || offset < 0 {
+			return 0, 0, false, errors.New("offset must be a non-negative integer")
+		}
+	}
+	return limit, offset, true, nil
+}
+
+// ListMachinesHandler handles GET /api/v0/machines. Without paging parameters
+// every machine is returned; ?limit= (default 100, max 1000) and ?offset= select
+// one page in ID order instead. X-Total-Count carries the number of machines
+// across all pages.
+// ?network_id= narrows the list to machines on that network and ?hostname= to
+// machines with that hostname (case-insensitive), both before paging; hostnames
+// are not unique, so this is how operators find collisions. ?fields=id,ipv4 trims each machine to the named fields.
 func (m *Machines) ListMachinesHandler(w http.ResponseWriter, r *http.Request) {
-	machines, err := m.store.ListMachines()
+	fields, err := parseMachineFields(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if fields != nil && r.URL.Query().Get("expand") != "" {
+		http.Error(w, "fields cannot be combined with expand", http.StatusBadRequest)
+		return
+	}
+	limit, offset, paged, err := parsePagination(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "ndjson" {
+		http.Error(w, "Unsupported format: expected json or ndjson", http.StatusBadRequest)
+		return
+	}
+
+	var machines []Machine
+	var total int
+	switch {
+	case r.URL.Query().Has("network_id") || r.URL.Query().Get("hostname") != "":
+		// Filters apply before paging, so page the filtered list here
+		var ok bool
+		if machines, ok = m.filteredMachines(r.Context(), w, r.URL.Query()); !ok {
+			return
+		}
+		total = len(machines)
+		if paged {
+			start := min(offset, total)
+			machines = machines[start : start+min(limit, total-start)]
+		}
+	case paged:
+		if machines, total, err = m.store.ListMachinesPage(r.Context(), limit, offset); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to list machines: %v", err), http.StatusInternalServerError)
+			return
+		}
+	case format == "ndjson" && r.URL.Query().Get("expand") == "":
+		m.streamMachinesNDJSON(w, r, fields)
+		return
+	default:
+		if machines, err = m.store.ListMachines(r.Context()); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to list machines: %v", err), http.StatusInternalServerError)
+			return
+		}
+		total = len(machines)
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+	if r.URL.Query().Get("expand") == "lease" {
+		m.writeMachinesWithLeases(r.Context(), w, machines)
+		return
+	}
+
+	if format == "ndjson" {
+		m.writeMachinesNDJSON(w, machines, fields)
+		return
+	}
+
+	response := make([]any, len(machines))
+	for i, machine := range machines {
+		if response[i], err = selectMachineFields(machine, fields); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to encode machine %d: %v", machine.ID, err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		m.logger.ErrorContext(r.Context(), "failed to encode machines response", "error", err)
+	}
+}
+
+// filteredMachines lists the machines matching ?network_id= and ?hostname=,
+// writing the error response and returning false on failure. An unknown
+// network is a 404; a known network without machines is an empty list.
+func (m *Machines) filteredMachines(ctx context.Context, w http.ResponseWriter, query url.Values) ([]Machine, bool) {
+	var machines []Machine
+	var err error
+	if query.Has("network_id") {
+		networkID, parseErr := strconv.ParseInt(query.Get("network_id"), 10, 64)
+		if parseErr != nil {
+			http.Error(w, "network_id must be an integer", http.StatusBadRequest)
+			return nil, false
+		}
+		if _, err := m.store.GetNetwork(ctx, networkID); err != nil {
+			http.Error(w, fmt.Sprintf("Network %d not found", networkID), http.StatusNotFound)
+			return nil, false
+		}
+		machines, err = m.store.ListNetworkMachines(ctx, networkID)
+	} else {
+		machines, err = m.store.ListMachines(ctx)
+	}
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to list machines: %v", err), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if hostname := query.Get("hostname"); hostname != "" {
+		machines = slices.DeleteFunc(machines, func(machine Machine) bool {
+			return !strings.EqualFold(machine.Hostname, hostname)
+		})
+	}
+	return machines, true
+}
+
+// writeMachinesWithLeases writes machines annotated with their lease, fetching all
+// leases in one batch rather than per machine.
+func (m *Machines) writeMachinesWithLeases(ctx context.Context, w http.ResponseWriter, machines []Machine) {
+	leases, err := m.store.ListMachineLeases(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list machine leases: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	response := make([]MachineResponse, len(machines))
+	response := make([]MachineWithLeaseResponse, len(machines))
 	for i, machine := range machines {
-		response[i] = MachineResponse{
-			ID:        machine.ID,
-			Name:      machine.Name,
-			Hostname:  machine.Hostname,
-			IPv4:      &machine.IPv4,
-			NetworkID: machine.NetworkID,
+		response[i] = MachineWithLeaseResponse{
+			MachineResponse: newMachineResponse(machine),
+			Assignment:      "static",
+		}
+		if lease, ok := leases[machine.ID]; ok {
+			response[i].Assignment = "leased"
+			response[i].Lease = &MachineLeaseResponse{
+				NetworkID: lease.NetworkID,
+				IPAddress: lease.IPAddress,
+				LeaseTime: lease.LeaseTime,
+				CreatedAt: lease.CreatedAt,
+				ExpiresAt: leaseExpiry(lease),
+			}
 		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("failed to encode machines response: %v", err)
+		m.logger.Error("failed to encode machines response", "error", err)
+	}
+}
+
+// leaseExpiry computes when a lease expires as RFC3339. Returns nil for infinite
+// leases or when the lease time or creation timestamp cannot be parsed.
+func leaseExpiry(lease MachineLease) *string {
+	duration, err := time.ParseDuration(lease.LeaseTime)
+	if err != nil {
+		return nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05"} {
+		if created, err := time.Parse(layout, lease.CreatedAt); err == nil {
+			expires := created.Add(duration).UTC().Format(time.RFC3339)
+			return &expires
+		}
+	}
+	return nil
+}
+
+// ndjsonBatchSize is how many machines streamMachinesNDJSON reads per query
+const ndjsonBatchSize = 500
+
+// streamMachinesNDJSON writes every machine as newline-delimited JSON, reading
+// them in ID-ordered batches so neither the whole table nor an open cursor is held
+// while the client reads. Each line is flushed as soon as it is written.
+// X-Total-Count is the count when streaming began.
+func (m *Machines) streamMachinesNDJSON(w http.ResponseWriter, r *http.Request, fields []string) {
+	batch, total, err := m.store.ListMachinesPage(r.Context(), ndjsonBatchSize, 0)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list machines: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	for len(batch) > 0 {
+		if !m.encodeMachinesNDJSON(w, rc, batch, fields) {
+			return
+		}
+		if batch, err = m.store.ListMachinesAfter(r.Context(), batch[len(batch)-1].ID, ndjsonBatchSize); err != nil {
+			// The status is already sent; a truncated stream is all the client can see
+			m.logger.ErrorContext(r.Context(), "failed to list machines while streaming ndjson", "error", err)
+			return
+		}
+	}
+}
+
+// writeMachinesNDJSON writes machines as newline-delimited JSON, one object per
+// line, flushing after each line so clients can process entries as they arrive.
+func (m *Machines) writeMachinesNDJSON(w http.ResponseWriter, machines []Machine, fields []string) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	m.encodeMachinesNDJSON(w, http.NewResponseController(w), machines, fields)
+}
+
+// encodeMachinesNDJSON writes one line per machine and flushes it, reporting
+// whether every line was written.
+func (m *Machines) encodeMachinesNDJSON(w http.ResponseWriter, rc *http.ResponseController, machines []Machine, fields []string) bool {
+	enc := json.NewEncoder(w)
+	for _, machine := range machines {
+		line, err := selectMachineFields(machine, fields)
+		if err == nil {
+			err = enc.Encode(line)
+		}
+		if err != nil {
+			m.logger.Error("failed to encode machine as ndjson", "machine_id", machine.ID, "error", err)
+			return false
+		}
+		if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			m.logger.Error("failed to flush ndjson", "error", err)
+			return false
+		}
 	}
+	return true
 }
 
 func (m *Machines) CreateMachineHandler(w http.ResponseWriter, r *http.Request) {
@@ -92,11 +512,11 @@ func (m *Machines) CreateMachineHandler(w http.ResponseWriter, r *http.Request)
 	var response MachineResponse
 	var err error
 
-	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err = decodeJSONBody(r, &req); err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
-		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid JSON"}); err != nil {
-			log.Printf("failed to encode error response: %v", err)
+		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: jsonErrorMessage(err, "Invalid JSON")}); err != nil {
+			m.logger.ErrorContext(r.Context(), "failed to encode error response", "error", err)
 		}
 		return
 	}
@@ -106,123 +526,132 @@ func (m *Machines) CreateMachineHandler(w http.ResponseWriter, r *http.Request)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Name and Hostname are required"}); err != nil {
-			log.Printf("failed to encode error response: %v", err)
+			m.logger.ErrorContext(r.Context(), "failed to encode error response", "error", err)
 		}
-		fmt.Printf("[ERROR] missing required fields in machine creation: %+v\n", req)
+		m.logger.WarnContext(r.Context(), "missing required fields in machine creation", "name", req.Name, "hostname", req.Hostname)
 		return
 	}
 
-	// Handle different IP assignment scenarios
-	if req.NetworkID != nil && req.IPv4 != nil {
-		// Both network_id and ipv4 provided - this is invalid
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Cannot specify both network_id and ipv4. Choose one or neither."}); err != nil {
-			log.Printf("failed to encode error response: %v", err)
-		}
-		fmt.Printf("[ERROR] both network_id and ipv4 specified: %+v\n", req)
+	if !m.checkMTU(w, req.MTU) {
+		return
+	}
+	runCmd, ok := m.checkRunCmd(w, req.RunCmd)
+	if !ok {
+		return
+	}
+	if !m.checkUserData(w, req.UserData, req.VendorData) {
+		return
+	}
+	ipv6, ok := m.checkIPv6(r.Context(), w, req.IPv6, 0)
+	if !ok {
 		return
-	} else if req.NetworkID != nil {
+	}
+
+	var availabilityZone string
+	if req.AvailabilityZone != nil {
+		availabilityZone = *req.AvailabilityZone
+	}
+
+	// Handle different IP assignment scenarios
+	if req.NetworkID != nil && req.IPv4 == nil {
 		// Network-based IP allocation - IP will be allocated by the store
 		machine = Machine{
-			Name:      req.Name,
-			Hostname:  req.Hostname,
-			IPv4:      "", // Will be allocated by the store
-			NetworkID: req.NetworkID,
-		}
-
-		created, err = m.store.CreateMachine(machine)
-		if err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError)
-			if err := json.NewEncoder(w).Encode(ErrorResponse{Error: fmt.Sprintf("Failed to create machine: %v", err)}); err != nil {
-				log.Printf("failed to encode error response: %v", err)
-			}
-			fmt.Printf("[ERROR] failed to create machine: %v\n", err)
-			return
+			Name:             req.Name,
+			Hostname:         req.Hostname,
+			IPv4:             "", // Will be allocated by the store
+			NetworkID:        req.NetworkID,
+			AvailabilityZone: availabilityZone,
 		}
 	} else if req.IPv4 != nil {
 		// Static IP provided
 		allocatedIP = *req.IPv4
 		// Validate static IP format
-		if net.ParseIP(allocatedIP) == nil || !isIPv4(allocatedIP) {
+		if msg := ipv4ValidationError(allocatedIP); msg != "" {
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusBadRequest)
-			if err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid IPv4 address format"}); err != nil {
-				log.Printf("failed to encode error response: %v", err)
+			if err := json.NewEncoder(w).Encode(ErrorResponse{Error: msg}); err != nil {
+				m.logger.ErrorContext(r.Context(), "failed to encode error response", "error", err)
 			}
-			fmt.Printf("[ERROR] invalid IPv4 address: %s\n", allocatedIP)
+			m.logger.WarnContext(r.Context(), "invalid IPv4 address", "ipv4", allocatedIP)
+			return
+		}
+		// A static IP paired with a network must lie in that network's subnet
+		if req.NetworkID != nil && !m.checkIPInNetwork(r.Context(), w, *req.NetworkID, allocatedIP) {
 			return
 		}
 		// Check for duplicate static IP
-		existing, _ := m.store.GetMachineByIPv4(allocatedIP)
+		existing, _ := m.store.GetMachineByIPv4(r.Context(), allocatedIP)
 		if existing != nil {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusConflict)
-			if err := json.NewEncoder(w).Encode(ErrorResponse{Error: "A machine with this IPv4 address already exists"}); err != nil {
-				log.Printf("failed to encode error response: %v", err)
-			}
-			fmt.Printf("[ERROR] duplicate IPv4 address: %s\n", allocatedIP)
+			m.writeMachineConflict(w, existing, "A machine with this IPv4 address already exists")
+			m.logger.WarnContext(r.Context(), "duplicate IPv4 address", "ipv4", allocatedIP)
 			return
 		}
 
-		// Create machine with static IP
+		// Machine with static IP
 		machine = Machine{
-			Name:      req.Name,
-			Hostname:  req.Hostname,
-			IPv4:      allocatedIP,
-			NetworkID: nil, // Static IPs don't use networks
-		}
-
-		created, err = m.store.CreateMachine(machine)
-		if err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError)
-			if err := json.NewEncoder(w).Encode(ErrorResponse{Error: fmt.Sprintf("Failed to create machine: %v", err)}); err != nil {
-				log.Printf("failed to encode error response: %v", err)
-			}
-			fmt.Printf("[ERROR] failed to create machine: %v\n", err)
-			return
+			Name:             req.Name,
+			Hostname:         req.Hostname,
+			IPv4:             allocatedIP,
+			NetworkID:        req.NetworkID, // Optional: static IPs may still belong to a network
+			AvailabilityZone: availabilityZone,
 		}
 	} else {
 		// No IP assignment - create machine with empty IP
 		machine = Machine{
-			Name:      req.Name,
-			Hostname:  req.Hostname,
-			IPv4:      "",
-			NetworkID: nil,
+			Name:             req.Name,
+			Hostname:         req.Hostname,
+			IPv4:             "",
+			NetworkID:        nil,
+			AvailabilityZone: availabilityZone,
 		}
+	}
 
-		created, err = m.store.CreateMachine(machine)
-		if err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError)
-			if err := json.NewEncoder(w).Encode(ErrorResponse{Error: fmt.Sprintf("Failed to create machine: %v", err)}); err != nil {
-				log.Printf("failed to encode error response: %v", err)
-			}
-			fmt.Printf("[ERROR] failed to create machine: %v\n", err)
-			return
+	machine.IPv6 = ipv6
+	if req.MTU != nil {
+		machine.MTU = *req.MTU
+	}
+	if req.RunCmd != nil {
+		machine.RunCmd = runCmd
+	}
+	if req.UserData != nil {
+		machine.UserData = *req.UserData
+	}
+	if req.VendorData != nil {
+		machine.VendorData = *req.VendorData
+	}
+
+	// Check for duplicate name
+	if existing, _ := m.store.GetMachineByName(r.Context(), machine.Name); existing != nil {
+		m.writeMachineConflict(w, existing, "A machine with this name already exists")
+		m.logger.WarnContext(r.Context(), "duplicate machine name", "name", machine.Name)
+		return
+	}
+
+	created, err = m.store.CreateMachine(r.Context(), machine)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: fmt.Sprintf("Failed to create machine: %v", err)}); err != nil {
+			m.logger.ErrorContext(r.Context(), "failed to encode error response", "error", err)
 		}
+		m.logger.ErrorContext(r.Context(), "failed to create machine", "error", err)
+		return
 	}
 
 	// Prepare response
-	response = MachineResponse{
-		ID:        created.ID,
-		Name:      created.Name,
-		Hostname:  created.Hostname,
-		IPv4:      &created.IPv4,
-		NetworkID: created.NetworkID,
-	}
+	response = newMachineResponse(created)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("failed to encode machine response: %v", err)
+		m.logger.ErrorContext(r.Context(), "failed to encode machine response", "error", err)
 	}
 
-	fmt.Printf("Created machine with ID: %d\n", created.ID)
+	m.logger.InfoContext(r.Context(), "created machine", "machine_id", created.ID)
 }
 
+// GetMachineHandler handles GET /api/v0/machines/{id}; ?fields=id,ipv4 trims
+// the response to the named fields.
 func (m *Machines) GetMachineHandler(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
@@ -230,17 +659,27 @@ func (m *Machines) GetMachineHandler(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid machine ID"}); err != nil {
-			log.Printf("failed to encode error response: %v", err)
+			m.logger.ErrorContext(r.Context(), "failed to encode error response", "error", err)
 		}
 		return
 	}
 
-	machine, err := m.store.GetMachine(id)
+	fields, err := parseMachineFields(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()}); err != nil {
+			m.logger.ErrorContext(r.Context(), "failed to encode error response", "error", err)
+		}
+		return
+	}
+
+	machine, err := m.store.GetMachine(r.Context(), id)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
 		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: fmt.Sprintf("Failed to get machine: %v", err)}); err != nil {
-			log.Printf("failed to encode error response: %v", err)
+			m.logger.ErrorContext(r.Context(), "failed to encode error response", "error", err)
 		}
 		return
 	}
@@ -249,22 +688,24 @@ func (m *Machines) GetMachineHandler(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusNotFound)
 		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Machine not found"}); err != nil {
-			log.Printf("failed to encode error response: %v", err)
+			m.logger.ErrorContext(r.Context(), "failed to encode error response", "error", err)
 		}
 		return
 	}
 
-	response := MachineResponse{
-		ID:        machine.ID,
-		Name:      machine.Name,
-		Hostname:  machine.Hostname,
-		IPv4:      &machine.IPv4,
-		NetworkID: machine.NetworkID,
+	response, err := selectMachineFields(*machine, fields)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: fmt.Sprintf("Failed to encode machine: %v", err)}); err != nil {
+			m.logger.ErrorContext(r.Context(), "failed to encode error response", "error", err)
+		}
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("failed to encode machine by name response: %v", err)
+		m.logger.ErrorContext(r.Context(), "failed to encode machine by name response", "error", err)
 	}
 }
 
@@ -275,17 +716,17 @@ func (m *Machines) DeleteMachineHandler(w http.ResponseWriter, r *http.Request)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid machine ID"}); err != nil {
-			log.Printf("failed to encode error response: %v", err)
+			m.logger.ErrorContext(r.Context(), "failed to encode error response", "error", err)
 		}
 		return
 	}
 
-	err = m.store.DeleteMachine(id)
+	err = m.store.DeleteMachine(r.Context(), id)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
 		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: fmt.Sprintf("Failed to delete machine: %v", err)}); err != nil {
-			log.Printf("failed to encode error response: %v", err)
+			m.logger.ErrorContext(r.Context(), "failed to encode error response", "error", err)
 		}
 		return
 	}
@@ -296,12 +737,12 @@ func (m *Machines) DeleteMachineHandler(w http.ResponseWriter, r *http.Request)
 func (m *Machines) GetMachineByNameHandler(w http.ResponseWriter, r *http.Request) {
 	name := chi.URLParam(r, "name")
 
-	machine, err := m.store.GetMachineByName(name)
+	machine, err := m.store.GetMachineByName(r.Context(), name)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
 		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: fmt.Sprintf("Failed to get machine: %v", err)}); err != nil {
-			log.Printf("failed to encode error response: %v", err)
+			m.logger.ErrorContext(r.Context(), "failed to encode error response", "error", err)
 		}
 		return
 	}
@@ -310,34 +751,28 @@ func (m *Machines) GetMachineByNameHandler(w http.ResponseWriter, r *http.Reques
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusNotFound)
 		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Machine not found"}); err != nil {
-			log.Printf("failed to encode error response: %v", err)
+			m.logger.ErrorContext(r.Context(), "failed to encode error response", "error", err)
 		}
 		return
 	}
 
-	response := MachineResponse{
-		ID:        machine.ID,
-		Name:      machine.Name,
-		Hostname:  machine.Hostname,
-		IPv4:      &machine.IPv4,
-		NetworkID: machine.NetworkID,
-	}
+	response := newMachineResponse(*machine)
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("failed to encode network response: %v", err)
+		m.logger.ErrorContext(r.Context(), "failed to encode network response", "error", err)
 	}
 }
 
 func (m *Machines) GetMachineByIPv4Handler(w http.ResponseWriter, r *http.Request) {
 	ipv4 := chi.URLParam(r, "ipv4")
 
-	machine, err := m.store.GetMachineByIPv4(ipv4)
+	machine, err := m.store.GetMachineByIPv4(r.Context(), ipv4)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
 		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: fmt.Sprintf("Failed to get machine: %v", err)}); err != nil {
-			log.Printf("failed to encode error response: %v", err)
+			m.logger.ErrorContext(r.Context(), "failed to encode error response", "error", err)
 		}
 		return
 	}
@@ -346,128 +781,728 @@ func (m *Machines) GetMachineByIPv4Handler(w http.ResponseWriter, r *http.Reques
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusNotFound)
 		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Machine not found"}); err != nil {
-			log.Printf("failed to encode error response: %v", err)
+			m.logger.ErrorContext(r.Context(), "failed to encode error response", "error", err)
 		}
 		return
 	}
 
-	response := MachineResponse{
-		ID:        machine.ID,
-		Name:      machine.Name,
-		Hostname:  machine.Hostname,
-		IPv4:      &machine.IPv4,
-		NetworkID: machine.NetworkID,
-	}
+	response := newMachineResponse(*machine)
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("failed to encode ssh keys response: %v", err)
+		m.logger.ErrorContext(r.Context(), "failed to encode ssh keys response", "error", err)
+	}
+}
+
+// ipv4ValidationError returns a user-facing message describing why ip is not a
+// usable IPv4 address, or an empty string if it is valid. A well-formed IPv6
+// address gets a distinct message so callers know they used the wrong family.
+func ipv4ValidationError(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "Invalid IPv4 address format"
 	}
+	if parsed.To4() == nil {
+		return "Invalid IPv4 address: expected IPv4 but got IPv6 address"
+	}
+	return ""
 }
 
-func isIPv4(ip string) bool {
+// ipv6ValidationError returns a user-facing message if ip is not a valid IPv6
+// address, or "" if it is.
+func ipv6ValidationError(ip string) string {
 	parsed := net.ParseIP(ip)
-	return parsed != nil && parsed.To4() != nil
+	if parsed == nil {
+		return "Invalid IPv6 address format"
+	}
+	if parsed.To4() != nil {
+		return "Invalid IPv6 address: expected IPv6 but got IPv4 address"
+	}
+	return ""
+}
+
+// checkIPv6 validates a requested IPv6 address for the machine with the given
+// ID (0 when creating) and returns it in canonical form, "" when nil or empty.
+// It writes a 400 for an invalid address or a 409 if another machine has it,
+// and returns false.
+func (m *Machines) checkIPv6(ctx context.Context, w http.ResponseWriter, ipv6 *string, machineID int64) (string, bool) {
+	if ipv6 == nil || *ipv6 == "" {
+		return "", true
+	}
+	if msg := ipv6ValidationError(*ipv6); msg != "" {
+		m.writeMachineError(w, http.StatusBadRequest, msg)
+		return "", false
+	}
+	canonical := net.ParseIP(*ipv6).String()
+	if existing, _ := m.store.GetMachineByIPv6(ctx, canonical); existing != nil && existing.ID != machineID {
+		m.writeMachineConflict(w, existing, "A machine with this IPv6 address already exists")
+		return "", false
+	}
+	return canonical, true
+}
+
+// decodeRunCmdRequest decodes a requested runcmd list, returning a user-facing
+// message unless it is a JSON array of non-empty strings. A nil value is an
+// empty list.
+func decodeRunCmdRequest(raw json.RawMessage) ([]string, string) {
+	if raw == nil {
+		return nil, ""
+	}
+	var cmds []string
+	if err := json.Unmarshal(raw, &cmds); err != nil {
+		return nil, "runcmd must be an array of strings"
+	}
+	if slices.Contains(cmds, "") {
+		return nil, "runcmd entries must not be empty"
+	}
+	return cmds, ""
+}
+
+// ipInNetworkError returns a user-facing message if the network does not exist
+// or ip lies outside its subnet, or "" if the address fits.
+func (m *Machines) ipInNetworkError(ctx context.Context, networkID int64, ip string) string {
+	network, err := m.store.GetNetwork(ctx, networkID)
+	if err != nil {
+		return fmt.Sprintf("Network %d not found", networkID)
+	}
+	if _, subnet, err := net.ParseCIDR(network.Subnet); err != nil || !subnet.Contains(net.ParseIP(ip)) {
+		return fmt.Sprintf("IPv4 address %s is outside network %s subnet %s", ip, network.Name, network.Subnet)
+	}
+	return ""
+}
+
+// checkIPInNetwork verifies that ip lies within the subnet of the given network,
+// writing a 400 error response and returning false if the network does not exist
+// or the address is outside it.
+func (m *Machines) checkIPInNetwork(ctx context.Context, w http.ResponseWriter, networkID int64, ip string) bool {
+	msg := m.ipInNetworkError(ctx, networkID, ip)
+	if msg == "" {
+		return true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	if err := json.NewEncoder(w).Encode(ErrorResponse{Error: msg}); err != nil {
+		m.logger.Error("failed to encode error response", "error", err)
+	}
+	m.logger.Warn("IPv4 address rejected for network", "network_id", networkID, "ipv4", ip, "reason", msg)
+	return false
+}
+
+// checkMTU writes a 400 and returns false if a requested MTU override is out of range.
+func (m *Machines) checkMTU(w http.ResponseWriter, mtu *int) bool {
+	if mtu == nil || domain.ValidMTU(*mtu) {
+		return true
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	if err := json.NewEncoder(w).Encode(ErrorResponse{Error: fmt.Sprintf("MTU must be between %d and %d", domain.MinMTU, domain.MaxMTU)}); err != nil {
+		m.logger.Error("failed to encode error response", "error", err)
+	}
+	return false
+}
+
+// checkRunCmd decodes a requested runcmd list, writing a 400 and returning
+// false unless it is a JSON array of non-empty strings. A null value clears
+// the list.
+func (m *Machines) checkRunCmd(w http.ResponseWriter, raw json.RawMessage) ([]string, bool) {
+	cmds, msg := decodeRunCmdRequest(raw)
+	if msg == "" {
+		return cmds, true
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	if err := json.NewEncoder(w).Encode(ErrorResponse{Error: msg}); err != nil {
+		m.logger.Error("failed to encode error response", "error", err)
+	}
+	return nil, false
+}
+
+// userDataHeaders are the first-line markers cloud-init recognizes in stored
+// user-data and vendor-data
+var userDataHeaders = []string{"#cloud-config", "#!", "#cloud-boothook"}
+
+// userDataValidationError returns a user-facing message naming field unless
+// data is empty or starts with one of userDataHeaders.
+func userDataValidationError(field, data string) string {
+	if data == "" {
+		return ""
+	}
+	for _, header := range userDataHeaders {
+		if strings.HasPrefix(data, header) {
+			return ""
+		}
+	}
+	return field + " must start with #cloud-config, #! or #cloud-boothook"
+}
+
+// checkUserData writes a 400 and returns false if requested user-data or
+// vendor-data lacks a recognized header.
+func (m *Machines) checkUserData(w http.ResponseWriter, userData, vendorData *string) bool {
+	for _, field := range []struct {
+		name string
+		data *string
+	}{{"user_data", userData}, {"vendor_data", vendorData}} {
+		if field.data == nil {
+			continue
+		}
+		if msg := userDataValidationError(field.name, *field.data); msg != "" {
+			m.writeMachineError(w, http.StatusBadRequest, msg)
+			return false
+		}
+	}
+	return true
+}
+
+// UpdateMachineRequest is a partial machine update. Omitted fields keep their
+// current value; pointers tell an omitted field from one set to its zero value.
+type UpdateMachineRequest struct {
+	Name             *string         `json:"name,omitempty"`
+	Hostname         *string         `json:"hostname,omitempty"`
+	IPv4             *string         `json:"ipv4,omitempty"`
+	IPv6             *string         `json:"ipv6,omitempty"`       // Empty removes the address
+	NetworkID        *int64          `json:"network_id,omitempty"` // Moves the machine to this network
+	AvailabilityZone *string         `json:"availability_zone,omitempty"`
+	MTU              *int            `json:"mtu,omitempty"`
+	RunCmd           json.RawMessage `json:"runcmd,omitempty"`
+	UserData         *string         `json:"user_data,omitempty"`   // Empty reverts to generated cloud-config
+	VendorData       *string         `json:"vendor_data,omitempty"` // Empty reverts to the global vendor-data
+}
+
+// writeMachineError writes a JSON ErrorResponse with the given status
+func (m *Machines) writeMachineError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(ErrorResponse{Error: msg}); err != nil {
+		m.logger.Error("failed to encode error response", "error", err)
+	}
 }
 
 // UpdateMachineHandler handles PATCH /api/v0/machines/{id}.
 //
-// Request: JSON body with fields "name", "hostname", "ipv4".
-// Validates ID, required fields, and IPv4 format. Returns 400 for invalid input, 404 if not found, 500 for DB errors.
+// Request: JSON body with any of "name", "hostname", "ipv4", "ipv6", "availability_zone",
+// "mtu", "runcmd", "user_data", "vendor_data". Only the fields present are changed; an empty "ipv6" removes it. Validates supplied values the same way
+// as create, and that a networked machine's IPv4 stays in its network's subnet.
+// Returns 400 for invalid input, 404 if not found, 500 for DB errors.
 // Response: 200 OK with updated machine, or error JSON.
 func (m *Machines) UpdateMachineHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		m.writeMachineError(w, http.StatusBadRequest, "Invalid machine ID")
+		return
+	}
+
+	var req UpdateMachineRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		m.writeMachineError(w, http.StatusBadRequest, jsonErrorMessage(err, "Invalid JSON"))
+		return
+	}
+
+	if (req.Name != nil && *req.Name == "") || (req.Hostname != nil && *req.Hostname == "") {
+		m.writeMachineError(w, http.StatusBadRequest, "Name and Hostname cannot be empty")
+		return
+	}
+	if req.IPv4 != nil {
+		if msg := ipv4ValidationError(*req.IPv4); msg != "" {
+			m.writeMachineError(w, http.StatusBadRequest, msg)
+			return
+		}
+	}
+	if !m.checkMTU(w, req.MTU) {
+		return
+	}
+	runCmd, ok := m.checkRunCmd(w, req.RunCmd)
+	if !ok {
+		return
+	}
+	if !m.checkUserData(w, req.UserData, req.VendorData) {
+		return
+	}
+
+	ipv6, ok := m.checkIPv6(r.Context(), w, req.IPv6, id)
+	if !ok {
+		return
+	}
+
+	machine, ok := m.machineForUpdate(r.Context(), w, id)
+	if !ok {
+		return
+	}
+	fromNetworkID := machine.NetworkID
+	networkID, ok := m.updatedNetwork(r.Context(), w, machine, req.NetworkID, req.IPv4)
+	if !ok {
+		return
+	}
+	if !sameNetwork(networkID, fromNetworkID) {
+		// Moving without a static address takes a lease from the new network
+		machine.NetworkID = networkID
+		machine.IPv4 = ""
+	}
+
+	if req.Name != nil {
+		machine.Name = *req.Name
+	}
+	if req.Hostname != nil {
+		machine.Hostname = *req.Hostname
+	}
+	if req.IPv4 != nil {
+		machine.IPv4 = *req.IPv4
+	}
+	if req.IPv6 != nil {
+		machine.IPv6 = ipv6
+	}
+	if req.AvailabilityZone != nil {
+		machine.AvailabilityZone = *req.AvailabilityZone
+	}
+	if req.MTU != nil {
+		machine.MTU = *req.MTU
+	}
+	if req.RunCmd != nil {
+		machine.RunCmd = runCmd
+	}
+	if req.UserData != nil {
+		machine.UserData = *req.UserData
+	}
+	if req.VendorData != nil {
+		machine.VendorData = *req.VendorData
+	}
+
+	m.saveMachineUpdate(r.Context(), w, *machine, fromNetworkID)
+}
+
+// ReplaceMachineHandler handles PUT /api/v0/machines/{id}.
+//
+// Request: the same JSON body as create. The machine is replaced as a whole: "name"
+// and "hostname" are required, "ipv4" is required unless the machine is on a network
+// (where omitting it keeps the allocated address), and omitted optional fields reset
+// to their defaults. Metadata enablement is left as is. Returns 400 for invalid
+// input, 404 if not found, 500 for DB errors.
+// Response: 200 OK with the replaced machine, or error JSON.
+func (m *Machines) ReplaceMachineHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		m.writeMachineError(w, http.StatusBadRequest, "Invalid machine ID")
+		return
+	}
+
+	var req CreateMachineRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		m.writeMachineError(w, http.StatusBadRequest, jsonErrorMessage(err, "Invalid JSON"))
+		return
+	}
+
+	if req.Name == "" || req.Hostname == "" {
+		m.writeMachineError(w, http.StatusBadRequest, "Name and Hostname are required")
+		return
+	}
+	if req.IPv4 != nil {
+		if msg := ipv4ValidationError(*req.IPv4); msg != "" {
+			m.writeMachineError(w, http.StatusBadRequest, msg)
+			return
+		}
+	}
+	if !m.checkMTU(w, req.MTU) {
+		return
+	}
+	runCmd, ok := m.checkRunCmd(w, req.RunCmd)
+	if !ok {
+		return
+	}
+	if !m.checkUserData(w, req.UserData, req.VendorData) {
+		return
+	}
+
+	ipv6, ok := m.checkIPv6(r.Context(), w, req.IPv6, id)
+	if !ok {
+		return
+	}
+
+	machine, ok := m.machineForUpdate(r.Context(), w, id)
+	if !ok {
+		return
+	}
+	networkID, ok := m.updatedNetwork(r.Context(), w, machine, req.NetworkID, req.IPv4)
+	if !ok {
+		return
+	}
+	if req.IPv4 == nil && networkID == nil {
+		m.writeMachineError(w, http.StatusBadRequest, "IPv4 is required for machines without a network")
+		return
+	}
+
+	replacement := Machine{
+		ID:               machine.ID,
+		Name:             req.Name,
+		Hostname:         req.Hostname,
+		IPv4:             machine.IPv4,
+		IPv6:             ipv6,
+		NetworkID:        networkID,
+		MetadataDisabled: machine.MetadataDisabled,
+		RunCmd:           runCmd,
+	}
+	if !sameNetwork(networkID, machine.NetworkID) {
+		replacement.IPv4 = "" // Leased from the new network unless given below
+	}
+	if req.IPv4 != nil {
+		replacement.IPv4 = *req.IPv4
+	}
+	if req.AvailabilityZone != nil {
+		replacement.AvailabilityZone = *req.AvailabilityZone
+	}
+	if req.MTU != nil {
+		replacement.MTU = *req.MTU
+	}
+	if req.UserData != nil {
+		replacement.UserData = *req.UserData
+	}
+	if req.VendorData != nil {
+		replacement.VendorData = *req.VendorData
+	}
+
+	m.saveMachineUpdate(r.Context(), w, replacement, machine.NetworkID)
+}
+
+// machineForUpdate loads the machine an update targets, writing the error
+// response and returning false if it does not exist.
+func (m *Machines) machineForUpdate(ctx context.Context, w http.ResponseWriter, id int64) (*Machine, bool) {
+	machine, err := m.store.GetMachine(ctx, id)
+	if err != nil {
+		m.writeMachineError(w, http.StatusInternalServerError, "Failed to get machine")
+		return nil, false
+	}
+	if machine == nil {
+		m.writeMachineError(w, http.StatusNotFound, "Machine not found")
+		return nil, false
+	}
+	return machine, true
+}
+
+// updatedNetwork returns the network the machine is on after an update that
+// asks for networkID (nil keeps the current one) and a static ipv4 (nil when
+// not given). It writes a 400 and returns false if the new network does
+// not exist or the static address lies outside the resulting network's subnet.
+func (m *Machines) updatedNetwork(ctx context.Context, w http.ResponseWriter, machine *Machine, networkID *int64, ipv4 *string) (*int64, bool) {
+	target := machine.NetworkID
+	if networkID != nil && (target == nil || *target != *networkID) {
+		if _, err := m.store.GetNetwork(ctx, *networkID); err != nil {
+			m.writeMachineError(w, http.StatusBadRequest, fmt.Sprintf("Network %d not found", *networkID))
+			return nil, false
+		}
+		target = networkID
+	}
+	if ipv4 != nil && target != nil && !m.checkIPInNetwork(ctx, w, *target, *ipv4) {
+		return nil, false
+	}
+	return target, true
+}
+
+// sameNetwork reports whether two optional network IDs name the same network
+func sameNetwork(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// saveMachineUpdate stores an updated machine and writes it as the response.
+// fromNetworkID is the machine's network before the update; when the machine
+// has changed networks the store moves its lease, and a new network without a
+// free address is a 409.
+func (m *Machines) saveMachineUpdate(ctx context.Context, w http.ResponseWriter, machine Machine, fromNetworkID *int64) {
+	var updated Machine
+	var err error
+	if !sameNetwork(machine.NetworkID, fromNetworkID) {
+		updated, err = m.store.MoveMachineNetwork(ctx, machine, fromNetworkID)
+	} else {
+		updated, err = m.store.CreateMachine(ctx, machine) // CreateMachine handles both create and update
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrInsufficientCapacity) {
+			m.writeMachineError(w, http.StatusConflict, fmt.Sprintf("Network %d has no free addresses", *machine.NetworkID))
+			return
+		}
+		m.logger.Error("failed to update machine", "machine_id", machine.ID, "error", err)
+		m.writeMachineError(w, http.StatusInternalServerError, "Failed to update machine")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(newMachineResponse(updated)); err != nil {
+		m.logger.Error("failed to encode update response", "error", err)
+	}
+}
+
+// GetMachineNetworkConfigHandler returns the rendered network-config for a machine,
+// independent of the requesting client's IP, for operator inspection.
+func (m *Machines) GetMachineNetworkConfigHandler(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid machine ID"}); err != nil {
-			log.Printf("failed to encode error response: %v", err)
+			m.logger.ErrorContext(r.Context(), "failed to encode error response", "error", err)
 		}
 		return
 	}
 
-	var req CreateMachineRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	machine, err := m.store.GetMachine(r.Context(), id)
+	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid JSON"}); err != nil {
-			log.Printf("failed to encode error response: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: fmt.Sprintf("Failed to get machine: %v", err)}); err != nil {
+			m.logger.ErrorContext(r.Context(), "failed to encode error response", "error", err)
 		}
 		return
 	}
 
-	// Validate required fields
-	if req.Name == "" || req.Hostname == "" {
+	if machine == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Machine not found"}); err != nil {
+			m.logger.ErrorContext(r.Context(), "failed to encode error response", "error", err)
+		}
+		return
+	}
+
+	networkConfig, err := m.store.RenderNetworkConfig(r.Context(), machine)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: fmt.Sprintf("Failed to render network config: %v", err)}); err != nil {
+			m.logger.ErrorContext(r.Context(), "failed to encode error response", "error", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/yaml")
+	if _, err := w.Write([]byte(networkConfig)); err != nil {
+		m.logger.ErrorContext(r.Context(), "failed to write network config", "error", err)
+	}
+}
+
+// GetMachineMetaDataByNameHandler handles GET /api/v0/machines/name/{name}/meta-data and
+// renders the NoCloud meta-data the named machine would receive, for operator inspection.
+func (m *Machines) GetMachineMetaDataByNameHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	machine, err := m.store.GetMachineByName(r.Context(), name)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: fmt.Sprintf("Failed to get machine: %v", err)}); err != nil {
+			m.logger.ErrorContext(r.Context(), "failed to encode error response", "error", err)
+		}
+		return
+	}
+
+	if machine == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Machine not found"}); err != nil {
+			m.logger.ErrorContext(r.Context(), "failed to encode error response", "error", err)
+		}
+		return
+	}
+
+	subnet, err := machineSubnet(r.Context(), m.store.GetNetwork, machine)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: fmt.Sprintf("Failed to get network: %v", err)}); err != nil {
+			m.logger.ErrorContext(r.Context(), "failed to encode error response", "error", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/yaml; charset=utf-8")
+	if _, err := w.Write([]byte(renderNoCloudMetaData(machine, subnet, m.dnsDomain))); err != nil {
+		m.logger.ErrorContext(r.Context(), "failed to write meta-data", "error", err)
+	}
+}
+
+// DisableMachineMetadataHandler handles POST /api/v0/machines/{id}/disable and stops
+// serving metadata to the machine without deleting it.
+func (m *Machines) DisableMachineMetadataHandler(w http.ResponseWriter, r *http.Request) {
+	m.setMachineMetadataEnabled(w, r, false)
+}
+
+// EnableMachineMetadataHandler handles POST /api/v0/machines/{id}/enable and resumes
+// serving metadata to a previously disabled machine.
+func (m *Machines) EnableMachineMetadataHandler(w http.ResponseWriter, r *http.Request) {
+	m.setMachineMetadataEnabled(w, r, true)
+}
+
+func (m *Machines) setMachineMetadataEnabled(w http.ResponseWriter, r *http.Request, enabled bool) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
-		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Name and Hostname are required"}); err != nil {
-			log.Printf("failed to encode error response: %v", err)
+		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid machine ID"}); err != nil {
+			m.logger.ErrorContext(r.Context(), "failed to encode error response", "error", err)
 		}
 		return
 	}
 
-	// Validate IPv4 format if provided
-	if req.IPv4 != nil && *req.IPv4 != "" {
-		if net.ParseIP(*req.IPv4) == nil || !isIPv4(*req.IPv4) {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-			if err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid IPv4 address format"}); err != nil {
-				log.Printf("failed to encode error response: %v", err)
-			}
+	machine, err := m.store.SetMachineMetadataEnabled(r.Context(), id, enabled)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: fmt.Sprintf("Failed to update machine: %v", err)}); err != nil {
+			m.logger.ErrorContext(r.Context(), "failed to encode error response", "error", err)
+		}
+		return
+	}
+
+	if machine == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Machine not found"}); err != nil {
+			m.logger.ErrorContext(r.Context(), "failed to encode error response", "error", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(newMachineResponse(*machine)); err != nil {
+		m.logger.ErrorContext(r.Context(), "failed to encode machine response", "error", err)
+	}
+}
+
+// PinMachineIPHandler handles POST /api/v0/machines/{id}/pin.
+//
+// Converts the machine's dynamic lease into a static address: the leased IP stays on
+// the machine, the lease is released and the machine leaves its network, unless
+// ?keep_network=true is given. Returns 404 if the machine does not exist, 409 if it
+// holds no lease, 500 for DB errors.
+// Response: 200 OK with the pinned machine, or error JSON.
+func (m *Machines) PinMachineIPHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		m.writeMachineError(w, http.StatusBadRequest, "Invalid machine ID")
+		return
+	}
+
+	machine, err := m.store.PinMachineIP(r.Context(), id, r.URL.Query().Get("keep_network") == "true")
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			m.writeMachineError(w, http.StatusConflict, "Machine has no dynamic lease to pin")
 			return
 		}
+		m.logger.ErrorContext(r.Context(), "failed to pin IP", "machine_id", id, "error", err)
+		m.writeMachineError(w, http.StatusInternalServerError, "Failed to pin machine IP")
+		return
+	}
+	if machine == nil {
+		m.writeMachineError(w, http.StatusNotFound, "Machine not found")
+		return
 	}
 
-	// Get the machine via store interface
-	machine, err := m.store.GetMachine(id)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(newMachineResponse(*machine)); err != nil {
+		m.logger.ErrorContext(r.Context(), "failed to encode machine response", "error", err)
+	}
+}
+
+// MachineDeletePreviewHandler handles GET /api/v0/machines/{id}/delete-preview and
+// reports the data a delete would remove, without deleting anything.
+func (m *Machines) MachineDeletePreviewHandler(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid machine ID"}); err != nil {
+			m.logger.ErrorContext(r.Context(), "failed to encode error response", "error", err)
+		}
+		return
+	}
+
+	preview, err := m.store.PreviewMachineDelete(r.Context(), id)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
-		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Failed to get machine"}); err != nil {
-			log.Printf("failed to encode error response: %v", err)
+		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: fmt.Sprintf("Failed to preview machine delete: %v", err)}); err != nil {
+			m.logger.ErrorContext(r.Context(), "failed to encode error response", "error", err)
 		}
 		return
 	}
 
-	if machine == nil {
+	if preview == nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusNotFound)
 		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Machine not found"}); err != nil {
-			log.Printf("failed to encode error response: %v", err)
+			m.logger.ErrorContext(r.Context(), "failed to encode error response", "error", err)
 		}
 		return
 	}
 
-	// Update machine fields
-	machine.Name = req.Name
-	machine.Hostname = req.Hostname
-	if req.IPv4 != nil && *req.IPv4 != "" {
-		machine.IPv4 = *req.IPv4
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(preview); err != nil {
+		m.logger.ErrorContext(r.Context(), "failed to encode delete preview response", "error", err)
+	}
+}
+
+// MachineDetailHandler handles GET /api/v0/machines/{id}/detail and returns the
+// machine with its network, DHCP range, SSH keys, key groups and lease.
+func (m *Machines) MachineDetailHandler(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid machine ID"}); err != nil {
+			m.logger.ErrorContext(r.Context(), "failed to encode error response", "error", err)
+		}
+		return
 	}
 
-	// Save via store interface
-	updated, err := m.store.CreateMachine(*machine) // CreateMachine handles both create and update
+	detail, err := m.store.GetMachineDetail(r.Context(), id)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
-		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Failed to update machine"}); err != nil {
-			log.Printf("failed to encode error response: %v", err)
+		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: fmt.Sprintf("Failed to get machine detail: %v", err)}); err != nil {
+			m.logger.ErrorContext(r.Context(), "failed to encode error response", "error", err)
 		}
 		return
 	}
 
-	response := MachineResponse{
-		ID:        updated.ID,
-		Name:      updated.Name,
-		Hostname:  updated.Hostname,
-		IPv4:      &updated.IPv4,
-		NetworkID: updated.NetworkID,
+	if detail == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		if err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Machine not found"}); err != nil {
+			m.logger.ErrorContext(r.Context(), "failed to encode error response", "error", err)
+		}
+		return
+	}
+
+	response := MachineDetailResponse{
+		MachineResponse: newMachineResponse(detail.Machine),
+		Network:         detail.Network,
+		DHCPRange:       detail.DHCPRange,
+		SSHKeys:         make([]SSHKeyResponse, len(detail.SSHKeys)),
+		KeyGroups:       make([]KeyGroupResponse, len(detail.KeyGroups)),
+	}
+	for i, k := range detail.SSHKeys {
+		response.SSHKeys[i] = SSHKeyResponse{ID: k.ID, MachineID: k.MachineID, KeyText: k.KeyText}
+	}
+	for i, g := range detail.KeyGroups {
+		response.KeyGroups[i] = KeyGroupResponse{ID: g.ID, Name: g.Name}
+	}
+	if lease := detail.Lease; lease != nil {
+		response.Lease = &MachineLeaseResponse{
+			NetworkID: lease.NetworkID,
+			IPAddress: lease.IPAddress,
+			LeaseTime: lease.LeaseTime,
+			CreatedAt: lease.CreatedAt,
+			ExpiresAt: leaseExpiry(*lease),
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("failed to encode update response: %v", err)
+		m.logger.ErrorContext(r.Context(), "failed to encode machine detail response", "error", err)
 	}
 }
@@ -4,102 +4,220 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
 
 	"github.com/jbweber/homelab/nook/internal/domain"
 	"github.com/jbweber/homelab/nook/internal/repository"
 )
 
 // ListMachines implements MachinesStore interface
-func (a *API) ListMachines() ([]Machine, error) {
-	machines, err := a.machineRepo.FindAll(context.Background())
+func (a *API) ListMachines(ctx context.Context) ([]Machine, error) {
+	machines, err := a.machineRepo.FindAll(ctx)
 	if err != nil {
 		return nil, err
 	}
-	// Convert domain.Machine to api.Machine
 	var result []Machine
 	for _, m := range machines {
-		result = append(result, Machine{
-			ID:        m.ID,
-			Name:      m.Name,
-			Hostname:  m.Hostname,
-			IPv4:      m.IPv4,
-			NetworkID: m.NetworkID,
-		})
+		result = append(result, machineFromDomain(m))
 	}
 	return result, nil
 }
 
-// CreateMachine implements MachinesStore interface
-func (a *API) CreateMachine(m Machine) (Machine, error) {
-	// Convert api.Machine to domain.Machine
-	domainMachine := domain.Machine{
-		ID:        m.ID,
-		Name:      m.Name,
-		Hostname:  m.Hostname,
-		IPv4:      m.IPv4,
-		NetworkID: m.NetworkID,
+// ListMachinesPage returns up to limit machines ordered by ID starting at
+// offset, together with the total number of machines.
+func (a *API) ListMachinesPage(ctx context.Context, limit, offset int) ([]Machine, int, error) {
+	total, err := a.machineRepo.Count(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	machines, err := a.machineRepo.FindAllPaged(ctx, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	result := make([]Machine, 0, len(machines))
+	for _, m := range machines {
+		result = append(result, machineFromDomain(m))
+	}
+	return result, total, nil
+}
+
+// ListMachinesAfter returns up to limit machines with an ID above afterID,
+// ordered by ID
+func (a *API) ListMachinesAfter(ctx context.Context, afterID int64, limit int) ([]Machine, error) {
+	machines, err := a.machineRepo.FindAllAfterID(ctx, afterID, limit)
+	if err != nil {
+		return nil, err
 	}
-	saved, err := a.machineRepo.Save(context.Background(), domainMachine)
+	result := make([]Machine, 0, len(machines))
+	for _, m := range machines {
+		result = append(result, machineFromDomain(m))
+	}
+	return result, nil
+}
+
+// ListNetworkMachines returns the machines on a network ordered by ID
+func (a *API) ListNetworkMachines(ctx context.Context, networkID int64) ([]Machine, error) {
+	machines, err := a.machineRepo.FindByNetworkID(ctx, networkID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Machine, 0, len(machines))
+	for _, m := range machines {
+		result = append(result, machineFromDomain(m))
+	}
+	return result, nil
+}
+
+// DuplicateHostnames returns the names of machines sharing a hostname, keyed
+// by lowercased hostname. Hostnames without collisions are omitted.
+func (a *API) DuplicateHostnames() (map[string][]string, error) {
+	machines, err := a.machineRepo.FindAll(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	byHostname := make(map[string][]string)
+	for _, m := range machines {
+		key := strings.ToLower(m.Hostname)
+		byHostname[key] = append(byHostname[key], m.Name)
+	}
+	for hostname, names := range byHostname {
+		if len(names) < 2 {
+			delete(byHostname, hostname)
+		}
+	}
+	return byHostname, nil
+}
+
+// LogDuplicateHostnames logs a warning for each hostname shared by more than
+// one machine, for running once at startup.
+func (a *API) LogDuplicateHostnames() error {
+	duplicates, err := a.DuplicateHostnames()
+	if err != nil {
+		return fmt.Errorf("failed to check for duplicate hostnames: %w", err)
+	}
+	hostnames := slices.Sorted(maps.Keys(duplicates))
+	for _, hostname := range hostnames {
+		log.Printf("warning: hostname %q is shared by machines %s", hostname, strings.Join(duplicates[hostname], ", "))
+	}
+	return nil
+}
+
+// CreateMachine implements MachinesStore interface
+func (a *API) CreateMachine(ctx context.Context, m Machine) (Machine, error) {
+	domainMachine := machineToDomain(m)
+	saved, err := a.machineRepo.Save(ctx, domainMachine)
 	if err != nil {
 		return Machine{}, err
 	}
 
 	// If network_id is provided but no IPv4, allocate IP after machine creation
 	if m.NetworkID != nil && m.IPv4 == "" {
-		lease, err := a.ipLeaseRepo.AllocateIPAddress(context.Background(), saved.ID, *m.NetworkID)
+		lease, err := a.ipLeaseRepo.AllocateIPAddress(ctx, saved.ID, *m.NetworkID)
 		if err != nil {
 			// If IP allocation fails, delete the machine and return error
-			if deleteErr := a.machineRepo.DeleteByID(context.Background(), saved.ID); deleteErr != nil {
-				fmt.Printf("Warning: failed to delete machine after IP allocation failure: %v\n", deleteErr)
+			if deleteErr := a.machineRepo.DeleteByID(ctx, saved.ID); deleteErr != nil {
+				a.logger.Warn("failed to delete machine after IP allocation failure", "machine_id", saved.ID, "network_id", *m.NetworkID, "error", deleteErr)
 			}
 			return Machine{}, fmt.Errorf("failed to allocate IP address: %w", err)
 		}
 		// Update the machine with the allocated IP
 		saved.IPv4 = lease.IPAddress
-		updated, err := a.machineRepo.Save(context.Background(), saved)
+		updated, err := a.machineRepo.Save(ctx, saved)
 		if err != nil {
 			// If update fails, deallocate the IP
-			if deallocErr := a.ipLeaseRepo.DeallocateIPAddress(context.Background(), saved.ID, *m.NetworkID); deallocErr != nil {
-				fmt.Printf("Warning: failed to deallocate IP after machine update failure: %v\n", deallocErr)
+			if deallocErr := a.ipLeaseRepo.DeallocateIPAddress(ctx, saved.ID, *m.NetworkID); deallocErr != nil {
+				a.logger.Warn("failed to deallocate IP after machine update failure", "machine_id", saved.ID, "network_id", *m.NetworkID, "error", deallocErr)
 			}
 			return Machine{}, err
 		}
 		saved = updated
 	}
 
-	// Convert back to api.Machine
-	return Machine{
-		ID:        saved.ID,
-		Name:      saved.Name,
-		Hostname:  saved.Hostname,
-		IPv4:      saved.IPv4,
-		NetworkID: saved.NetworkID,
-	}, nil
+	return machineFromDomain(saved), nil
+}
+
+// MoveMachineNetwork implements MachinesStore interface. It saves m after a move
+// off fromNetworkID (nil when the machine had no network): a machine joining a
+// network without a static IPv4 is leased an address from it first, then the
+// lease on the old network, if any, is released. If the new network has no free
+// address the error wraps repository.ErrInsufficientCapacity and nothing changes.
+func (a *API) MoveMachineNetwork(ctx context.Context, m Machine, fromNetworkID *int64) (Machine, error) {
+	var lease *domain.IPAddressLease
+	if m.NetworkID != nil && m.IPv4 == "" {
+		var err error
+		lease, err = a.ipLeaseRepo.AllocateIPAddress(ctx, m.ID, *m.NetworkID)
+		if err != nil {
+			return Machine{}, fmt.Errorf("failed to allocate IP address: %w", err)
+		}
+		m.IPv4 = lease.IPAddress
+	}
+
+	saved, err := a.machineRepo.Save(ctx, machineToDomain(m))
+	if err != nil {
+		if lease != nil {
+			if deallocErr := a.ipLeaseRepo.DeallocateIPAddress(ctx, m.ID, *m.NetworkID); deallocErr != nil {
+				a.logger.Warn("failed to deallocate IP after machine update failure", "machine_id", m.ID, "network_id", *m.NetworkID, "error", deallocErr)
+			}
+		}
+		return Machine{}, err
+	}
+
+	// Machines with a static address on a network hold no lease there
+	if fromNetworkID != nil {
+		if err := a.ipLeaseRepo.DeallocateIPAddress(ctx, m.ID, *fromNetworkID); err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return Machine{}, fmt.Errorf("failed to release lease on network %d: %w", *fromNetworkID, err)
+		}
+	}
+	return machineFromDomain(saved), nil
 }
 
 // GetMachine implements MachinesStore interface
-func (a *API) GetMachine(id int64) (*Machine, error) {
-	machine, err := a.machineRepo.FindByID(context.Background(), id)
+func (a *API) GetMachine(ctx context.Context, id int64) (*Machine, error) {
+	machine, err := a.machineRepo.FindByID(ctx, id)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
 			return nil, nil
 		}
 		return nil, err
 	}
-	// Convert domain.Machine to api.Machine
-	return &Machine{
-		ID:        machine.ID,
-		Name:      machine.Name,
-		Hostname:  machine.Hostname,
-		IPv4:      machine.IPv4,
-		NetworkID: machine.NetworkID,
-	}, nil
+	result := machineFromDomain(machine)
+	return &result, nil
+}
+
+// SetMachineMetadataEnabled implements MachinesStore interface. Returns nil if
+// the machine does not exist.
+func (a *API) SetMachineMetadataEnabled(ctx context.Context, id int64, enabled bool) (*Machine, error) {
+	if err := a.machineRepo.SetMetadataEnabled(ctx, id, enabled); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return a.GetMachine(ctx, id)
+}
+
+// PinMachineIP implements MachinesStore interface. Returns nil if the machine
+// does not exist, and repository.ErrNotFound if it holds no lease to pin.
+func (a *API) PinMachineIP(ctx context.Context, id int64, keepNetwork bool) (*Machine, error) {
+	machine, err := a.GetMachine(ctx, id)
+	if err != nil || machine == nil {
+		return nil, err
+	}
+	if _, err := a.ipLeaseRepo.PinMachineLease(ctx, id, keepNetwork); err != nil {
+		return nil, err
+	}
+	// The machine was readdressed behind the machine repository's back
+	a.machineRepo.Invalidate()
+	return a.GetMachine(ctx, id)
 }
 
 // DeleteMachine implements MachinesStore interface
-func (a *API) DeleteMachine(id int64) error {
+func (a *API) DeleteMachine(ctx context.Context, id int64) error {
 	// First, get the machine to check if it has a network-allocated IP
-	machine, err := a.machineRepo.FindByID(context.Background(), id)
+	machine, err := a.machineRepo.FindByID(ctx, id)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
 			return nil // Machine doesn't exist, consider it deleted
@@ -109,38 +227,130 @@ func (a *API) DeleteMachine(id int64) error {
 
 	// If the machine has a network_id and IPv4, deallocate the IP
 	if machine.NetworkID != nil && machine.IPv4 != "" {
-		if deallocErr := a.ipLeaseRepo.DeallocateIPAddress(context.Background(), machine.ID, *machine.NetworkID); deallocErr != nil {
+		if deallocErr := a.ipLeaseRepo.DeallocateIPAddress(ctx, machine.ID, *machine.NetworkID); deallocErr != nil {
 			// Log the error but don't fail the deletion
-			fmt.Printf("Warning: failed to deallocate IP for machine %d: %v\n", machine.ID, deallocErr)
+			a.logger.Warn("failed to deallocate IP for deleted machine", "machine_id", machine.ID, "network_id", *machine.NetworkID, "error", deallocErr)
 		}
 	}
 
 	// Delete the machine
-	return a.machineRepo.DeleteByID(context.Background(), id)
+	return a.machineRepo.DeleteByID(ctx, id)
 }
 
 // GetMachineByName implements MachinesStore interface
-func (a *API) GetMachineByName(name string) (*Machine, error) {
-	machine, err := a.machineRepo.FindByName(context.Background(), name)
+func (a *API) GetMachineByName(ctx context.Context, name string) (*Machine, error) {
+	machine, err := a.machineRepo.FindByName(ctx, name)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	result := machineFromDomain(machine)
+	return &result, nil
+}
+
+// PreviewMachineDelete implements MachinesStore interface
+func (a *API) PreviewMachineDelete(ctx context.Context, id int64) (*MachineDeletePreview, error) {
+	machine, err := a.machineRepo.FindByID(ctx, id)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
 			return nil, nil
 		}
 		return nil, err
 	}
-	// Convert domain.Machine to api.Machine
-	return &Machine{
-		ID:        machine.ID,
-		Name:      machine.Name,
-		Hostname:  machine.Hostname,
-		IPv4:      machine.IPv4,
-		NetworkID: machine.NetworkID,
+
+	keys, err := a.sshKeyRepo.FindByMachineID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	leases, err := a.ipLeaseRepo.FindByMachineID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// The machine's address is freed whether it is static or held by a lease
+	ipv4 := machine.IPv4
+	if ipv4 == "" && len(leases) > 0 {
+		ipv4 = leases[0].IPAddress
+	}
+
+	return &MachineDeletePreview{
+		MachineID: machine.ID,
+		SSHKeys:   len(keys),
+		Leases:    len(leases),
+		IPFreed:   ipv4 != "",
+		IPv4:      ipv4,
 	}, nil
 }
 
+// GetMachineDetail implements MachinesStore interface. It issues a fixed number of
+// queries regardless of how many keys or groups the machine has, and returns nil
+// if the machine does not exist.
+func (a *API) GetMachineDetail(ctx context.Context, id int64) (*MachineDetail, error) {
+	machine, err := a.machineRepo.FindByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	detail := &MachineDetail{Machine: machineFromDomain(machine), SSHKeys: []SSHKey{}, KeyGroups: []domain.KeyGroup{}}
+
+	keys, err := a.sshKeyRepo.FindByMachineID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		detail.SSHKeys = append(detail.SSHKeys, SSHKey{ID: k.ID, MachineID: k.MachineID, KeyText: k.KeyText})
+	}
+	if a.keyGroupRepo != nil {
+		if detail.KeyGroups, err = a.keyGroupRepo.FindGroupsForMachine(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	leases, err := a.ipLeaseRepo.FindByMachineID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(leases) > 0 {
+		l := leases[0]
+		detail.Lease = &MachineLease{NetworkID: l.NetworkID, IPAddress: l.IPAddress, LeaseTime: l.LeaseTime, CreatedAt: l.CreatedAt}
+	}
+
+	networkID := machine.NetworkID
+	if networkID == nil && detail.Lease != nil {
+		networkID = &detail.Lease.NetworkID
+	}
+	if networkID == nil {
+		return detail, nil
+	}
+	network, err := a.networkRepo.FindByID(ctx, *networkID)
+	if err != nil {
+		return nil, err
+	}
+	detail.Network = &network
+
+	if detail.Lease != nil {
+		ranges, err := a.dhcpRangeRepo.FindByNetworkID(ctx, network.ID)
+		if err != nil {
+			return nil, err
+		}
+		leased := domain.DHCPRange{StartIP: detail.Lease.IPAddress, EndIP: detail.Lease.IPAddress}
+		for i := range ranges {
+			if dhcpRangesOverlap(ranges[i], leased) {
+				detail.DHCPRange = &ranges[i]
+				break
+			}
+		}
+	}
+	return detail, nil
+}
+
 // AllocateIPAddress implements MachinesStore interface
-func (a *API) AllocateIPAddress(machineID, networkID int64) (string, error) {
-	lease, err := a.ipLeaseRepo.AllocateIPAddress(context.Background(), machineID, networkID)
+func (a *API) AllocateIPAddress(ctx context.Context, machineID, networkID int64) (string, error) {
+	lease, err := a.ipLeaseRepo.AllocateIPAddress(ctx, machineID, networkID)
 	if err != nil {
 		return "", err
 	}
@@ -148,25 +358,105 @@ func (a *API) AllocateIPAddress(machineID, networkID int64) (string, error) {
 }
 
 // DeallocateIPAddress implements MachinesStore interface
-func (a *API) DeallocateIPAddress(machineID, networkID int64) error {
-	return a.ipLeaseRepo.DeallocateIPAddress(context.Background(), machineID, networkID)
+func (a *API) DeallocateIPAddress(ctx context.Context, machineID, networkID int64) error {
+	return a.ipLeaseRepo.DeallocateIPAddress(ctx, machineID, networkID)
+}
+
+// ListMachineLeases implements MachinesStore interface
+func (a *API) ListMachineLeases(ctx context.Context) (map[int64]MachineLease, error) {
+	leases, err := a.ipLeaseRepo.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[int64]MachineLease, len(leases))
+	for _, l := range leases {
+		result[l.MachineID] = MachineLease{
+			NetworkID: l.NetworkID,
+			IPAddress: l.IPAddress,
+			LeaseTime: l.LeaseTime,
+			CreatedAt: l.CreatedAt,
+		}
+	}
+	return result, nil
+}
+
+// CreateMachines implements MachinesStore interface. The machines are created
+// in one transaction; a failure is a *repository.BatchItemError and leaves
+// nothing behind.
+func (a *API) CreateMachines(ctx context.Context, machines []Machine) ([]Machine, error) {
+	batch := make([]domain.Machine, len(machines))
+	for i, m := range machines {
+		batch[i] = machineToDomain(m)
+	}
+	saved, err := a.machineRepo.CreateMachines(ctx, batch)
+	if err != nil {
+		return nil, err
+	}
+	created := make([]Machine, len(saved))
+	for i, m := range saved {
+		created[i] = machineFromDomain(m)
+	}
+	return created, nil
 }
 
 // GetMachineByIPv4 implements MetaDataStore interface
-func (a *API) GetMachineByIPv4(ipv4 string) (*Machine, error) {
-	machine, err := a.machineRepo.FindByIPv4(context.Background(), ipv4)
+func (a *API) GetMachineByIPv4(ctx context.Context, ipv4 string) (*Machine, error) {
+	machine, err := a.machineRepo.FindByIPv4(ctx, ipv4)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
 			return nil, nil
 		}
 		return nil, err
 	}
-	// Convert domain.Machine to api.Machine
-	return &Machine{
-		ID:        machine.ID,
-		Name:      machine.Name,
-		Hostname:  machine.Hostname,
-		IPv4:      machine.IPv4,
-		NetworkID: machine.NetworkID,
-	}, nil
+	result := machineFromDomain(machine)
+	return &result, nil
+}
+
+// GetMachineByIPv6 implements MetaDataStore interface
+func (a *API) GetMachineByIPv6(ctx context.Context, ipv6 string) (*Machine, error) {
+	machine, err := a.machineRepo.FindByIPv6(ctx, ipv6)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	result := machineFromDomain(machine)
+	return &result, nil
+}
+
+// machineFromDomain converts a domain.Machine to an api.Machine
+func machineFromDomain(m domain.Machine) Machine {
+	return Machine{
+		ID:               m.ID,
+		Name:             m.Name,
+		Hostname:         m.Hostname,
+		IPv4:             m.IPv4,
+		IPv6:             m.IPv6,
+		NetworkID:        m.NetworkID,
+		AvailabilityZone: m.AvailabilityZone,
+		MetadataDisabled: m.MetadataDisabled,
+		MTU:              m.MTU,
+		RunCmd:           m.RunCmd,
+		UserData:         m.UserData,
+		VendorData:       m.VendorData,
+	}
+}
+
+// machineToDomain converts an api.Machine to a domain.Machine
+func machineToDomain(m Machine) domain.Machine {
+	return domain.Machine{
+		ID:               m.ID,
+		Name:             m.Name,
+		Hostname:         m.Hostname,
+		IPv4:             m.IPv4,
+		IPv6:             m.IPv6,
+		NetworkID:        m.NetworkID,
+		AvailabilityZone: m.AvailabilityZone,
+		MetadataDisabled: m.MetadataDisabled,
+		MTU:              m.MTU,
+		RunCmd:           m.RunCmd,
+		UserData:         m.UserData,
+		VendorData:       m.VendorData,
+	}
 }
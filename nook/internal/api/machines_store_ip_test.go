@@ -65,11 +65,31 @@ func (m *mockIPLeaseRepo) IsIPAddressAvailable(ctx context.Context, networkID in
 	return false, errors.New("not implemented")
 }
 
+func (m *mockIPLeaseRepo) FindIPUsage(ctx context.Context) ([]domain.IPUsage, error) {
+	return nil, nil
+}
+
+func (m *mockIPLeaseRepo) MigrateNetwork(ctx context.Context, sourceNetworkID, targetNetworkID int64) (int, error) {
+	return 0, errors.New("not implemented")
+}
+
+func (m *mockIPLeaseRepo) ReserveIPAddresses(ctx context.Context, networkID int64, count int, token string) ([]domain.IPReservation, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *mockIPLeaseRepo) ReleaseIPReservations(ctx context.Context, networkID int64, token string) (int, error) {
+	return 0, errors.New("not implemented")
+}
+
+func (m *mockIPLeaseRepo) PinMachineLease(ctx context.Context, machineID int64, keepNetwork bool) (string, error) {
+	return "", errors.New("not implemented")
+}
+
 func TestAPI_AllocateIPAddress_Success(t *testing.T) {
 	mockRepo := &mockIPLeaseRepo{}
 	api := &API{ipLeaseRepo: mockRepo}
 
-	ip, err := api.AllocateIPAddress(1, 1)
+	ip, err := api.AllocateIPAddress(context.Background(), 1, 1)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -83,7 +103,7 @@ func TestAPI_AllocateIPAddress_Error(t *testing.T) {
 	mockRepo := &mockIPLeaseRepo{err: errors.New("allocation error")}
 	api := &API{ipLeaseRepo: mockRepo}
 
-	ip, err := api.AllocateIPAddress(1, 1)
+	ip, err := api.AllocateIPAddress(context.Background(), 1, 1)
 	if err == nil {
 		t.Fatal("Expected error, got none")
 	}
@@ -97,7 +117,7 @@ func TestAPI_DeallocateIPAddress_Success(t *testing.T) {
 	mockRepo := &mockIPLeaseRepo{}
 	api := &API{ipLeaseRepo: mockRepo}
 
-	err := api.DeallocateIPAddress(1, 1)
+	err := api.DeallocateIPAddress(context.Background(), 1, 1)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -107,7 +127,7 @@ func TestAPI_DeallocateIPAddress_Error(t *testing.T) {
 	mockRepo := &mockIPLeaseRepo{err: errors.New("deallocation error")}
 	api := &API{ipLeaseRepo: mockRepo}
 
-	err := api.DeallocateIPAddress(1, 1)
+	err := api.DeallocateIPAddress(context.Background(), 1, 1)
 	if err == nil {
 		t.Fatal("Expected error, got none")
 	}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"reflect"
+)
+
+// mergePatchContentType is the media type of RFC 7386 JSON Merge Patch bodies.
+const mergePatchContentType = "application/merge-patch+json"
+
+// isMergePatch reports whether the request body is a JSON Merge Patch document.
+func isMergePatch(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == mergePatchContentType
+}
+
+// applyMergePatch applies an RFC 7386 merge patch to target, which must be a
+// pointer to a JSON-serializable value. Fields absent from the patch keep
+// their current value and fields set to null are reset to their zero value.
+func applyMergePatch(target interface{}, patch []byte) error {
+	current, err := json.Marshal(target)
+	if err != nil {
+		return err
+	}
+	var doc, patchDoc interface{}
+	if err := json.Unmarshal(current, &doc); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(patch, &patchDoc); err != nil {
+		return err
+	}
+	merged, err := json.Marshal(mergePatchValue(doc, patchDoc))
+	if err != nil {
+		return err
+	}
+	// Decode into a zeroed target so fields removed by the patch end up empty
+	v := reflect.ValueOf(target).Elem()
+	v.Set(reflect.Zero(v.Type()))
+	return json.Unmarshal(merged, target)
+}
+
+// mergePatchValue implements the MergePatch algorithm from RFC 7386 section 2.
+func mergePatchValue(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = map[string]interface{}{}
+	}
+	for key, value := range patchObj {
+		if value == nil {
+			delete(targetObj, key)
+		} else {
+			targetObj[key] = mergePatchValue(targetObj[key], value)
+		}
+	}
+	return targetObj
+}
@@ -1,23 +1,32 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
+
+	"github.com/jbweber/homelab/nook/internal/domain"
 )
 
 // MetaDataStore describes the datastore methods needed for metadata endpoints.
 type MetaDataStore interface {
-	GetMachineByIPv4(ipv4 string) (*Machine, error)
+	GetMachineByIPv4(ctx context.Context, ipv4 string) (*Machine, error)
+	GetMachineByIPv6(ctx context.Context, ipv6 string) (*Machine, error)
+	GetNetwork(ctx context.Context, id int64) (domain.Network, error)
 	// Add more methods here as needed for other metadata endpoints
 }
 
 // MetaData holds dependencies and handler methods for /meta-data* endpoints.
 type MetaData struct {
-	store MetaDataStore
+	store         MetaDataStore
+	enforceSubnet bool   // Refuse requests from outside the machine's network subnet
+	dnsDomain     string // Domain qualifying hostnames, "" for short names
 }
 
 // NewMetaData creates a new MetaData instance with the given store.
@@ -41,7 +50,7 @@ func (m *MetaData) NoCloudMetaDataHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	machine, err := m.store.GetMachineByIPv4(ip)
+	machine, err := machineByClientIP(r.Context(), m.store, ip)
 	if err != nil {
 		log.Printf("failed to lookup machine by IP %s: %v", ip, err)
 		http.Error(w, "internal server error", http.StatusInternalServerError)
@@ -52,10 +61,121 @@ func (m *MetaData) NoCloudMetaDataHandler(w http.ResponseWriter, r *http.Request
 		http.Error(w, "machine not found", http.StatusNotFound)
 		return
 	}
+	if machine.MetadataDisabled {
+		log.Printf("metadata disabled for machine %d at IP %s", machine.ID, ip)
+		http.Error(w, "machine not found", http.StatusNotFound)
+		return
+	}
+	if !m.allowSubnet(w, r, machine) {
+		return
+	}
+
+	subnet, err := machineSubnet(r.Context(), m.store.GetNetwork, machine)
+	if err != nil {
+		log.Printf("failed to lookup network for machine %d: %v", machine.ID, err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	meta := renderNoCloudMetaData(machine, subnet, m.dnsDomain)
+
+	w.Header().Set("Content-Type", "text/yaml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte(meta)); err != nil {
+		log.Printf("failed to write meta-data response: %v", err)
+	}
+}
+
+// allowSubnet applies subnet enforcement when enabled, writing a 403 and
+// returning false if the request did not come from the machine's network.
+func (m *MetaData) allowSubnet(w http.ResponseWriter, r *http.Request, machine *Machine) bool {
+	if !m.enforceSubnet {
+		return true
+	}
+	return enforceMachineSubnet(w, r, m.store.GetNetwork, machine.ID, machine.NetworkID)
+}
+
+// enforceMachineSubnet checks that the client address of r lies within the
+// subnet of the machine's network, writing a 403 and returning false if not.
+// The client address comes from extractClientIP, so X-Forwarded-For is only
+// believed from a trusted proxy and a host on another segment cannot obtain a
+// machine's metadata by claiming its IP. Machines without a network are not
+// restricted.
+func enforceMachineSubnet(w http.ResponseWriter, r *http.Request, getNetwork func(ctx context.Context, id int64) (domain.Network, error), machineID int64, networkID *int64) bool {
+	if networkID == nil {
+		return true
+	}
+	network, err := getNetwork(r.Context(), *networkID)
+	if err != nil {
+		log.Printf("failed to lookup network for machine %d: %v", machineID, err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return false
+	}
+	_, subnet, err := net.ParseCIDR(network.Subnet)
+	if err != nil {
+		log.Printf("network %d has invalid subnet %q: %v", network.ID, network.Subnet, err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return false
+	}
+	host, err := extractClientIP(r)
+	client := net.ParseIP(host)
+	if err != nil || client == nil || !subnet.Contains(client) {
+		log.Printf("refusing metadata for machine %d to %s: outside network subnet %s", machineID, host, subnet)
+		http.Error(w, "request not from the machine's network", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// machineSubnet returns the subnet of the machine's network, or "" when the
+// machine is not on a network.
+func machineSubnet(ctx context.Context, getNetwork func(ctx context.Context, id int64) (domain.Network, error), machine *Machine) (string, error) {
+	if machine.NetworkID == nil {
+		return "", nil
+	}
+	network, err := getNetwork(ctx, *machine.NetworkID)
+	if err != nil {
+		return "", err
+	}
+	return network.Subnet, nil
+}
 
-	instanceID := fmt.Sprintf("iid-%08d", machine.ID)
+// subnetCIDRAndNetmask derives the canonical CIDR block and dotted netmask of a
+// subnet, e.g. "192.168.1.0/24" and "255.255.255.0". ok is false when the
+// subnet is empty or unparsable.
+func subnetCIDRAndNetmask(subnet string) (cidr, netmask string, ok bool) {
+	_, ipNet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return "", "", false
+	}
+	return ipNet.String(), net.IP(ipNet.Mask).String(), true
+}
+
+// qualifyHostname appends dnsDomain to hostname, leaving it unchanged when no
+// domain is configured or it is already qualified with that domain.
+func qualifyHostname(hostname, dnsDomain string) string {
+	dnsDomain = strings.Trim(dnsDomain, ".")
+	if dnsDomain == "" || hostname == "" || strings.HasSuffix(hostname, "."+dnsDomain) {
+		return hostname
+	}
+	return hostname + "." + dnsDomain
+}
+
+// InstanceID returns the instance-id served for a machine: "iid-" and the machine
+// ID zero-padded to 8 digits. Every endpoint reporting an instance-id goes through
+// it, so a machine sees the same value wherever it looks.
+func InstanceID(machineID int64) string {
+	return fmt.Sprintf("iid-%08d", machineID)
+}
+
+// renderNoCloudMetaData renders the NoCloud meta-data document for a machine.
+// subnet is the machine's network subnet, or "" when it has no network;
+// dnsDomain qualifies the hostnames, or "" to serve short names.
+func renderNoCloudMetaData(machine *Machine, subnet, dnsDomain string) string {
+	instanceID := InstanceID(machine.ID)
+	hostname := qualifyHostname(machine.Hostname, dnsDomain)
 	// Use proper YAML format for NoCloud compatibility
-	meta := fmt.Sprintf(`instance-id: %s
+	metaData := fmt.Sprintf(`instance-id: %s
 hostname: %s
 local-hostname: %s
 local-ipv4: %s
@@ -63,36 +183,69 @@ public-hostname: %s
 security-groups: default
 `,
 		instanceID,
-		machine.Hostname,
-		machine.Hostname,
+		hostname,
+		hostname,
 		machine.IPv4,
-		machine.Hostname,
+		hostname,
 	)
-
-	w.Header().Set("Content-Type", "text/yaml; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write([]byte(meta)); err != nil {
-		log.Printf("failed to write meta-data response: %v", err)
+	if machine.IPv6 != "" {
+		metaData += fmt.Sprintf("local-ipv6: %s\n", machine.IPv6)
+	}
+	if machine.AvailabilityZone != "" {
+		metaData += fmt.Sprintf("availability-zone: %s\n", machine.AvailabilityZone)
 	}
+	if cidr, netmask, ok := subnetCIDRAndNetmask(subnet); ok {
+		metaData += fmt.Sprintf("subnet-cidr: %s\nnetmask: %s\n", cidr, netmask)
+	}
+	return metaData
+}
+
+// MetaDataKey describes one key served under /meta-data/
+type MetaDataKey struct {
+	Name    string `json:"name"`
+	Dynamic bool   `json:"dynamic"` // Derived from the requesting machine; static keys are the same for every machine
+	EC2     bool   `json:"ec2"`     // Also served under the EC2 meta-data prefixes
+}
+
+// metaDataKeys is the canonical list of keys served by MetaDataKeyHandler. The
+// /meta-data/ and EC2 directory listings and GET /api/v0/meta-data/keys are all
+// built from it, so a key added here must also be handled there.
+var metaDataKeys = []MetaDataKey{
+	{Name: "instance-id", Dynamic: true, EC2: true},
+	{Name: "hostname", Dynamic: true, EC2: true},
+	{Name: "local-hostname", Dynamic: true, EC2: true},
+	{Name: "local-ipv4", Dynamic: true, EC2: true},
+	{Name: "local-ipv6", Dynamic: true},
+	{Name: "public-hostname", Dynamic: true},
+	{Name: "security-groups", Dynamic: false},
+	{Name: "availability-zone", Dynamic: true},
+	{Name: "subnet-cidr", Dynamic: true},
+	{Name: "netmask", Dynamic: true},
 }
 
 // MetaDataDirectoryHandler serves a directory listing for /meta-data/ (refactored for MetaData).
 func (m *MetaData) MetaDataDirectoryHandler(w http.ResponseWriter, r *http.Request) {
 	// NoCloud metadata directory listing
-	dir := `instance-id
-hostname
-local-hostname
-local-ipv4
-public-hostname
-security-groups
-`
+	var dir strings.Builder
+	for _, key := range metaDataKeys {
+		dir.WriteString(key.Name + "\n")
+	}
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write([]byte(dir)); err != nil {
+	if _, err := w.Write([]byte(dir.String())); err != nil {
 		log.Printf("failed to write meta-data directory response: %v", err)
 	}
 }
 
+// MetaDataKeysHandler handles GET /api/v0/meta-data/keys and lists the keys
+// served under /meta-data/, marking which vary by machine.
+func (m *MetaData) MetaDataKeysHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(metaDataKeys); err != nil {
+		log.Printf("failed to encode meta-data keys response: %v", err)
+	}
+}
+
 // MetaDataKeyHandler serves individual metadata keys for /meta-data/{key} (refactored for MetaData).
 func (m *MetaData) MetaDataKeyHandler(w http.ResponseWriter, r *http.Request) {
 	key := chi.URLParam(r, "key")
@@ -116,7 +269,7 @@ func (m *MetaData) MetaDataKeyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	machine, err := m.store.GetMachineByIPv4(ip)
+	machine, err := machineByClientIP(r.Context(), m.store, ip)
 	if err != nil {
 		log.Printf("failed to lookup machine by IP %s for key %s: %v", ip, key, err)
 		http.Error(w, "internal server error", http.StatusInternalServerError)
@@ -127,17 +280,53 @@ func (m *MetaData) MetaDataKeyHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "machine not found", http.StatusNotFound)
 		return
 	}
+	if machine.MetadataDisabled {
+		log.Printf("metadata disabled for machine %d at IP %s requesting key %s", machine.ID, ip, key)
+		http.Error(w, "machine not found", http.StatusNotFound)
+		return
+	}
+	if !m.allowSubnet(w, r, machine) {
+		return
+	}
 
 	var value string
 	switch key {
 	case "instance-id":
-		value = fmt.Sprintf("iid-%08d", machine.ID)
+		value = InstanceID(machine.ID)
 	case "hostname", "local-hostname", "public-hostname":
-		value = machine.Hostname
+		value = qualifyHostname(machine.Hostname, m.dnsDomain)
 	case "local-ipv4":
 		value = machine.IPv4
+	case "local-ipv6":
+		if machine.IPv6 == "" {
+			http.Error(w, "machine has no IPv6 address", http.StatusNotFound)
+			return
+		}
+		value = machine.IPv6
 	case "security-groups":
 		value = "default"
+	case "availability-zone":
+		if machine.AvailabilityZone == "" {
+			http.Error(w, "machine has no availability zone", http.StatusNotFound)
+			return
+		}
+		value = machine.AvailabilityZone
+	case "subnet-cidr", "netmask":
+		subnet, err := machineSubnet(r.Context(), m.store.GetNetwork, machine)
+		if err != nil {
+			log.Printf("failed to lookup network for machine %d: %v", machine.ID, err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		cidr, netmask, ok := subnetCIDRAndNetmask(subnet)
+		if !ok {
+			http.Error(w, "machine has no network", http.StatusNotFound)
+			return
+		}
+		value = cidr
+		if key == "netmask" {
+			value = netmask
+		}
 	default:
 		log.Printf("unknown metadata key requested: %s", key)
 		http.Error(w, "unknown metadata key", http.StatusNotFound)
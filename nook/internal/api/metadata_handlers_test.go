@@ -2,24 +2,42 @@ package api
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/go-chi/chi/v5"
+
+	"github.com/jbweber/homelab/nook/internal/config"
+	"github.com/jbweber/homelab/nook/internal/domain"
 )
 
 type mockMetaDataStore struct {
 	machine *Machine
+	network *domain.Network
 	err     error
 }
 
-func (m *mockMetaDataStore) GetMachineByIPv4(ipv4 string) (*Machine, error) {
+func (m *mockMetaDataStore) GetMachineByIPv4(ctx context.Context, ipv4 string) (*Machine, error) {
+	return m.machine, m.err
+}
+
+func (m *mockMetaDataStore) GetMachineByIPv6(ctx context.Context, ipv6 string) (*Machine, error) {
 	return m.machine, m.err
 }
 
+func (m *mockMetaDataStore) GetNetwork(ctx context.Context, id int64) (domain.Network, error) {
+	if m.network == nil || m.network.ID != id {
+		return domain.Network{}, errors.New("network not found")
+	}
+	return *m.network, nil
+}
+
 func TestNoCloudMetaDataHandler_Success(t *testing.T) {
 	store := &mockMetaDataStore{
 		machine: &Machine{ID: 42, Name: "test", Hostname: "testhost", IPv4: "1.2.3.4"},
@@ -62,6 +80,181 @@ security-groups: default
 	}
 }
 
+func TestNoCloudMetaDataHandler_Subnet(t *testing.T) {
+	networkID := int64(7)
+	store := &mockMetaDataStore{
+		machine: &Machine{ID: 42, Name: "test", Hostname: "testhost", IPv4: "192.168.1.20", NetworkID: &networkID},
+		network: &domain.Network{ID: 7, Name: "lab", Subnet: "192.168.1.0/24"},
+	}
+	meta := NewMetaData(store)
+	req := httptest.NewRequest("GET", "/meta-data", nil)
+	req.RemoteAddr = "192.168.1.20:12345"
+	w := httptest.NewRecorder()
+	meta.NoCloudMetaDataHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	expectedContent := `instance-id: iid-00000042
+hostname: testhost
+local-hostname: testhost
+local-ipv4: 192.168.1.20
+public-hostname: testhost
+security-groups: default
+subnet-cidr: 192.168.1.0/24
+netmask: 255.255.255.0
+`
+	if w.Body.String() != expectedContent {
+		t.Errorf("unexpected response body:\nexpected:\n%s\ngot:\n%s", expectedContent, w.Body.String())
+	}
+
+	for key, expected := range map[string]string{"subnet-cidr": "192.168.1.0/24\n", "netmask": "255.255.255.0\n"} {
+		req := httptest.NewRequest("GET", "/meta-data/"+key, nil)
+		req.RemoteAddr = "192.168.1.20:12345"
+		ctx := chi.NewRouteContext()
+		ctx.URLParams.Add("key", key)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
+		w := httptest.NewRecorder()
+		meta.MetaDataKeyHandler(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200 for %s, got %d", key, w.Code)
+		}
+		if w.Body.String() != expected {
+			t.Errorf("expected %s %q, got %q", key, expected, w.Body.String())
+		}
+	}
+
+	// Without a network the leaves are omitted
+	store.machine.NetworkID = nil
+	req = httptest.NewRequest("GET", "/meta-data/netmask", nil)
+	req.RemoteAddr = "192.168.1.20:12345"
+	ctx := chi.NewRouteContext()
+	ctx.URLParams.Add("key", "netmask")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
+	w = httptest.NewRecorder()
+	meta.MetaDataKeyHandler(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for netmask without a network, got %d", w.Code)
+	}
+}
+
+func TestNoCloudMetaDataHandler_SubnetEnforcement(t *testing.T) {
+	networkID := int64(7)
+	store := &mockMetaDataStore{
+		machine: &Machine{ID: 42, Name: "test", Hostname: "testhost", IPv4: "192.168.1.20", NetworkID: &networkID},
+		network: &domain.Network{ID: 7, Name: "lab", Subnet: "192.168.1.0/24"},
+	}
+	meta := NewMetaData(store)
+	meta.enforceSubnet = true
+
+	// Request from inside the machine's subnet is served
+	req := httptest.NewRequest("GET", "/meta-data", nil)
+	req.RemoteAddr = "192.168.1.20:12345"
+	w := httptest.NewRecorder()
+	meta.NoCloudMetaDataHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for matching subnet, got %d", w.Code)
+	}
+
+	// Request from another segment claiming the machine's IP is refused
+	req = httptest.NewRequest("GET", "/meta-data", nil)
+	req.RemoteAddr = "10.0.0.5:12345"
+	req.Header.Set("X-Forwarded-For", "192.168.1.20")
+	w = httptest.NewRecorder()
+	meta.NoCloudMetaDataHandler(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for cross-subnet request, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/meta-data/hostname", nil)
+	req.RemoteAddr = "10.0.0.5:12345"
+	req.Header.Set("X-Forwarded-For", "192.168.1.20")
+	ctx := chi.NewRouteContext()
+	ctx.URLParams.Add("key", "hostname")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
+	w = httptest.NewRecorder()
+	meta.MetaDataKeyHandler(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for cross-subnet key request, got %d", w.Code)
+	}
+
+	// Behind a trusted proxy the forwarded client address is checked
+	req = viaTrustedProxy(httptest.NewRequest("GET", "/meta-data", nil), "192.168.1.20")
+	w = httptest.NewRecorder()
+	meta.NoCloudMetaDataHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200 for in-subnet client behind a trusted proxy, got %d", w.Code)
+	}
+	req = viaTrustedProxy(httptest.NewRequest("GET", "/meta-data", nil), "10.0.0.5")
+	w = httptest.NewRecorder()
+	meta.NoCloudMetaDataHandler(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for cross-subnet client behind a trusted proxy, got %d", w.Code)
+	}
+
+	// Without enforcement the same request is served
+	meta.enforceSubnet = false
+	req = httptest.NewRequest("GET", "/meta-data", nil)
+	req.RemoteAddr = "10.0.0.5:12345"
+	req.Header.Set("X-Forwarded-For", "192.168.1.20")
+	w = httptest.NewRecorder()
+	meta.NoCloudMetaDataHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200 with enforcement off, got %d", w.Code)
+	}
+}
+
+func TestNoCloudMetaDataHandler_FQDN(t *testing.T) {
+	store := &mockMetaDataStore{
+		machine: &Machine{ID: 42, Name: "test", Hostname: "testhost", IPv4: "192.168.1.20"},
+	}
+	meta := NewMetaData(store)
+
+	render := func() string {
+		req := httptest.NewRequest("GET", "/meta-data", nil)
+		req.RemoteAddr = "192.168.1.20:12345"
+		w := httptest.NewRecorder()
+		meta.NoCloudMetaDataHandler(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+		return w.Body.String()
+	}
+
+	// Without a domain the short name is served
+	short := render()
+	for _, line := range []string{"hostname: testhost\n", "local-hostname: testhost\n", "public-hostname: testhost\n"} {
+		if !strings.Contains(short, line) {
+			t.Errorf("expected %q in:\n%s", line, short)
+		}
+	}
+
+	meta.dnsDomain = "lab.example.com"
+	qualified := render()
+	for _, line := range []string{"hostname: testhost.lab.example.com\n", "local-hostname: testhost.lab.example.com\n", "public-hostname: testhost.lab.example.com\n"} {
+		if !strings.Contains(qualified, line) {
+			t.Errorf("expected %q in:\n%s", line, qualified)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/meta-data/hostname", nil)
+	req.RemoteAddr = "192.168.1.20:12345"
+	ctx := chi.NewRouteContext()
+	ctx.URLParams.Add("key", "hostname")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
+	w := httptest.NewRecorder()
+	meta.MetaDataKeyHandler(w, req)
+	if w.Body.String() != "testhost.lab.example.com\n" {
+		t.Errorf("expected qualified hostname key, got %q", w.Body.String())
+	}
+
+	// Already-qualified hostnames are not qualified twice
+	store.machine.Hostname = "testhost.lab.example.com"
+	if !strings.Contains(render(), "hostname: testhost.lab.example.com\n") {
+		t.Errorf("expected hostname to be qualified once")
+	}
+}
+
 func TestNoCloudMetaDataHandler_NotFound(t *testing.T) {
 	store := &mockMetaDataStore{machine: nil, err: nil}
 	meta := NewMetaData(store)
@@ -106,6 +299,37 @@ func TestMetaDataKeyHandler_Success(t *testing.T) {
 	}
 }
 
+func TestMetaDataKeyHandler_LocalIPv6(t *testing.T) {
+	store := &mockMetaDataStore{
+		machine: &Machine{ID: 42, Name: "test", Hostname: "testhost", IPv4: "1.2.3.4"},
+	}
+	meta := NewMetaData(store)
+	get := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/meta-data/local-ipv6", nil)
+		req.RemoteAddr = "[2001:db8::4]:12345"
+		ctx := chi.NewRouteContext()
+		ctx.URLParams.Add("key", "local-ipv6")
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
+		w := httptest.NewRecorder()
+		meta.MetaDataKeyHandler(w, req)
+		return w
+	}
+
+	// Machines without an IPv6 address have no such key
+	if w := get(); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+
+	store.machine.IPv6 = "2001:db8::4"
+	w := get()
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if got := strings.TrimSpace(w.Body.String()); got != "2001:db8::4" {
+		t.Errorf("expected 2001:db8::4, got %q", got)
+	}
+}
+
 func TestMetaDataKeyHandler_UnknownKey(t *testing.T) {
 	store := &mockMetaDataStore{
 		machine: &Machine{ID: 42, Name: "test", Hostname: "testhost", IPv4: "1.2.3.4"},
@@ -240,6 +464,50 @@ func TestMetaDataKeyHandler_Success_ContentType(t *testing.T) {
 	}
 }
 
+func TestInstanceID_ConsistentAcrossEndpoints(t *testing.T) {
+	api, cleanup := setupIntegrationTestAPI(t)
+	defer cleanup()
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+
+	machine, err := api.CreateMachine(context.Background(), Machine{Name: "iid", Hostname: "iid", IPv4: "192.0.2.42"})
+	if err != nil {
+		t.Fatalf("failed to create machine: %v", err)
+	}
+	want := InstanceID(machine.ID)
+	if want != fmt.Sprintf("iid-%08d", machine.ID) {
+		t.Fatalf("unexpected instance-id format %q", want)
+	}
+
+	// NoCloud meta-data document
+	req := httptest.NewRequest("GET", "/meta-data", nil)
+	req.RemoteAddr = "192.0.2.42:12345"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), "instance-id: "+want+"\n") {
+		t.Errorf("meta-data does not carry instance-id %s:\n%s", want, w.Body.String())
+	}
+
+	// Single meta-data key
+	req = httptest.NewRequest("GET", "/meta-data/instance-id", nil)
+	req.RemoteAddr = "192.0.2.42:12345"
+	ctx := chi.NewRouteContext()
+	ctx.URLParams.Add("key", "instance-id")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
+	w = httptest.NewRecorder()
+	NewMetaData(api).MetaDataKeyHandler(w, req)
+	if got := strings.TrimSpace(w.Body.String()); got != want {
+		t.Errorf("meta-data key returned instance-id %q, want %q", got, want)
+	}
+
+	// Meta-data rendered for an operator by machine name
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v0/machines/name/iid/meta-data", nil))
+	if !strings.Contains(w.Body.String(), "instance-id: "+want+"\n") {
+		t.Errorf("meta-data by name does not carry instance-id %s:\n%s", want, w.Body.String())
+	}
+}
+
 func TestMetaDataDirectoryHandler_Success(t *testing.T) {
 	store := &mockMetaDataStore{}
 	meta := NewMetaData(store)
@@ -271,10 +539,59 @@ func TestMetaDataDirectoryHandler_Success(t *testing.T) {
 hostname
 local-hostname
 local-ipv4
+local-ipv6
 public-hostname
 security-groups
+availability-zone
+subnet-cidr
+netmask
 `
 	if string(body) != expected {
 		t.Errorf("unexpected directory listing:\nexpected:\n%s\ngot:\n%s", expected, string(body))
 	}
 }
+
+func TestMetaDataKeysHandler_MatchesDirectoryListing(t *testing.T) {
+	r, _ := setupEC2TestRouter(t, "TestMetaDataKeysHandler_MatchesDirectoryListing", config.NewConfig())
+
+	w := getFrom(r, "/api/v0/meta-data/keys", "192.168.1.50:12345")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var keys []MetaDataKey
+	if err := json.NewDecoder(w.Body).Decode(&keys); err != nil {
+		t.Fatalf("failed to decode keys: %v", err)
+	}
+
+	w = getFrom(r, "/meta-data/", "192.168.1.50:12345")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for the directory listing, got %d", w.Code)
+	}
+	listing := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+
+	if len(keys) != len(listing) {
+		t.Fatalf("endpoint lists %d keys but directory lists %d", len(keys), len(listing))
+	}
+	for i, key := range keys {
+		if key.Name != listing[i] {
+			t.Errorf("key %d: endpoint has %q, directory has %q", i, key.Name, listing[i])
+		}
+		if key.Name == "security-groups" && key.Dynamic {
+			t.Errorf("expected security-groups to be static")
+		}
+		if key.Name == "hostname" && !key.Dynamic {
+			t.Errorf("expected hostname to be dynamic")
+		}
+
+		// Every listed key is routed and handled, even if this machine has no value for it
+		w := getFrom(r, "/meta-data/"+key.Name, "192.168.1.50:12345")
+		if strings.Contains(w.Body.String(), "unknown metadata key") || w.Code == http.StatusMethodNotAllowed {
+			t.Errorf("key %q is listed but not served: %d %s", key.Name, w.Code, w.Body.String())
+		}
+	}
+
+	// Unlisted keys are not served
+	if w := getFrom(r, "/meta-data/bogus", "192.168.1.50:12345"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unlisted key, got %d", w.Code)
+	}
+}
@@ -1,14 +1,20 @@
 package api
 
 import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/jbweber/homelab/nook/internal/config"
 	"github.com/jbweber/homelab/nook/internal/migrations"
 	"github.com/jbweber/homelab/nook/internal/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // setupIntegrationTestAPI creates a test API server with a real database
@@ -55,24 +61,24 @@ func TestMetaDataIntegration_Basic(t *testing.T) {
 
 	// Test 3: Test with invalid IP format
 	t.Run("InvalidIP", func(t *testing.T) {
-		req := httptest.NewRequest("GET", "/meta-data", nil)
-		req.Header.Set("X-Forwarded-For", "invalid-ip-format")
+		req := viaTrustedProxy(httptest.NewRequest("GET", "/meta-data", nil), "invalid-ip-format")
 		w := httptest.NewRecorder()
 		r.ServeHTTP(w, req)
 
-		assert.Equal(t, http.StatusBadRequest, w.Code)
-		assert.Contains(t, w.Body.String(), "invalid IP address format")
+		// The proxy's own address is used instead, and owns no machine
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "machine not found")
 	})
 
 	// Test 4: Test with invalid IP format
 	t.Run("InvalidIP", func(t *testing.T) {
-		req := httptest.NewRequest("GET", "/meta-data", nil)
-		req.Header.Set("X-Forwarded-For", "invalid-ip-format")
+		req := viaTrustedProxy(httptest.NewRequest("GET", "/meta-data", nil), "invalid-ip-format")
 		w := httptest.NewRecorder()
 		r.ServeHTTP(w, req)
 
-		assert.Equal(t, http.StatusBadRequest, w.Code)
-		assert.Contains(t, w.Body.String(), "invalid IP address format")
+		// The proxy's own address is used instead, and owns no machine
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "machine not found")
 	})
 }
 
@@ -135,3 +141,116 @@ func TestMetaDataIntegration_VendorData(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 	// Vendor data is currently empty, so we just check the response
 }
+
+// TestMetaDataIntegration_SeedArchive tests the cidata tar.gz export
+func TestMetaDataIntegration_SeedArchive(t *testing.T) {
+	db, cleanup := testutil.SetupTestDB(t, "seed_archive_test")
+	defer cleanup()
+
+	migrator := migrations.NewMigrator(db)
+	for _, migration := range migrations.GetInitialMigrations() {
+		migrator.AddMigration(migration)
+	}
+	if err := migrator.RunMigrations(); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	res, err := db.Exec("INSERT INTO machines (name, hostname, ipv4) VALUES (?, ?, ?)",
+		"seed-machine", "seed-host", "192.168.1.60")
+	if err != nil {
+		t.Fatalf("Failed to insert test machine: %v", err)
+	}
+	machineID, _ := res.LastInsertId()
+	if _, err := db.Exec("INSERT INTO ssh_keys (machine_id, key_text) VALUES (?, ?)",
+		machineID, "ssh-ed25519 AAAAseed seed@lab"); err != nil {
+		t.Fatalf("Failed to insert test SSH key: %v", err)
+	}
+
+	cfg := config.NewConfig()
+	cfg.APIKey = "secret"
+	api, err := NewAPIWithConfig(db, cfg)
+	require.NoError(t, err)
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/seed.tar.gz?machine_id=%d", machineID), nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/gzip", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "seed-machine-cidata.tar.gz")
+
+	gz, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+	files := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		content, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[hdr.Name] = string(content)
+	}
+
+	assert.Equal(t, map[string]string{
+		"meta-data": `instance-id: iid-` + fmt.Sprintf("%08d", machineID) + `
+hostname: seed-host
+local-hostname: seed-host
+local-ipv4: 192.168.1.60
+public-hostname: seed-host
+security-groups: default
+`,
+		"user-data": `#cloud-config
+hostname: seed-host
+manage_etc_hosts: true
+ssh_authorized_keys:
+  - ssh-ed25519 AAAAseed seed@lab
+`,
+		"network-config": dhcpNetworkConfig,
+	}, files)
+
+	t.Run("UnknownMachine", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/seed.tar.gz?machine_id=9999", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("MissingMachineID", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/seed.tar.gz", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		// Even from the machine's own address, the archive needs the API key
+		for name, auth := range map[string]string{"NoKey": "", "WrongKey": "Bearer wrong"} {
+			req := httptest.NewRequest("GET", fmt.Sprintf("/seed.tar.gz?machine_id=%d", machineID), nil)
+			req.RemoteAddr = "192.168.1.60:12345"
+			if auth != "" {
+				req.Header.Set("Authorization", auth)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusUnauthorized, w.Code, name)
+			assert.NotContains(t, w.Body.String(), "seed@lab", name)
+		}
+	})
+
+	t.Run("NoAPIKeyConfigured", func(t *testing.T) {
+		open := chi.NewRouter()
+		NewAPI(db).RegisterRoutes(open)
+		req := httptest.NewRequest("GET", fmt.Sprintf("/seed.tar.gz?machine_id=%d", machineID), nil)
+		w := httptest.NewRecorder()
+		open.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/jbweber/homelab/nook/internal/domain"
+)
+
+// MetricsStore defines the datastore interface for metrics handlers
+type MetricsStore interface {
+	ListMachines(ctx context.Context) ([]Machine, error)
+	ListNetworks(ctx context.Context) ([]domain.Network, error)
+}
+
+// Metrics groups handlers that export inventory in Prometheus text format
+type Metrics struct {
+	store MetricsStore
+}
+
+// NewMetrics creates a new Metrics instance with the given store.
+func NewMetrics(store MetricsStore) *Metrics {
+	return &Metrics{store: store}
+}
+
+// labelValueEscaper escapes Prometheus label values: backslash, double quote and newline.
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// InventoryHandler handles GET /api/v0/metrics/inventory.
+//
+// Emits one nook_machine_info gauge per machine, suitable for a node-exporter
+// textfile collector. The network label is empty for machines without a network.
+func (mt *Metrics) InventoryHandler(w http.ResponseWriter, r *http.Request) {
+	machines, err := mt.store.ListMachines(r.Context())
+	if err != nil {
+		log.Printf("failed to list machines: %v", err)
+		http.Error(w, "failed to list machines", http.StatusInternalServerError)
+		return
+	}
+	networks, err := mt.store.ListNetworks(r.Context())
+	if err != nil {
+		log.Printf("failed to list networks: %v", err)
+		http.Error(w, "failed to list networks", http.StatusInternalServerError)
+		return
+	}
+	networkNames := make(map[int64]string, len(networks))
+	for _, n := range networks {
+		networkNames[n.ID] = n.Name
+	}
+
+	var b strings.Builder
+	b.WriteString("# HELP nook_machine_info Machines known to nook; the value is always 1.\n")
+	b.WriteString("# TYPE nook_machine_info gauge\n")
+	for _, m := range machines {
+		network := ""
+		if m.NetworkID != nil {
+			network = networkNames[*m.NetworkID]
+		}
+		fmt.Fprintf(&b, "nook_machine_info{name=\"%s\",hostname=\"%s\",ipv4=\"%s\",network=\"%s\"} 1\n",
+			labelValueEscaper.Replace(m.Name),
+			labelValueEscaper.Replace(m.Hostname),
+			labelValueEscaper.Replace(m.IPv4),
+			labelValueEscaper.Replace(network))
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := w.Write([]byte(b.String())); err != nil {
+		log.Printf("failed to write inventory metrics: %v", err)
+	}
+}
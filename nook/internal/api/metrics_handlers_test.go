@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jbweber/homelab/nook/internal/domain"
+)
+
+type mockMetricsStore struct {
+	machines []Machine
+	networks []domain.Network
+	err      error
+}
+
+func (m *mockMetricsStore) ListMachines(ctx context.Context) ([]Machine, error) {
+	return m.machines, m.err
+}
+
+func (m *mockMetricsStore) ListNetworks(ctx context.Context) ([]domain.Network, error) {
+	return m.networks, m.err
+}
+
+func TestMetrics_InventoryHandler(t *testing.T) {
+	networkID := int64(3)
+	store := &mockMetricsStore{
+		machines: []Machine{
+			{ID: 1, Name: "web", Hostname: "web.lab", IPv4: "192.168.1.10", NetworkID: &networkID},
+			{ID: 2, Name: `odd "name" \ with` + "\nnewline", Hostname: "odd", IPv4: "192.168.1.11"},
+		},
+		networks: []domain.Network{{ID: networkID, Name: "lab"}},
+	}
+	metrics := NewMetrics(store)
+
+	req := httptest.NewRequest("GET", "/api/v0/metrics/inventory", nil)
+	w := httptest.NewRecorder()
+	metrics.InventoryHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Expected Prometheus text content type, got %q", ct)
+	}
+
+	expected := `# HELP nook_machine_info Machines known to nook; the value is always 1.
+# TYPE nook_machine_info gauge
+nook_machine_info{name="web",hostname="web.lab",ipv4="192.168.1.10",network="lab"} 1
+nook_machine_info{name="odd \"name\" \\ with\nnewline",hostname="odd",ipv4="192.168.1.11",network=""} 1
+`
+	if w.Body.String() != expected {
+		t.Errorf("Unexpected metrics output:\n%s", w.Body.String())
+	}
+}
+
+func TestMetrics_InventoryHandler_StoreError(t *testing.T) {
+	metrics := NewMetrics(&mockMetricsStore{err: errors.New("db down")})
+
+	req := httptest.NewRequest("GET", "/api/v0/metrics/inventory", nil)
+	w := httptest.NewRecorder()
+	metrics.InventoryHandler(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", w.Code)
+	}
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/jbweber/homelab/nook/internal/config"
+)
+
+// SlowRequestLogger returns middleware that logs a warning to logger for any
+// request taking longer than threshold, with its method, route pattern and
+// elapsed time. Records carry the request ID when logger comes from NewLogger.
+// A threshold of zero or less disables logging.
+func SlowRequestLogger(logger *slog.Logger, threshold time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if threshold <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			next.ServeHTTP(w, r)
+			elapsed := time.Since(start)
+			if elapsed <= threshold {
+				return
+			}
+
+			// Prefer the route pattern so log lines group by endpoint rather than by ID
+			route := r.URL.Path
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+			logger.WarnContext(r.Context(), "slow request",
+				"method", r.Method,
+				"route", route,
+				"elapsed_ms", float64(elapsed.Microseconds())/1000,
+				"threshold_ms", threshold.Milliseconds(),
+			)
+		})
+	}
+}
+
+// Readiness gates request handling until startup work (migrations, self-checks,
+// seeding) has finished, so early clients get a clear 503 rather than errors from
+// a half-initialized database.
+type Readiness struct {
+	ready atomic.Bool
+}
+
+// NewReadiness creates a Readiness gate in the not-ready state.
+func NewReadiness() *Readiness {
+	return &Readiness{}
+}
+
+// MarkReady opens the gate. It is safe to call from any goroutine.
+func (rd *Readiness) MarkReady() {
+	rd.ready.Store(true)
+}
+
+// Ready reports whether startup has completed.
+func (rd *Readiness) Ready() bool {
+	return rd.ready.Load()
+}
+
+// Middleware answers every request with 503 "starting up" until MarkReady is called.
+func (rd *Readiness) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !rd.Ready() {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "starting up", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ConcurrencyLimit returns middleware that allows at most limit requests in flight.
+// Requests beyond the limit are rejected immediately with 503 and Retry-After
+// rather than queued, so a burst cannot pile up behind the database. A limit of
+// zero or less disables the check.
+func ConcurrencyLimit(limit int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limit <= 0 {
+			return next
+		}
+		slots := make(chan struct{}, limit)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+				next.ServeHTTP(w, r)
+			default:
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "too many concurrent requests", http.StatusServiceUnavailable)
+			}
+		})
+	}
+}
+
+// ResponseHeaders returns middleware that adds the given static headers to every
+// response. They are set before the handler runs, so a handler can still replace
+// them; reserved headers such as Content-Length are never set.
+func ResponseHeaders(headers map[string]string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(headers) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for name, value := range headers {
+				if !config.IsReservedResponseHeader(name) {
+					w.Header().Set(name, value)
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// QueryCount is middleware that reports how many SQL queries a request ran in
+// the X-Query-Count response header. It is a debugging aid: each request gets
+// its own config.QueryCounter in its context, which the stores pass down to a
+// database opened with config.OpenCountingDB.
+func QueryCount(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counter := &config.QueryCounter{}
+		cw := &queryCountWriter{ResponseWriter: w, counter: counter}
+		next.ServeHTTP(cw, r.WithContext(config.WithQueryCounter(r.Context(), counter)))
+		// A handler that wrote nothing still gets the header with its implicit 200
+		cw.stamp()
+	})
+}
+
+// queryCountWriter stamps X-Query-Count just before the headers are sent.
+type queryCountWriter struct {
+	http.ResponseWriter
+	counter     *config.QueryCounter
+	wroteHeader bool
+}
+
+// stamp sets X-Query-Count unless the headers have already been sent
+func (w *queryCountWriter) stamp() {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.Header().Set("X-Query-Count", strconv.FormatInt(w.counter.Count(), 10))
+	}
+}
+
+func (w *queryCountWriter) WriteHeader(code int) {
+	w.stamp()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *queryCountWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush sends the headers if they are still pending, then flushes the
+// underlying writer, so streaming responses keep streaming.
+func (w *queryCountWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (w *queryCountWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,254 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jbweber/homelab/nook/internal/config"
+	"github.com/jbweber/homelab/nook/internal/domain"
+	"github.com/jbweber/homelab/nook/internal/migrations"
+	"github.com/jbweber/homelab/nook/internal/repository"
+	"github.com/jbweber/homelab/nook/internal/testutil"
+)
+
+func TestSlowRequestLogger(t *testing.T) {
+	var buf bytes.Buffer
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(SlowRequestLogger(NewLogger(&buf), 20*time.Millisecond))
+	r.Get("/fast", func(w http.ResponseWriter, r *http.Request) {})
+	r.Get("/slow/{id}", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	})
+
+	// Fast requests are not logged
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/fast", nil))
+	assert.Empty(t, buf.String())
+
+	// Slow requests are logged with request ID, method and route pattern
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow/42", nil))
+	lines := logLines(t, &buf)
+	require.Len(t, lines, 1)
+	assert.Equal(t, "WARN", lines[0]["level"])
+	assert.Equal(t, "slow request", lines[0]["msg"])
+	assert.NotEmpty(t, lines[0]["request_id"])
+	assert.Equal(t, "GET", lines[0]["method"])
+	assert.Equal(t, "/slow/{id}", lines[0]["route"])
+	assert.GreaterOrEqual(t, lines[0]["elapsed_ms"], float64(50))
+	assert.Equal(t, float64(20), lines[0]["threshold_ms"])
+}
+
+func TestSlowRequestLogger_Disabled(t *testing.T) {
+	var buf bytes.Buffer
+
+	handler := SlowRequestLogger(NewLogger(&buf), 0)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	assert.Empty(t, buf.String())
+}
+
+func TestReadiness_Middleware(t *testing.T) {
+	readiness := NewReadiness()
+
+	r := chi.NewRouter()
+	r.Use(readiness.Middleware)
+	r.Get("/api/v0/machines", func(w http.ResponseWriter, r *http.Request) {})
+
+	// Requests during startup are rejected
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v0/machines", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "starting up\n", w.Body.String())
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	// And succeed once ready is signaled
+	readiness.MarkReady()
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v0/machines", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	const limit = 3
+	entered := make(chan struct{})
+	release := make(chan struct{})
+
+	r := chi.NewRouter()
+	r.Use(ConcurrencyLimit(limit))
+	r.Get("/block", func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+	})
+
+	// Fill every slot with a handler that blocks until released
+	done := make(chan int, limit)
+	for i := 0; i < limit; i++ {
+		go func() {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/block", nil))
+			done <- w.Code
+		}()
+		<-entered
+	}
+
+	// Excess requests are turned away without reaching the handler
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/block", nil))
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	}
+
+	close(release)
+	for i := 0; i < limit; i++ {
+		assert.Equal(t, http.StatusOK, <-done)
+	}
+
+	// Slots are returned once the blocked requests finish
+	go func() { <-entered }()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/block", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestResponseHeaders(t *testing.T) {
+	handler := ResponseHeaders(map[string]string{
+		"X-Content-Type-Options":    "nosniff",
+		"Strict-Transport-Security": "max-age=63072000",
+		"Content-Length":            "1",
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	}))
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
+	assert.Equal(t, "max-age=63072000", resp.Header.Get("Strict-Transport-Security"))
+	// Reserved headers keep the value net/http computes
+	assert.Equal(t, int64(5), resp.ContentLength)
+}
+
+func TestQueryCount_ExpandedMachineListIsBatched(t *testing.T) {
+	dsn := testutil.NewTestDSN("TestQueryCount_ExpandedMachineListIsBatched")
+	db := config.OpenCountingDB(dsn)
+	t.Cleanup(func() {
+		_ = db.Close()
+		_ = testutil.CleanupTestDB(dsn)
+	})
+	_, err := db.Exec("PRAGMA foreign_keys = ON")
+	require.NoError(t, err)
+	migrator := migrations.NewMigrator(db)
+	for _, migration := range migrations.GetInitialMigrations() {
+		migrator.AddMigration(migration)
+	}
+	require.NoError(t, migrator.RunMigrations())
+
+	r := chi.NewRouter()
+	r.Use(QueryCount)
+	NewAPI(db).RegisterRoutes(r)
+
+	listQueries := func() int {
+		req := httptest.NewRequest("GET", "/api/v0/machines?expand=lease", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		n, err := strconv.Atoi(w.Header().Get("X-Query-Count"))
+		require.NoError(t, err, "X-Query-Count header must be set")
+		return n
+	}
+
+	ctx := context.Background()
+	network, err := repository.NewNetworkRepository(db).Save(ctx, domain.Network{Name: "lab", Bridge: "br0", Subnet: "192.168.80.0/24"})
+	require.NoError(t, err)
+	_, err = repository.NewDHCPRangeRepository(db).Save(ctx, domain.DHCPRange{NetworkID: network.ID, StartIP: "192.168.80.100", EndIP: "192.168.80.200", LeaseTime: "24h"})
+	require.NoError(t, err)
+	machineRepo := repository.NewMachineRepository(db)
+	leaseRepo := repository.NewIPLeaseRepository(db)
+	addMachines := func(from, to int) {
+		for i := from; i < to; i++ {
+			m, err := machineRepo.Save(ctx, domain.Machine{Name: "m" + strconv.Itoa(i), Hostname: "m" + strconv.Itoa(i), IPv4: "10.80.0." + strconv.Itoa(i+1), NetworkID: &network.ID})
+			require.NoError(t, err)
+			_, err = leaseRepo.AllocateIPAddress(ctx, m.ID, network.ID)
+			require.NoError(t, err)
+		}
+	}
+
+	addMachines(0, 2)
+	few := listQueries()
+	addMachines(2, 20)
+	many := listQueries()
+
+	// One query for machines and one for leases, however many machines there are
+	assert.Positive(t, few)
+	assert.LessOrEqual(t, few, 2)
+	assert.Equal(t, few, many, "query count must not grow with the number of machines")
+}
+
+func TestQueryCount_ConcurrentRequestsAreCountedSeparately(t *testing.T) {
+	dsn := testutil.NewTestDSN("TestQueryCount_ConcurrentRequestsAreCountedSeparately")
+	db := config.OpenCountingDB(dsn)
+	t.Cleanup(func() {
+		_ = db.Close()
+		_ = testutil.CleanupTestDB(dsn)
+	})
+
+	// Each request runs as many queries as its path says, and none finishes
+	// until all are in flight, so the counts must be kept apart while they overlap
+	const requests = 8
+	var inFlight sync.WaitGroup
+	inFlight.Add(requests)
+	r := chi.NewRouter()
+	r.Use(QueryCount)
+	r.Get("/{n}", func(w http.ResponseWriter, r *http.Request) {
+		inFlight.Done()
+		inFlight.Wait()
+		n, _ := strconv.Atoi(chi.URLParam(r, "n"))
+		for range n {
+			_, err := db.ExecContext(r.Context(), "SELECT 1")
+			assert.NoError(t, err)
+		}
+	})
+
+	var wg sync.WaitGroup
+	for n := 1; n <= requests; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/"+strconv.Itoa(n), nil))
+			assert.Equal(t, strconv.Itoa(n), w.Header().Get("X-Query-Count"))
+		}()
+	}
+	wg.Wait()
+}
+
+func TestQueryCount_FlushesThroughWrapper(t *testing.T) {
+	handler := QueryCount(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok := w.(http.Flusher)
+		assert.True(t, ok, "the wrapper must be an http.Flusher")
+		assert.NoError(t, http.NewResponseController(w).Flush())
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.True(t, w.Flushed)
+	assert.Equal(t, "0", w.Header().Get("X-Query-Count"), "flushing sends the header first")
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// MOTDStore defines the datastore interface for the message of the day handlers
+type MOTDStore interface {
+	GetMOTD(ctx context.Context) (string, error)
+	SetMOTD(ctx context.Context, motd string) error
+}
+
+// MOTD groups handlers for the lab-wide message of the day
+type MOTD struct {
+	store MOTDStore
+}
+
+// NewMOTD creates a new MOTD instance with the given store.
+func NewMOTD(store MOTDStore) *MOTD {
+	return &MOTD{store: store}
+}
+
+// MOTDRequest is the body of PUT /api/v0/motd; an empty motd clears it
+type MOTDRequest struct {
+	MOTD string `json:"motd"`
+}
+
+// MOTDResponse is the body of GET and PUT /api/v0/motd
+type MOTDResponse struct {
+	MOTD string `json:"motd"`
+}
+
+// GetMOTDHandler handles GET /api/v0/motd
+func (m *MOTD) GetMOTDHandler(w http.ResponseWriter, r *http.Request) {
+	motd, err := m.store.GetMOTD(r.Context())
+	if err != nil {
+		log.Printf("failed to get motd: %v", err)
+		http.Error(w, "failed to get motd", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(MOTDResponse{MOTD: motd}); err != nil {
+		log.Printf("failed to encode motd response: %v", err)
+	}
+}
+
+// SetMOTDHandler handles PUT /api/v0/motd. The new MOTD is written to /etc/motd
+// by the user-data of every machine from its next boot.
+func (m *MOTD) SetMOTDHandler(w http.ResponseWriter, r *http.Request) {
+	var req MOTDRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		http.Error(w, jsonErrorMessage(err, "invalid JSON"), http.StatusBadRequest)
+		return
+	}
+
+	if err := m.store.SetMOTD(r.Context(), req.MOTD); err != nil {
+		log.Printf("failed to set motd: %v", err)
+		http.Error(w, "failed to set motd", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(MOTDResponse{MOTD: req.MOTD}); err != nil {
+		log.Printf("failed to encode motd response: %v", err)
+	}
+}
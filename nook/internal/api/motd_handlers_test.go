@@ -0,0 +1,71 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMOTD_UserDataPropagation(t *testing.T) {
+	api, cleanup := setupIntegrationTestAPI(t)
+	defer cleanup()
+
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+
+	if _, err := api.db.Exec("INSERT INTO machines (name, hostname, ipv4) VALUES (?, ?, ?)",
+		"motd-machine", "motd-host", "192.168.1.70"); err != nil {
+		t.Fatalf("Failed to insert test machine: %v", err)
+	}
+
+	userData := func(ip string) string {
+		req := httptest.NewRequest("GET", "/user-data", nil)
+		req.RemoteAddr = ip + ":12345"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		return w.Body.String()
+	}
+	setMOTD := func(motd string) {
+		body, _ := json.Marshal(MOTDRequest{MOTD: motd})
+		req := httptest.NewRequest("PUT", "/api/v0/motd", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// No MOTD by default
+	req := httptest.NewRequest("GET", "/api/v0/motd", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"motd": ""}`, w.Body.String())
+	assert.NotContains(t, userData("192.168.1.70"), "write_files")
+
+	setMOTD("Welcome to the lab")
+
+	req = httptest.NewRequest("GET", "/api/v0/motd", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.JSONEq(t, `{"motd": "Welcome to the lab"}`, w.Body.String())
+
+	// Known and unknown machines both receive it
+	expected := "write_files:\n  - path: /etc/motd\n    content: \"Welcome to the lab\\n\"\n"
+	assert.Contains(t, userData("192.168.1.70"), expected)
+	assert.Contains(t, userData("192.168.1.71"), expected)
+
+	// Updates propagate to the next fetch
+	setMOTD("Maintenance tonight\nSave your work")
+	assert.Contains(t, userData("192.168.1.70"), `content: "Maintenance tonight\nSave your work\n"`)
+	assert.NotContains(t, userData("192.168.1.70"), "Welcome to the lab")
+
+	// Clearing removes the entry
+	setMOTD("")
+	assert.NotContains(t, userData("192.168.1.70"), "write_files")
+}
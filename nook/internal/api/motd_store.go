@@ -0,0 +1,29 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jbweber/homelab/nook/internal/repository"
+)
+
+// GetMOTD implements MOTDStore interface. Returns "" when no MOTD has been set.
+func (a *API) GetMOTD(ctx context.Context) (string, error) {
+	if a.settingsRepo == nil {
+		return "", nil
+	}
+	motd, err := a.settingsRepo.Get(ctx, repository.SettingMOTD)
+	if errors.Is(err, repository.ErrNotFound) {
+		return "", nil
+	}
+	return motd, err
+}
+
+// SetMOTD implements MOTDStore interface
+func (a *API) SetMOTD(ctx context.Context, motd string) error {
+	if a.settingsRepo == nil {
+		return fmt.Errorf("motd: %w", repository.ErrOperationNotSupported)
+	}
+	return a.settingsRepo.Set(ctx, repository.SettingMOTD, motd)
+}
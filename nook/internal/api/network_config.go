@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/jbweber/homelab/nook/internal/domain"
+)
+
+// dhcpNetworkConfig is served when a machine has no managed network to configure statically
+const dhcpNetworkConfig = `version: 2
+ethernets:
+  eth0:
+    dhcp4: true
+`
+
+// renderNetworkConfig renders a netplan v2 network-config for a machine. Machines
+// attached to a network get a static address in that network's subnet, with its
+// gateway and DNS servers; anything else falls back to DHCP. The machine's MTU
+// override, or else the network's MTU, is set on the interface.
+func renderNetworkConfig(machine *Machine, network *domain.Network) string {
+	mtu := 0
+	if network != nil {
+		mtu = network.MTU
+	}
+	if machine != nil && machine.MTU != 0 {
+		mtu = machine.MTU
+	}
+
+	if machine == nil || network == nil || machine.IPv4 == "" {
+		return dhcpNetworkConfig + renderMTU(mtu)
+	}
+	_, subnet, err := net.ParseCIDR(network.Subnet)
+	if err != nil {
+		return dhcpNetworkConfig + renderMTU(mtu)
+	}
+	prefix, _ := subnet.Mask.Size()
+
+	var b strings.Builder
+	b.WriteString("version: 2\nethernets:\n  eth0:\n    dhcp4: false\n")
+	b.WriteString(renderMTU(mtu))
+	fmt.Fprintf(&b, "    addresses:\n      - %s/%d\n", machine.IPv4, prefix)
+	if network.Gateway != "" {
+		fmt.Fprintf(&b, "    gateway4: %s\n", network.Gateway)
+	}
+	if dns := splitDNSServers(network.DNSServers); len(dns) > 0 {
+		b.WriteString("    nameservers:\n      addresses:\n")
+		for _, server := range dns {
+			fmt.Fprintf(&b, "        - %s\n", server)
+		}
+	}
+	return b.String()
+}
+
+// renderMTU renders the interface mtu line, or "" when mtu is unset
+func renderMTU(mtu int) string {
+	if mtu == 0 {
+		return ""
+	}
+	return fmt.Sprintf("    mtu: %d\n", mtu)
+}
+
+// splitDNSServers splits a network's comma-separated DNS server list, dropping blanks
+func splitDNSServers(servers string) []string {
+	var dns []string
+	for _, server := range strings.Split(servers, ",") {
+		if server = strings.TrimSpace(server); server != "" {
+			dns = append(dns, server)
+		}
+	}
+	return dns
+}
+
+// RenderNetworkConfig implements MachinesStore interface
+func (a *API) RenderNetworkConfig(ctx context.Context, machine *Machine) (string, error) {
+	if machine.NetworkID == nil {
+		return renderNetworkConfig(machine, nil), nil
+	}
+	network, err := a.networkRepo.FindByID(ctx, *machine.NetworkID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get network %d: %w", *machine.NetworkID, err)
+	}
+	return renderNetworkConfig(machine, &network), nil
+}
+
+// userAgentHasPrefix reports whether the request's User-Agent starts with prefix,
+// ignoring case. An empty prefix matches every request.
+func userAgentHasPrefix(r *http.Request, prefix string) bool {
+	ua := r.UserAgent()
+	return len(ua) >= len(prefix) && strings.EqualFold(ua[:len(prefix)], prefix)
+}
+
+// noCloudNetworkConfigHandler serves NoCloud-compatible network-config for the requesting machine.
+// When a User-Agent prefix is configured, other clients get 404 as if the document did not exist.
+func (a *API) noCloudNetworkConfigHandler(w http.ResponseWriter, r *http.Request) {
+	if !userAgentHasPrefix(r, a.cfg.NetworkConfigUserAgent) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	ip, err := extractClientIP(r)
+	if err != nil {
+		log.Printf("failed to extract client IP: %v", err)
+		http.Error(w, "unable to determine client IP address", http.StatusBadRequest)
+		return
+	}
+	if net.ParseIP(ip) == nil {
+		log.Printf("invalid IP address format: %s", ip)
+		http.Error(w, "invalid IP address format", http.StatusBadRequest)
+		return
+	}
+
+	machine, err := machineByClientIP(r.Context(), a, ip)
+	if err != nil {
+		log.Printf("failed to lookup machine by IP %s: %v", ip, err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if machine != nil && machine.MetadataDisabled {
+		log.Printf("metadata disabled for machine %d, refusing network-config for IP %s", machine.ID, ip)
+		http.Error(w, "machine not found", http.StatusNotFound)
+		return
+	}
+	if machine != nil && a.cfg.EnforceMetadataSubnet && !enforceMachineSubnet(w, r, a.GetNetwork, machine.ID, machine.NetworkID) {
+		return
+	}
+
+	networkConfig := dhcpNetworkConfig
+	if machine == nil {
+		log.Printf("machine not found for IP %s, providing DHCP network config", ip)
+	} else {
+		networkConfig, err = a.RenderNetworkConfig(r.Context(), machine)
+		if err != nil {
+			log.Printf("failed to render network config for machine %d: %v", machine.ID, err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/yaml")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte(networkConfig)); err != nil {
+		log.Printf("failed to write network config: %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"cmp"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jbweber/homelab/nook/internal/domain"
+)
+
+// NetworkLayoutResponse is a network's subnet with its DHCP ranges in address
+// order and the host addresses no range covers.
+type NetworkLayoutResponse struct {
+	Subnet string             `json:"subnet"`
+	Ranges []domain.DHCPRange `json:"ranges"`
+	Gaps   []AddressGap       `json:"gaps"`
+}
+
+// AddressGap is an inclusive run of addresses not covered by any DHCP range
+type AddressGap struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+	Size  uint32 `json:"size"`
+}
+
+// NetworkLayoutHandler handles GET /api/v0/networks/{id}/layout, for planning
+// where new pools fit in a subnet.
+func (n *Networks) NetworkLayoutHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid network ID", http.StatusBadRequest)
+		return
+	}
+	network, err := n.store.GetNetwork(r.Context(), id)
+	if err != nil {
+		http.Error(w, "network not found", http.StatusNotFound)
+		return
+	}
+
+	ranges, err := n.store.GetDHCPRanges(r.Context(), id)
+	if err != nil {
+		log.Printf("failed to get DHCP ranges for network %d: %v", id, err)
+		http.Error(w, "failed to get DHCP ranges", http.StatusInternalServerError)
+		return
+	}
+
+	layout, err := networkLayout(network.Subnet, ranges)
+	if err != nil {
+		log.Printf("failed to compute layout for network %d: %v", id, err)
+		http.Error(w, "network subnet is invalid", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(layout); err != nil {
+		log.Printf("failed to encode network layout: %v", err)
+	}
+}
+
+// networkLayout sorts ranges by start address and computes the gaps between
+// them over the subnet's host addresses, which exclude the network and
+// broadcast addresses for subnets larger than /31. Overlapping ranges are
+// merged, and ranges with unparseable bounds are listed but cover nothing.
+func networkLayout(subnet string, ranges []domain.DHCPRange) (NetworkLayoutResponse, error) {
+	_, ipNet, err := net.ParseCIDR(subnet)
+	if err != nil || ipNet.IP.To4() == nil {
+		return NetworkLayoutResponse{}, fmt.Errorf("subnet %q is not an IPv4 CIDR", subnet)
+	}
+	ones, bits := ipNet.Mask.Size()
+	first := ipv4ToUint32(ipNet.IP)
+	last := first | (uint32(1)<<(bits-ones) - 1)
+	if bits-ones > 1 {
+		first++
+		last--
+	}
+
+	sorted := slices.Clone(ranges)
+	slices.SortStableFunc(sorted, func(a, b domain.DHCPRange) int {
+		return compareIPv4(a.StartIP, b.StartIP)
+	})
+
+	gaps := []AddressGap{}
+	next := uint64(first) // First address not yet covered; uint64 so it can pass the top of the space
+	for _, d := range sorted {
+		start, end := net.ParseIP(d.StartIP).To4(), net.ParseIP(d.EndIP).To4()
+		if start == nil || end == nil {
+			continue
+		}
+		s, e := uint64(ipv4ToUint32(start)), uint64(ipv4ToUint32(end))
+		if e < next || s > uint64(last) {
+			continue
+		}
+		if s > next {
+			gaps = append(gaps, newAddressGap(uint32(next), uint32(s-1)))
+		}
+		next = max(next, e+1)
+	}
+	if next <= uint64(last) {
+		gaps = append(gaps, newAddressGap(uint32(next), last))
+	}
+
+	if sorted == nil {
+		sorted = []domain.DHCPRange{}
+	}
+	return NetworkLayoutResponse{Subnet: ipNet.String(), Ranges: sorted, Gaps: gaps}, nil
+}
+
+func newAddressGap(start, end uint32) AddressGap {
+	return AddressGap{Start: uint32ToIPv4(start).String(), End: uint32ToIPv4(end).String(), Size: end - start + 1}
+}
+
+// compareIPv4 orders dotted-quad strings numerically, sorting unparseable
+// addresses first.
+func compareIPv4(a, b string) int {
+	aIP, bIP := net.ParseIP(a).To4(), net.ParseIP(b).To4()
+	switch {
+	case aIP == nil && bIP == nil:
+		return 0
+	case aIP == nil:
+		return -1
+	case bIP == nil:
+		return 1
+	}
+	return cmp.Compare(ipv4ToUint32(aIP), ipv4ToUint32(bIP))
+}
+
+func ipv4ToUint32(ip net.IP) uint32 {
+	return binary.BigEndian.Uint32(ip.To4())
+}
+
+func uint32ToIPv4(n uint32) net.IP {
+	ip := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(ip, n)
+	return ip
+}
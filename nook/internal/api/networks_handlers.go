@@ -1,40 +1,88 @@
 package api
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/jbweber/homelab/nook/internal/domain"
+	"github.com/jbweber/homelab/nook/internal/repository"
 )
 
 // NetworksStore defines the datastore interface for network handlers
 type NetworksStore interface {
-	CreateNetwork(network domain.Network) (domain.Network, error)
-	GetNetwork(id int64) (domain.Network, error)
-	GetNetworkByName(name string) (domain.Network, error)
-	ListNetworks() ([]domain.Network, error)
-	UpdateNetwork(network domain.Network) (domain.Network, error)
-	DeleteNetwork(id int64) error
-	GetDHCPRanges(networkID int64) ([]domain.DHCPRange, error)
-	CreateDHCPRange(dhcpRange domain.DHCPRange) (domain.DHCPRange, error)
-	DeleteDHCPRange(id int64) error
+	CreateNetwork(ctx context.Context, network domain.Network) (domain.Network, error)
+	GetNetwork(ctx context.Context, id int64) (domain.Network, error)
+	GetNetworkByName(ctx context.Context, name string) (domain.Network, error)
+	ListNetworks(ctx context.Context) ([]domain.Network, error)
+	UpdateNetwork(ctx context.Context, network domain.Network) (domain.Network, error)
+	DeleteNetwork(ctx context.Context, id int64) error
+	GetDHCPRanges(ctx context.Context, networkID int64) ([]domain.DHCPRange, error)
+	GetDHCPRange(ctx context.Context, id int64) (domain.DHCPRange, error)
+	CreateDHCPRange(ctx context.Context, dhcpRange domain.DHCPRange) (domain.DHCPRange, error)
+	CreateDHCPRanges(ctx context.Context, ranges []domain.DHCPRange) ([]domain.DHCPRange, error)
+	DeleteDHCPRange(ctx context.Context, id int64) error
+	GetDHCPRangeLeases(ctx context.Context, id int64) ([]domain.IPAddressLease, error)
+	ForceDeleteDHCPRange(ctx context.Context, id int64) (int, error)
+	GetNetworkTags(ctx context.Context, networkID int64) (map[string]string, error)
+	SetNetworkTags(ctx context.Context, networkID int64, tags map[string]string) error
+	ListNetworksByTags(ctx context.Context, tags map[string]string) ([]domain.Network, error)
+	GetMACReservations(ctx context.Context, networkID int64) ([]domain.MACReservation, error)
+	CreateMACReservation(ctx context.Context, reservation domain.MACReservation) (domain.MACReservation, error)
+	DeleteMACReservation(ctx context.Context, networkID, id int64) error
+	MigrateNetworkMachines(ctx context.Context, sourceNetworkID, targetNetworkID int64) (int, error)
+	ListNetworkMetadata(ctx context.Context, networkID int64) ([]NetworkMetadataSummary, error)
+	ReserveIPAddresses(ctx context.Context, networkID int64, count int) ([]domain.IPReservation, error)
+	ReleaseIPReservations(ctx context.Context, networkID int64, token string) (int, error)
+}
+
+// NetworkMetadataSummary is the metadata a machine on a network would be served
+type NetworkMetadataSummary struct {
+	MachineID       int64  `json:"machine_id"`
+	InstanceID      string `json:"instance_id"`
+	Hostname        string `json:"hostname"`
+	IPv4            string `json:"ipv4"`
+	SSHKeys         int    `json:"ssh_keys"` // Keys delivered in user-data, including key group keys
+	MetadataEnabled bool   `json:"metadata_enabled"`
 }
 
 // Networks groups network handlers for testability
 type Networks struct {
-	store NetworksStore
+	store     NetworksStore
+	dnsDomain string // Domain qualifying hostnames in metadata summaries
 }
 
 func NewNetworks(store NetworksStore) *Networks {
 	return &Networks{store: store}
 }
 
-// NetworksHandler returns all networks
+// NetworksHandler returns all networks, optionally filtered by ?tag=key=value (repeatable)
 func (n *Networks) NetworksHandler(w http.ResponseWriter, r *http.Request) {
-	networks, err := n.store.ListNetworks()
+	var networks []domain.Network
+	var err error
+	if tagParams := r.URL.Query()["tag"]; len(tagParams) > 0 {
+		tags := make(map[string]string, len(tagParams))
+		for _, param := range tagParams {
+			key, value, ok := strings.Cut(param, "=")
+			if !ok || key == "" {
+				http.Error(w, "invalid tag filter: expected key=value", http.StatusBadRequest)
+				return
+			}
+			tags[key] = value
+		}
+		networks, err = n.store.ListNetworksByTags(r.Context(), tags)
+	} else {
+		networks, err = n.store.ListNetworks(r.Context())
+	}
 	if err != nil {
 		log.Printf("failed to list networks: %v", err)
 		http.Error(w, "failed to list networks", http.StatusInternalServerError)
@@ -52,8 +100,8 @@ func (n *Networks) NetworksHandler(w http.ResponseWriter, r *http.Request) {
 // CreateNetworkHandler creates a new network
 func (n *Networks) CreateNetworkHandler(w http.ResponseWriter, r *http.Request) {
 	var network domain.Network
-	if err := json.NewDecoder(r.Body).Decode(&network); err != nil {
-		http.Error(w, "invalid JSON", http.StatusBadRequest)
+	if err := decodeJSONBody(r, &network); err != nil {
+		http.Error(w, jsonErrorMessage(err, "invalid JSON"), http.StatusBadRequest)
 		return
 	}
 
@@ -65,12 +113,24 @@ func (n *Networks) CreateNetworkHandler(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "bridge is required", http.StatusBadRequest)
 		return
 	}
+	if !domain.ValidBridgeName(network.Bridge) {
+		http.Error(w, "bridge must be a valid interface name (at most 15 characters, no whitespace, '/' or ':')", http.StatusBadRequest)
+		return
+	}
 	if network.Subnet == "" {
 		http.Error(w, "subnet is required", http.StatusBadRequest)
 		return
 	}
+	if !domain.ValidAllocationStrategy(network.AllocationStrategy) {
+		http.Error(w, "allocation strategy must be lowest or random", http.StatusBadRequest)
+		return
+	}
+	if !domain.ValidMTU(network.MTU) {
+		http.Error(w, fmt.Sprintf("mtu must be between %d and %d", domain.MinMTU, domain.MaxMTU), http.StatusBadRequest)
+		return
+	}
 
-	createdNetwork, err := n.store.CreateNetwork(network)
+	createdNetwork, err := n.store.CreateNetwork(r.Context(), network)
 	if err != nil {
 		log.Printf("failed to create network: %v", err)
 		http.Error(w, "failed to create network", http.StatusInternalServerError)
@@ -98,7 +158,7 @@ func (n *Networks) GetNetworkHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	network, err := n.store.GetNetwork(id)
+	network, err := n.store.GetNetwork(r.Context(), id)
 	if err != nil {
 		log.Printf("failed to get network: %v", err)
 		http.Error(w, "network not found", http.StatusNotFound)
@@ -113,7 +173,8 @@ func (n *Networks) GetNetworkHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// UpdateNetworkHandler updates a network
+// UpdateNetworkHandler updates a network. A plain JSON body replaces every field;
+// an application/merge-patch+json body changes only the fields it contains.
 func (n *Networks) UpdateNetworkHandler(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	if idStr == "" {
@@ -128,13 +189,43 @@ func (n *Networks) UpdateNetworkHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	var network domain.Network
-	if err := json.NewDecoder(r.Body).Decode(&network); err != nil {
-		http.Error(w, "invalid JSON", http.StatusBadRequest)
+	if isMergePatch(r) {
+		// Merge patch: start from the stored network and change only the fields sent
+		network, err = n.store.GetNetwork(r.Context(), id)
+		if err != nil {
+			log.Printf("failed to get network: %v", err)
+			http.Error(w, "network not found", http.StatusNotFound)
+			return
+		}
+		patch, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+		if err := applyMergePatch(&network, patch); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+	} else if err := decodeJSONBody(r, &network); err != nil {
+		http.Error(w, jsonErrorMessage(err, "invalid JSON"), http.StatusBadRequest)
+		return
+	}
+
+	if network.Bridge != "" && !domain.ValidBridgeName(network.Bridge) {
+		http.Error(w, "bridge must be a valid interface name (at most 15 characters, no whitespace, '/' or ':')", http.StatusBadRequest)
+		return
+	}
+	if !domain.ValidAllocationStrategy(network.AllocationStrategy) {
+		http.Error(w, "allocation strategy must be lowest or random", http.StatusBadRequest)
+		return
+	}
+	if !domain.ValidMTU(network.MTU) {
+		http.Error(w, fmt.Sprintf("mtu must be between %d and %d", domain.MinMTU, domain.MaxMTU), http.StatusBadRequest)
 		return
 	}
 
 	network.ID = id
-	updatedNetwork, err := n.store.UpdateNetwork(network)
+	updatedNetwork, err := n.store.UpdateNetwork(r.Context(), network)
 	if err != nil {
 		log.Printf("failed to update network: %v", err)
 		http.Error(w, "failed to update network", http.StatusInternalServerError)
@@ -149,6 +240,54 @@ func (n *Networks) UpdateNetworkHandler(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// RenameNetworkHandler handles POST /api/v0/networks/{id}/rename with body
+// {"name": "new-name"}, returning 409 if another network already uses the name.
+func (n *Networks) RenameNetworkHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid network ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := decodeJSONBody(r, &req); err != nil {
+		http.Error(w, jsonErrorMessage(err, "invalid JSON"), http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+
+	network, err := n.store.GetNetwork(r.Context(), id)
+	if err != nil {
+		log.Printf("failed to get network: %v", err)
+		http.Error(w, "network not found", http.StatusNotFound)
+		return
+	}
+
+	oldName := network.Name
+	network.Name = req.Name
+	renamed, err := n.store.UpdateNetwork(r.Context(), network)
+	if err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			http.Error(w, "a network named "+req.Name+" already exists", http.StatusConflict)
+			return
+		}
+		log.Printf("failed to rename network %d: %v", id, err)
+		http.Error(w, "failed to rename network", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("renamed network %d from %s to %s", id, oldName, renamed.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(renamed); err != nil {
+		log.Printf("failed to encode renamed network: %v", err)
+	}
+}
+
 // DeleteNetworkHandler deletes a network
 func (n *Networks) DeleteNetworkHandler(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
@@ -163,7 +302,7 @@ func (n *Networks) DeleteNetworkHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := n.store.DeleteNetwork(id); err != nil {
+	if err := n.store.DeleteNetwork(r.Context(), id); err != nil {
 		log.Printf("failed to delete network: %v", err)
 		http.Error(w, "failed to delete network", http.StatusInternalServerError)
 		return
@@ -186,7 +325,7 @@ func (n *Networks) GetNetworkDHCPRangesHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	ranges, err := n.store.GetDHCPRanges(id)
+	ranges, err := n.store.GetDHCPRanges(r.Context(), id)
 	if err != nil {
 		log.Printf("failed to get DHCP ranges: %v", err)
 		http.Error(w, "failed to get DHCP ranges", http.StatusInternalServerError)
@@ -201,7 +340,9 @@ func (n *Networks) GetNetworkDHCPRangesHandler(w http.ResponseWriter, r *http.Re
 	}
 }
 
-// CreateDHCPRangeHandler creates a DHCP range for a network
+// CreateDHCPRangeHandler creates a DHCP range for a network. The range must be
+// ordered, lie within the network's subnet and not overlap another range on the
+// network; otherwise it returns 400.
 func (n *Networks) CreateDHCPRangeHandler(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	if idStr == "" {
@@ -216,8 +357,8 @@ func (n *Networks) CreateDHCPRangeHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	var dhcpRange domain.DHCPRange
-	if err := json.NewDecoder(r.Body).Decode(&dhcpRange); err != nil {
-		http.Error(w, "invalid JSON", http.StatusBadRequest)
+	if err := decodeJSONBody(r, &dhcpRange); err != nil {
+		http.Error(w, jsonErrorMessage(err, "invalid JSON"), http.StatusBadRequest)
 		return
 	}
 
@@ -231,7 +372,26 @@ func (n *Networks) CreateDHCPRangeHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	createdRange, err := n.store.CreateDHCPRange(dhcpRange)
+	network, err := n.store.GetNetwork(r.Context(), networkID)
+	if err != nil {
+		log.Printf("failed to get network: %v", err)
+		http.Error(w, "network not found", http.StatusNotFound)
+		return
+	}
+
+	existing, err := n.store.GetDHCPRanges(r.Context(), networkID)
+	if err != nil {
+		log.Printf("failed to get DHCP ranges: %v", err)
+		http.Error(w, "failed to get existing DHCP ranges", http.StatusInternalServerError)
+		return
+	}
+
+	if problems := validateDHCPRange(network, existing, dhcpRange); len(problems) > 0 {
+		http.Error(w, "invalid DHCP range: "+strings.Join(problems, "; "), http.StatusBadRequest)
+		return
+	}
+
+	createdRange, err := n.store.CreateDHCPRange(r.Context(), dhcpRange)
 	if err != nil {
 		log.Printf("failed to create DHCP range: %v", err)
 		http.Error(w, "failed to create DHCP range", http.StatusInternalServerError)
@@ -245,7 +405,152 @@ func (n *Networks) CreateDHCPRangeHandler(w http.ResponseWriter, r *http.Request
 	}
 }
 
-// DeleteDHCPRangeHandler deletes a DHCP range
+// BulkCreateDHCPRangesHandler creates several DHCP ranges for a network at once.
+//
+// Every range must lie within the network's subnet and overlap neither the other
+// ranges in the batch nor the network's existing ranges. Any invalid entry rejects
+// the whole batch; otherwise all ranges are inserted in one transaction.
+func (n *Networks) BulkCreateDHCPRangesHandler(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	networkID, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid network ID", http.StatusBadRequest)
+		return
+	}
+
+	var ranges []domain.DHCPRange
+	if err := decodeJSONBody(r, &ranges); err != nil {
+		http.Error(w, jsonErrorMessage(err, "invalid JSON"), http.StatusBadRequest)
+		return
+	}
+	if len(ranges) == 0 {
+		http.Error(w, "at least one DHCP range is required", http.StatusBadRequest)
+		return
+	}
+
+	network, err := n.store.GetNetwork(r.Context(), networkID)
+	if err != nil {
+		log.Printf("failed to get network: %v", err)
+		http.Error(w, "network not found", http.StatusNotFound)
+		return
+	}
+
+	existing, err := n.store.GetDHCPRanges(r.Context(), networkID)
+	if err != nil {
+		log.Printf("failed to get DHCP ranges: %v", err)
+		http.Error(w, "failed to get existing DHCP ranges", http.StatusInternalServerError)
+		return
+	}
+
+	for i := range ranges {
+		ranges[i].ID = 0
+		ranges[i].NetworkID = networkID
+	}
+	if problems := validateDHCPRangeBatch(network, existing, ranges); len(problems) > 0 {
+		http.Error(w, "invalid DHCP ranges: "+strings.Join(problems, "; "), http.StatusBadRequest)
+		return
+	}
+
+	created, err := n.store.CreateDHCPRanges(r.Context(), ranges)
+	if err != nil {
+		log.Printf("failed to create DHCP ranges: %v", err)
+		http.Error(w, "failed to create DHCP ranges", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(created); err != nil {
+		log.Printf("failed to encode created DHCP ranges: %v", err)
+	}
+}
+
+// validateDHCPRange checks one range against the network subnet and the
+// network's existing ranges, returning every problem found. A range with an ID
+// is an update and is not compared with its own stored row.
+func validateDHCPRange(network domain.Network, existing []domain.DHCPRange, d domain.DHCPRange) []string {
+	_, subnet, err := net.ParseCIDR(network.Subnet)
+	if err != nil {
+		return []string{fmt.Sprintf("network subnet %q is invalid", network.Subnet)}
+	}
+	if problem := dhcpRangeBoundsProblem(subnet, network.Subnet, d); problem != "" {
+		return []string{problem}
+	}
+
+	var others []domain.DHCPRange
+	for _, e := range existing {
+		if d.ID == 0 || e.ID != d.ID {
+			others = append(others, e)
+		}
+	}
+	return dhcpRangeOverlapProblems(d, others)
+}
+
+// validateDHCPRangeBatch checks a batch of new ranges against the network subnet,
+// each other, and the network's existing ranges, returning every problem found.
+func validateDHCPRangeBatch(network domain.Network, existing, batch []domain.DHCPRange) []string {
+	var problems []string
+
+	_, subnet, err := net.ParseCIDR(network.Subnet)
+	if err != nil {
+		return []string{fmt.Sprintf("network subnet %q is invalid", network.Subnet)}
+	}
+
+	var valid []domain.DHCPRange
+	for i, d := range batch {
+		if problem := dhcpRangeBoundsProblem(subnet, network.Subnet, d); problem != "" {
+			problems = append(problems, fmt.Sprintf("range %d: %s", i, problem))
+			continue
+		}
+		valid = append(valid, d)
+	}
+
+	for i := 0; i < len(valid); i++ {
+		for j := i + 1; j < len(valid); j++ {
+			if dhcpRangesOverlap(valid[i], valid[j]) {
+				problems = append(problems, fmt.Sprintf("%s-%s overlaps %s-%s in the same batch",
+					valid[i].StartIP, valid[i].EndIP, valid[j].StartIP, valid[j].EndIP))
+			}
+		}
+		problems = append(problems, dhcpRangeOverlapProblems(valid[i], existing)...)
+	}
+
+	return problems
+}
+
+// dhcpRangeBoundsProblem describes why a range's bounds are not ordered IPv4
+// addresses inside subnet, or returns "" if they are.
+func dhcpRangeBoundsProblem(subnet *net.IPNet, cidr string, d domain.DHCPRange) string {
+	start, end := net.ParseIP(d.StartIP).To4(), net.ParseIP(d.EndIP).To4()
+	switch {
+	case start == nil || end == nil:
+		return "start and end must be IPv4 addresses"
+	case bytes.Compare(start, end) > 0:
+		return fmt.Sprintf("start %s is after end %s", d.StartIP, d.EndIP)
+	case !subnet.Contains(start) || !subnet.Contains(end):
+		return fmt.Sprintf("%s-%s is outside subnet %s", d.StartIP, d.EndIP, cidr)
+	}
+	return ""
+}
+
+// dhcpRangeOverlapProblems describes each existing range that d overlaps.
+func dhcpRangeOverlapProblems(d domain.DHCPRange, existing []domain.DHCPRange) []string {
+	var problems []string
+	for _, e := range existing {
+		if dhcpRangesOverlap(d, e) {
+			problems = append(problems, fmt.Sprintf("%s-%s overlaps existing range %d (%s-%s)",
+				d.StartIP, d.EndIP, e.ID, e.StartIP, e.EndIP))
+		}
+	}
+	return problems
+}
+
+// DeleteDHCPRangeHandler deletes a DHCP range.
+//
+// Returns 409 if leases fall within the range, unless ?force=true&confirm=true is
+// given, in which case those leases are released together with the range and the
+// machines holding them are leased new addresses from the network's other
+// ranges (409 if those ranges are too full).
 func (n *Networks) DeleteDHCPRangeHandler(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "rangeId")
 	if idStr == "" {
@@ -259,7 +564,37 @@ func (n *Networks) DeleteDHCPRangeHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if err := n.store.DeleteDHCPRange(id); err != nil {
+	if r.URL.Query().Get("force") == "true" {
+		if !requireConfirmation(w, r) {
+			return
+		}
+		released, err := n.store.ForceDeleteDHCPRange(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, repository.ErrInsufficientCapacity) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			log.Printf("failed to force delete DHCP range: %v", err)
+			http.Error(w, "failed to delete DHCP range", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("deleted DHCP range %d and released %d leases", id, released)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	leases, err := n.store.GetDHCPRangeLeases(r.Context(), id)
+	if err != nil {
+		log.Printf("failed to get leases for DHCP range: %v", err)
+		http.Error(w, "failed to delete DHCP range", http.StatusInternalServerError)
+		return
+	}
+	if len(leases) > 0 {
+		http.Error(w, fmt.Sprintf("DHCP range has %d active leases; use force=true&confirm=true to release them", len(leases)), http.StatusConflict)
+		return
+	}
+
+	if err := n.store.DeleteDHCPRange(r.Context(), id); err != nil {
 		log.Printf("failed to delete DHCP range: %v", err)
 		http.Error(w, "failed to delete DHCP range", http.StatusInternalServerError)
 		return
@@ -267,3 +602,359 @@ func (n *Networks) DeleteDHCPRangeHandler(w http.ResponseWriter, r *http.Request
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// DeleteNetworkDHCPRangeHandler handles DELETE /api/v0/networks/{id}/dhcp/{rangeId}.
+// It deletes the range as DeleteDHCPRangeHandler does, but returns 404 unless the
+// range belongs to network {id}.
+func (n *Networks) DeleteNetworkDHCPRangeHandler(w http.ResponseWriter, r *http.Request) {
+	networkID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid network ID", http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, "rangeId"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid DHCP range ID", http.StatusBadRequest)
+		return
+	}
+
+	dhcpRange, err := n.store.GetDHCPRange(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "DHCP range not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("failed to get DHCP range: %v", err)
+		http.Error(w, "failed to delete DHCP range", http.StatusInternalServerError)
+		return
+	}
+	if dhcpRange.NetworkID != networkID {
+		http.Error(w, "DHCP range not found", http.StatusNotFound)
+		return
+	}
+
+	n.DeleteDHCPRangeHandler(w, r)
+}
+
+// GetNetworkTagsHandler gets all tags for a network
+func (n *Networks) GetNetworkTagsHandler(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid network ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := n.store.GetNetwork(r.Context(), id); err != nil {
+		log.Printf("failed to get network: %v", err)
+		http.Error(w, "network not found", http.StatusNotFound)
+		return
+	}
+
+	tags, err := n.store.GetNetworkTags(r.Context(), id)
+	if err != nil {
+		log.Printf("failed to get network tags: %v", err)
+		http.Error(w, "failed to get network tags", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(tags); err != nil {
+		log.Printf("failed to encode network tags: %v", err)
+	}
+}
+
+// SetNetworkTagsHandler replaces all tags for a network
+func (n *Networks) SetNetworkTagsHandler(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid network ID", http.StatusBadRequest)
+		return
+	}
+
+	var tags map[string]string
+	if err := decodeJSONBody(r, &tags); err != nil {
+		http.Error(w, jsonErrorMessage(err, "invalid JSON"), http.StatusBadRequest)
+		return
+	}
+	for key := range tags {
+		if key == "" {
+			http.Error(w, "tag keys must not be empty", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if _, err := n.store.GetNetwork(r.Context(), id); err != nil {
+		log.Printf("failed to get network: %v", err)
+		http.Error(w, "network not found", http.StatusNotFound)
+		return
+	}
+
+	if err := n.store.SetNetworkTags(r.Context(), id, tags); err != nil {
+		log.Printf("failed to set network tags: %v", err)
+		http.Error(w, "failed to set network tags", http.StatusInternalServerError)
+		return
+	}
+
+	if tags == nil {
+		tags = map[string]string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(tags); err != nil {
+		log.Printf("failed to encode network tags: %v", err)
+	}
+}
+
+// GetMACReservationsHandler lists the MAC reservations for a network
+func (n *Networks) GetMACReservationsHandler(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid network ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := n.store.GetNetwork(r.Context(), id); err != nil {
+		log.Printf("failed to get network: %v", err)
+		http.Error(w, "network not found", http.StatusNotFound)
+		return
+	}
+
+	reservations, err := n.store.GetMACReservations(r.Context(), id)
+	if err != nil {
+		log.Printf("failed to get MAC reservations: %v", err)
+		http.Error(w, "failed to get MAC reservations", http.StatusInternalServerError)
+		return
+	}
+	if reservations == nil {
+		reservations = []domain.MACReservation{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(reservations); err != nil {
+		log.Printf("failed to encode MAC reservations: %v", err)
+	}
+}
+
+// CreateMACReservationHandler reserves an IP address for a MAC address in a network.
+//
+// The MAC is normalized to lowercase colon form. The IP must be IPv4 and inside the
+// network's subnet; a MAC or IP already reserved in the network returns 409.
+func (n *Networks) CreateMACReservationHandler(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	networkID, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid network ID", http.StatusBadRequest)
+		return
+	}
+
+	var reservation domain.MACReservation
+	if err := decodeJSONBody(r, &reservation); err != nil {
+		http.Error(w, jsonErrorMessage(err, "invalid JSON"), http.StatusBadRequest)
+		return
+	}
+	reservation.NetworkID = networkID
+
+	mac, err := net.ParseMAC(reservation.MAC)
+	if err != nil || len(mac) != 6 {
+		http.Error(w, "invalid MAC address", http.StatusBadRequest)
+		return
+	}
+	reservation.MAC = mac.String()
+	if msg := ipv4ValidationError(reservation.IPAddress); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	network, err := n.store.GetNetwork(r.Context(), networkID)
+	if err != nil {
+		log.Printf("failed to get network: %v", err)
+		http.Error(w, "network not found", http.StatusNotFound)
+		return
+	}
+	if _, subnet, err := net.ParseCIDR(network.Subnet); err != nil || !subnet.Contains(net.ParseIP(reservation.IPAddress)) {
+		http.Error(w, fmt.Sprintf("IP address %s is outside network subnet %s", reservation.IPAddress, network.Subnet), http.StatusBadRequest)
+		return
+	}
+
+	existing, err := n.store.GetMACReservations(r.Context(), networkID)
+	if err != nil {
+		log.Printf("failed to get MAC reservations: %v", err)
+		http.Error(w, "failed to create MAC reservation", http.StatusInternalServerError)
+		return
+	}
+	for _, e := range existing {
+		if e.MAC == reservation.MAC {
+			http.Error(w, fmt.Sprintf("MAC address %s is already reserved in this network", reservation.MAC), http.StatusConflict)
+			return
+		}
+		if e.IPAddress == reservation.IPAddress {
+			http.Error(w, fmt.Sprintf("IP address %s is already reserved in this network", reservation.IPAddress), http.StatusConflict)
+			return
+		}
+	}
+
+	created, err := n.store.CreateMACReservation(r.Context(), reservation)
+	if err != nil {
+		log.Printf("failed to create MAC reservation: %v", err)
+		http.Error(w, "failed to create MAC reservation", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(created); err != nil {
+		log.Printf("failed to encode created MAC reservation: %v", err)
+	}
+}
+
+// DeleteMACReservationHandler deletes a MAC reservation from a network
+func (n *Networks) DeleteMACReservationHandler(w http.ResponseWriter, r *http.Request) {
+	networkID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid network ID", http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, "reservationId"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid MAC reservation ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := n.store.DeleteMACReservation(r.Context(), networkID, id); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "MAC reservation not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("failed to delete MAC reservation: %v", err)
+		http.Error(w, "failed to delete MAC reservation", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DnsmasqConfigHandler renders a network's DHCP ranges, options and MAC
+// reservations as a dnsmasq configuration fragment.
+func (n *Networks) DnsmasqConfigHandler(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid network ID", http.StatusBadRequest)
+		return
+	}
+
+	network, err := n.store.GetNetwork(r.Context(), id)
+	if err != nil {
+		log.Printf("failed to get network: %v", err)
+		http.Error(w, "network not found", http.StatusNotFound)
+		return
+	}
+
+	ranges, err := n.store.GetDHCPRanges(r.Context(), id)
+	if err != nil {
+		log.Printf("failed to get DHCP ranges: %v", err)
+		http.Error(w, "failed to render dnsmasq config", http.StatusInternalServerError)
+		return
+	}
+	reservations, err := n.store.GetMACReservations(r.Context(), id)
+	if err != nil {
+		log.Printf("failed to get MAC reservations: %v", err)
+		http.Error(w, "failed to render dnsmasq config", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if _, err := w.Write([]byte(renderDnsmasqConfig(network, ranges, reservations))); err != nil {
+		log.Printf("failed to write dnsmasq config: %v", err)
+	}
+}
+
+// NetworkMetadataHandler handles GET /api/v0/networks/{id}/metadata and summarizes
+// the metadata served to every machine on the network, for checking a rollout
+// before machines boot.
+func (n *Networks) NetworkMetadataHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid network ID", http.StatusBadRequest)
+		return
+	}
+	if _, err := n.store.GetNetwork(r.Context(), id); err != nil {
+		http.Error(w, "network not found", http.StatusNotFound)
+		return
+	}
+
+	summaries, err := n.store.ListNetworkMetadata(r.Context(), id)
+	if err != nil {
+		log.Printf("failed to list metadata for network %d: %v", id, err)
+		http.Error(w, "failed to list network metadata", http.StatusInternalServerError)
+		return
+	}
+	for i := range summaries {
+		summaries[i].Hostname = qualifyHostname(summaries[i].Hostname, n.dnsDomain)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(summaries); err != nil {
+		log.Printf("failed to encode network metadata: %v", err)
+	}
+}
+
+// MigrateNetworkHandler handles POST /api/v0/networks/{id}/migrate.
+//
+// Request: JSON body {"target_network_id": N}. Moves every machine on the network
+// to the target, reallocating each an IP from the target's DHCP ranges in a single
+// transaction. Returns 409 and changes nothing if the target lacks capacity.
+func (n *Networks) MigrateNetworkHandler(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	sourceID, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid network ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		TargetNetworkID int64 `json:"target_network_id"`
+	}
+	if err := decodeJSONBody(r, &req); err != nil {
+		http.Error(w, jsonErrorMessage(err, "invalid JSON"), http.StatusBadRequest)
+		return
+	}
+	if req.TargetNetworkID == 0 {
+		http.Error(w, "target_network_id is required", http.StatusBadRequest)
+		return
+	}
+	if req.TargetNetworkID == sourceID {
+		http.Error(w, "target network must differ from the source network", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := n.store.GetNetwork(r.Context(), sourceID); err != nil {
+		log.Printf("failed to get network: %v", err)
+		http.Error(w, "network not found", http.StatusNotFound)
+		return
+	}
+	if _, err := n.store.GetNetwork(r.Context(), req.TargetNetworkID); err != nil {
+		log.Printf("failed to get target network: %v", err)
+		http.Error(w, "target network not found", http.StatusBadRequest)
+		return
+	}
+
+	migrated, err := n.store.MigrateNetworkMachines(r.Context(), sourceID, req.TargetNetworkID)
+	if err != nil {
+		if errors.Is(err, repository.ErrInsufficientCapacity) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		log.Printf("failed to migrate network %d to %d: %v", sourceID, req.TargetNetworkID, err)
+		http.Error(w, "failed to migrate machines", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("migrated %d machines from network %d to network %d", migrated, sourceID, req.TargetNetworkID)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]int{"migrated": migrated}); err != nil {
+		log.Printf("failed to encode migrate response: %v", err)
+	}
+}
@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/go-chi/chi/v5"
@@ -365,6 +368,98 @@ func TestNetworks_CreateDHCPRangeHandler(t *testing.T) {
 	}
 }
 
+func TestNetworks_CreateDHCPRangeHandler_Validation(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestNetworks_CreateDHCPRangeHandler_Validation")
+	defer cleanup()
+
+	machineRepo := repository.NewMachineRepository(db)
+	sshKeyRepo := repository.NewSSHKeyRepository(db)
+	networkRepo := repository.NewNetworkRepository(db)
+	dhcpRepo := repository.NewDHCPRangeRepository(db)
+	ipLeaseRepo := repository.NewIPLeaseRepository(db)
+
+	savedNetwork, err := networkRepo.Save(context.Background(), domain.Network{Name: "single", Bridge: "br0", Subnet: "10.20.0.0/24"})
+	if err != nil {
+		t.Fatalf("Failed to save network: %v", err)
+	}
+	if _, err := dhcpRepo.Save(context.Background(), domain.DHCPRange{NetworkID: savedNetwork.ID, StartIP: "10.20.0.100", EndIP: "10.20.0.150", LeaseTime: "24h"}); err != nil {
+		t.Fatalf("Failed to save DHCP range: %v", err)
+	}
+
+	api := NewAPIWithRepos(machineRepo, sshKeyRepo, networkRepo, dhcpRepo, ipLeaseRepo)
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+	url := "/api/v0/networks/" + strconv.FormatInt(savedNetwork.ID, 10) + "/dhcp"
+
+	tests := []struct {
+		name     string
+		body     string
+		expected int
+		message  string
+		total    int // ranges on the network afterwards
+	}{
+		{
+			name:     "Overlapping",
+			body:     `{"StartIP":"10.20.0.140","EndIP":"10.20.0.160"}`,
+			expected: http.StatusBadRequest,
+			message:  "overlaps existing range",
+			total:    1,
+		},
+		{
+			name:     "Reversed",
+			body:     `{"StartIP":"10.20.0.50","EndIP":"10.20.0.40"}`,
+			expected: http.StatusBadRequest,
+			message:  "is after end",
+			total:    1,
+		},
+		{
+			name:     "OutsideSubnet",
+			body:     `{"StartIP":"10.20.0.200","EndIP":"10.20.1.10"}`,
+			expected: http.StatusBadRequest,
+			message:  "outside subnet 10.20.0.0/24",
+			total:    1,
+		},
+		{
+			name:     "Adjacent",
+			body:     `{"StartIP":"10.20.0.151","EndIP":"10.20.0.160"}`,
+			expected: http.StatusCreated,
+			total:    2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", url, bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d: %s", tt.expected, w.Code, w.Body.String())
+			}
+			if tt.message != "" && !strings.Contains(w.Body.String(), tt.message) {
+				t.Errorf("Expected body to mention %q, got %q", tt.message, w.Body.String())
+			}
+
+			ranges, err := dhcpRepo.FindByNetworkID(context.Background(), savedNetwork.ID)
+			if err != nil {
+				t.Fatalf("Failed to list DHCP ranges: %v", err)
+			}
+			if len(ranges) != tt.total {
+				t.Errorf("Expected %d ranges on the network, got %d", tt.total, len(ranges))
+			}
+		})
+	}
+
+	t.Run("UnknownNetwork", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/v0/networks/9999/dhcp", bytes.NewBufferString(`{"StartIP":"10.20.0.10","EndIP":"10.20.0.20"}`))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+		}
+	})
+}
+
 func TestNetworks_GetNetworkDHCPRangesHandler(t *testing.T) {
 	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestNetworks_GetNetworkDHCPRangesHandler")
 	defer cleanup()
@@ -482,6 +577,206 @@ func TestNetworks_DeleteDHCPRangeHandler_Success(t *testing.T) {
 	}
 }
 
+func TestNetworks_DeleteNetworkDHCPRangeHandler(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestNetworks_DeleteNetworkDHCPRangeHandler")
+	defer cleanup()
+
+	// Create two networks with a DHCP range on the first
+	networkRepo := repository.NewNetworkRepository(db)
+	dhcpRepo := repository.NewDHCPRangeRepository(db)
+
+	owner, err := networkRepo.Save(context.Background(), domain.Network{Name: "owner", Bridge: "br0", Subnet: "192.168.1.0/24"})
+	if err != nil {
+		t.Fatalf("Failed to save network: %v", err)
+	}
+	other, err := networkRepo.Save(context.Background(), domain.Network{Name: "other", Bridge: "br1", Subnet: "192.168.2.0/24"})
+	if err != nil {
+		t.Fatalf("Failed to save network: %v", err)
+	}
+	savedRange, err := dhcpRepo.Save(context.Background(), domain.DHCPRange{NetworkID: owner.ID, StartIP: "192.168.1.100", EndIP: "192.168.1.150", LeaseTime: "24h"})
+	if err != nil {
+		t.Fatalf("Failed to save DHCP range: %v", err)
+	}
+
+	api := NewAPIWithRepos(repository.NewMachineRepository(db), repository.NewSSHKeyRepository(db), networkRepo, dhcpRepo, repository.NewIPLeaseRepository(db))
+	networks := NewNetworks(api)
+
+	deleteRange := func(networkID, rangeID int64) int {
+		req := httptest.NewRequest("DELETE", "/api/v0/networks/"+strconv.FormatInt(networkID, 10)+"/dhcp/"+strconv.FormatInt(rangeID, 10), nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", strconv.FormatInt(networkID, 10))
+		rctx.URLParams.Add("rangeId", strconv.FormatInt(rangeID, 10))
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+		networks.DeleteNetworkDHCPRangeHandler(w, req)
+		return w.Code
+	}
+
+	// A range addressed through the wrong network is not found and not deleted
+	if code := deleteRange(other.ID, savedRange.ID); code != http.StatusNotFound {
+		t.Errorf("Expected status %d for wrong network, got %d", http.StatusNotFound, code)
+	}
+	if _, err := dhcpRepo.FindByID(context.Background(), savedRange.ID); err != nil {
+		t.Errorf("Expected DHCP range to survive, got %v", err)
+	}
+
+	if code := deleteRange(owner.ID, savedRange.ID+100); code != http.StatusNotFound {
+		t.Errorf("Expected status %d for unknown range, got %d", http.StatusNotFound, code)
+	}
+
+	if code := deleteRange(owner.ID, savedRange.ID); code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, code)
+	}
+	if _, err := dhcpRepo.FindByID(context.Background(), savedRange.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected DHCP range to be deleted, got %v", err)
+	}
+}
+
+func TestNetworks_DeleteDHCPRangeHandler_LeasesConflict(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestNetworks_DeleteDHCPRangeHandler_LeasesConflict")
+	defer cleanup()
+
+	networkRepo := repository.NewNetworkRepository(db)
+	dhcpRepo := repository.NewDHCPRangeRepository(db)
+	machineRepo := repository.NewMachineRepository(db)
+	sshKeyRepo := repository.NewSSHKeyRepository(db)
+	ipLeaseRepo := repository.NewIPLeaseRepository(db)
+
+	savedNetwork, savedRange := seedLeasedDHCPRange(t, networkRepo, dhcpRepo, machineRepo, ipLeaseRepo)
+
+	api := NewAPIWithRepos(machineRepo, sshKeyRepo, networkRepo, dhcpRepo, ipLeaseRepo)
+	networks := NewNetworks(api)
+
+	req := httptest.NewRequest("DELETE", "/api/v0/networks/dhcp/"+strconv.FormatInt(savedRange.ID, 10), nil)
+	w := httptest.NewRecorder()
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("rangeId", strconv.FormatInt(savedRange.ID, 10))
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	networks.DeleteDHCPRangeHandler(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status %d, got %d", http.StatusConflict, w.Code)
+	}
+
+	// Range and lease must both survive the rejected delete
+	if exists, _ := dhcpRepo.ExistsByID(context.Background(), savedRange.ID); !exists {
+		t.Error("Expected DHCP range to still exist")
+	}
+	leases, err := ipLeaseRepo.FindByNetworkID(context.Background(), savedNetwork.ID)
+	if err != nil {
+		t.Fatalf("Failed to list leases: %v", err)
+	}
+	if len(leases) != 1 {
+		t.Errorf("Expected 1 lease to remain, got %d", len(leases))
+	}
+}
+
+func TestNetworks_DeleteDHCPRangeHandler_Force(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestNetworks_DeleteDHCPRangeHandler_Force")
+	defer cleanup()
+
+	networkRepo := repository.NewNetworkRepository(db)
+	dhcpRepo := repository.NewDHCPRangeRepository(db)
+	machineRepo := repository.NewMachineRepository(db)
+	sshKeyRepo := repository.NewSSHKeyRepository(db)
+	ipLeaseRepo := repository.NewIPLeaseRepository(db)
+
+	savedNetwork, savedRange := seedLeasedDHCPRange(t, networkRepo, dhcpRepo, machineRepo, ipLeaseRepo)
+
+	api := NewAPIWithRepos(machineRepo, sshKeyRepo, networkRepo, dhcpRepo, ipLeaseRepo)
+	networks := NewNetworks(api)
+
+	req := httptest.NewRequest("DELETE", "/api/v0/networks/dhcp/"+strconv.FormatInt(savedRange.ID, 10)+"?force=true&confirm=true", nil)
+	w := httptest.NewRecorder()
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("rangeId", strconv.FormatInt(savedRange.ID, 10))
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	networks.DeleteDHCPRangeHandler(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+
+	if exists, _ := dhcpRepo.ExistsByID(context.Background(), savedRange.ID); exists {
+		t.Error("Expected DHCP range to be deleted")
+	}
+	leases, err := ipLeaseRepo.FindByNetworkID(context.Background(), savedNetwork.ID)
+	if err != nil {
+		t.Fatalf("Failed to list leases: %v", err)
+	}
+	if len(leases) != 0 {
+		t.Errorf("Expected leases to be released, got %d", len(leases))
+	}
+}
+
+func TestNetworks_DeleteDHCPRangeHandler_ForceRequiresConfirmation(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestNetworks_DeleteDHCPRangeHandler_ForceRequiresConfirmation")
+	defer cleanup()
+
+	networkRepo := repository.NewNetworkRepository(db)
+	dhcpRepo := repository.NewDHCPRangeRepository(db)
+	machineRepo := repository.NewMachineRepository(db)
+	sshKeyRepo := repository.NewSSHKeyRepository(db)
+	ipLeaseRepo := repository.NewIPLeaseRepository(db)
+
+	_, savedRange := seedLeasedDHCPRange(t, networkRepo, dhcpRepo, machineRepo, ipLeaseRepo)
+
+	api := NewAPIWithRepos(machineRepo, sshKeyRepo, networkRepo, dhcpRepo, ipLeaseRepo)
+	networks := NewNetworks(api)
+
+	req := httptest.NewRequest("DELETE", "/api/v0/networks/dhcp/"+strconv.FormatInt(savedRange.ID, 10)+"?force=true", nil)
+	w := httptest.NewRecorder()
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("rangeId", strconv.FormatInt(savedRange.ID, 10))
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	networks.DeleteDHCPRangeHandler(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "confirmation required") {
+		t.Errorf("Expected confirmation error, got %q", w.Body.String())
+	}
+
+	// Nothing should have been deleted
+	if exists, _ := dhcpRepo.ExistsByID(context.Background(), savedRange.ID); !exists {
+		t.Error("Expected DHCP range to remain without confirmation")
+	}
+}
+
+// seedLeasedDHCPRange creates a network with one DHCP range and a machine holding a lease from it
+func seedLeasedDHCPRange(t *testing.T, networkRepo repository.NetworkRepository, dhcpRepo repository.DHCPRangeRepository, machineRepo repository.MachineRepository, ipLeaseRepo repository.IPLeaseRepository) (domain.Network, domain.DHCPRange) {
+	t.Helper()
+
+	savedNetwork, err := networkRepo.Save(context.Background(), domain.Network{Name: "test-network", Bridge: "br0", Subnet: "192.168.1.0/24"})
+	if err != nil {
+		t.Fatalf("Failed to save network: %v", err)
+	}
+
+	savedRange, err := dhcpRepo.Save(context.Background(), domain.DHCPRange{
+		NetworkID: savedNetwork.ID,
+		StartIP:   "192.168.1.100",
+		EndIP:     "192.168.1.150",
+		LeaseTime: "24h",
+	})
+	if err != nil {
+		t.Fatalf("Failed to save DHCP range: %v", err)
+	}
+
+	machine, err := machineRepo.Save(context.Background(), domain.Machine{Name: "leased", Hostname: "leased", NetworkID: &savedNetwork.ID})
+	if err != nil {
+		t.Fatalf("Failed to save machine: %v", err)
+	}
+	if _, err := ipLeaseRepo.AllocateIPAddress(context.Background(), machine.ID, savedNetwork.ID); err != nil {
+		t.Fatalf("Failed to allocate IP: %v", err)
+	}
+
+	return savedNetwork, savedRange
+}
+
 func TestNetworks_DeleteDHCPRangeHandler_MissingID(t *testing.T) {
 	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestNetworks_DeleteDHCPRangeHandler_MissingID")
 	defer cleanup()
@@ -614,6 +909,55 @@ func TestNetworks_CreateNetworkHandler_InvalidJSON(t *testing.T) {
 	}
 }
 
+func TestNetworks_CreateNetworkHandler_BridgeValidation(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestNetworks_CreateNetworkHandler_BridgeValidation")
+	defer cleanup()
+
+	networkRepo := repository.NewNetworkRepository(db)
+	dhcpRepo := repository.NewDHCPRangeRepository(db)
+	machineRepo := repository.NewMachineRepository(db)
+	sshKeyRepo := repository.NewSSHKeyRepository(db)
+	ipLeaseRepo := repository.NewIPLeaseRepository(db)
+
+	api := NewAPIWithRepos(machineRepo, sshKeyRepo, networkRepo, dhcpRepo, ipLeaseRepo)
+	networks := NewNetworks(api)
+
+	tests := []struct {
+		name     string
+		bridge   string
+		expected int
+	}{
+		{"valid", "br0", http.StatusCreated},
+		{"over-length", "br-this-is-too-long", http.StatusBadRequest},
+		{"contains space", "br 0", http.StatusBadRequest},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := json.Marshal(domain.Network{
+				Name:   "bridge-test-" + strconv.Itoa(i),
+				Bridge: tt.bridge,
+				Subnet: "192.168.2.0/24",
+			})
+			if err != nil {
+				t.Fatalf("Failed to marshal request: %v", err)
+			}
+
+			req := httptest.NewRequest("POST", "/api/v0/networks", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			networks.CreateNetworkHandler(w, req)
+
+			if w.Code != tt.expected {
+				t.Errorf("Expected status %d for bridge %q, got %d: %s", tt.expected, tt.bridge, w.Code, w.Body.String())
+			}
+			if tt.expected == http.StatusBadRequest && !strings.Contains(w.Body.String(), "bridge") {
+				t.Errorf("Expected error to mention bridge, got %q", w.Body.String())
+			}
+		})
+	}
+}
+
 func TestNetworks_GetNetworkHandler_InvalidID(t *testing.T) {
 	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestNetworks_GetNetworkHandler_InvalidID")
 	defer cleanup()
@@ -677,3 +1021,735 @@ func TestNetworks_GetNetworkHandler_NotFound(t *testing.T) {
 		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
 	}
 }
+
+func TestNetworks_TagsHandlers(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestNetworks_TagsHandlers")
+	defer cleanup()
+
+	machineRepo := repository.NewMachineRepository(db)
+	sshKeyRepo := repository.NewSSHKeyRepository(db)
+	networkRepo := repository.NewNetworkRepository(db)
+	dhcpRepo := repository.NewDHCPRangeRepository(db)
+	ipLeaseRepo := repository.NewIPLeaseRepository(db)
+
+	dmz, err := networkRepo.Save(context.Background(), domain.Network{Name: "dmz", Bridge: "br0", Subnet: "192.168.1.0/24"})
+	if err != nil {
+		t.Fatalf("Failed to save network: %v", err)
+	}
+	_, err = networkRepo.Save(context.Background(), domain.Network{Name: "lab", Bridge: "br1", Subnet: "192.168.2.0/24"})
+	if err != nil {
+		t.Fatalf("Failed to save network: %v", err)
+	}
+
+	api := NewAPIWithRepos(machineRepo, sshKeyRepo, networkRepo, dhcpRepo, ipLeaseRepo)
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+
+	// Set tags
+	req := httptest.NewRequest("PUT", "/api/v0/networks/"+strconv.FormatInt(dmz.ID, 10)+"/tags", bytes.NewBufferString(`{"zone":"dmz"}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// Read them back
+	req = httptest.NewRequest("GET", "/api/v0/networks/"+strconv.FormatInt(dmz.ID, 10)+"/tags", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var tags map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&tags); err != nil {
+		t.Fatalf("Failed to decode tags: %v", err)
+	}
+	if tags["zone"] != "dmz" {
+		t.Errorf("Expected zone=dmz, got %v", tags)
+	}
+
+	// Filter the list by tag
+	req = httptest.NewRequest("GET", "/api/v0/networks?tag=zone=dmz", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var networks []domain.Network
+	if err := json.NewDecoder(w.Body).Decode(&networks); err != nil {
+		t.Fatalf("Failed to decode networks: %v", err)
+	}
+	if len(networks) != 1 || networks[0].Name != "dmz" {
+		t.Errorf("Expected only the dmz network, got %v", networks)
+	}
+
+	// Malformed filter
+	req = httptest.NewRequest("GET", "/api/v0/networks?tag=zone", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for malformed tag filter, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	// Unknown network
+	req = httptest.NewRequest("PUT", "/api/v0/networks/99999/tags", bytes.NewBufferString(`{"zone":"dmz"}`))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for unknown network, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestNetworks_BulkCreateDHCPRangesHandler(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestNetworks_BulkCreateDHCPRangesHandler")
+	defer cleanup()
+
+	machineRepo := repository.NewMachineRepository(db)
+	sshKeyRepo := repository.NewSSHKeyRepository(db)
+	networkRepo := repository.NewNetworkRepository(db)
+	dhcpRepo := repository.NewDHCPRangeRepository(db)
+	ipLeaseRepo := repository.NewIPLeaseRepository(db)
+
+	savedNetwork, err := networkRepo.Save(context.Background(), domain.Network{Name: "bulk", Bridge: "br0", Subnet: "10.10.0.0/24"})
+	if err != nil {
+		t.Fatalf("Failed to save network: %v", err)
+	}
+	if _, err := dhcpRepo.Save(context.Background(), domain.DHCPRange{NetworkID: savedNetwork.ID, StartIP: "10.10.0.200", EndIP: "10.10.0.210", LeaseTime: "24h"}); err != nil {
+		t.Fatalf("Failed to save DHCP range: %v", err)
+	}
+
+	api := NewAPIWithRepos(machineRepo, sshKeyRepo, networkRepo, dhcpRepo, ipLeaseRepo)
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+	url := "/api/v0/networks/" + strconv.FormatInt(savedNetwork.ID, 10) + "/dhcp/bulk"
+
+	tests := []struct {
+		name     string
+		body     string
+		expected int
+		total    int // ranges on the network afterwards
+	}{
+		{
+			name:     "InternalOverlap",
+			body:     `[{"StartIP":"10.10.0.10","EndIP":"10.10.0.20"},{"StartIP":"10.10.0.15","EndIP":"10.10.0.30"}]`,
+			expected: http.StatusBadRequest,
+			total:    1,
+		},
+		{
+			name:     "OverlapsExisting",
+			body:     `[{"StartIP":"10.10.0.50","EndIP":"10.10.0.60"},{"StartIP":"10.10.0.205","EndIP":"10.10.0.220"}]`,
+			expected: http.StatusBadRequest,
+			total:    1,
+		},
+		{
+			name:     "OutsideSubnet",
+			body:     `[{"StartIP":"10.10.1.10","EndIP":"10.10.1.20"}]`,
+			expected: http.StatusBadRequest,
+			total:    1,
+		},
+		{
+			name:     "ValidBatch",
+			body:     `[{"StartIP":"10.10.0.10","EndIP":"10.10.0.20","LeaseTime":"12h"},{"StartIP":"10.10.0.100","EndIP":"10.10.0.150"}]`,
+			expected: http.StatusCreated,
+			total:    3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", url, bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d: %s", tt.expected, w.Code, w.Body.String())
+			}
+
+			ranges, err := dhcpRepo.FindByNetworkID(context.Background(), savedNetwork.ID)
+			if err != nil {
+				t.Fatalf("Failed to list DHCP ranges: %v", err)
+			}
+			if len(ranges) != tt.total {
+				t.Errorf("Expected %d ranges on the network, got %d", tt.total, len(ranges))
+			}
+		})
+	}
+}
+
+func TestNetworks_DnsmasqConfig_Forwarders(t *testing.T) {
+	r := setupTestAPI(t)
+
+	req := httptest.NewRequest("POST", "/api/v0/networks", bytes.NewBufferString(
+		`{"Name":"lab","Bridge":"br0","Subnet":"192.168.1.0/24","DNSServers":"192.168.1.1","DNSForwarders":"1.1.1.1, 9.9.9.9"}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var network domain.Network
+	if err := json.NewDecoder(w.Body).Decode(&network); err != nil {
+		t.Fatalf("Failed to decode network: %v", err)
+	}
+	if network.DNSForwarders != "1.1.1.1, 9.9.9.9" || network.DNSServers != "192.168.1.1" {
+		t.Errorf("Expected resolvers and forwarders stored separately, got %+v", network)
+	}
+
+	req = httptest.NewRequest("GET", "/api/v0/networks/"+strconv.FormatInt(network.ID, 10)+"/dnsmasq", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	// Resolvers are handed to clients; forwarders become upstream server lines
+	expected := `# nook: network lab (192.168.1.0/24)
+dhcp-option=option:dns-server,192.168.1.1
+server=1.1.1.1
+server=9.9.9.9
+`
+	if w.Body.String() != expected {
+		t.Errorf("Unexpected dnsmasq config:\n%s", w.Body.String())
+	}
+}
+
+func TestNetworks_NetworkMetadataHandler(t *testing.T) {
+	api, cleanup := setupIntegrationTestAPI(t)
+	defer cleanup()
+	api.cfg.Domain = "lab.example.com"
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+	ctx := context.Background()
+
+	lab, err := api.networkRepo.Save(ctx, domain.Network{Name: "lab", Bridge: "br0", Subnet: "192.168.1.0/24"})
+	if err != nil {
+		t.Fatalf("Failed to save network: %v", err)
+	}
+	empty, err := api.networkRepo.Save(ctx, domain.Network{Name: "empty", Bridge: "br1", Subnet: "192.168.2.0/24"})
+	if err != nil {
+		t.Fatalf("Failed to save network: %v", err)
+	}
+
+	web, err := api.machineRepo.Save(ctx, domain.Machine{Name: "web", Hostname: "web", IPv4: "192.168.1.10", NetworkID: &lab.ID})
+	if err != nil {
+		t.Fatalf("Failed to save machine: %v", err)
+	}
+	dbHost, err := api.machineRepo.Save(ctx, domain.Machine{Name: "db", Hostname: "db", IPv4: "192.168.1.11", NetworkID: &lab.ID})
+	if err != nil {
+		t.Fatalf("Failed to save machine: %v", err)
+	}
+	if _, err := api.machineRepo.Save(ctx, domain.Machine{Name: "elsewhere", Hostname: "elsewhere", IPv4: "10.0.0.5"}); err != nil {
+		t.Fatalf("Failed to save machine: %v", err)
+	}
+	if err := api.machineRepo.SetMetadataEnabled(ctx, dbHost.ID, false); err != nil {
+		t.Fatalf("Failed to disable metadata: %v", err)
+	}
+
+	// web has its own key plus a group key; db has none
+	if _, err := api.sshKeyRepo.CreateForMachine(ctx, web.ID, testEd25519Key); err != nil {
+		t.Fatalf("Failed to create key: %v", err)
+	}
+	group, err := api.keyGroupRepo.Save(ctx, domain.KeyGroup{Name: "ops"})
+	if err != nil {
+		t.Fatalf("Failed to save key group: %v", err)
+	}
+	if _, err := api.keyGroupRepo.AddKey(ctx, group.ID, "ssh-rsa AAAAB3NzaC1yc2E ops@lab"); err != nil {
+		t.Fatalf("Failed to add group key: %v", err)
+	}
+	if err := api.keyGroupRepo.AddMember(ctx, group.ID, web.ID); err != nil {
+		t.Fatalf("Failed to add member: %v", err)
+	}
+
+	get := func(id int64) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/v0/networks/"+strconv.FormatInt(id, 10)+"/metadata", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get(lab.ID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var summaries []NetworkMetadataSummary
+	if err := json.NewDecoder(w.Body).Decode(&summaries); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	expected := []NetworkMetadataSummary{
+		{MachineID: web.ID, InstanceID: InstanceID(web.ID), Hostname: "web.lab.example.com", IPv4: "192.168.1.10", SSHKeys: 2, MetadataEnabled: true},
+		{MachineID: dbHost.ID, InstanceID: InstanceID(dbHost.ID), Hostname: "db.lab.example.com", IPv4: "192.168.1.11", SSHKeys: 0, MetadataEnabled: false},
+	}
+	if len(summaries) != len(expected) {
+		t.Fatalf("Expected %d summaries, got %+v", len(expected), summaries)
+	}
+	for i := range expected {
+		if summaries[i] != expected[i] {
+			t.Errorf("Summary %d: expected %+v, got %+v", i, expected[i], summaries[i])
+		}
+	}
+
+	// An empty network returns an empty array rather than null
+	w = get(empty.ID)
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Errorf("Expected empty array, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := get(9999); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for unknown network, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestNetworks_MACReservationHandlers(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestNetworks_MACReservationHandlers")
+	defer cleanup()
+
+	machineRepo := repository.NewMachineRepository(db)
+	sshKeyRepo := repository.NewSSHKeyRepository(db)
+	networkRepo := repository.NewNetworkRepository(db)
+	dhcpRepo := repository.NewDHCPRangeRepository(db)
+	ipLeaseRepo := repository.NewIPLeaseRepository(db)
+
+	network, err := networkRepo.Save(context.Background(), domain.Network{
+		Name:       "lab",
+		Bridge:     "br0",
+		Subnet:     "192.168.1.0/24",
+		Gateway:    "192.168.1.1",
+		DNSServers: "1.1.1.1, 9.9.9.9",
+	})
+	if err != nil {
+		t.Fatalf("Failed to save network: %v", err)
+	}
+	if _, err := dhcpRepo.Save(context.Background(), domain.DHCPRange{NetworkID: network.ID, StartIP: "192.168.1.100", EndIP: "192.168.1.150", LeaseTime: "12h"}); err != nil {
+		t.Fatalf("Failed to save DHCP range: %v", err)
+	}
+
+	api := NewAPIWithRepos(machineRepo, sshKeyRepo, networkRepo, dhcpRepo, ipLeaseRepo)
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+	base := "/api/v0/networks/" + strconv.FormatInt(network.ID, 10)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", base+"/reservations", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// MAC is normalized to lowercase colon form
+	w := post(`{"MAC":"52-54-00-AB-CD-EF","IPAddress":"192.168.1.20","Hostname":"printer"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var created domain.MACReservation
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("Failed to decode reservation: %v", err)
+	}
+	if created.MAC != "52:54:00:ab:cd:ef" {
+		t.Errorf("Expected normalized MAC, got %q", created.MAC)
+	}
+
+	for name, tc := range map[string]struct {
+		body string
+		code int
+	}{
+		"duplicate MAC":  {`{"MAC":"52:54:00:ab:cd:ef","IPAddress":"192.168.1.21"}`, http.StatusConflict},
+		"duplicate IP":   {`{"MAC":"52:54:00:00:00:01","IPAddress":"192.168.1.20"}`, http.StatusConflict},
+		"invalid MAC":    {`{"MAC":"not-a-mac","IPAddress":"192.168.1.22"}`, http.StatusBadRequest},
+		"outside subnet": {`{"MAC":"52:54:00:00:00:02","IPAddress":"10.0.0.5"}`, http.StatusBadRequest},
+	} {
+		if w := post(tc.body); w.Code != tc.code {
+			t.Errorf("%s: expected status %d, got %d: %s", name, tc.code, w.Code, w.Body.String())
+		}
+	}
+
+	// The reservation is retrievable
+	req := httptest.NewRequest("GET", base+"/reservations", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var reservations []domain.MACReservation
+	if err := json.NewDecoder(w.Body).Decode(&reservations); err != nil {
+		t.Fatalf("Failed to decode reservations: %v", err)
+	}
+	if len(reservations) != 1 || reservations[0] != created {
+		t.Errorf("Expected [%+v], got %+v", created, reservations)
+	}
+
+	// And appears in the dnsmasq export as a dhcp-host line
+	req = httptest.NewRequest("GET", base+"/dnsmasq", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	expected := `# nook: network lab (192.168.1.0/24)
+dhcp-range=192.168.1.100,192.168.1.150,255.255.255.0,12h
+dhcp-option=option:router,192.168.1.1
+dhcp-option=option:dns-server,1.1.1.1,9.9.9.9
+dhcp-host=52:54:00:ab:cd:ef,192.168.1.20,printer
+`
+	if w.Body.String() != expected {
+		t.Errorf("Unexpected dnsmasq config:\n%s", w.Body.String())
+	}
+
+	// Delete it
+	req = httptest.NewRequest("DELETE", base+"/reservations/"+strconv.FormatInt(created.ID, 10), nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+	req = httptest.NewRequest("DELETE", base+"/reservations/"+strconv.FormatInt(created.ID, 10), nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestNetworks_MigrateNetworkHandler(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestNetworks_MigrateNetworkHandler")
+	defer cleanup()
+
+	machineRepo := repository.NewMachineRepository(db)
+	sshKeyRepo := repository.NewSSHKeyRepository(db)
+	networkRepo := repository.NewNetworkRepository(db)
+	dhcpRepo := repository.NewDHCPRangeRepository(db)
+	ipLeaseRepo := repository.NewIPLeaseRepository(db)
+
+	api := NewAPIWithRepos(machineRepo, sshKeyRepo, networkRepo, dhcpRepo, ipLeaseRepo)
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+
+	saveNetwork := func(name, subnet, start, end string) domain.Network {
+		n, err := networkRepo.Save(context.Background(), domain.Network{Name: name, Bridge: "br-" + name, Subnet: subnet})
+		if err != nil {
+			t.Fatalf("Failed to save network: %v", err)
+		}
+		if _, err := dhcpRepo.Save(context.Background(), domain.DHCPRange{NetworkID: n.ID, StartIP: start, EndIP: end, LeaseTime: "24h"}); err != nil {
+			t.Fatalf("Failed to save DHCP range: %v", err)
+		}
+		return n
+	}
+	old := saveNetwork("old", "192.168.1.0/24", "192.168.1.100", "192.168.1.150")
+	small := saveNetwork("small", "10.0.1.0/24", "10.0.1.10", "10.0.1.10")
+	big := saveNetwork("big", "10.0.2.0/24", "10.0.2.10", "10.0.2.50")
+
+	for _, name := range []string{"a", "b"} {
+		if _, err := api.CreateMachine(context.Background(), Machine{Name: name, Hostname: name, NetworkID: &old.ID}); err != nil {
+			t.Fatalf("Failed to create machine: %v", err)
+		}
+	}
+
+	migrate := func(target int64) *httptest.ResponseRecorder {
+		body := `{"target_network_id":` + strconv.FormatInt(target, 10) + `}`
+		req := httptest.NewRequest("POST", "/api/v0/networks/"+strconv.FormatInt(old.ID, 10)+"/migrate", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// Target without enough addresses is rejected and nothing moves
+	if w := migrate(small.ID); w.Code != http.StatusConflict {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusConflict, w.Code, w.Body.String())
+	}
+	machines, _ := api.ListMachines(context.Background())
+	for _, m := range machines {
+		if *m.NetworkID != old.ID {
+			t.Errorf("Expected machine %s to stay on network %d, got %d", m.Name, old.ID, *m.NetworkID)
+		}
+	}
+
+	w := migrate(big.ID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var resp map[string]int
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp["migrated"] != 2 {
+		t.Errorf("Expected 2 machines migrated, got %d", resp["migrated"])
+	}
+	machines, _ = api.ListMachines(context.Background())
+	for _, m := range machines {
+		if *m.NetworkID != big.ID || !strings.HasPrefix(m.IPv4, "10.0.2.") {
+			t.Errorf("Expected machine %s on network %d in 10.0.2.0/24, got %d %s", m.Name, big.ID, *m.NetworkID, m.IPv4)
+		}
+	}
+
+	// Migrating onto itself is rejected
+	if w := migrate(old.ID); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestNetworks_RenameNetworkHandler(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestNetworks_RenameNetworkHandler")
+	defer cleanup()
+
+	networkRepo := repository.NewNetworkRepository(db)
+	api := NewAPIWithRepos(repository.NewMachineRepository(db), repository.NewSSHKeyRepository(db), networkRepo,
+		repository.NewDHCPRangeRepository(db), repository.NewIPLeaseRepository(db))
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+
+	lab, err := networkRepo.Save(context.Background(), domain.Network{Name: "lab", Bridge: "br0", Subnet: "192.168.1.0/24", Gateway: "192.168.1.1"})
+	if err != nil {
+		t.Fatalf("Failed to save network: %v", err)
+	}
+	if _, err := networkRepo.Save(context.Background(), domain.Network{Name: "prod", Bridge: "br1", Subnet: "10.0.0.0/24"}); err != nil {
+		t.Fatalf("Failed to save network: %v", err)
+	}
+
+	rename := func(id int64, name string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/v0/networks/"+strconv.FormatInt(id, 10)+"/rename", strings.NewReader(`{"name":"`+name+`"}`))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// Successful rename keeps every other field
+	w := rename(lab.ID, "staging")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var renamed domain.Network
+	if err := json.Unmarshal(w.Body.Bytes(), &renamed); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if renamed.Name != "staging" || renamed.Gateway != "192.168.1.1" || renamed.Subnet != "192.168.1.0/24" {
+		t.Errorf("Unexpected renamed network: %+v", renamed)
+	}
+	if stored, _ := networkRepo.FindByID(context.Background(), lab.ID); stored.Name != "staging" {
+		t.Errorf("Expected stored name staging, got %s", stored.Name)
+	}
+
+	// Colliding name is rejected and nothing changes
+	if w := rename(lab.ID, "prod"); w.Code != http.StatusConflict {
+		t.Errorf("Expected status %d, got %d", http.StatusConflict, w.Code)
+	}
+	if stored, _ := networkRepo.FindByID(context.Background(), lab.ID); stored.Name != "staging" {
+		t.Errorf("Expected name to stay staging, got %s", stored.Name)
+	}
+
+	if w := rename(lab.ID, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for empty name, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := rename(99999, "other"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for unknown network, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestNetworks_UpdateNetworkHandler_MergePatch(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestNetworks_UpdateNetworkHandler_MergePatch")
+	defer cleanup()
+
+	networkRepo := repository.NewNetworkRepository(db)
+	api := NewAPIWithRepos(repository.NewMachineRepository(db), repository.NewSSHKeyRepository(db), networkRepo,
+		repository.NewDHCPRangeRepository(db), repository.NewIPLeaseRepository(db))
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+
+	saved, err := networkRepo.Save(context.Background(), domain.Network{
+		Name: "lab", Bridge: "br0", Subnet: "192.168.1.0/24",
+		Gateway: "192.168.1.1", DNSServers: "1.1.1.1, 9.9.9.9", Description: "Original description",
+	})
+	if err != nil {
+		t.Fatalf("Failed to save network: %v", err)
+	}
+	path := "/api/v0/networks/" + strconv.FormatInt(saved.ID, 10)
+
+	patch := func(contentType, body string) domain.Network {
+		req := httptest.NewRequest("PATCH", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		stored, err := networkRepo.FindByID(context.Background(), saved.ID)
+		if err != nil {
+			t.Fatalf("Failed to reload network: %v", err)
+		}
+		return stored
+	}
+
+	// Only the description changes; gateway and DNS are preserved
+	stored := patch("application/merge-patch+json", `{"Description":"Updated description"}`)
+	if stored.Description != "Updated description" {
+		t.Errorf("Expected updated description, got %q", stored.Description)
+	}
+	if stored.Gateway != "192.168.1.1" || stored.DNSServers != "1.1.1.1, 9.9.9.9" || stored.Name != "lab" {
+		t.Errorf("Expected other fields preserved, got %+v", stored)
+	}
+
+	// null clears a field
+	stored = patch("application/merge-patch+json; charset=utf-8", `{"Description":null}`)
+	if stored.Description != "" || stored.Gateway != "192.168.1.1" {
+		t.Errorf("Expected only description cleared, got %+v", stored)
+	}
+
+	// Plain JSON still replaces every field
+	stored = patch("application/json", `{"Name":"lab","Bridge":"br0","Subnet":"192.168.1.0/24","Description":"Replaced"}`)
+	if stored.Gateway != "" || stored.DNSServers != "" {
+		t.Errorf("Expected full replacement to blank gateway and DNS, got %+v", stored)
+	}
+
+	// Merge patch against a missing network
+	req := httptest.NewRequest("PATCH", "/api/v0/networks/99999", strings.NewReader(`{"Description":"x"}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestNetworks_NetworkLayoutHandler(t *testing.T) {
+	api, cleanup := setupIntegrationTestAPI(t)
+	defer cleanup()
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+	ctx := context.Background()
+
+	network, err := api.networkRepo.Save(ctx, domain.Network{Name: "lab", Bridge: "br0", Subnet: "192.168.1.0/24"})
+	if err != nil {
+		t.Fatalf("Failed to save network: %v", err)
+	}
+	// Saved out of order to check sorting
+	for _, d := range []domain.DHCPRange{
+		{NetworkID: network.ID, StartIP: "192.168.1.150", EndIP: "192.168.1.199", LeaseTime: "12h"},
+		{NetworkID: network.ID, StartIP: "192.168.1.100", EndIP: "192.168.1.119", LeaseTime: "12h"},
+	} {
+		if _, err := api.dhcpRangeRepo.Save(ctx, d); err != nil {
+			t.Fatalf("Failed to save DHCP range: %v", err)
+		}
+	}
+
+	get := func(id int64) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/v0/networks/"+strconv.FormatInt(id, 10)+"/layout", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get(network.ID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var layout NetworkLayoutResponse
+	if err := json.NewDecoder(w.Body).Decode(&layout); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if layout.Subnet != "192.168.1.0/24" {
+		t.Errorf("Expected subnet 192.168.1.0/24, got %s", layout.Subnet)
+	}
+	if len(layout.Ranges) != 2 || layout.Ranges[0].StartIP != "192.168.1.100" || layout.Ranges[1].StartIP != "192.168.1.150" {
+		t.Errorf("Expected ranges sorted by start address, got %+v", layout.Ranges)
+	}
+	expected := []AddressGap{
+		{Start: "192.168.1.1", End: "192.168.1.99", Size: 99},
+		{Start: "192.168.1.120", End: "192.168.1.149", Size: 30},
+		{Start: "192.168.1.200", End: "192.168.1.254", Size: 55},
+	}
+	if !slices.Equal(layout.Gaps, expected) {
+		t.Errorf("Expected gaps %+v, got %+v", expected, layout.Gaps)
+	}
+
+	if w := get(99999); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for unknown network, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestNetworkLayout_OverlapsAndFullCoverage(t *testing.T) {
+	layout, err := networkLayout("10.0.0.0/29", []domain.DHCPRange{
+		{StartIP: "10.0.0.3", EndIP: "10.0.0.6"},
+		{StartIP: "10.0.0.1", EndIP: "10.0.0.4"},
+	})
+	if err != nil {
+		t.Fatalf("networkLayout failed: %v", err)
+	}
+	if len(layout.Gaps) != 0 {
+		t.Errorf("Expected overlapping ranges to cover the subnet, got gaps %+v", layout.Gaps)
+	}
+
+	layout, err = networkLayout("10.0.0.0/29", nil)
+	if err != nil {
+		t.Fatalf("networkLayout failed: %v", err)
+	}
+	expected := []AddressGap{{Start: "10.0.0.1", End: "10.0.0.6", Size: 6}}
+	if !slices.Equal(layout.Gaps, expected) || len(layout.Ranges) != 0 {
+		t.Errorf("Expected one gap over all host addresses, got %+v", layout)
+	}
+
+	if _, err := networkLayout("not-a-subnet", nil); err == nil {
+		t.Error("Expected error for invalid subnet")
+	}
+}
+
+func TestNetworks_ReserveIPAddressesHandler(t *testing.T) {
+	api, cleanup := setupIntegrationTestAPI(t)
+	defer cleanup()
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+	ctx := context.Background()
+
+	network, err := api.networkRepo.Save(ctx, domain.Network{Name: "cluster", Bridge: "br0", Subnet: "192.168.5.0/24"})
+	if err != nil {
+		t.Fatalf("Failed to save network: %v", err)
+	}
+	if _, err := api.dhcpRangeRepo.Save(ctx, domain.DHCPRange{NetworkID: network.ID, StartIP: "192.168.5.10", EndIP: "192.168.5.17", LeaseTime: "24h"}); err != nil {
+		t.Fatalf("Failed to save DHCP range: %v", err)
+	}
+	base := "/api/v0/networks/" + strconv.FormatInt(network.ID, 10) + "/reserve"
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// A batch that fits
+	w := do("POST", base+"?count=5")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var batch IPReservationResponse
+	if err := json.NewDecoder(w.Body).Decode(&batch); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	expected := []string{"192.168.5.10", "192.168.5.11", "192.168.5.12", "192.168.5.13", "192.168.5.14"}
+	if batch.Token == "" || batch.NetworkID != network.ID || !slices.Equal(batch.Addresses, expected) {
+		t.Errorf("Unexpected reservation %+v", batch)
+	}
+
+	// Only three remain; a batch of four fails with nothing reserved
+	w = do("POST", base+"?count=4")
+	if w.Code != http.StatusConflict {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusConflict, w.Code, w.Body.String())
+	}
+	w = do("POST", base+"?count=3")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected the remaining three to be reservable, got %d: %s", w.Code, w.Body.String())
+	}
+
+	for _, path := range []string{base, base + "?count=0", base + "?count=abc", base + "?count=1000"} {
+		if w := do("POST", path); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", path, http.StatusBadRequest, w.Code)
+		}
+	}
+	if w := do("POST", "/api/v0/networks/99999/reserve?count=1"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for unknown network, got %d", http.StatusNotFound, w.Code)
+	}
+
+	// Releasing the first batch frees its addresses
+	if w := do("DELETE", base+"/"+batch.Token); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+	if w := do("DELETE", base+"/"+batch.Token); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d releasing twice, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := do("POST", base+"?count=5"); w.Code != http.StatusCreated {
+		t.Errorf("Expected released addresses to be reservable again, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -2,51 +2,175 @@ package api
 
 import (
 	"context"
+	"crypto/rand"
+	"fmt"
 
 	"github.com/jbweber/homelab/nook/internal/domain"
 )
 
 // CreateNetwork implements NetworksStore interface
-func (a *API) CreateNetwork(network domain.Network) (domain.Network, error) {
-	return a.networkRepo.Save(context.Background(), network)
+func (a *API) CreateNetwork(ctx context.Context, network domain.Network) (domain.Network, error) {
+	return a.networkRepo.Save(ctx, network)
 }
 
 // GetNetwork implements NetworksStore interface
-func (a *API) GetNetwork(id int64) (domain.Network, error) {
-	return a.networkRepo.FindByID(context.Background(), id)
+func (a *API) GetNetwork(ctx context.Context, id int64) (domain.Network, error) {
+	return a.networkRepo.FindByID(ctx, id)
 }
 
 // GetNetworkByName implements NetworksStore interface
-func (a *API) GetNetworkByName(name string) (domain.Network, error) {
-	return a.networkRepo.FindByName(context.Background(), name)
+func (a *API) GetNetworkByName(ctx context.Context, name string) (domain.Network, error) {
+	return a.networkRepo.FindByName(ctx, name)
 }
 
 // ListNetworks implements NetworksStore interface
-func (a *API) ListNetworks() ([]domain.Network, error) {
-	return a.networkRepo.FindAll(context.Background())
+func (a *API) ListNetworks(ctx context.Context) ([]domain.Network, error) {
+	return a.networkRepo.FindAll(ctx)
 }
 
 // UpdateNetwork implements NetworksStore interface
-func (a *API) UpdateNetwork(network domain.Network) (domain.Network, error) {
-	return a.networkRepo.Save(context.Background(), network)
+func (a *API) UpdateNetwork(ctx context.Context, network domain.Network) (domain.Network, error) {
+	return a.networkRepo.Save(ctx, network)
 }
 
 // DeleteNetwork implements NetworksStore interface
-func (a *API) DeleteNetwork(id int64) error {
-	return a.networkRepo.DeleteByID(context.Background(), id)
+func (a *API) DeleteNetwork(ctx context.Context, id int64) error {
+	return a.networkRepo.DeleteByID(ctx, id)
 }
 
 // GetDHCPRanges implements NetworksStore interface
-func (a *API) GetDHCPRanges(networkID int64) ([]domain.DHCPRange, error) {
-	return a.networkRepo.GetDHCPRanges(context.Background(), networkID)
+func (a *API) GetDHCPRanges(ctx context.Context, networkID int64) ([]domain.DHCPRange, error) {
+	return a.networkRepo.GetDHCPRanges(ctx, networkID)
+}
+
+// GetDHCPRange implements NetworksStore interface
+func (a *API) GetDHCPRange(ctx context.Context, id int64) (domain.DHCPRange, error) {
+	return a.dhcpRangeRepo.FindByID(ctx, id)
 }
 
 // CreateDHCPRange implements NetworksStore interface
-func (a *API) CreateDHCPRange(dhcpRange domain.DHCPRange) (domain.DHCPRange, error) {
-	return a.dhcpRangeRepo.Save(context.Background(), dhcpRange)
+func (a *API) CreateDHCPRange(ctx context.Context, dhcpRange domain.DHCPRange) (domain.DHCPRange, error) {
+	return a.dhcpRangeRepo.Save(ctx, dhcpRange)
+}
+
+// CreateDHCPRanges implements NetworksStore interface
+func (a *API) CreateDHCPRanges(ctx context.Context, ranges []domain.DHCPRange) ([]domain.DHCPRange, error) {
+	return a.dhcpRangeRepo.SaveAll(ctx, ranges)
 }
 
 // DeleteDHCPRange implements NetworksStore interface
-func (a *API) DeleteDHCPRange(id int64) error {
-	return a.dhcpRangeRepo.DeleteByID(context.Background(), id)
+func (a *API) DeleteDHCPRange(ctx context.Context, id int64) error {
+	return a.dhcpRangeRepo.DeleteByID(ctx, id)
+}
+
+// GetDHCPRangeLeases implements NetworksStore interface
+func (a *API) GetDHCPRangeLeases(ctx context.Context, id int64) ([]domain.IPAddressLease, error) {
+	return a.dhcpRangeRepo.FindLeasesInRange(ctx, id)
+}
+
+// ForceDeleteDHCPRange implements NetworksStore interface
+func (a *API) ForceDeleteDHCPRange(ctx context.Context, id int64) (int, error) {
+	released, err := a.dhcpRangeRepo.DeleteWithLeases(ctx, id)
+	// Leased machines were readdressed behind the machine repository's back
+	a.machineRepo.Invalidate()
+	return released, err
+}
+
+// GetNetworkTags implements NetworksStore interface
+func (a *API) GetNetworkTags(ctx context.Context, networkID int64) (map[string]string, error) {
+	return a.networkRepo.GetTags(ctx, networkID)
+}
+
+// SetNetworkTags implements NetworksStore interface
+func (a *API) SetNetworkTags(ctx context.Context, networkID int64, tags map[string]string) error {
+	return a.networkRepo.SetTags(ctx, networkID, tags)
+}
+
+// ListNetworksByTags implements NetworksStore interface
+func (a *API) ListNetworksByTags(ctx context.Context, tags map[string]string) ([]domain.Network, error) {
+	return a.networkRepo.FindByTags(ctx, tags)
+}
+
+// GetMACReservations implements NetworksStore interface
+func (a *API) GetMACReservations(ctx context.Context, networkID int64) ([]domain.MACReservation, error) {
+	return a.networkRepo.GetMACReservations(ctx, networkID)
+}
+
+// CreateMACReservation implements NetworksStore interface
+func (a *API) CreateMACReservation(ctx context.Context, reservation domain.MACReservation) (domain.MACReservation, error) {
+	return a.networkRepo.SaveMACReservation(ctx, reservation)
+}
+
+// DeleteMACReservation implements NetworksStore interface
+func (a *API) DeleteMACReservation(ctx context.Context, networkID, id int64) error {
+	return a.networkRepo.DeleteMACReservation(ctx, networkID, id)
+}
+
+// MigrateNetworkMachines implements NetworksStore interface
+func (a *API) MigrateNetworkMachines(ctx context.Context, sourceNetworkID, targetNetworkID int64) (int, error) {
+	moved, err := a.ipLeaseRepo.MigrateNetwork(ctx, sourceNetworkID, targetNetworkID)
+	// Machines were readdressed behind the machine repository's back
+	a.machineRepo.Invalidate()
+	return moved, err
+}
+
+// ReserveIPAddresses implements NetworksStore interface. The batch is reserved
+// under a fresh random token, which the caller needs to release it.
+func (a *API) ReserveIPAddresses(ctx context.Context, networkID int64, count int) ([]domain.IPReservation, error) {
+	return a.ipLeaseRepo.ReserveIPAddresses(ctx, networkID, count, rand.Text())
+}
+
+// ReleaseIPReservations implements NetworksStore interface
+func (a *API) ReleaseIPReservations(ctx context.Context, networkID int64, token string) (int, error) {
+	return a.ipLeaseRepo.ReleaseIPReservations(ctx, networkID, token)
+}
+
+// ListNetworkMetadata implements NetworksStore interface. Machines, their keys and
+// their key group keys are each fetched in one query, however many machines the
+// network has.
+func (a *API) ListNetworkMetadata(ctx context.Context, networkID int64) ([]NetworkMetadataSummary, error) {
+	machines, err := a.machineRepo.FindAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list machines: %w", err)
+	}
+	keys, err := a.sshKeyRepo.FindAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list SSH keys: %w", err)
+	}
+	keysByMachine := make(map[int64][]domain.SSHKey)
+	for _, k := range keys {
+		keysByMachine[k.MachineID] = append(keysByMachine[k.MachineID], k)
+	}
+	if a.keyGroupRepo != nil {
+		groupKeys, err := a.keyGroupRepo.FindAllMemberKeys(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list group keys: %w", err)
+		}
+		for machineID, gks := range groupKeys {
+			for _, k := range gks {
+				keysByMachine[machineID] = append(keysByMachine[machineID], domain.SSHKey{MachineID: machineID, KeyText: k.KeyText})
+			}
+		}
+	}
+
+	summaries := []NetworkMetadataSummary{}
+	for _, m := range machines {
+		if m.NetworkID == nil || *m.NetworkID != networkID {
+			continue
+		}
+		summaries = append(summaries, NetworkMetadataSummary{
+			MachineID:       m.ID,
+			InstanceID:      InstanceID(m.ID),
+			Hostname:        m.Hostname,
+			IPv4:            m.IPv4,
+			SSHKeys:         len(uniqueSSHKeys(keysByMachine[m.ID])),
+			MetadataEnabled: !m.MetadataDisabled,
+		})
+	}
+	return summaries, nil
+}
+
+// ListIPUsage implements IPUsageStore interface
+func (a *API) ListIPUsage(ctx context.Context) ([]domain.IPUsage, error) {
+	return a.ipLeaseRepo.FindIPUsage(ctx)
 }
@@ -53,6 +53,30 @@ func (m *mockNetworkRepo) ExistsByID(ctx context.Context, id int64) (bool, error
 	return false, errors.New("not implemented")
 }
 
+func (m *mockNetworkRepo) GetTags(ctx context.Context, networkID int64) (map[string]string, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *mockNetworkRepo) SetTags(ctx context.Context, networkID int64, tags map[string]string) error {
+	return errors.New("not implemented")
+}
+
+func (m *mockNetworkRepo) FindByTags(ctx context.Context, tags map[string]string) ([]domain.Network, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *mockNetworkRepo) GetMACReservations(ctx context.Context, networkID int64) ([]domain.MACReservation, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *mockNetworkRepo) SaveMACReservation(ctx context.Context, reservation domain.MACReservation) (domain.MACReservation, error) {
+	return domain.MACReservation{}, errors.New("not implemented")
+}
+
+func (m *mockNetworkRepo) DeleteMACReservation(ctx context.Context, networkID, id int64) error {
+	return errors.New("not implemented")
+}
+
 type mockDHCPRangeRepo struct {
 	err error
 }
@@ -81,6 +105,18 @@ func (m *mockDHCPRangeRepo) FindByNetworkID(ctx context.Context, networkID int64
 	return []domain.DHCPRange{}, errors.New("not implemented")
 }
 
+func (m *mockDHCPRangeRepo) FindLeasesInRange(ctx context.Context, id int64) ([]domain.IPAddressLease, error) {
+	return []domain.IPAddressLease{}, errors.New("not implemented")
+}
+
+func (m *mockDHCPRangeRepo) DeleteWithLeases(ctx context.Context, id int64) (int, error) {
+	return 0, errors.New("not implemented")
+}
+
+func (m *mockDHCPRangeRepo) SaveAll(ctx context.Context, ranges []domain.DHCPRange) ([]domain.DHCPRange, error) {
+	return nil, errors.New("not implemented")
+}
+
 func TestAPI_GetNetworkByName_Success(t *testing.T) {
 	mockRepo := &mockNetworkRepo{
 		networks: []domain.Network{
@@ -89,7 +125,7 @@ func TestAPI_GetNetworkByName_Success(t *testing.T) {
 	}
 	api := &API{networkRepo: mockRepo}
 
-	network, err := api.GetNetworkByName("test-network")
+	network, err := api.GetNetworkByName(context.Background(), "test-network")
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -103,7 +139,7 @@ func TestAPI_GetNetworkByName_NotFound(t *testing.T) {
 	mockRepo := &mockNetworkRepo{networks: []domain.Network{}}
 	api := &API{networkRepo: mockRepo}
 
-	_, err := api.GetNetworkByName("nonexistent")
+	_, err := api.GetNetworkByName(context.Background(), "nonexistent")
 	if err == nil {
 		t.Fatal("Expected error for nonexistent network")
 	}
@@ -113,7 +149,7 @@ func TestAPI_GetNetworkByName_Error(t *testing.T) {
 	mockRepo := &mockNetworkRepo{err: errors.New("repository error")}
 	api := &API{networkRepo: mockRepo}
 
-	_, err := api.GetNetworkByName("test-network")
+	_, err := api.GetNetworkByName(context.Background(), "test-network")
 	if err == nil {
 		t.Fatal("Expected error, got none")
 	}
@@ -123,7 +159,7 @@ func TestAPI_DeleteDHCPRange_Success(t *testing.T) {
 	mockRepo := &mockDHCPRangeRepo{}
 	api := &API{dhcpRangeRepo: mockRepo}
 
-	err := api.DeleteDHCPRange(1)
+	err := api.DeleteDHCPRange(context.Background(), 1)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -133,7 +169,7 @@ func TestAPI_DeleteDHCPRange_Error(t *testing.T) {
 	mockRepo := &mockDHCPRangeRepo{err: errors.New("deletion error")}
 	api := &API{dhcpRangeRepo: mockRepo}
 
-	err := api.DeleteDHCPRange(1)
+	err := api.DeleteDHCPRange(context.Background(), 1)
 	if err == nil {
 		t.Fatal("Expected error, got none")
 	}
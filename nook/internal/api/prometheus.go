@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Instrumentation holds the Prometheus registry served at /metrics along with
+// the per-request collectors its middleware updates.
+type Instrumentation struct {
+	registry *prometheus.Registry
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// NewInstrumentation creates an Instrumentation with request count and
+// latency collectors registered.
+func NewInstrumentation() *Instrumentation {
+	in := &Instrumentation{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nook_http_requests_total",
+			Help: "HTTP requests handled, by route pattern and status code.",
+		}, []string{"route", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "nook_http_request_duration_seconds",
+			Help:    "HTTP request latency, by route pattern and status code.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "code"}),
+	}
+	in.registry.MustRegister(in.requests, in.duration)
+	return in
+}
+
+// Register adds further collectors, such as API.InventoryCollector, to the registry.
+func (in *Instrumentation) Register(collectors ...prometheus.Collector) {
+	in.registry.MustRegister(collectors...)
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func (in *Instrumentation) Handler() http.Handler {
+	return promhttp.HandlerFor(in.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware records each request's count and duration. Requests are labeled
+// by chi route pattern rather than path so IDs do not create new series;
+// requests matching no route share the "unmatched" label.
+func (in *Instrumentation) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK // Handler wrote nothing
+		}
+		code := strconv.Itoa(status)
+		in.requests.WithLabelValues(route, code).Inc()
+		in.duration.WithLabelValues(route, code).Observe(time.Since(start).Seconds())
+	})
+}
+
+var (
+	machinesDesc    = prometheus.NewDesc("nook_machines", "Machines known to nook.", nil, nil)
+	networksDesc    = prometheus.NewDesc("nook_networks", "Networks known to nook.", nil, nil)
+	activeLeaseDesc = prometheus.NewDesc("nook_active_ip_leases", "IP addresses currently leased to machines.", nil, nil)
+)
+
+// inventoryCollector reports inventory gauges, counted from the repositories on each scrape
+type inventoryCollector struct {
+	api *API
+}
+
+// InventoryCollector returns a collector for machine, network and lease totals.
+func (a *API) InventoryCollector() prometheus.Collector {
+	return inventoryCollector{api: a}
+}
+
+func (c inventoryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- machinesDesc
+	ch <- networksDesc
+	ch <- activeLeaseDesc
+}
+
+func (c inventoryCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx := context.Background()
+	gauge := func(desc *prometheus.Desc, count int, err error) {
+		if err != nil {
+			ch <- prometheus.NewInvalidMetric(desc, err)
+			return
+		}
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(count))
+	}
+
+	machines, err := c.api.machineRepo.Count(ctx)
+	gauge(machinesDesc, machines, err)
+	networks, err := c.api.networkRepo.FindAll(ctx)
+	gauge(networksDesc, len(networks), err)
+	leases, err := c.api.ipLeaseRepo.FindAll(ctx)
+	gauge(activeLeaseDesc, len(leases), err)
+}
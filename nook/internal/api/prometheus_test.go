@@ -0,0 +1,60 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jbweber/homelab/nook/internal/domain"
+)
+
+func TestInstrumentation(t *testing.T) {
+	api, cleanup := setupIntegrationTestAPI(t)
+	defer cleanup()
+	ctx := context.Background()
+	machine, err := api.machineRepo.Save(ctx, domain.Machine{Name: "scraped", Hostname: "scraped", IPv4: "10.0.0.5"})
+	require.NoError(t, err)
+
+	instr := NewInstrumentation()
+	instr.Register(api.InventoryCollector())
+	r := chi.NewRouter()
+	r.Use(instr.Middleware)
+	r.Handle("/metrics", instr.Handler())
+	api.RegisterRoutes(r)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	found := instr.requests.WithLabelValues("/api/v0/machines/{id}", "200")
+	require.Equal(t, http.StatusOK, get("/api/v0/machines/"+strconv.FormatInt(machine.ID, 10)).Code)
+	assert.Equal(t, 1.0, testutil.ToFloat64(found))
+	require.Equal(t, http.StatusOK, get("/api/v0/machines/"+strconv.FormatInt(machine.ID, 10)).Code)
+	assert.Equal(t, 2.0, testutil.ToFloat64(found))
+
+	// Misses are labeled by pattern too, not by the requested ID
+	require.Equal(t, http.StatusNotFound, get("/api/v0/machines/999").Code)
+	assert.Equal(t, 1.0, testutil.ToFloat64(instr.requests.WithLabelValues("/api/v0/machines/{id}", "404")))
+	require.Equal(t, http.StatusNotFound, get("/no/such/route").Code)
+	assert.Equal(t, 1.0, testutil.ToFloat64(instr.requests.WithLabelValues("unmatched", "404")))
+
+	w := get("/metrics")
+	require.Equal(t, http.StatusOK, w.Code)
+	body, err := io.ReadAll(w.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "nook_machines 1\n")
+	assert.Contains(t, string(body), "nook_networks 0\n")
+	assert.Contains(t, string(body), "nook_active_ip_leases 0\n")
+	assert.Contains(t, string(body), `nook_http_request_duration_seconds_count{code="200",route="/api/v0/machines/{id}"} 2`)
+}
@@ -0,0 +1,19 @@
+package api
+
+// Reconcile action names reported in ReconcileAction.Action
+const (
+	ReconcileLeaseCreated = "lease_created"
+	ReconcileLeaseRemoved = "lease_removed"
+	ReconcileSkipped      = "skipped"
+)
+
+// ReconcileAction describes one repair made (or declined) by a reconcile run
+type ReconcileAction struct {
+	Action  string `json:"action"`
+	Message string `json:"message"`
+}
+
+// ReconcileReport lists every action taken by a reconcile run
+type ReconcileReport struct {
+	Actions []ReconcileAction `json:"actions"`
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// seedFile is one file of a NoCloud seed
+type seedFile struct {
+	name    string
+	content string
+}
+
+// buildSeedArchive writes the files into a gzipped tar, as the flat contents of
+// a NoCloud cidata volume.
+func buildSeedArchive(files []seedFile, modTime time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	for _, f := range files {
+		hdr := &tar.Header{
+			Name:    f.name,
+			Mode:    0644,
+			Size:    int64(len(f.content)),
+			ModTime: modTime,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, fmt.Errorf("failed to write tar header for %s: %w", f.name, err)
+		}
+		if _, err := tw.Write([]byte(f.content)); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", f.name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close tar writer: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close gzip writer: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// noCloudSeedArchiveHandler serves a tar.gz of a machine's meta-data, user-data
+// and network-config, for writing to a cidata USB stick. The machine is chosen
+// by ID rather than client IP, so it must only be mounted behind RequireAPIKey.
+func (a *API) noCloudSeedArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("machine_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "machine_id query parameter must be a valid machine ID", http.StatusBadRequest)
+		return
+	}
+
+	machine, err := a.GetMachine(r.Context(), id)
+	if err != nil {
+		log.Printf("failed to get machine %d: %v", id, err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if machine == nil || machine.MetadataDisabled {
+		http.Error(w, "machine not found", http.StatusNotFound)
+		return
+	}
+
+	subnet, err := machineSubnet(r.Context(), a.GetNetwork, machine)
+	if err != nil {
+		log.Printf("failed to lookup network for machine %d: %v", machine.ID, err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	keys, err := a.authorizedKeys(r.Context(), machine.ID)
+	if err != nil {
+		log.Printf("%v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	motd, err := a.GetMOTD(r.Context())
+	if err != nil {
+		log.Printf("failed to get motd: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	networkConfig, err := a.RenderNetworkConfig(r.Context(), machine)
+	if err != nil {
+		log.Printf("failed to render network config for machine %d: %v", machine.ID, err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	userData := machine.UserData
+	if userData == "" {
+		userData = renderNoCloudUserData(machine.Hostname, keys, machine.RunCmd, motd)
+	}
+
+	archive, err := buildSeedArchive([]seedFile{
+		{name: "meta-data", content: renderNoCloudMetaData(machine, subnet, a.cfg.Domain)},
+		{name: "user-data", content: userData},
+		{name: "network-config", content: networkConfig},
+	}, time.Now())
+	if err != nil {
+		log.Printf("failed to build seed archive for machine %d: %v", machine.ID, err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", machine.Name+"-cidata.tar.gz"))
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(archive); err != nil {
+		log.Printf("failed to write seed archive: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// validateSSHPublicKey checks that keyText is a single well-formed authorized_keys
+// entry: any key type golang.org/x/crypto/ssh understands, optionally preceded by
+// options and followed by a comment.
+func validateSSHPublicKey(keyText string) error {
+	pub, _, _, rest, err := ssh.ParseAuthorizedKey([]byte(keyText))
+	if err != nil {
+		return fmt.Errorf("malformed SSH public key: %w", err)
+	}
+	if strings.TrimSpace(string(rest)) != "" {
+		return fmt.Errorf("key_text must contain a single SSH public key")
+	}
+
+	// sshd refuses a key whose declared type differs from the one in its blob,
+	// which the parser itself does not check
+	blob := base64.StdEncoding.EncodeToString(pub.Marshal())
+	fields := strings.Fields(keyText)
+	for i := 1; i < len(fields); i++ {
+		if fields[i] == blob && fields[i-1] != pub.Type() {
+			return fmt.Errorf("SSH public key is declared as %s but is a %s key", fields[i-1], pub.Type())
+		}
+	}
+	return nil
+}
+
+// sshKeyFingerprint parses an authorized_keys style line ("type base64 [comment]")
+// and returns the key type and its OpenSSH SHA256 fingerprint, as printed by
+// `ssh-keygen -l`.
+func sshKeyFingerprint(keyText string) (keyType, fingerprint string, err error) {
+	fields := strings.Fields(keyText)
+	if len(fields) < 2 {
+		return "", "", fmt.Errorf("malformed SSH public key")
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return fields[0], "", fmt.Errorf("invalid SSH public key encoding: %w", err)
+	}
+
+	sum := sha256.Sum256(blob)
+	return fields[0], "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:]), nil
+}
+
+// replaceSSHKeyComment returns keyText with its trailing comment replaced by
+// comment, keeping the key type and blob as they were. An empty comment drops it.
+// The result must still parse as a key.
+func replaceSSHKeyComment(keyText, comment string) (string, error) {
+	if strings.ContainsAny(comment, "\r\n") {
+		return "", fmt.Errorf("comment must be a single line")
+	}
+	fields := strings.Fields(keyText)
+	if len(fields) < 2 {
+		return "", fmt.Errorf("malformed SSH public key")
+	}
+
+	updated := fields[0] + " " + fields[1]
+	if comment = strings.TrimSpace(comment); comment != "" {
+		updated += " " + comment
+	}
+	if _, _, err := sshKeyFingerprint(updated); err != nil {
+		return "", err
+	}
+	return updated, nil
+}
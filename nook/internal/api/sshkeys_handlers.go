@@ -1,12 +1,17 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"slices"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
+
+	"github.com/jbweber/homelab/nook/internal/repository"
 )
 
 // SSHKey represents an SSH public key associated with a machine
@@ -18,10 +23,15 @@ type SSHKey struct {
 
 // SSHKeysStore defines the datastore interface for SSH key handlers
 type SSHKeysStore interface {
-	ListAllSSHKeys() ([]SSHKey, error)
-	GetMachineByIPv4(ip string) (*Machine, error)
-	CreateSSHKey(machineID int64, keyText string) (*SSHKey, error)
-	DeleteSSHKey(id int64) error
+	ListAllSSHKeys(ctx context.Context) ([]SSHKey, error)
+	ListMachineSSHKeys(ctx context.Context, machineID int64) ([]SSHKey, error)
+	GetMachine(ctx context.Context, id int64) (*Machine, error)
+	GetMachineByIPv4(ctx context.Context, ip string) (*Machine, error)
+	CreateSSHKey(ctx context.Context, machineID int64, keyText string) (*SSHKey, error)
+	DeleteSSHKey(ctx context.Context, id int64) error
+	DeleteMachineSSHKeys(ctx context.Context, machineID int64) (int, error)
+	DeleteSSHKeysByFingerprint(ctx context.Context, fingerprint string) (int, error)
+	UpdateSSHKeyComment(ctx context.Context, id int64, comment string) (*SSHKey, error)
 }
 
 // SSHKeys groups SSH key handlers for testability
@@ -40,12 +50,32 @@ type SSHKeyResponse struct {
 	KeyText   string `json:"key_text"`
 }
 
+// SSHKeyFingerprintResponse is the compact key view returned by ?fields=fingerprint
+type SSHKeyFingerprintResponse struct {
+	ID          int64  `json:"id"`
+	MachineID   int64  `json:"machine_id"`
+	Type        string `json:"type"`
+	Fingerprint string `json:"fingerprint"`
+}
+
 func (s *SSHKeys) SSHKeysHandler(w http.ResponseWriter, r *http.Request) {
-	keys, err := s.store.ListAllSSHKeys()
+	fields := r.URL.Query().Get("fields")
+	if fields != "" && fields != "fingerprint" {
+		http.Error(w, "unsupported fields value: expected fingerprint", http.StatusBadRequest)
+		return
+	}
+
+	keys, err := s.store.ListAllSSHKeys(r.Context())
 	if err != nil {
 		http.Error(w, "failed to list SSH keys", http.StatusInternalServerError)
 		return
 	}
+
+	if fields == "fingerprint" {
+		writeSSHKeyFingerprints(w, keys)
+		return
+	}
+
 	resp := make([]SSHKeyResponse, len(keys))
 	for i, k := range keys {
 		resp[i] = SSHKeyResponse{
@@ -67,21 +97,48 @@ func (s *SSHKeys) SSHKeysHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// writeSSHKeyFingerprints writes keys without their text, with fingerprints computed
+// on read. Keys that cannot be parsed are listed with an empty fingerprint.
+func writeSSHKeyFingerprints(w http.ResponseWriter, keys []SSHKey) {
+	resp := make([]SSHKeyFingerprintResponse, len(keys))
+	for i, k := range keys {
+		keyType, fingerprint, err := sshKeyFingerprint(k.KeyText)
+		if err != nil {
+			log.Printf("failed to fingerprint ssh key %d: %v", k.ID, err)
+		}
+		resp[i] = SSHKeyFingerprintResponse{
+			ID:          k.ID,
+			MachineID:   k.MachineID,
+			Type:        keyType,
+			Fingerprint: fingerprint,
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("failed to encode ssh key fingerprints response: %v", err)
+	}
+}
+
 func (s *SSHKeys) CreateSSHKeyHandler(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		MachineID int64  `json:"machine_id"`
 		KeyText   string `json:"key_text"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid JSON", http.StatusBadRequest)
+	if err := decodeJSONBody(r, &req); err != nil {
+		http.Error(w, jsonErrorMessage(err, "invalid JSON"), http.StatusBadRequest)
 		return
 	}
 	if req.KeyText == "" {
 		http.Error(w, "key_text is required", http.StatusBadRequest)
 		return
 	}
-	key, err := s.store.CreateSSHKey(req.MachineID, req.KeyText)
+	key, err := s.store.CreateSSHKey(r.Context(), req.MachineID, req.KeyText)
 	if err != nil {
+		if errors.Is(err, repository.ErrInvalidEntity) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "failed to create SSH key", http.StatusInternalServerError)
 		return
 	}
@@ -97,6 +154,146 @@ func (s *SSHKeys) CreateSSHKeyHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// MachineSSHKeysHandler handles GET /api/v0/machines/{id}/ssh-keys and lists the
+// keys belonging to one machine. Returns 404 if the machine does not exist.
+func (s *SSHKeys) MachineSSHKeysHandler(w http.ResponseWriter, r *http.Request) {
+	machineID, ok := s.machineForKeys(w, r)
+	if !ok {
+		return
+	}
+
+	keys, err := s.store.ListMachineSSHKeys(r.Context(), machineID)
+	if err != nil {
+		log.Printf("[ERROR] failed to list SSH keys for machine %d: %v", machineID, err)
+		http.Error(w, "failed to list SSH keys", http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]SSHKeyResponse, len(keys))
+	for i, k := range keys {
+		resp[i] = SSHKeyResponse{ID: k.ID, MachineID: k.MachineID, KeyText: k.KeyText}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("failed to encode machine ssh keys response: %v", err)
+	}
+}
+
+// DeleteMachineSSHKeysHandler handles DELETE /api/v0/machines/{id}/ssh-keys and
+// removes every key of one machine, for rotating its keys. Returns 404 if the
+// machine does not exist and 200 with {"deleted": N} on success.
+func (s *SSHKeys) DeleteMachineSSHKeysHandler(w http.ResponseWriter, r *http.Request) {
+	machineID, ok := s.machineForKeys(w, r)
+	if !ok {
+		return
+	}
+
+	deleted, err := s.store.DeleteMachineSSHKeys(r.Context(), machineID)
+	if err != nil {
+		log.Printf("[ERROR] failed to delete SSH keys for machine %d: %v", machineID, err)
+		http.Error(w, "failed to delete SSH keys", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]int{"deleted": deleted}); err != nil {
+		log.Printf("failed to encode delete ssh keys response: %v", err)
+	}
+}
+
+// DeleteMachineSSHKeyHandler handles DELETE /api/v0/machines/{id}/ssh-keys/{keyId}.
+// The key is only deleted if it belongs to the machine in the path; a key of
+// another machine is 404 as if it did not exist. Returns 204 on success.
+func (s *SSHKeys) DeleteMachineSSHKeyHandler(w http.ResponseWriter, r *http.Request) {
+	machineID, ok := s.machineForKeys(w, r)
+	if !ok {
+		return
+	}
+	keyID, err := strconv.ParseInt(chi.URLParam(r, "keyId"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid SSH key ID", http.StatusBadRequest)
+		return
+	}
+
+	keys, err := s.store.ListMachineSSHKeys(r.Context(), machineID)
+	if err != nil {
+		log.Printf("[ERROR] failed to list SSH keys for machine %d: %v", machineID, err)
+		http.Error(w, "failed to delete SSH key", http.StatusInternalServerError)
+		return
+	}
+	if !slices.ContainsFunc(keys, func(k SSHKey) bool { return k.ID == keyID }) {
+		http.Error(w, "SSH key not found", http.StatusNotFound)
+		return
+	}
+
+	if err := s.store.DeleteSSHKey(r.Context(), keyID); err != nil {
+		log.Printf("[ERROR] failed to delete SSH key %d: %v", keyID, err)
+		http.Error(w, "failed to delete SSH key", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateMachineSSHKeyHandler handles POST /api/v0/machines/{id}/ssh-keys with body
+// {"key_text": "..."} and adds a key to the machine in the path. Returns 404 if
+// the machine does not exist and 201 with the created key on success.
+func (s *SSHKeys) CreateMachineSSHKeyHandler(w http.ResponseWriter, r *http.Request) {
+	machineID, ok := s.machineForKeys(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		KeyText string `json:"key_text"`
+	}
+	if err := decodeJSONBody(r, &req); err != nil {
+		http.Error(w, jsonErrorMessage(err, "invalid JSON"), http.StatusBadRequest)
+		return
+	}
+	if req.KeyText == "" {
+		http.Error(w, "key_text is required", http.StatusBadRequest)
+		return
+	}
+
+	key, err := s.store.CreateSSHKey(r.Context(), machineID, req.KeyText)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidEntity) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("[ERROR] failed to create SSH key for machine %d: %v", machineID, err)
+		http.Error(w, "failed to create SSH key", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(SSHKeyResponse{ID: key.ID, MachineID: key.MachineID, KeyText: key.KeyText}); err != nil {
+		log.Printf("failed to encode create ssh key response: %v", err)
+	}
+}
+
+// machineForKeys resolves the machine ID in the path, writing the error response
+// and returning false if it is malformed or names no machine.
+func (s *SSHKeys) machineForKeys(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	machineID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid machine ID", http.StatusBadRequest)
+		return 0, false
+	}
+	machine, err := s.store.GetMachine(r.Context(), machineID)
+	if err != nil {
+		log.Printf("[ERROR] failed to get machine %d: %v", machineID, err)
+		http.Error(w, "failed to get machine", http.StatusInternalServerError)
+		return 0, false
+	}
+	if machine == nil {
+		http.Error(w, "machine not found", http.StatusNotFound)
+		return 0, false
+	}
+	return machineID, true
+}
+
 func (s *SSHKeys) DeleteSSHKeyHandler(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
@@ -105,7 +302,7 @@ func (s *SSHKeys) DeleteSSHKeyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = s.store.DeleteSSHKey(id)
+	err = s.store.DeleteSSHKey(r.Context(), id)
 	if err != nil {
 		http.Error(w, "failed to delete SSH key", http.StatusInternalServerError)
 		return
@@ -114,6 +311,72 @@ func (s *SSHKeys) DeleteSSHKeyHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// UpdateSSHKeyHandler handles PATCH /api/v0/ssh-keys/{id} with body {"comment": "..."}
+// and relabels the key by rewriting its trailing comment. The key type and blob,
+// and so its fingerprint, are unchanged; an empty comment removes it.
+func (s *SSHKeys) UpdateSSHKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid SSH key ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Comment *string `json:"comment"`
+	}
+	if err := decodeJSONBody(r, &req); err != nil {
+		http.Error(w, jsonErrorMessage(err, "invalid JSON"), http.StatusBadRequest)
+		return
+	}
+	if req.Comment == nil {
+		http.Error(w, "comment is required", http.StatusBadRequest)
+		return
+	}
+
+	key, err := s.store.UpdateSSHKeyComment(r.Context(), id, *req.Comment)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidEntity) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("[ERROR] failed to update SSH key %d: %v", id, err)
+		http.Error(w, "failed to update SSH key", http.StatusInternalServerError)
+		return
+	}
+	if key == nil {
+		http.Error(w, "SSH key not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(SSHKeyResponse{ID: key.ID, MachineID: key.MachineID, KeyText: key.KeyText}); err != nil {
+		log.Printf("failed to encode update ssh key response: %v", err)
+	}
+}
+
+// DeleteSSHKeysByFingerprintHandler handles DELETE /api/v0/ssh-keys?fingerprint=SHA256:...
+// and removes every key with that fingerprint across all machines.
+func (s *SSHKeys) DeleteSSHKeysByFingerprintHandler(w http.ResponseWriter, r *http.Request) {
+	fingerprint := r.URL.Query().Get("fingerprint")
+	if fingerprint == "" {
+		http.Error(w, "fingerprint query parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := s.store.DeleteSSHKeysByFingerprint(r.Context(), fingerprint)
+	if err != nil {
+		log.Printf("[ERROR] failed to delete SSH keys by fingerprint %s: %v", fingerprint, err)
+		http.Error(w, "failed to delete SSH keys", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]int{"deleted": deleted}); err != nil {
+		log.Printf("failed to encode delete ssh keys response: %v", err)
+	}
+}
+
 // RegisterSSHKeysRoutes registers all SSH key related routes on the provided router.
 // This function encapsulates all SSH key route registration logic, making it easier
 // to test and maintain SSH key functionality independently.
@@ -124,6 +387,8 @@ func RegisterSSHKeysRoutes(r chi.Router, store SSHKeysStore) {
 	r.Route("/api/v0/ssh-keys", func(r chi.Router) {
 		r.Get("/", sshKeys.SSHKeysHandler)
 		r.Post("/", sshKeys.CreateSSHKeyHandler)
+		r.Delete("/", sshKeys.DeleteSSHKeysByFingerprintHandler)
+		r.Patch("/{id}", sshKeys.UpdateSSHKeyHandler)
 		r.Delete("/{id}", sshKeys.DeleteSSHKeyHandler)
 	})
 
@@ -7,6 +7,8 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/go-chi/chi/v5"
@@ -17,15 +19,29 @@ type mockSSHKeysStore struct {
 	err     error
 }
 
-func (m *mockSSHKeysStore) ListAllSSHKeys() ([]SSHKey, error) {
+func (m *mockSSHKeysStore) ListAllSSHKeys(ctx context.Context) ([]SSHKey, error) {
 	return m.sshKeys, m.err
 }
 
-func (m *mockSSHKeysStore) GetMachineByIPv4(ip string) (*Machine, error) {
+func (m *mockSSHKeysStore) GetMachineByIPv4(ctx context.Context, ip string) (*Machine, error) {
 	return nil, nil // Not used in SSH key handlers
 }
 
-func (m *mockSSHKeysStore) CreateSSHKey(machineID int64, keyText string) (*SSHKey, error) {
+func (m *mockSSHKeysStore) GetMachine(ctx context.Context, id int64) (*Machine, error) {
+	return nil, m.err
+}
+
+func (m *mockSSHKeysStore) ListMachineSSHKeys(ctx context.Context, machineID int64) ([]SSHKey, error) {
+	var keys []SSHKey
+	for _, k := range m.sshKeys {
+		if k.MachineID == machineID {
+			keys = append(keys, k)
+		}
+	}
+	return keys, m.err
+}
+
+func (m *mockSSHKeysStore) CreateSSHKey(ctx context.Context, machineID int64, keyText string) (*SSHKey, error) {
 	if m.err != nil {
 		return nil, m.err
 	}
@@ -38,7 +54,7 @@ func (m *mockSSHKeysStore) CreateSSHKey(machineID int64, keyText string) (*SSHKe
 	return key, nil
 }
 
-func (m *mockSSHKeysStore) DeleteSSHKey(id int64) error {
+func (m *mockSSHKeysStore) DeleteSSHKey(ctx context.Context, id int64) error {
 	if m.err != nil {
 		return m.err
 	}
@@ -52,6 +68,18 @@ func (m *mockSSHKeysStore) DeleteSSHKey(id int64) error {
 	return nil // Key not found, but don't error
 }
 
+func (m *mockSSHKeysStore) DeleteMachineSSHKeys(ctx context.Context, machineID int64) (int, error) {
+	return 0, errors.New("not implemented")
+}
+
+func (m *mockSSHKeysStore) DeleteSSHKeysByFingerprint(ctx context.Context, fingerprint string) (int, error) {
+	return 0, errors.New("not implemented")
+}
+
+func (m *mockSSHKeysStore) UpdateSSHKeyComment(ctx context.Context, id int64, comment string) (*SSHKey, error) {
+	return nil, errors.New("not implemented")
+}
+
 func TestSSHKeys_SSHKeysHandler_Empty(t *testing.T) {
 	store := &mockSSHKeysStore{sshKeys: []SSHKey{}}
 	sshKeys := NewSSHKeys(store)
@@ -77,6 +105,151 @@ func TestSSHKeys_SSHKeysHandler_Empty(t *testing.T) {
 	}
 }
 
+const testEd25519Key = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIHHWRsRoeU3xJXRngvR6Eavcr4HtOIkitq6kLNDWS8Z5 alice@lab"
+
+// Fingerprint of testEd25519Key as reported by `ssh-keygen -l`
+const testEd25519Fingerprint = "SHA256:KOnFDTR+OP1U5awIUTzKRHLN8MNY9NZRM8r8XnVk2Bw"
+
+const testRSAKey = "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQDEu/Z9QRTRi99pfzpgEO3e+2c1rVVEU5SfPTnFKa2GqJbNXQ041Fi8p30o6VxAHWNsGnHL7NI+ltwUo05Qtg9cnw9tey/QTVqeBfsxMZFClgtCx6tQtouQHqxjovUCBfpxCQyXmereOwWGR4fYMErioODibQOoQWVrEqOD4p1AdSd5tuwBaWPYEijJfYGD29DND+pojR4CN6NK5ZTNtZs2nsxThEvxO/YUPUk/KSzCMPAw7knx+hJIDg3rk6zKCh7pv7qliJ5Ed+zGEEEvhtmWcATEhh87AFKqRRVjmgK0S5n8geCzx191FPORCmHEyitF6YLXpEQYfaxVBapppBfP bob@lab"
+
+const testECDSAKey = "ecdsa-sha2-nistp256 AAAAE2VjZHNhLXNoYTItbmlzdHAyNTYAAAAIbmlzdHAyNTYAAABBBOxSkO4jg9aLSg6fLww6z5hFCSGdUXsaWK88IQ5fJIi/YoaOUyxO61u/kBm8XVTOdK55cJdOQdqOcBElnybfFDk= carol@lab"
+
+func TestSSHKeys_SSHKeysHandler_Fingerprints(t *testing.T) {
+	store := &mockSSHKeysStore{sshKeys: []SSHKey{{ID: 1, MachineID: 7, KeyText: testEd25519Key}}}
+	sshKeys := NewSSHKeys(store)
+
+	req := httptest.NewRequest("GET", "/api/v0/ssh-keys?fields=fingerprint", nil)
+	w := httptest.NewRecorder()
+	sshKeys.SSHKeysHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	// Only the compact fields are returned
+	var resp []map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp) != 1 {
+		t.Fatalf("Expected 1 key, got %d", len(resp))
+	}
+	if _, ok := resp[0]["key_text"]; ok {
+		t.Error("Expected key_text to be omitted")
+	}
+	if len(resp[0]) != 4 {
+		t.Errorf("Expected exactly id, machine_id, type and fingerprint, got %v", resp[0])
+	}
+	if resp[0]["type"] != "ssh-ed25519" {
+		t.Errorf("Expected type ssh-ed25519, got %v", resp[0]["type"])
+	}
+	if resp[0]["fingerprint"] != testEd25519Fingerprint {
+		t.Errorf("Expected fingerprint %s, got %v", testEd25519Fingerprint, resp[0]["fingerprint"])
+	}
+}
+
+func TestSSHKeys_SSHKeysHandler_DefaultIncludesKeyText(t *testing.T) {
+	store := &mockSSHKeysStore{sshKeys: []SSHKey{{ID: 1, MachineID: 7, KeyText: testEd25519Key}}}
+	sshKeys := NewSSHKeys(store)
+
+	req := httptest.NewRequest("GET", "/api/v0/ssh-keys", nil)
+	w := httptest.NewRecorder()
+	sshKeys.SSHKeysHandler(w, req)
+
+	var resp []SSHKeyResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp) != 1 || resp[0].KeyText != testEd25519Key {
+		t.Errorf("Expected full key text, got %v", resp)
+	}
+}
+
+func TestSSHKeys_SSHKeysHandler_UnsupportedFields(t *testing.T) {
+	sshKeys := NewSSHKeys(&mockSSHKeysStore{})
+
+	req := httptest.NewRequest("GET", "/api/v0/ssh-keys?fields=bogus", nil)
+	w := httptest.NewRecorder()
+	sshKeys.SSHKeysHandler(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestSSHKeyFingerprint_Malformed(t *testing.T) {
+	if _, _, err := sshKeyFingerprint("not-a-key"); err == nil {
+		t.Error("Expected error for key without a body")
+	}
+	if _, _, err := sshKeyFingerprint("ssh-ed25519 !!!notbase64"); err == nil {
+		t.Error("Expected error for invalid base64")
+	}
+}
+
+func TestValidateSSHPublicKey(t *testing.T) {
+	for _, valid := range []string{
+		testEd25519Key,
+		testRSAKey,
+		testECDSAKey,
+		strings.TrimSuffix(testEd25519Key, " alice@lab"),
+		`no-port-forwarding,command="/bin/true" ` + testEd25519Key,
+		testEd25519Key + "\n",
+	} {
+		if err := validateSSHPublicKey(valid); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", valid, err)
+		}
+	}
+
+	fields := strings.Fields(testEd25519Key)
+	for _, invalid := range []string{
+		"",
+		"not-a-key",
+		"ssh-ed25519 !!!notbase64",
+		fields[0] + " " + fields[1][:20] + " truncated@lab",
+		"ssh-rsa " + fields[1] + " mismatched@lab",
+		testEd25519Key + "\n" + testRSAKey,
+	} {
+		if err := validateSSHPublicKey(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestSSHKeys_CreateSSHKeyHandler_MalformedKey(t *testing.T) {
+	api, cleanup := setupIntegrationTestAPI(t)
+	defer cleanup()
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+
+	res, err := api.db.Exec("INSERT INTO machines (name, hostname, ipv4) VALUES (?, ?, ?)", "validated", "validated", "192.168.1.92")
+	if err != nil {
+		t.Fatalf("Failed to insert machine: %v", err)
+	}
+	machineID, _ := res.LastInsertId()
+
+	post := func(keyText string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]interface{}{"machine_id": machineID, "key_text": keyText})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/api/v0/ssh-keys", bytes.NewReader(body)))
+		return w
+	}
+
+	w := post("ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIHHWRsRoeU3x alice@lab")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 for a truncated key, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "malformed SSH public key") {
+		t.Errorf("Expected a descriptive error, got %q", w.Body.String())
+	}
+	if keys, _ := api.ListMachineSSHKeys(context.Background(), machineID); len(keys) != 0 {
+		t.Errorf("Expected the malformed key not to be stored, got %d keys", len(keys))
+	}
+
+	if w := post(testEd25519Key); w.Code != http.StatusCreated {
+		t.Errorf("Expected status 201 for a valid ed25519 key, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
 func TestSSHKeys_SSHKeysHandler_Success(t *testing.T) {
 	store := &mockSSHKeysStore{
 		sshKeys: []SSHKey{
@@ -323,3 +496,235 @@ func TestRegisterSSHKeysRoutes(t *testing.T) {
 		}
 	}
 }
+
+func TestSSHKeys_DeleteByFingerprint_MissingFingerprint(t *testing.T) {
+	store := &mockSSHKeysStore{}
+	r := chi.NewRouter()
+	RegisterSSHKeysRoutes(r, store)
+
+	req := httptest.NewRequest("DELETE", "/api/v0/ssh-keys", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestSSHKeys_MachineSSHKeys(t *testing.T) {
+	api, cleanup := setupIntegrationTestAPI(t)
+	defer cleanup()
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+
+	res, err := api.db.Exec("INSERT INTO machines (name, hostname, ipv4) VALUES (?, ?, ?)", "keyed", "keyed", "192.168.1.91")
+	if err != nil {
+		t.Fatalf("Failed to insert machine: %v", err)
+	}
+	machineID, _ := res.LastInsertId()
+	path := "/api/v0/machines/" + strconv.FormatInt(machineID, 10) + "/ssh-keys"
+
+	list := func(path string) (int, []SSHKeyResponse) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		var keys []SSHKeyResponse
+		if w.Code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(&keys); err != nil {
+				t.Fatalf("Failed to decode keys: %v", err)
+			}
+		}
+		return w.Code, keys
+	}
+
+	if code, keys := list(path); code != http.StatusOK || len(keys) != 0 {
+		t.Fatalf("Expected 200 with no keys, got %d with %d keys", code, len(keys))
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", path, strings.NewReader(`{"key_text":"`+testEd25519Key+`"}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created SSHKeyResponse
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("Failed to decode created key: %v", err)
+	}
+	if created.MachineID != machineID || created.KeyText != testEd25519Key {
+		t.Errorf("Unexpected created key: %+v", created)
+	}
+
+	code, keys := list(path)
+	if code != http.StatusOK || len(keys) != 1 || keys[0].ID != created.ID {
+		t.Errorf("Expected the created key to be listed, got %d: %+v", code, keys)
+	}
+
+	// Unknown machines are 404 for both listing and adding
+	if code, _ := list("/api/v0/machines/99999/ssh-keys"); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 listing keys of a missing machine, got %d", code)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/api/v0/machines/99999/ssh-keys", strings.NewReader(`{"key_text":"`+testEd25519Key+`"}`)))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 adding a key to a missing machine, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", path, strings.NewReader(`{}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without key_text, got %d", w.Code)
+	}
+}
+
+func TestSSHKeys_UpdateSSHKeyHandler_Comment(t *testing.T) {
+	api, cleanup := setupIntegrationTestAPI(t)
+	defer cleanup()
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+
+	res, err := api.db.Exec("INSERT INTO machines (name, hostname, ipv4) VALUES (?, ?, ?)", "relabel", "relabel", "192.168.1.90")
+	if err != nil {
+		t.Fatalf("Failed to insert machine: %v", err)
+	}
+	machineID, _ := res.LastInsertId()
+	key, err := api.CreateSSHKey(context.Background(), machineID, testEd25519Key)
+	if err != nil {
+		t.Fatalf("Failed to create key: %v", err)
+	}
+
+	patch := func(id int64, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PATCH", "/api/v0/ssh-keys/"+strconv.FormatInt(id, 10), bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := patch(key.ID, `{"comment": "alice@laptop"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp SSHKeyResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	expected := strings.Replace(testEd25519Key, "alice@lab", "alice@laptop", 1)
+	if resp.KeyText != expected {
+		t.Errorf("Expected key text %q, got %q", expected, resp.KeyText)
+	}
+
+	// The stored key keeps its type and blob, so the fingerprint is unchanged
+	stored, err := api.sshKeyRepo.FindByID(context.Background(), key.ID)
+	if err != nil {
+		t.Fatalf("Failed to load key: %v", err)
+	}
+	if stored.KeyText != expected {
+		t.Errorf("Expected stored key text %q, got %q", expected, stored.KeyText)
+	}
+	if _, fp, _ := sshKeyFingerprint(stored.KeyText); fp != testEd25519Fingerprint {
+		t.Errorf("Expected fingerprint %s, got %s", testEd25519Fingerprint, fp)
+	}
+
+	// An empty comment removes it
+	w = patch(key.ID, `{"comment": ""}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	stored, _ = api.sshKeyRepo.FindByID(context.Background(), key.ID)
+	if stored.KeyText != strings.TrimSuffix(testEd25519Key, " alice@lab") {
+		t.Errorf("Expected comment to be removed, got %q", stored.KeyText)
+	}
+
+	if w := patch(key.ID, `{"comment": "two\nlines"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for multi-line comment, got %d", w.Code)
+	}
+	if w := patch(key.ID, `{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without comment, got %d", w.Code)
+	}
+	if w := patch(9999, `{"comment": "x"}`); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown key, got %d", w.Code)
+	}
+}
+
+func TestSSHKeys_DeleteMachineSSHKeys(t *testing.T) {
+	api, cleanup := setupIntegrationTestAPI(t)
+	defer cleanup()
+	r := chi.NewRouter()
+	api.RegisterRoutes(r)
+	ctx := context.Background()
+
+	insertMachine := func(name, ip string) int64 {
+		res, err := api.db.Exec("INSERT INTO machines (name, hostname, ipv4) VALUES (?, ?, ?)", name, name, ip)
+		if err != nil {
+			t.Fatalf("Failed to insert machine: %v", err)
+		}
+		id, _ := res.LastInsertId()
+		return id
+	}
+	addKey := func(machineID int64, keyText string) int64 {
+		key, err := api.sshKeyRepo.CreateForMachine(ctx, machineID, keyText)
+		if err != nil {
+			t.Fatalf("Failed to create key: %v", err)
+		}
+		return key.ID
+	}
+	keysPath := func(machineID int64) string {
+		return "/api/v0/machines/" + strconv.FormatInt(machineID, 10) + "/ssh-keys"
+	}
+	del := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("DELETE", path, nil))
+		return w
+	}
+	remaining := func(machineID int64) int {
+		keys, err := api.sshKeyRepo.FindByMachineID(ctx, machineID)
+		if err != nil {
+			t.Fatalf("Failed to list keys: %v", err)
+		}
+		return len(keys)
+	}
+
+	rotated := insertMachine("rotated", "192.168.1.92")
+	other := insertMachine("other", "192.168.1.93")
+	rotatedKey := addKey(rotated, testEd25519Key)
+	addKey(rotated, testRSAKey)
+	otherKey := addKey(other, testECDSAKey)
+
+	// Another machine's key is not reachable through this machine's path
+	if w := del(keysPath(rotated) + "/" + strconv.FormatInt(otherKey, 10)); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 deleting another machine's key, got %d", w.Code)
+	}
+	if got := remaining(other); got != 1 {
+		t.Errorf("Expected the other machine's key to remain, got %d keys", got)
+	}
+
+	if w := del(keysPath(rotated) + "/" + strconv.FormatInt(rotatedKey, 10)); w.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204 deleting a key, got %d", w.Code)
+	}
+	if got := remaining(rotated); got != 1 {
+		t.Errorf("Expected 1 key left after deleting one, got %d", got)
+	}
+
+	w := del(keysPath(rotated))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 deleting all keys, got %d", w.Code)
+	}
+	var resp map[string]int
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp["deleted"] != 1 {
+		t.Errorf("Expected 1 key deleted, got %d", resp["deleted"])
+	}
+	if got := remaining(rotated); got != 0 {
+		t.Errorf("Expected no keys left, got %d", got)
+	}
+	if got := remaining(other); got != 1 {
+		t.Errorf("Expected the other machine's key to remain, got %d keys", got)
+	}
+
+	if w := del(keysPath(99999)); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing machine, got %d", w.Code)
+	}
+	if w := del(keysPath(rotated) + "/abc"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid key ID, got %d", w.Code)
+	}
+}
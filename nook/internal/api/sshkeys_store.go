@@ -2,11 +2,15 @@ package api
 
 import (
 	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jbweber/homelab/nook/internal/repository"
 )
 
 // ListAllSSHKeys implements SSHKeysStore interface
-func (a *API) ListAllSSHKeys() ([]SSHKey, error) {
-	keys, err := a.sshKeyRepo.FindAll(context.Background())
+func (a *API) ListAllSSHKeys(ctx context.Context) ([]SSHKey, error) {
+	keys, err := a.sshKeyRepo.FindAll(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -22,9 +26,31 @@ func (a *API) ListAllSSHKeys() ([]SSHKey, error) {
 	return result, nil
 }
 
-// CreateSSHKey implements SSHKeysStore interface
-func (a *API) CreateSSHKey(machineID int64, keyText string) (*SSHKey, error) {
-	key, err := a.sshKeyRepo.CreateForMachine(context.Background(), machineID, keyText)
+// ListMachineSSHKeys implements SSHKeysStore interface
+func (a *API) ListMachineSSHKeys(ctx context.Context, machineID int64) ([]SSHKey, error) {
+	keys, err := a.sshKeyRepo.FindByMachineID(ctx, machineID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]SSHKey, len(keys))
+	for i, k := range keys {
+		result[i] = SSHKey{
+			ID:        k.ID,
+			MachineID: k.MachineID,
+			KeyText:   k.KeyText,
+		}
+	}
+	return result, nil
+}
+
+// CreateSSHKey implements SSHKeysStore interface. A key that does not parse as
+// an authorized_keys entry is refused with an error wrapping
+// repository.ErrInvalidEntity.
+func (a *API) CreateSSHKey(ctx context.Context, machineID int64, keyText string) (*SSHKey, error) {
+	if err := validateSSHPublicKey(keyText); err != nil {
+		return nil, fmt.Errorf("%v: %w", err, repository.ErrInvalidEntity)
+	}
+	key, err := a.sshKeyRepo.CreateForMachine(ctx, machineID, keyText)
 	if err != nil {
 		return nil, err
 	}
@@ -36,7 +62,58 @@ func (a *API) CreateSSHKey(machineID int64, keyText string) (*SSHKey, error) {
 	}, nil
 }
 
+// UpdateSSHKeyComment implements SSHKeysStore interface. It returns nil if the
+// key does not exist, and an error wrapping repository.ErrInvalidEntity if the
+// comment cannot be applied.
+func (a *API) UpdateSSHKeyComment(ctx context.Context, id int64, comment string) (*SSHKey, error) {
+	key, err := a.sshKeyRepo.FindByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	keyText, err := replaceSSHKeyComment(key.KeyText, comment)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, repository.ErrInvalidEntity)
+	}
+	updated, err := a.sshKeyRepo.UpdateKeyText(ctx, id, keyText)
+	if err != nil {
+		return nil, err
+	}
+	return &SSHKey{
+		ID:        updated.ID,
+		MachineID: updated.MachineID,
+		KeyText:   updated.KeyText,
+	}, nil
+}
+
 // DeleteSSHKey implements SSHKeysStore interface
-func (a *API) DeleteSSHKey(id int64) error {
-	return a.sshKeyRepo.DeleteByID(context.Background(), id)
+func (a *API) DeleteSSHKey(ctx context.Context, id int64) error {
+	return a.sshKeyRepo.DeleteByID(ctx, id)
+}
+
+// DeleteMachineSSHKeys implements SSHKeysStore interface
+func (a *API) DeleteMachineSSHKeys(ctx context.Context, machineID int64) (int, error) {
+	return a.sshKeyRepo.DeleteByMachineID(ctx, machineID)
+}
+
+// DeleteSSHKeysByFingerprint implements SSHKeysStore interface. Fingerprints are
+// computed from the stored key text, so matching happens here rather than in SQL.
+func (a *API) DeleteSSHKeysByFingerprint(ctx context.Context, fingerprint string) (int, error) {
+	keys, err := a.sshKeyRepo.FindAll(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int64
+	for _, k := range keys {
+		if _, fp, err := sshKeyFingerprint(k.KeyText); err == nil && fp == fingerprint {
+			ids = append(ids, k.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	return a.sshKeyRepo.DeleteByIDs(ctx, ids)
 }
@@ -39,6 +39,18 @@ func (m *mockSSHKeyRepo) DeleteByID(ctx context.Context, id int64) error {
 	return nil // Key not found, but don't error
 }
 
+func (m *mockSSHKeyRepo) DeleteByIDs(ctx context.Context, ids []int64) (int, error) {
+	return 0, errors.New("not implemented")
+}
+
+func (m *mockSSHKeyRepo) DeleteByMachineID(ctx context.Context, machineID int64) (int, error) {
+	return 0, errors.New("not implemented")
+}
+
+func (m *mockSSHKeyRepo) UpdateKeyText(ctx context.Context, id int64, keyText string) (*domain.SSHKey, error) {
+	return nil, errors.New("not implemented")
+}
+
 func (m *mockSSHKeyRepo) ExistsByID(ctx context.Context, id int64) (bool, error) {
 	return false, errors.New("not implemented")
 }
@@ -70,7 +82,7 @@ func TestAPI_ListAllSSHKeys_Success(t *testing.T) {
 
 	api := &API{sshKeyRepo: mockRepo}
 
-	keys, err := api.ListAllSSHKeys()
+	keys, err := api.ListAllSSHKeys(context.Background())
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -88,7 +100,7 @@ func TestAPI_ListAllSSHKeys_Empty(t *testing.T) {
 	mockRepo := &mockSSHKeyRepo{sshKeys: []domain.SSHKey{}}
 	api := &API{sshKeyRepo: mockRepo}
 
-	keys, err := api.ListAllSSHKeys()
+	keys, err := api.ListAllSSHKeys(context.Background())
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -102,7 +114,7 @@ func TestAPI_ListAllSSHKeys_Error(t *testing.T) {
 	mockRepo := &mockSSHKeyRepo{err: errors.New("repository error")}
 	api := &API{sshKeyRepo: mockRepo}
 
-	keys, err := api.ListAllSSHKeys()
+	keys, err := api.ListAllSSHKeys(context.Background())
 	if err == nil {
 		t.Fatal("Expected error, got none")
 	}
@@ -116,7 +128,7 @@ func TestAPI_CreateSSHKey_Success(t *testing.T) {
 	mockRepo := &mockSSHKeyRepo{sshKeys: []domain.SSHKey{}}
 	api := &API{sshKeyRepo: mockRepo}
 
-	key, err := api.CreateSSHKey(1, "ssh-rsa AAAAB3NzaC1yc2E...")
+	key, err := api.CreateSSHKey(context.Background(), 1, testRSAKey)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -129,7 +141,7 @@ func TestAPI_CreateSSHKey_Success(t *testing.T) {
 		t.Errorf("Expected MachineID 1, got %d", key.MachineID)
 	}
 
-	if key.KeyText != "ssh-rsa AAAAB3NzaC1yc2E..." {
+	if key.KeyText != testRSAKey {
 		t.Errorf("Expected key text to match, got %s", key.KeyText)
 	}
 
@@ -142,7 +154,7 @@ func TestAPI_CreateSSHKey_Error(t *testing.T) {
 	mockRepo := &mockSSHKeyRepo{err: errors.New("repository error")}
 	api := &API{sshKeyRepo: mockRepo}
 
-	key, err := api.CreateSSHKey(1, "ssh-rsa AAAAB3NzaC1yc2E...")
+	key, err := api.CreateSSHKey(context.Background(), 1, testRSAKey)
 	if err == nil {
 		t.Fatal("Expected error, got none")
 	}
@@ -160,7 +172,7 @@ func TestAPI_DeleteSSHKey_Success(t *testing.T) {
 	}
 	api := &API{sshKeyRepo: mockRepo}
 
-	err := api.DeleteSSHKey(1)
+	err := api.DeleteSSHKey(context.Background(), 1)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -176,7 +188,7 @@ func TestAPI_DeleteSSHKey_NotFound(t *testing.T) {
 	api := &API{sshKeyRepo: mockRepo}
 
 	// Deleting non-existent key should not error
-	err := api.DeleteSSHKey(999)
+	err := api.DeleteSSHKey(context.Background(), 999)
 	if err != nil {
 		t.Fatalf("Expected no error for non-existent key, got %v", err)
 	}
@@ -186,7 +198,7 @@ func TestAPI_DeleteSSHKey_Error(t *testing.T) {
 	mockRepo := &mockSSHKeyRepo{err: errors.New("repository error")}
 	api := &API{sshKeyRepo: mockRepo}
 
-	err := api.DeleteSSHKey(1)
+	err := api.DeleteSSHKey(context.Background(), 1)
 	if err == nil {
 		t.Fatal("Expected error, got none")
 	}
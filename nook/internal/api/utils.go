@@ -1,21 +1,112 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/http"
+	"strings"
 )
 
-// extractClientIP extracts the client IP from the request, preferring X-Forwarded-For header
-// over RemoteAddr. Returns an error if the IP cannot be parsed.
+type trustedProxiesKey struct{}
+
+// TrustProxies returns middleware recording the reverse proxy networks whose
+// X-Forwarded-For header extractClientIP may honor. Install it ahead of
+// RequestLogger so access logs record the forwarded client rather than the
+// proxy.
+func TrustProxies(nets []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(nets) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), trustedProxiesKey{}, nets)))
+		})
+	}
+}
+
+// extractClientIP extracts the client IP from the request. X-Forwarded-For is
+// only honored when RemoteAddr is a trusted proxy (see TrustProxies); otherwise
+// RemoteAddr is used, so clients cannot claim another machine's address.
+// Returns an error if RemoteAddr cannot be parsed.
 func extractClientIP(r *http.Request) (string, error) {
-	ip := r.Header.Get("X-Forwarded-For")
-	if ip == "" {
-		var err error
-		ip, _, err = net.SplitHostPort(r.RemoteAddr)
-		if err != nil {
-			return "", fmt.Errorf("unable to parse remote address: %w", err)
+	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse remote address: %w", err)
+	}
+	nets, _ := r.Context().Value(trustedProxiesKey{}).([]*net.IPNet)
+	if !inNets(net.ParseIP(remoteIP), nets) {
+		return remoteIP, nil
+	}
+	if ip := forwardedClientIP(r.Header.Values("X-Forwarded-For"), nets); ip != "" {
+		return ip, nil
+	}
+	return remoteIP, nil
+}
+
+// forwardedClientIP picks the client from an X-Forwarded-For chain received from
+// a trusted proxy. Each proxy appends the address it received the request from,
+// so the chain is walked from the right, skipping hops that are trusted proxies
+// themselves; the first untrusted hop is the client, since anything to its left
+// was supplied by that client. It returns "" if the chain is empty or any entry
+// is not an IP address.
+func forwardedClientIP(headers []string, nets []*net.IPNet) string {
+	var hops []net.IP
+	for _, header := range headers {
+		for _, hop := range strings.Split(header, ",") {
+			ip := net.ParseIP(strings.TrimSpace(hop))
+			if ip == nil {
+				return ""
+			}
+			hops = append(hops, ip)
+		}
+	}
+	if len(hops) == 0 {
+		return ""
+	}
+
+	for i := len(hops) - 1; i > 0; i-- {
+		if !inNets(hops[i], nets) {
+			return hops[i].String()
 		}
 	}
-	return ip, nil
+	return hops[0].String()
+}
+
+// inNets reports whether ip lies in one of nets
+func inNets(ip net.IP, nets []*net.IPNet) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// machineIPLookup resolves machines by either address family.
+type machineIPLookup interface {
+	GetMachineByIPv4(ctx context.Context, ipv4 string) (*Machine, error)
+	GetMachineByIPv6(ctx context.Context, ipv6 string) (*Machine, error)
+}
+
+// machineByClientIP looks up the machine owning ip, choosing the IPv6 lookup
+// when the address is not IPv4. It returns nil when no machine owns the address.
+func machineByClientIP(ctx context.Context, store machineIPLookup, ip string) (*Machine, error) {
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		return store.GetMachineByIPv6(ctx, parsed.String())
+	}
+	return store.GetMachineByIPv4(ctx, ip)
+}
+
+// requireConfirmation guards destructive operations. It returns true when the
+// request carries ?confirm=true; otherwise it writes a 400 and returns false.
+func requireConfirmation(w http.ResponseWriter, r *http.Request) bool {
+	if r.URL.Query().Get("confirm") == "true" {
+		return true
+	}
+	http.Error(w, "confirmation required: repeat the request with confirm=true", http.StatusBadRequest)
+	return false
 }
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testProxyAddr is the RemoteAddr viaTrustedProxy requests arrive from
+const testProxyAddr = "10.255.0.1:8080"
+
+// viaTrustedProxy makes req arrive from a trusted reverse proxy that reports
+// forwardedFor in X-Forwarded-For, as the TrustProxies middleware would.
+func viaTrustedProxy(req *http.Request, forwardedFor string) *http.Request {
+	_, proxy, _ := net.ParseCIDR("10.255.0.1/32")
+	req.RemoteAddr = testProxyAddr
+	req.Header.Set("X-Forwarded-For", forwardedFor)
+	return req.WithContext(context.WithValue(req.Context(), trustedProxiesKey{}, []*net.IPNet{proxy}))
+}
+
+func TestExtractClientIP_TrustedProxies(t *testing.T) {
+	_, trusted, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+
+	var got string
+	handler := TrustProxies([]*net.IPNet{trusted})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, err = extractClientIP(r)
+	}))
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		want         string
+	}{
+		{"TrustedProxy", "10.1.2.3:4567", "192.168.1.50", "192.168.1.50"},
+		{"UntrustedSource", "203.0.113.9:4567", "192.168.1.50", "203.0.113.9"},
+		{"NoHeader", "10.1.2.3:4567", "", "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/meta-data", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestExtractClientIP_NoTrustedProxies(t *testing.T) {
+	// Without the middleware no source is trusted
+	req := httptest.NewRequest("GET", "/meta-data", nil)
+	req.RemoteAddr = "10.1.2.3:4567"
+	req.Header.Set("X-Forwarded-For", "192.168.1.50")
+	ip, err := extractClientIP(req)
+	require.NoError(t, err)
+	assert.Equal(t, "10.1.2.3", ip)
+
+	req.RemoteAddr = "not-an-address"
+	_, err = extractClientIP(req)
+	assert.Error(t, err)
+}
+
+func TestExtractClientIP_ForwardedChain(t *testing.T) {
+	var nets []*net.IPNet
+	for _, cidr := range []string{"10.0.0.0/8", "fd00::/8"} {
+		_, n, err := net.ParseCIDR(cidr)
+		require.NoError(t, err)
+		nets = append(nets, n)
+	}
+
+	var got string
+	var err error
+	handler := TrustProxies(nets)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, err = extractClientIP(r)
+	}))
+
+	tests := []struct {
+		name    string
+		headers []string
+		want    string
+	}{
+		{"SingleValue", []string{"192.168.1.50"}, "192.168.1.50"},
+		{"MultiHop", []string{"192.168.1.50, 10.0.0.7, 10.0.0.8"}, "192.168.1.50"},
+		// The client prepended a spoofed address; the first untrusted hop wins
+		{"SpoofedPrefix", []string{"192.168.1.99, 192.168.1.50, 10.0.0.7"}, "192.168.1.50"},
+		{"RepeatedHeaders", []string{"192.168.1.99", "192.168.1.50"}, "192.168.1.50"},
+		{"AllTrusted", []string{"10.0.0.5, 10.0.0.7"}, "10.0.0.5"},
+		{"IPv6", []string{"2001:db8::5, fd00::1"}, "2001:db8::5"},
+		{"Garbage", []string{"not-an-ip"}, "10.1.2.3"},
+		{"GarbageHop", []string{"192.168.1.50, bogus, 10.0.0.7"}, "10.1.2.3"},
+		{"PortInHop", []string{"192.168.1.50:1234"}, "10.1.2.3"},
+		{"EmptyHop", []string{"192.168.1.50,,10.0.0.7"}, "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/meta-data", nil)
+			req.RemoteAddr = "10.1.2.3:4567"
+			for _, h := range tt.headers {
+				req.Header.Add("X-Forwarded-For", h)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
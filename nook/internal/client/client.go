@@ -0,0 +1,190 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultServerURL is the nook API the CLI talks to when neither --server nor
+// ServerURLEnv is set.
+const DefaultServerURL = "http://localhost:8080"
+
+// ServerURLEnv names the environment variable that overrides DefaultServerURL.
+const ServerURLEnv = "NOOK_SERVER"
+
+// ParseServerURL checks that raw is an absolute http or https URL with a host
+// and returns it without a trailing slash, ready to have API paths appended.
+func ParseServerURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid server URL %q: %w", raw, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("invalid server URL %q: scheme must be http or https", raw)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid server URL %q: missing host", raw)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("invalid server URL %q: must not have a query or fragment", raw)
+	}
+	return strings.TrimSuffix(u.String(), "/"), nil
+}
+
+// Client issues the CLI's requests against one nook server.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	apiKey     string // Sent as a bearer token when set
+}
+
+// New creates a Client for the server at serverURL, which is validated with
+// ParseServerURL.
+func New(serverURL string, httpClient *http.Client) (*Client, error) {
+	baseURL, err := ParseServerURL(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{baseURL: baseURL, httpClient: httpClient}, nil
+}
+
+// SetAPIKey makes every request carry apiKey as its bearer token, for servers
+// started with --api-key. An empty key sends no Authorization header.
+func (c *Client) SetAPIKey(apiKey string) {
+	c.apiKey = apiKey
+}
+
+// BaseURL returns the server URL requests are sent to.
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+// AddMachine creates a machine with a static IPv4 address.
+func (c *Client) AddMachine(ctx context.Context, name, hostname, ipv4 string) error {
+	return c.do(ctx, http.MethodPost, "/api/v0/machines", map[string]string{
+		"name":     name,
+		"hostname": hostname,
+		"ipv4":     ipv4,
+	}, http.StatusCreated)
+}
+
+// AddNetwork creates a network.
+func (c *Client) AddNetwork(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodPost, "/api/v0/networks", map[string]string{
+		"name": name,
+	}, http.StatusCreated)
+}
+
+// AddSSHKey adds one key to a machine.
+func (c *Client) AddSSHKey(ctx context.Context, machineID int64, keyText string) error {
+	return c.do(ctx, http.MethodPost, "/api/v0/ssh-keys", map[string]interface{}{
+		"machine_id": machineID,
+		"key_text":   keyText,
+	}, http.StatusCreated)
+}
+
+// ImportSSHKeysFromURL fetches an authorized_keys style list from sourceURL, such
+// as https://github.com/<user>.keys, parses it one key per line and adds each
+// valid key to the machine with AddSSHKey. It returns an error only when the
+// source cannot be fetched or holds no keys; per-key problems are collected in
+// the result.
+func (c *Client) ImportSSHKeysFromURL(ctx context.Context, sourceURL string, machineID int64) (KeyImportResult, error) {
+	var result KeyImportResult
+	keys, err := FetchSSHKeys(ctx, c.httpClient, sourceURL)
+	if err != nil {
+		return result, err
+	}
+	if len(keys) == 0 {
+		return result, fmt.Errorf("no SSH keys found at %s", sourceURL)
+	}
+
+	for _, key := range keys {
+		if err := ValidateSSHKey(key); err != nil {
+			result.Failures = append(result.Failures, KeyImportFailure{Key: key, Err: err})
+			continue
+		}
+		if err := c.AddSSHKey(ctx, machineID, key); err != nil {
+			result.Failures = append(result.Failures, KeyImportFailure{Key: key, Err: err})
+			continue
+		}
+		result.Added = append(result.Added, key)
+	}
+	return result, nil
+}
+
+// DeleteMachine deletes a machine by ID.
+func (c *Client) DeleteMachine(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/v0/machines/%d", id), nil, http.StatusNoContent)
+}
+
+// DeleteNetwork deletes a network.
+func (c *Client) DeleteNetwork(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/api/v0/networks/"+url.PathEscape(name), nil, http.StatusNoContent)
+}
+
+// DeleteSSHKey deletes an SSH key by ID.
+func (c *Client) DeleteSSHKey(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/v0/ssh-keys/%d", id), nil, http.StatusNoContent)
+}
+
+// Export writes the server's full backup document to w.
+func (c *Client) Export(ctx context.Context, w io.Writer) error {
+	return c.send(ctx, http.MethodGet, "/api/v0/export", nil, http.StatusOK, w)
+}
+
+// Import restores a backup document read from r into the server, which must
+// hold no inventory yet.
+func (c *Client) Import(ctx context.Context, r io.Reader) error {
+	return c.send(ctx, http.MethodPost, "/api/v0/import", r, http.StatusCreated, nil)
+}
+
+// do sends a request with an optional JSON body and fails unless the server
+// answers with want, including the start of the response body in the error.
+func (c *Client) do(ctx context.Context, method, path string, body interface{}, want int) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	return c.send(ctx, method, path, reader, want, nil)
+}
+
+// send is do for a body that is already JSON. When out is non-nil the response
+// body is copied to it on success.
+func (c *Client) send(ctx context.Context, method, path string, body io.Reader, want int, out io.Writer) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != want {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out != nil {
+		_, err = io.Copy(out, resp.Body)
+	}
+	return err
+}
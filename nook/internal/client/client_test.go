@@ -0,0 +1,146 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseServerURL(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{raw: "http://localhost:8080", want: "http://localhost:8080"},
+		{raw: "https://nook.lab.example.com/", want: "https://nook.lab.example.com"},
+		{raw: "http://10.0.0.5:8080/nook/", want: "http://10.0.0.5:8080/nook"},
+		{raw: "localhost:8080", wantErr: true},
+		{raw: "ftp://nook", wantErr: true},
+		{raw: "http://", wantErr: true},
+		{raw: "http://nook?x=1", wantErr: true},
+		{raw: "http://[::1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := ParseServerURL(tt.raw)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestClient_Requests(t *testing.T) {
+	type call struct {
+		method, path, body string
+	}
+	var calls []call
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		calls = append(calls, call{r.Method, r.URL.EscapedPath(), string(body)})
+		switch {
+		case r.URL.Path == "/prefix/api/v0/machines/404":
+			http.Error(w, "machine not found", http.StatusNotFound)
+		case r.Method == http.MethodPost:
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL+"/prefix/", srv.Client())
+	require.NoError(t, err)
+	assert.Equal(t, srv.URL+"/prefix", c.BaseURL())
+
+	ctx := context.Background()
+	require.NoError(t, c.AddMachine(ctx, "web", "web.lab", "10.0.0.5"))
+	require.NoError(t, c.AddNetwork(ctx, "lab"))
+	require.NoError(t, c.AddSSHKey(ctx, 7, "ssh-ed25519 AAAA test"))
+	require.NoError(t, c.DeleteMachine(ctx, 3))
+	require.NoError(t, c.DeleteNetwork(ctx, "lab net"))
+	require.NoError(t, c.DeleteSSHKey(ctx, 9))
+
+	assert.Equal(t, []call{
+		{"POST", "/prefix/api/v0/machines", `{"hostname":"web.lab","ipv4":"10.0.0.5","name":"web"}`},
+		{"POST", "/prefix/api/v0/networks", `{"name":"lab"}`},
+		{"POST", "/prefix/api/v0/ssh-keys", `{"key_text":"ssh-ed25519 AAAA test","machine_id":7}`},
+		{"DELETE", "/prefix/api/v0/machines/3", ""},
+		{"DELETE", "/prefix/api/v0/networks/lab%20net", ""},
+		{"DELETE", "/prefix/api/v0/ssh-keys/9", ""},
+	}, calls)
+
+	err = c.DeleteMachine(ctx, 404)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "404 Not Found: machine not found")
+}
+
+func TestClient_ExportImport(t *testing.T) {
+	const doc = `{"format":"nook-backup","schema_version":22}`
+	var imported string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v0/export":
+			_, _ = io.WriteString(w, doc)
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v0/import":
+			body, _ := io.ReadAll(r.Body)
+			if imported != "" {
+				http.Error(w, "database is not empty", http.StatusConflict)
+				return
+			}
+			imported = string(body)
+			w.WriteHeader(http.StatusCreated)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL, srv.Client())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	var out strings.Builder
+	require.NoError(t, c.Export(ctx, &out))
+	assert.Equal(t, doc, out.String())
+
+	require.NoError(t, c.Import(ctx, strings.NewReader(out.String())))
+	assert.Equal(t, doc, imported)
+
+	err = c.Import(ctx, strings.NewReader(doc))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "409 Conflict: database is not empty")
+}
+
+func TestClient_SetAPIKey(t *testing.T) {
+	var authorizations []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL, srv.Client())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, c.DeleteMachine(ctx, 1))
+	c.SetAPIKey("secret")
+	require.NoError(t, c.DeleteMachine(ctx, 1))
+	assert.Equal(t, []string{"", "Bearer secret"}, authorizations)
+}
+
+func TestNew_InvalidURL(t *testing.T) {
+	_, err := New("localhost:8080", http.DefaultClient)
+	assert.Error(t, err)
+}
@@ -0,0 +1,77 @@
+// Package client holds the HTTP client side of the nook CLI commands.
+package client
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// maxKeysBodySize caps how much of a key source is read; real key lists are a
+// few kilobytes.
+const maxKeysBodySize = 1 << 20
+
+// KeyImportFailure is a key from a source that could not be added, and why
+type KeyImportFailure struct {
+	Key string
+	Err error
+}
+
+// KeyImportResult reports the outcome of importing keys from a URL. Keys are
+// submitted one at a time, so some may be added while others fail.
+type KeyImportResult struct {
+	Added    []string
+	Failures []KeyImportFailure
+}
+
+// FetchSSHKeys downloads a key list and splits it into one key per line,
+// skipping blank lines and # comments.
+func FetchSSHKeys(ctx context.Context, httpClient *http.Client, sourceURL string) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key source URL: %w", err)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", sourceURL, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: %s", sourceURL, resp.Status)
+	}
+
+	var keys []string
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, maxKeysBodySize))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", sourceURL, err)
+	}
+	return keys, nil
+}
+
+// ValidateSSHKey checks that key is an authorized_keys style public key line:
+// a key type, a base64 blob whose embedded type matches it, and an optional
+// comment.
+func ValidateSSHKey(key string) error {
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key))
+	if err != nil {
+		return fmt.Errorf("malformed SSH public key: %w", err)
+	}
+	if fields := strings.Fields(key); fields[0] != pub.Type() {
+		return fmt.Errorf("SSH public key type does not match %q", fields[0])
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newEd25519Key returns a fresh authorized_keys line with the given comment
+func newEd25519Key(t *testing.T, comment string) string {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	keyType := "ssh-ed25519"
+	blob := binary.BigEndian.AppendUint32(nil, uint32(len(keyType)))
+	blob = append(blob, keyType...)
+	blob = binary.BigEndian.AppendUint32(blob, uint32(len(pub)))
+	blob = append(blob, pub...)
+	return keyType + " " + base64.StdEncoding.EncodeToString(blob) + " " + comment
+}
+
+func TestClient_ImportSSHKeysFromURL(t *testing.T) {
+	alice1 := newEd25519Key(t, "alice@laptop")
+	alice2 := newEd25519Key(t, "alice@desktop")
+	rejected := newEd25519Key(t, "rejected")
+
+	type submission struct {
+		MachineID int64  `json:"machine_id"`
+		KeyText   string `json:"key_text"`
+	}
+	var mu sync.Mutex
+	var submitted []submission
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /alice.keys", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "%s\n\n%s\nnot-a-key\n%s\n", alice1, alice2, rejected)
+	})
+	mux.HandleFunc("POST /api/v0/ssh-keys", func(w http.ResponseWriter, r *http.Request) {
+		var s submission
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&s))
+		if s.KeyText == rejected {
+			http.Error(w, "failed to create SSH key", http.StatusInternalServerError)
+			return
+		}
+		mu.Lock()
+		submitted = append(submitted, s)
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	c, err := New(server.URL, server.Client())
+	require.NoError(t, err)
+
+	result, err := c.ImportSSHKeysFromURL(context.Background(), server.URL+"/alice.keys", 7)
+	require.NoError(t, err)
+
+	assert.Equal(t, []submission{{MachineID: 7, KeyText: alice1}, {MachineID: 7, KeyText: alice2}}, submitted)
+	assert.Equal(t, []string{alice1, alice2}, result.Added)
+	require.Len(t, result.Failures, 2)
+	assert.Equal(t, "not-a-key", result.Failures[0].Key)
+	assert.Contains(t, result.Failures[0].Err.Error(), "malformed")
+	assert.Equal(t, rejected, result.Failures[1].Key)
+	assert.Contains(t, result.Failures[1].Err.Error(), "500")
+}
+
+func TestClient_ImportSSHKeysFromURL_FetchErrors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /empty.keys", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("POST /api/v0/ssh-keys", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("no key should be submitted")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	c, err := New(server.URL, server.Client())
+	require.NoError(t, err)
+
+	_, err = c.ImportSSHKeysFromURL(context.Background(), server.URL+"/missing.keys", 1)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "404")
+
+	_, err = c.ImportSSHKeysFromURL(context.Background(), server.URL+"/empty.keys", 1)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no SSH keys")
+}
+
+func TestValidateSSHKey(t *testing.T) {
+	key := newEd25519Key(t, "user@host")
+	assert.NoError(t, ValidateSSHKey(key))
+
+	// The blob's embedded type must match the declared one
+	assert.Error(t, ValidateSSHKey(strings.Replace(key, "ssh-ed25519", "ssh-rsa", 1)))
+	assert.Error(t, ValidateSSHKey("ssh-ed25519 !!!notbase64"))
+	assert.Error(t, ValidateSSHKey("ssh-ed25519"))
+}
@@ -2,10 +2,14 @@ package config
 
 import (
 	"database/sql"
+	"encoding/base64"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/jbweber/homelab/nook/internal/migrations"
 	_ "modernc.org/sqlite"
@@ -13,16 +17,167 @@ import (
 
 // Config holds all configuration for the nook service
 type Config struct {
-	DBPath string
-	Port   string
+	DBPath   string `json:"db_path"`
+	Port     string `json:"port"`
+	APIKey   string `json:"api_key"`   // Bearer token required by /api/v0 and admin endpoints (management API open and admin API disabled when empty)
+	SeedFile string `json:"seed_file"` // Optional JSON/YAML inventory imported on startup when the database is empty
+	Domain   string `json:"domain"`    // DNS domain appended to hostnames in meta-data (short names when empty)
+
+	VendorDataFile string `json:"vendor_data_file"` // Optional file served as /vendor-data to machines without their own (read once at startup)
+
+	SlowRequestThreshold   time.Duration `json:"slow_request_threshold"`   // Requests slower than this are logged (0 disables)
+	StrictJSON             bool          `json:"strict_json"`              // Reject request bodies containing unknown JSON fields (off for backward compatibility)
+	AutoMigrate            bool          `json:"auto_migrate"`             // Apply pending migrations at startup; when off, an outdated schema fails startup
+	MaxConcurrentRequests  int           `json:"max_concurrent_requests"`  // Requests handled at once; excess requests get 503 (0 disables)
+	WarnDuplicateHostnames bool          `json:"warn_duplicate_hostnames"` // Log machines sharing a hostname at startup
+	NegativeCacheTTL       time.Duration `json:"negative_cache_ttl"`       // Remember metadata lookups from unknown IPs this long to spare the database (0 disables)
+	ShutdownTimeout        time.Duration `json:"shutdown_timeout"`         // How long in-flight requests get to finish on SIGINT/SIGTERM before the server stops
+
+	EnforceMetadataSubnet  bool   `json:"enforce_metadata_subnet"`   // Refuse metadata (403) unless the connecting address is inside the machine's network subnet
+	NetworkConfigUserAgent string `json:"network_config_user_agent"` // Serve /network-config (404 otherwise) only to User-Agents starting with this, e.g. "Cloud-Init"; empty serves everyone
+
+	TrustedProxies []string `json:"trusted_proxies"` // CIDRs of reverse proxies whose X-Forwarded-For is honored; empty always uses the connecting address
+
+	SSHKeyEncryptionKey string `json:"ssh_key_encryption_key"` // Base64 AES key (16, 24 or 32 bytes) for encrypting SSH keys at rest (plaintext when empty)
+
+	ResponseHeaders map[string]string `json:"response_headers"` // Static headers added to every response, e.g. X-Content-Type-Options or Strict-Transport-Security
+
+	DebugQueryCount bool `json:"debug_query_count"` // Count SQL queries and report them per request in X-Query-Count
 }
 
+// DefaultMaxConcurrentRequests bounds in-flight requests so a burst queues on
+// clients rather than on SQLite's single writer.
+const DefaultMaxConcurrentRequests = 64
+
+// DefaultShutdownTimeout is how long a stopping server waits for in-flight requests.
+const DefaultShutdownTimeout = 10 * time.Second
+
+// APIKeyEnv names the environment variable that supplies the API key when
+// --api-key is not given.
+const APIKeyEnv = "NOOK_API_KEY"
+
+// RedactedPlaceholder replaces secret values in Redacted output
+const RedactedPlaceholder = "[REDACTED]"
+
 // NewConfig creates a new Config with default values
 func NewConfig() *Config {
 	return &Config{
-		DBPath: "~/nook/data/nook.db",
-		Port:   "8080",
+		DBPath:                "~/nook/data/nook.db",
+		Port:                  "8080",
+		SlowRequestThreshold:  time.Second,
+		AutoMigrate:           true,
+		MaxConcurrentRequests: DefaultMaxConcurrentRequests,
+		ShutdownTimeout:       DefaultShutdownTimeout,
+	}
+}
+
+// Redacted returns a copy of the config that is safe to display, with secrets
+// replaced by RedactedPlaceholder. Unset secrets stay empty so it is still
+// visible whether they are configured.
+func (c *Config) Redacted() Config {
+	redacted := *c
+	if redacted.APIKey != "" {
+		redacted.APIKey = RedactedPlaceholder
+	}
+	if redacted.SSHKeyEncryptionKey != "" {
+		redacted.SSHKeyEncryptionKey = RedactedPlaceholder
+	}
+	return redacted
+}
+
+// SSHKeyEncryptionKeyBytes decodes the base64 SSH key encryption key. It returns
+// nil when encryption is not configured.
+func (c *Config) SSHKeyEncryptionKeyBytes() ([]byte, error) {
+	if c.SSHKeyEncryptionKey == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(c.SSHKeyEncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("SSH key encryption key is not valid base64: %w", err)
+	}
+	switch len(key) {
+	case 16, 24, 32:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("SSH key encryption key must decode to 16, 24 or 32 bytes, got %d", len(key))
+	}
+}
+
+// VendorData reads VendorDataFile. It returns "" when no file is configured.
+func (c *Config) VendorData() (string, error) {
+	if c.VendorDataFile == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(c.expandPath(c.VendorDataFile))
+	if err != nil {
+		return "", fmt.Errorf("failed to read vendor-data file: %w", err)
+	}
+	return string(data), nil
+}
+
+// TrustedProxyNets parses TrustedProxies. It returns nil when no proxies are trusted.
+func (c *Config) TrustedProxyNets() ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, cidr := range c.TrustedProxies {
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q is not a valid CIDR: %w", cidr, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// reservedResponseHeaders are managed by net/http or describe the body of a
+// particular response, so they cannot be set statically.
+var reservedResponseHeaders = map[string]bool{
+	"Connection":        true,
+	"Content-Encoding":  true,
+	"Content-Length":    true,
+	"Content-Type":      true,
+	"Date":              true,
+	"Trailer":           true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+}
+
+// IsReservedResponseHeader reports whether name is a header ResponseHeaders may
+// not override.
+func IsReservedResponseHeader(name string) bool {
+	return reservedResponseHeaders[http.CanonicalHeaderKey(name)]
+}
+
+// ValidateResponseHeaders checks that every configured response header has a
+// valid name that is not reserved and a value without line breaks.
+func (c *Config) ValidateResponseHeaders() error {
+	for name, value := range c.ResponseHeaders {
+		if !isHeaderToken(name) {
+			return fmt.Errorf("response header name %q is not a valid HTTP header name", name)
+		}
+		if IsReservedResponseHeader(name) {
+			return fmt.Errorf("response header %s cannot be overridden", http.CanonicalHeaderKey(name))
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("response header %s has a value containing a line break", http.CanonicalHeaderKey(name))
+		}
 	}
+	return nil
+}
+
+// isHeaderToken reports whether s is an RFC 9110 token, the syntax of header names
+func isHeaderToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", c):
+		default:
+			return false
+		}
+	}
+	return true
 }
 
 // InitializeDatabase creates and configures the database connection
@@ -35,9 +190,15 @@ func (c *Config) InitializeDatabase() (*sql.DB, error) {
 		return nil, fmt.Errorf("failed to create database directory: %w", err)
 	}
 
-	db, err := sql.Open("sqlite", dbPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+	var db *sql.DB
+	if c.DebugQueryCount {
+		db = OpenCountingDB(SQLiteDSN(dbPath))
+	} else {
+		var err error
+		db, err = sql.Open("sqlite", SQLiteDSN(dbPath))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open database: %w", err)
+		}
 	}
 
 	// Enable foreign keys
@@ -84,6 +245,13 @@ func (c *Config) runMigrations(db *sql.DB) error {
 		migrator.AddMigration(migration)
 	}
 
+	if !c.AutoMigrate {
+		if err := migrator.CheckSchema(); err != nil {
+			return fmt.Errorf("%w (or enable auto_migrate / --auto-migrate)", err)
+		}
+		return nil
+	}
+
 	// Run migrations
 	if err := migrator.RunMigrations(); err != nil {
 		return err
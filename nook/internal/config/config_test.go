@@ -1,11 +1,16 @@
 package config
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/jbweber/homelab/nook/internal/migrations"
 )
 
 func TestNewConfig(t *testing.T) {
@@ -22,6 +27,147 @@ func TestNewConfig(t *testing.T) {
 	if config.Port != "8080" {
 		t.Errorf("Expected Port '8080', got '%s'", config.Port)
 	}
+
+	if config.SlowRequestThreshold != time.Second {
+		t.Errorf("Expected SlowRequestThreshold 1s, got %s", config.SlowRequestThreshold)
+	}
+	if config.MaxConcurrentRequests != DefaultMaxConcurrentRequests {
+		t.Errorf("Expected MaxConcurrentRequests %d, got %d", DefaultMaxConcurrentRequests, config.MaxConcurrentRequests)
+	}
+	if config.ShutdownTimeout != DefaultShutdownTimeout {
+		t.Errorf("Expected ShutdownTimeout %s, got %s", DefaultShutdownTimeout, config.ShutdownTimeout)
+	}
+}
+
+func TestConfig_Redacted(t *testing.T) {
+	config := NewConfig()
+	config.APIKey = "super-secret"
+
+	redacted := config.Redacted()
+	if redacted.APIKey != RedactedPlaceholder {
+		t.Errorf("Expected APIKey to be redacted, got '%s'", redacted.APIKey)
+	}
+	if redacted.Port != config.Port {
+		t.Errorf("Expected Port '%s', got '%s'", config.Port, redacted.Port)
+	}
+
+	// The original must be left untouched
+	if config.APIKey != "super-secret" {
+		t.Errorf("Expected original APIKey to be preserved, got '%s'", config.APIKey)
+	}
+
+	// An unset key stays empty so operators can tell it is not configured
+	if NewConfig().Redacted().APIKey != "" {
+		t.Error("Expected empty APIKey to remain empty")
+	}
+
+	config.SSHKeyEncryptionKey = "c2VjcmV0LWtleS0xNi1ieQ=="
+	if config.Redacted().SSHKeyEncryptionKey != RedactedPlaceholder {
+		t.Error("Expected SSHKeyEncryptionKey to be redacted")
+	}
+}
+
+func TestConfig_SSHKeyEncryptionKeyBytes(t *testing.T) {
+	config := NewConfig()
+
+	// No key configured means plaintext storage
+	key, err := config.SSHKeyEncryptionKeyBytes()
+	if err != nil || key != nil {
+		t.Errorf("Expected no key and no error, got %v, %v", key, err)
+	}
+
+	config.SSHKeyEncryptionKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=" // 32 bytes
+	key, err = config.SSHKeyEncryptionKeyBytes()
+	if err != nil {
+		t.Fatalf("Expected valid key, got error: %v", err)
+	}
+	if len(key) != 32 {
+		t.Errorf("Expected 32-byte key, got %d bytes", len(key))
+	}
+
+	for _, invalid := range []string{"not base64!", "c2hvcnQ="} {
+		config.SSHKeyEncryptionKey = invalid
+		if _, err := config.SSHKeyEncryptionKeyBytes(); err == nil {
+			t.Errorf("Expected error for key %q", invalid)
+		}
+	}
+}
+
+func TestConfig_VendorData(t *testing.T) {
+	config := NewConfig()
+
+	data, err := config.VendorData()
+	if err != nil || data != "" {
+		t.Errorf("Expected no vendor-data and no error, got %q, %v", data, err)
+	}
+
+	config.VendorDataFile = filepath.Join(t.TempDir(), "vendor-data")
+	if _, err := config.VendorData(); err == nil {
+		t.Error("Expected error for missing vendor-data file")
+	}
+
+	if err := os.WriteFile(config.VendorDataFile, []byte("#cloud-config\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	data, err = config.VendorData()
+	if err != nil || data != "#cloud-config\n" {
+		t.Errorf("Expected file contents, got %q, %v", data, err)
+	}
+}
+
+func TestConfig_TrustedProxyNets(t *testing.T) {
+	config := NewConfig()
+
+	// No proxies configured means X-Forwarded-For is never trusted
+	nets, err := config.TrustedProxyNets()
+	if err != nil || nets != nil {
+		t.Errorf("Expected no networks and no error, got %v, %v", nets, err)
+	}
+
+	config.TrustedProxies = []string{"10.0.0.0/8", " 192.168.1.5/32", "fd00::/8"}
+	nets, err = config.TrustedProxyNets()
+	if err != nil {
+		t.Fatalf("Expected valid CIDRs, got error: %v", err)
+	}
+	if len(nets) != 3 || nets[1].String() != "192.168.1.5/32" {
+		t.Errorf("Unexpected networks %v", nets)
+	}
+
+	for _, invalid := range []string{"10.0.0.1", "not-a-cidr", "10.0.0.0/33"} {
+		config.TrustedProxies = []string{invalid}
+		if _, err := config.TrustedProxyNets(); err == nil {
+			t.Errorf("Expected error for CIDR %q", invalid)
+		}
+	}
+}
+
+func TestConfig_ValidateResponseHeaders(t *testing.T) {
+	config := NewConfig()
+	if err := config.ValidateResponseHeaders(); err != nil {
+		t.Errorf("Expected no headers to be valid, got %v", err)
+	}
+
+	config.ResponseHeaders = map[string]string{
+		"X-Content-Type-Options":    "nosniff",
+		"strict-transport-security": "max-age=63072000",
+	}
+	if err := config.ValidateResponseHeaders(); err != nil {
+		t.Errorf("Expected valid headers, got %v", err)
+	}
+
+	for _, invalid := range []map[string]string{
+		{"": "x"},
+		{"Bad Name": "x"},
+		{"X-Bad:": "x"},
+		{"Content-Length": "0"},
+		{"content-type": "text/plain"},
+		{"X-Split": "a\r\nSet-Cookie: b"},
+	} {
+		config.ResponseHeaders = invalid
+		if err := config.ValidateResponseHeaders(); err == nil {
+			t.Errorf("Expected error for headers %q", invalid)
+		}
+	}
 }
 
 func TestConfig_expandPath_WithTilde(t *testing.T) {
@@ -98,6 +244,22 @@ func TestConfig_InitializeDatabase_Success(t *testing.T) {
 	if !fkEnabled {
 		t.Error("Expected foreign keys to be enabled")
 	}
+
+	// Every pooled connection waits for busy writers, not just the first
+	conns := make([]*sql.Conn, 3)
+	for i := range conns {
+		if conns[i], err = db.Conn(context.Background()); err != nil {
+			t.Fatalf("Failed to get connection %d: %v", i, err)
+		}
+		defer conns[i].Close()
+		var timeout int64
+		if err := conns[i].QueryRowContext(context.Background(), "PRAGMA busy_timeout").Scan(&timeout); err != nil {
+			t.Fatalf("Failed to read busy_timeout on connection %d: %v", i, err)
+		}
+		if timeout != BusyTimeout.Milliseconds() {
+			t.Errorf("Expected busy_timeout %d on connection %d, got %d", BusyTimeout.Milliseconds(), i, timeout)
+		}
+	}
 }
 
 func TestConfig_InitializeDatabase_DirectoryCreation(t *testing.T) {
@@ -126,6 +288,45 @@ func TestConfig_InitializeDatabase_DirectoryCreation(t *testing.T) {
 	}
 }
 
+func TestConfig_InitializeDatabase_AutoMigrateDisabled(t *testing.T) {
+	tempDir := t.TempDir()
+	dbPath := filepath.Join(tempDir, "test.db")
+
+	config := NewConfig()
+	config.DBPath = dbPath
+	config.AutoMigrate = false
+
+	// A fresh database has no schema, so startup should fail with a clear error
+	// rather than serving requests that hit "no such table"
+	db, err := config.InitializeDatabase()
+	if err == nil {
+		db.Close()
+		t.Fatal("Expected error for unmigrated database with auto-migrate disabled")
+	}
+	if !errors.Is(err, migrations.ErrSchemaOutdated) {
+		t.Errorf("Expected ErrSchemaOutdated, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "auto-migrate") {
+		t.Errorf("Expected error to mention auto-migrate, got %v", err)
+	}
+
+	// With auto-migrate enabled the schema is brought up to date
+	config.AutoMigrate = true
+	db, err = config.InitializeDatabase()
+	if err != nil {
+		t.Fatalf("Expected no error with auto-migrate enabled, got %v", err)
+	}
+	db.Close()
+
+	// Once migrated, startup succeeds with auto-migrate disabled
+	config.AutoMigrate = false
+	db, err = config.InitializeDatabase()
+	if err != nil {
+		t.Fatalf("Expected no error for migrated database, got %v", err)
+	}
+	db.Close()
+}
+
 func TestConfig_InitializeDatabase_InvalidPath(t *testing.T) {
 	config := NewConfig()
 
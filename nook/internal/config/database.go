@@ -2,9 +2,21 @@ package config
 
 import (
 	"database/sql"
+	"fmt"
 	"time"
 )
 
+// BusyTimeout is how long a connection waits for another writer's transaction
+// to commit before failing with SQLITE_BUSY.
+const BusyTimeout = 5 * time.Second
+
+// SQLiteDSN returns the DSN for the database file at path. Pragmas that must
+// hold on every pooled connection, like busy_timeout, go in the DSN so the
+// driver applies them to each connection it opens.
+func SQLiteDSN(path string) string {
+	return fmt.Sprintf("%s?_pragma=busy_timeout(%d)", path, BusyTimeout.Milliseconds())
+}
+
 // OptimizeDatabaseConnection applies performance optimizations to the database connection
 func OptimizeDatabaseConnection(db *sql.DB) {
 	// Set connection pool parameters for optimal performance
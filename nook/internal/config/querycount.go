@@ -0,0 +1,147 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync/atomic"
+
+	"modernc.org/sqlite"
+)
+
+// QueryCounter counts SQL statements executed through a database opened with
+// OpenCountingDB. It is a debugging aid for spotting N+1 query patterns. A
+// counter rides in the context passed to QueryContext and ExecContext, so
+// concurrent requests each count only their own statements; statements run
+// with a context that carries no counter are not counted.
+type QueryCounter struct {
+	n atomic.Int64
+}
+
+// Count returns the number of statements executed so far.
+func (c *QueryCounter) Count() int64 {
+	return c.n.Load()
+}
+
+type queryCounterKey struct{}
+
+// WithQueryCounter returns a copy of ctx whose statements are counted by counter.
+func WithQueryCounter(ctx context.Context, counter *QueryCounter) context.Context {
+	return context.WithValue(ctx, queryCounterKey{}, counter)
+}
+
+// countQuery increments the counter carried by ctx, if any
+func countQuery(ctx context.Context) {
+	if counter, ok := ctx.Value(queryCounterKey{}).(*QueryCounter); ok {
+		counter.n.Add(1)
+	}
+}
+
+// OpenCountingDB opens a SQLite database whose every Exec and Query increments
+// the QueryCounter in the statement's context.
+func OpenCountingDB(dsn string) *sql.DB {
+	return sql.OpenDB(&countingConnector{driver: &sqlite.Driver{}, dsn: dsn})
+}
+
+type countingConnector struct {
+	driver driver.Driver
+	dsn    string
+}
+
+func (c *countingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &countingConn{Conn: conn}, nil
+}
+
+func (c *countingConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// countingConn counts statements run directly on the connection and wraps
+// prepared statements so their executions are counted too.
+type countingConn struct {
+	driver.Conn
+}
+
+func (c *countingConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *countingConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = p.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &countingStmt{Stmt: stmt}, nil
+}
+
+func (c *countingConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+// ExecContext and QueryContext return driver.ErrSkip when the underlying
+// connection lacks them, so database/sql falls back to a counted prepared statement.
+func (c *countingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	countQuery(ctx)
+	return e.ExecContext(ctx, query, args)
+}
+
+func (c *countingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	countQuery(ctx)
+	return q.QueryContext(ctx, query, args)
+}
+
+func (c *countingConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+type countingStmt struct {
+	driver.Stmt
+}
+
+func (s *countingStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	countQuery(ctx)
+	if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+		return e.ExecContext(ctx, args)
+	}
+	return s.Stmt.Exec(namedValuesToValues(args))
+}
+
+func (s *countingStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	countQuery(ctx)
+	if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		return q.QueryContext(ctx, args)
+	}
+	return s.Stmt.Query(namedValuesToValues(args))
+}
+
+func namedValuesToValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
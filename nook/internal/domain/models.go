@@ -1,12 +1,21 @@
 package domain
 
+import "strings"
+
 // Machine represents a virtual machine in the system
 type Machine struct {
-	ID        int64  // Unique identifier
-	Name      string // Machine name
-	Hostname  string // Hostname for NoCloud metadata
-	IPv4      string // Static IPv4 address (optional, for static assignments)
-	NetworkID *int64 // Network ID for dynamic IP assignment (optional)
+	ID               int64    // Unique identifier
+	Name             string   // Machine name
+	Hostname         string   // Hostname for NoCloud metadata
+	IPv4             string   // Static IPv4 address (optional, for static assignments)
+	IPv6             string   // Static IPv6 address (optional)
+	NetworkID        *int64   // Network ID for dynamic IP assignment (optional)
+	AvailabilityZone string   // Placement availability zone (optional)
+	MetadataDisabled bool     // Metadata endpoints refuse this machine while set
+	MTU              int      // Interface MTU override (0 inherits the network's)
+	RunCmd           []string // Commands emitted as the cloud-init runcmd block (optional)
+	UserData         string   // Stored user-data served verbatim (empty generates cloud-config)
+	VendorData       string   // Stored vendor-data (empty falls back to the global vendor-data)
 }
 
 // SSHKey represents an SSH public key associated with a machine
@@ -16,15 +25,71 @@ type SSHKey struct {
 	KeyText   string // Public SSH key text
 }
 
+// KeyGroup is a named set of SSH keys injected into every member machine
+type KeyGroup struct {
+	ID   int64  // Unique identifier
+	Name string // Group name (e.g., "admins")
+}
+
+// KeyGroupKey is an SSH public key belonging to a key group
+type KeyGroupKey struct {
+	ID      int64  // Unique identifier
+	GroupID int64  // Foreign key to KeyGroup
+	KeyText string // Public SSH key text
+}
+
 // Network represents a network configuration on a hypervisor
 type Network struct {
-	ID          int64  // Unique identifier
-	Name        string // Network name (e.g., "br0", "internal")
-	Bridge      string // Bridge interface name (e.g., "br0")
-	Subnet      string // Subnet in CIDR notation (e.g., "192.168.1.0/24")
-	Gateway     string // Gateway IP address
-	DNSServers  string // Comma-separated DNS server IPs
-	Description string // Optional description
+	ID                 int64  // Unique identifier
+	Name               string // Network name (e.g., "br0", "internal")
+	Bridge             string // Bridge interface name (e.g., "br0")
+	Subnet             string // Subnet in CIDR notation (e.g., "192.168.1.0/24")
+	Gateway            string // Gateway IP address
+	DNSServers         string // Comma-separated DNS server IPs handed to clients
+	DNSForwarders      string // Comma-separated upstream servers a local resolver forwards to
+	Description        string // Optional description
+	AllocationStrategy string // How free addresses are picked: "lowest" (default) or "random"
+	MTU                int    // Interface MTU for machines on this network (0 leaves the default)
+}
+
+// IP allocation strategies for Network.AllocationStrategy
+const (
+	AllocationStrategyLowest = "lowest" // Lowest free address first
+	AllocationStrategyRandom = "random" // Uniformly random free address
+)
+
+// ValidAllocationStrategy reports whether s names a supported allocation strategy.
+// The empty string is accepted and means the default.
+func ValidAllocationStrategy(s string) bool {
+	switch s {
+	case "", AllocationStrategyLowest, AllocationStrategyRandom:
+		return true
+	}
+	return false
+}
+
+// Interface MTU bounds accepted for Network.MTU and Machine.MTU
+const (
+	MinMTU = 576  // Smallest IPv4 datagram every host must accept
+	MaxMTU = 9216 // Common jumbo frame ceiling
+)
+
+// ValidMTU reports whether mtu is within MinMTU and MaxMTU. Zero is accepted
+// and means unset.
+func ValidMTU(mtu int) bool {
+	return mtu == 0 || (mtu >= MinMTU && mtu <= MaxMTU)
+}
+
+// MaxBridgeNameLength is the longest Linux interface name (IFNAMSIZ less the NUL)
+const MaxBridgeNameLength = 15
+
+// ValidBridgeName reports whether name is usable as a Linux bridge interface
+// name: 1-15 bytes, not "." or "..", and free of whitespace, '/' and ':'.
+func ValidBridgeName(name string) bool {
+	if name == "" || len(name) > MaxBridgeNameLength || name == "." || name == ".." {
+		return false
+	}
+	return !strings.ContainsAny(name, "/: \t\n\r\v\f")
 }
 
 // DHCPRange represents a DHCP range within a network
@@ -36,6 +101,26 @@ type DHCPRange struct {
 	LeaseTime string // DHCP lease time (e.g., "12h", "24h")
 }
 
+// MACReservation pins an IP address to a MAC address within a network for
+// external DHCP servers. It is independent of nook's own IP lease table.
+type MACReservation struct {
+	ID        int64  // Unique identifier
+	NetworkID int64  // Foreign key to Network
+	MAC       string // Hardware address, normalized to lowercase colon form
+	IPAddress string // Reserved IPv4 address
+	Hostname  string // Optional hostname handed out with the reservation
+}
+
+// IPReservation holds a free address out of allocation until the token it was
+// reserved under is released. Addresses reserved together share a token.
+type IPReservation struct {
+	ID        int64  // Unique identifier
+	NetworkID int64  // Foreign key to Network
+	IPAddress string // Reserved IPv4 address
+	Token     string // Opaque token shared by a batch of reservations
+	CreatedAt string // When the reservation was made
+}
+
 // IPAddressLease represents an IP address leased to a machine from a network
 type IPAddressLease struct {
 	ID        int64  // Unique identifier
@@ -46,3 +131,18 @@ type IPAddressLease struct {
 	CreatedAt string // When the lease was created
 	UpdatedAt string // When the lease was last updated
 }
+
+// IP usage sources for IPUsage.Source
+const (
+	IPUsageSourceStatic = "static" // Address set directly on the machine
+	IPUsageSourceLease  = "lease"  // Address leased from a network's DHCP ranges
+)
+
+// IPUsage is one in-use IP address and the machine that holds it
+type IPUsage struct {
+	IPAddress   string // The in-use address
+	Source      string // IPUsageSourceStatic or IPUsageSourceLease
+	MachineID   int64  // Owning machine
+	MachineName string // Owning machine's name
+	NetworkID   *int64 // Network of the lease or machine (optional)
+}
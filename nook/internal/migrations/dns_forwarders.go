@@ -0,0 +1,24 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+// GetDNSForwardersMigrations returns migrations for per-network upstream DNS forwarders
+func GetDNSForwardersMigrations() []Migration {
+	return []Migration{
+		{
+			Version: 19,
+			Name:    "add_network_dns_forwarders",
+			Up: func(db *sql.DB) error {
+				// Kept apart from dns_servers: resolvers go to clients, forwarders to the local resolver
+				_, err := db.Exec(`ALTER TABLE networks ADD COLUMN dns_forwarders TEXT NOT NULL DEFAULT ''`)
+				return err
+			},
+			Down: func(db *sql.DB) error {
+				_, err := db.Exec(`ALTER TABLE networks DROP COLUMN dns_forwarders`)
+				return err
+			},
+		},
+	}
+}
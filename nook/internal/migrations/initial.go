@@ -179,6 +179,20 @@ func GetInitialMigrations() []Migration {
 
 	// Append performance migrations
 	migrations = append(migrations, GetPerformanceMigrations()...)
+	migrations = append(migrations, GetNetworkTagsMigrations()...)
+	migrations = append(migrations, GetMachinePlacementMigrations()...)
+	migrations = append(migrations, GetMACReservationMigrations()...)
+	migrations = append(migrations, GetNetworkAllocationMigrations()...)
+	migrations = append(migrations, GetMachineMetadataMigrations()...)
+	migrations = append(migrations, GetSettingsMigrations()...)
+	migrations = append(migrations, GetInterfaceMTUMigrations()...)
+	migrations = append(migrations, GetKeyGroupMigrations()...)
+	migrations = append(migrations, GetDNSForwardersMigrations()...)
+	migrations = append(migrations, GetMachineRunCmdMigrations()...)
+	migrations = append(migrations, GetIPReservationMigrations()...)
+	migrations = append(migrations, GetMachineIPv6Migrations()...)
+	migrations = append(migrations, GetMachineUserDataMigrations()...)
+	migrations = append(migrations, GetMachineVendorDataMigrations()...)
 	return migrations
 }
 
@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+// GetInterfaceMTUMigrations returns migrations for network and per-machine interface MTUs
+func GetInterfaceMTUMigrations() []Migration {
+	return []Migration{
+		{
+			Version: 17,
+			Name:    "add_interface_mtu",
+			Up: func(db *sql.DB) error {
+				// 0 means unset: networks leave the MTU to the OS, machines inherit their network's
+				if _, err := db.Exec(`ALTER TABLE networks ADD COLUMN mtu INTEGER NOT NULL DEFAULT 0`); err != nil {
+					return err
+				}
+				_, err := db.Exec(`ALTER TABLE machines ADD COLUMN mtu INTEGER NOT NULL DEFAULT 0`)
+				return err
+			},
+			Down: func(db *sql.DB) error {
+				if _, err := db.Exec(`ALTER TABLE machines DROP COLUMN mtu`); err != nil {
+					return err
+				}
+				_, err := db.Exec(`ALTER TABLE networks DROP COLUMN mtu`)
+				return err
+			},
+		},
+	}
+}
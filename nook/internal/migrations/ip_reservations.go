@@ -0,0 +1,39 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+// GetIPReservationMigrations returns migrations for batch IP reservations held by a token
+func GetIPReservationMigrations() []Migration {
+	return []Migration{
+		{
+			Version: 21,
+			Name:    "create_ip_reservations_table",
+			Up: func(db *sql.DB) error {
+				statements := []string{
+					`CREATE TABLE IF NOT EXISTS ip_reservations (
+						id INTEGER PRIMARY KEY AUTOINCREMENT,
+						network_id INTEGER NOT NULL,
+						ip_address TEXT NOT NULL,
+						token TEXT NOT NULL,
+						created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+						UNIQUE(network_id, ip_address),
+						FOREIGN KEY (network_id) REFERENCES networks(id) ON DELETE CASCADE
+					)`,
+					`CREATE INDEX IF NOT EXISTS idx_ip_reservations_token ON ip_reservations(token)`,
+				}
+				for _, stmt := range statements {
+					if _, err := db.Exec(stmt); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Down: func(db *sql.DB) error {
+				_, err := db.Exec(`DROP TABLE IF EXISTS ip_reservations`)
+				return err
+			},
+		},
+	}
+}
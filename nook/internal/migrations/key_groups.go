@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+// GetKeyGroupMigrations returns migrations for SSH key groups shared across machines
+func GetKeyGroupMigrations() []Migration {
+	return []Migration{
+		{
+			Version: 18,
+			Name:    "create_key_groups_tables",
+			Up: func(db *sql.DB) error {
+				statements := []string{
+					`CREATE TABLE IF NOT EXISTS key_groups (
+						id INTEGER PRIMARY KEY AUTOINCREMENT,
+						name TEXT NOT NULL UNIQUE,
+						created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+					)`,
+					`CREATE TABLE IF NOT EXISTS key_group_keys (
+						id INTEGER PRIMARY KEY AUTOINCREMENT,
+						group_id INTEGER NOT NULL,
+						key_text TEXT NOT NULL,
+						FOREIGN KEY (group_id) REFERENCES key_groups(id) ON DELETE CASCADE
+					)`,
+					`CREATE INDEX IF NOT EXISTS idx_key_group_keys_group_id ON key_group_keys(group_id)`,
+					`CREATE TABLE IF NOT EXISTS key_group_members (
+						group_id INTEGER NOT NULL,
+						machine_id INTEGER NOT NULL,
+						PRIMARY KEY (group_id, machine_id),
+						FOREIGN KEY (group_id) REFERENCES key_groups(id) ON DELETE CASCADE,
+						FOREIGN KEY (machine_id) REFERENCES machines(id) ON DELETE CASCADE
+					)`,
+					`CREATE INDEX IF NOT EXISTS idx_key_group_members_machine_id ON key_group_members(machine_id)`,
+				}
+				for _, stmt := range statements {
+					if _, err := db.Exec(stmt); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Down: func(db *sql.DB) error {
+				for _, table := range []string{"key_group_members", "key_group_keys", "key_groups"} {
+					if _, err := db.Exec(`DROP TABLE IF EXISTS ` + table); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+	}
+}
@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+// GetMACReservationMigrations returns migrations for per-network MAC reservations
+func GetMACReservationMigrations() []Migration {
+	return []Migration{
+		{
+			Version: 13,
+			Name:    "create_mac_reservations_table",
+			Up: func(db *sql.DB) error {
+				_, err := db.Exec(`
+					CREATE TABLE IF NOT EXISTS mac_reservations (
+						id INTEGER PRIMARY KEY AUTOINCREMENT,
+						network_id INTEGER NOT NULL,
+						mac TEXT NOT NULL,
+						ip_address TEXT NOT NULL,
+						hostname TEXT NOT NULL DEFAULT '',
+						created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+						UNIQUE (network_id, mac),
+						UNIQUE (network_id, ip_address),
+						FOREIGN KEY (network_id) REFERENCES networks(id) ON DELETE CASCADE
+					)
+				`)
+				return err
+			},
+			Down: func(db *sql.DB) error {
+				_, err := db.Exec(`DROP TABLE IF EXISTS mac_reservations`)
+				return err
+			},
+		},
+	}
+}
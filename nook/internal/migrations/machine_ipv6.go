@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+// GetMachineIPv6Migrations returns migrations for optional per-machine IPv6 addresses
+func GetMachineIPv6Migrations() []Migration {
+	return []Migration{
+		{
+			Version: 22,
+			Name:    "add_machine_ipv6",
+			Up: func(db *sql.DB) error {
+				// Empty means the machine has no IPv6 address
+				if _, err := db.Exec(`ALTER TABLE machines ADD COLUMN ipv6 TEXT NOT NULL DEFAULT ''`); err != nil {
+					return err
+				}
+				_, err := db.Exec(`CREATE UNIQUE INDEX idx_machines_ipv6 ON machines(ipv6) WHERE ipv6 != ''`)
+				return err
+			},
+			Down: func(db *sql.DB) error {
+				if _, err := db.Exec(`DROP INDEX IF EXISTS idx_machines_ipv6`); err != nil {
+					return err
+				}
+				_, err := db.Exec(`ALTER TABLE machines DROP COLUMN ipv6`)
+				return err
+			},
+		},
+	}
+}
@@ -0,0 +1,23 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+// GetMachineMetadataMigrations returns migrations for per-machine metadata serving controls
+func GetMachineMetadataMigrations() []Migration {
+	return []Migration{
+		{
+			Version: 15,
+			Name:    "add_machine_metadata_enabled",
+			Up: func(db *sql.DB) error {
+				_, err := db.Exec(`ALTER TABLE machines ADD COLUMN metadata_enabled INTEGER NOT NULL DEFAULT 1`)
+				return err
+			},
+			Down: func(db *sql.DB) error {
+				_, err := db.Exec(`ALTER TABLE machines DROP COLUMN metadata_enabled`)
+				return err
+			},
+		},
+	}
+}
@@ -0,0 +1,23 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+// GetMachinePlacementMigrations returns migrations for machine placement metadata
+func GetMachinePlacementMigrations() []Migration {
+	return []Migration{
+		{
+			Version: 12,
+			Name:    "add_machine_availability_zone",
+			Up: func(db *sql.DB) error {
+				_, err := db.Exec(`ALTER TABLE machines ADD COLUMN availability_zone TEXT NOT NULL DEFAULT ''`)
+				return err
+			},
+			Down: func(db *sql.DB) error {
+				_, err := db.Exec(`ALTER TABLE machines DROP COLUMN availability_zone`)
+				return err
+			},
+		},
+	}
+}
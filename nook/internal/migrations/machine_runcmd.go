@@ -0,0 +1,24 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+// GetMachineRunCmdMigrations returns migrations for per-machine cloud-init runcmd lists
+func GetMachineRunCmdMigrations() []Migration {
+	return []Migration{
+		{
+			Version: 20,
+			Name:    "add_machine_runcmd",
+			Up: func(db *sql.DB) error {
+				// JSON array of command strings; empty means no runcmd block
+				_, err := db.Exec(`ALTER TABLE machines ADD COLUMN runcmd TEXT NOT NULL DEFAULT ''`)
+				return err
+			},
+			Down: func(db *sql.DB) error {
+				_, err := db.Exec(`ALTER TABLE machines DROP COLUMN runcmd`)
+				return err
+			},
+		},
+	}
+}
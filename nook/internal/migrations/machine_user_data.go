@@ -0,0 +1,24 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+// GetMachineUserDataMigrations returns migrations for stored per-machine user-data
+func GetMachineUserDataMigrations() []Migration {
+	return []Migration{
+		{
+			Version: 23,
+			Name:    "add_machine_user_data",
+			Up: func(db *sql.DB) error {
+				// Served verbatim as user-data; empty means generate cloud-config
+				_, err := db.Exec(`ALTER TABLE machines ADD COLUMN user_data TEXT NOT NULL DEFAULT ''`)
+				return err
+			},
+			Down: func(db *sql.DB) error {
+				_, err := db.Exec(`ALTER TABLE machines DROP COLUMN user_data`)
+				return err
+			},
+		},
+	}
+}
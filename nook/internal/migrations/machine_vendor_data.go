@@ -0,0 +1,24 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+// GetMachineVendorDataMigrations returns migrations for stored per-machine vendor-data
+func GetMachineVendorDataMigrations() []Migration {
+	return []Migration{
+		{
+			Version: 24,
+			Name:    "add_machine_vendor_data",
+			Up: func(db *sql.DB) error {
+				// Served as vendor-data; empty falls back to the global vendor-data file
+				_, err := db.Exec(`ALTER TABLE machines ADD COLUMN vendor_data TEXT NOT NULL DEFAULT ''`)
+				return err
+			},
+			Down: func(db *sql.DB) error {
+				_, err := db.Exec(`ALTER TABLE machines DROP COLUMN vendor_data`)
+				return err
+			},
+		},
+	}
+}
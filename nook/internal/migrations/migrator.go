@@ -2,10 +2,16 @@ package migrations
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"sort"
 )
 
+// ErrSchemaOutdated is returned when the database is missing migrations the
+// service needs, which would otherwise surface as "no such table" errors at
+// request time.
+var ErrSchemaOutdated = errors.New("database schema is out of date")
+
 // Migration represents a database migration with up and down functions
 type Migration struct {
 	Version int64
@@ -117,6 +123,45 @@ func (m *Migrator) GetCurrentVersion() (int64, error) {
 	return m.getCurrentVersion()
 }
 
+// PendingMigrations returns the registered migrations not yet applied, without
+// creating the tracking table on a database that has never been migrated.
+func (m *Migrator) PendingMigrations() ([]Migration, error) {
+	var tables int
+	err := m.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'").Scan(&tables)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for schema_migrations table: %w", err)
+	}
+
+	var current int64
+	if tables > 0 {
+		if current, err = m.getCurrentVersion(); err != nil {
+			return nil, fmt.Errorf("failed to get current version: %w", err)
+		}
+	}
+
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if migration.Version > current {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// CheckSchema verifies every registered migration has been applied, returning
+// an error wrapping ErrSchemaOutdated that names the versions involved if not.
+func (m *Migrator) CheckSchema() error {
+	pending, err := m.PendingMigrations()
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %d migration(s) pending, from version %d (%s) to %d; run migrations before starting the service",
+		ErrSchemaOutdated, len(pending), pending[0].Version, pending[0].Name, pending[len(pending)-1].Version)
+}
+
 // GetMigrations returns all registered migrations
 func (m *Migrator) GetMigrations() []Migration {
 	return m.migrations
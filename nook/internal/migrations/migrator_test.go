@@ -36,7 +36,7 @@ func TestMigrator_RunMigrations(t *testing.T) {
 	// Verify current version (should be the highest migration version)
 	version, err := migrator.GetCurrentVersion()
 	require.NoError(t, err)
-	assert.Equal(t, int64(10), version) // Updated to include performance migration
+	assert.Equal(t, int64(24), version) // Updated to include machine vendor-data migration
 
 	// Verify tables exist
 	var count int
@@ -91,6 +91,45 @@ func TestMigrator_AddMigration(t *testing.T) {
 	assert.Equal(t, int64(3), migrations[2].Version)
 }
 
+func TestMigrator_CheckSchema(t *testing.T) {
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", "TestMigrator_CheckSchema")
+	db, err := sql.Open("sqlite", dsn)
+	require.NoError(t, err)
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("Warning: failed to close test database: %v", closeErr)
+		}
+	}()
+
+	migrator := NewMigrator(db)
+	for _, migration := range GetInitialMigrations() {
+		migrator.AddMigration(migration)
+	}
+
+	// A database that has never been migrated reports every migration as pending
+	pending, err := migrator.PendingMigrations()
+	require.NoError(t, err)
+	assert.Len(t, pending, len(GetInitialMigrations()))
+
+	err = migrator.CheckSchema()
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrSchemaOutdated)
+	assert.Contains(t, err.Error(), "pending")
+
+	// Checking must not create the tracking table
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='schema_migrations'").Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	require.NoError(t, migrator.RunMigrations())
+
+	pending, err = migrator.PendingMigrations()
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+	assert.NoError(t, migrator.CheckSchema())
+}
+
 func TestUpgradeExistingTables(t *testing.T) {
 	// Create a test database with old schema
 	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", "TestUpgradeExistingTables")
@@ -0,0 +1,23 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+// GetNetworkAllocationMigrations returns migrations for per-network IP allocation settings
+func GetNetworkAllocationMigrations() []Migration {
+	return []Migration{
+		{
+			Version: 14,
+			Name:    "add_network_allocation_strategy",
+			Up: func(db *sql.DB) error {
+				_, err := db.Exec(`ALTER TABLE networks ADD COLUMN allocation_strategy TEXT NOT NULL DEFAULT 'lowest'`)
+				return err
+			},
+			Down: func(db *sql.DB) error {
+				_, err := db.Exec(`ALTER TABLE networks DROP COLUMN allocation_strategy`)
+				return err
+			},
+		},
+	}
+}
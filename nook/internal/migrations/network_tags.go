@@ -0,0 +1,36 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+// GetNetworkTagsMigrations returns migrations for network tagging
+func GetNetworkTagsMigrations() []Migration {
+	return []Migration{
+		{
+			Version: 11,
+			Name:    "create_network_tags_table",
+			Up: func(db *sql.DB) error {
+				_, err := db.Exec(`
+					CREATE TABLE IF NOT EXISTS network_tags (
+						network_id INTEGER NOT NULL,
+						key TEXT NOT NULL,
+						value TEXT NOT NULL,
+						PRIMARY KEY (network_id, key),
+						FOREIGN KEY (network_id) REFERENCES networks(id) ON DELETE CASCADE
+					)
+				`)
+				if err != nil {
+					return err
+				}
+
+				_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_network_tags_key_value ON network_tags(key, value)`)
+				return err
+			},
+			Down: func(db *sql.DB) error {
+				_, err := db.Exec(`DROP TABLE IF EXISTS network_tags`)
+				return err
+			},
+		},
+	}
+}
@@ -0,0 +1,26 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+// GetSettingsMigrations returns migrations for deployment-wide key/value settings
+func GetSettingsMigrations() []Migration {
+	return []Migration{
+		{
+			Version: 16,
+			Name:    "create_settings_table",
+			Up: func(db *sql.DB) error {
+				_, err := db.Exec(`CREATE TABLE IF NOT EXISTS settings (
+					key TEXT PRIMARY KEY,
+					value TEXT NOT NULL
+				)`)
+				return err
+			},
+			Down: func(db *sql.DB) error {
+				_, err := db.Exec(`DROP TABLE IF EXISTS settings`)
+				return err
+			},
+		},
+	}
+}
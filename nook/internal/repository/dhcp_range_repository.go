@@ -3,7 +3,9 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"net"
 
 	"github.com/jbweber/homelab/nook/internal/domain"
 )
@@ -12,6 +14,9 @@ import (
 type DHCPRangeRepository interface {
 	Repository[domain.DHCPRange, int64]
 	FindByNetworkID(ctx context.Context, networkID int64) ([]domain.DHCPRange, error)
+	FindLeasesInRange(ctx context.Context, id int64) ([]domain.IPAddressLease, error)
+	DeleteWithLeases(ctx context.Context, id int64) (int, error)
+	SaveAll(ctx context.Context, ranges []domain.DHCPRange) ([]domain.DHCPRange, error)
 }
 
 // dhcpRangeRepositoryImpl implements DHCPRangeRepository
@@ -48,6 +53,9 @@ func (r *dhcpRangeRepositoryImpl) createDHCPRange(d domain.DHCPRange) (domain.DH
 	if d.EndIP == "" {
 		return domain.DHCPRange{}, fmt.Errorf("DHCP range end IP is required")
 	}
+	if err := checkDHCPRangeInSubnet(context.Background(), r.db, d); err != nil {
+		return domain.DHCPRange{}, err
+	}
 
 	result, err := r.db.Exec(`
 		INSERT INTO dhcp_ranges (network_id, start_ip, end_ip, lease_time)
@@ -66,6 +74,55 @@ func (r *dhcpRangeRepositoryImpl) createDHCPRange(d domain.DHCPRange) (domain.DH
 	return d, nil
 }
 
+// SaveAll creates several DHCP ranges in a single transaction; either all are
+// created or none are.
+func (r *dhcpRangeRepositoryImpl) SaveAll(ctx context.Context, ranges []domain.DHCPRange) ([]domain.DHCPRange, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	saved := make([]domain.DHCPRange, 0, len(ranges))
+	for _, d := range ranges {
+		if d.NetworkID == 0 {
+			return nil, fmt.Errorf("DHCP range network ID is required")
+		}
+		if d.StartIP == "" {
+			return nil, fmt.Errorf("DHCP range start IP is required")
+		}
+		if d.EndIP == "" {
+			return nil, fmt.Errorf("DHCP range end IP is required")
+		}
+		if err := checkDHCPRangeInSubnet(ctx, tx, d); err != nil {
+			return nil, err
+		}
+
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO dhcp_ranges (network_id, start_ip, end_ip, lease_time)
+			VALUES (?, ?, ?, ?)`,
+			d.NetworkID, d.StartIP, d.EndIP, d.LeaseTime)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create DHCP range %s-%s: %w", d.StartIP, d.EndIP, err)
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get DHCP range ID: %w", err)
+		}
+		d.ID = id
+		saved = append(saved, d)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit DHCP ranges: %w", err)
+	}
+
+	return saved, nil
+}
+
 // updateDHCPRange updates an existing DHCP range in the database
 func (r *dhcpRangeRepositoryImpl) updateDHCPRange(d domain.DHCPRange) (domain.DHCPRange, error) {
 	if d.NetworkID == 0 {
@@ -77,6 +134,9 @@ func (r *dhcpRangeRepositoryImpl) updateDHCPRange(d domain.DHCPRange) (domain.DH
 	if d.EndIP == "" {
 		return domain.DHCPRange{}, fmt.Errorf("DHCP range end IP is required")
 	}
+	if err := checkDHCPRangeInSubnet(context.Background(), r.db, d); err != nil {
+		return domain.DHCPRange{}, err
+	}
 
 	_, err := r.db.Exec(`
 		UPDATE dhcp_ranges
@@ -90,17 +150,49 @@ func (r *dhcpRangeRepositoryImpl) updateDHCPRange(d domain.DHCPRange) (domain.DH
 	return d, nil
 }
 
+// checkDHCPRangeInSubnet confirms both ends of d lie inside its network's subnet,
+// so allocation never hands out addresses the network cannot route.
+func checkDHCPRangeInSubnet(ctx context.Context, q queryer, d domain.DHCPRange) error {
+	var subnet string
+	if err := q.QueryRowContext(ctx, "SELECT subnet FROM networks WHERE id = ?", d.NetworkID).Scan(&subnet); err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("network %d: %w", d.NetworkID, ErrNotFound)
+		}
+		return fmt.Errorf("failed to get network subnet: %w", err)
+	}
+	_, ipNet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return fmt.Errorf("network %d subnet %q is not a valid CIDR: %w", d.NetworkID, subnet, ErrInvalidEntity)
+	}
+
+	for _, bound := range []struct{ name, ip string }{{"start", d.StartIP}, {"end", d.EndIP}} {
+		ip := net.ParseIP(bound.ip)
+		if ip == nil {
+			return fmt.Errorf("DHCP range %s IP %q is not a valid IP address: %w", bound.name, bound.ip, ErrInvalidEntity)
+		}
+		if !ipNet.Contains(ip) {
+			return fmt.Errorf("DHCP range %s IP %s is outside network subnet %s: %w", bound.name, bound.ip, subnet, ErrInvalidEntity)
+		}
+	}
+	return nil
+}
+
 // FindByID finds a DHCP range by ID
 func (r *dhcpRangeRepositoryImpl) FindByID(ctx context.Context, id int64) (domain.DHCPRange, error) {
+	return findDHCPRange(ctx, r.db, id)
+}
+
+// findDHCPRange finds a DHCP range by ID through q
+func findDHCPRange(ctx context.Context, q queryer, id int64) (domain.DHCPRange, error) {
 	var dhcpRange domain.DHCPRange
-	err := r.db.QueryRow(`
+	err := q.QueryRowContext(ctx, `
 		SELECT id, network_id, start_ip, end_ip, lease_time
 		FROM dhcp_ranges WHERE id = ?`, id).Scan(
 		&dhcpRange.ID, &dhcpRange.NetworkID, &dhcpRange.StartIP,
 		&dhcpRange.EndIP, &dhcpRange.LeaseTime)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return domain.DHCPRange{}, fmt.Errorf("DHCP range with ID %d not found", id)
+			return domain.DHCPRange{}, fmt.Errorf("DHCP range with ID %d: %w", id, ErrNotFound)
 		}
 		return domain.DHCPRange{}, fmt.Errorf("failed to find DHCP range: %w", err)
 	}
@@ -193,3 +285,139 @@ func (r *dhcpRangeRepositoryImpl) FindByNetworkID(ctx context.Context, networkID
 
 	return ranges, nil
 }
+
+// FindLeasesInRange finds all IP leases on the range's network whose address falls within the range
+func (r *dhcpRangeRepositoryImpl) FindLeasesInRange(ctx context.Context, id int64) ([]domain.IPAddressLease, error) {
+	return findLeasesInRange(ctx, r.db, id)
+}
+
+// findLeasesInRange finds the leases within a DHCP range through q
+func findLeasesInRange(ctx context.Context, q queryer, id int64) ([]domain.IPAddressLease, error) {
+	dhcpRange, err := findDHCPRange(ctx, q, id)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT id, machine_id, network_id, ip_address, lease_time, created_at, updated_at
+		FROM ip_address_leases WHERE network_id = ?`, dhcpRange.NetworkID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find IP leases for DHCP range %d: %w", id, err)
+	}
+	defer rows.Close()
+
+	var leases []domain.IPAddressLease
+	for rows.Next() {
+		var lease domain.IPAddressLease
+		err := rows.Scan(
+			&lease.ID, &lease.MachineID, &lease.NetworkID, &lease.IPAddress,
+			&lease.LeaseTime, &lease.CreatedAt, &lease.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan IP lease: %w", err)
+		}
+		if ipInRange(lease.IPAddress, dhcpRange.StartIP, dhcpRange.EndIP) {
+			leases = append(leases, lease)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating IP leases: %w", err)
+	}
+
+	return leases, nil
+}
+
+// DeleteWithLeases deletes a DHCP range together with every lease that falls within it.
+// Machines whose IPv4 came from a released lease are leased a new address from the
+// network's remaining ranges. Everything happens in a single transaction; if the
+// remaining ranges cannot hold those machines the error wraps
+// ErrInsufficientCapacity and nothing changes. Returns the number of leases released.
+func (r *dhcpRangeRepositoryImpl) DeleteWithLeases(ctx context.Context, id int64) (released int, err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+			err = errors.Join(err, fmt.Errorf("failed to roll back DHCP range deletion: %w", rollbackErr))
+		}
+	}()
+
+	dhcpRange, err := findDHCPRange(ctx, tx, id)
+	if err != nil {
+		return 0, err
+	}
+	leases, err := findLeasesInRange(ctx, tx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	// Machines still using a released address need a new one
+	var readdress []int64
+	for _, lease := range leases {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM ip_address_leases WHERE id = ?", lease.ID); err != nil {
+			return 0, fmt.Errorf("failed to release IP lease %s: %w", lease.IPAddress, err)
+		}
+		var count int
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM machines WHERE id = ? AND ipv4 = ?", lease.MachineID, lease.IPAddress).Scan(&count); err != nil {
+			return 0, fmt.Errorf("failed to check machine %d: %w", lease.MachineID, err)
+		}
+		if count > 0 {
+			readdress = append(readdress, lease.MachineID)
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM dhcp_ranges WHERE id = ?", id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete DHCP range: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return 0, fmt.Errorf("DHCP range with ID %d: %w", id, ErrNotFound)
+	}
+
+	if len(readdress) > 0 {
+		free, err := freeIPs(ctx, tx, dhcpRange.NetworkID, len(readdress))
+		if err != nil {
+			return 0, err
+		}
+		if len(free) < len(readdress) {
+			return 0, fmt.Errorf("network %d has %d free addresses outside DHCP range %d for %d leased machines: %w",
+				dhcpRange.NetworkID, len(free), id, len(readdress), ErrInsufficientCapacity)
+		}
+		for i, machineID := range readdress {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO ip_address_leases (machine_id, network_id, ip_address, lease_time) VALUES (?, ?, ?, ?)",
+				machineID, dhcpRange.NetworkID, free[i].IPAddress, free[i].LeaseTime); err != nil {
+				return 0, fmt.Errorf("failed to lease %s for machine %d: %w", free[i].IPAddress, machineID, err)
+			}
+			if _, err := tx.ExecContext(ctx, "UPDATE machines SET ipv4 = ? WHERE id = ?", free[i].IPAddress, machineID); err != nil {
+				return 0, fmt.Errorf("failed to readdress machine %d: %w", machineID, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit DHCP range deletion: %w", err)
+	}
+
+	return len(leases), nil
+}
+
+// ipInRange reports whether ip lies within the inclusive range [startIP, endIP]
+func ipInRange(ip, startIP, endIP string) bool {
+	parsed := net.ParseIP(ip)
+	start := net.ParseIP(startIP)
+	end := net.ParseIP(endIP)
+	if parsed == nil || start == nil || end == nil {
+		return false
+	}
+	if parsed.To4() == nil || start.To4() == nil || end.To4() == nil {
+		return false
+	}
+
+	ipInt := ipToInt(parsed)
+	return ipInt >= ipToInt(start) && ipInt <= ipToInt(end)
+}
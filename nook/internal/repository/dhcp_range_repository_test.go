@@ -2,6 +2,8 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/jbweber/homelab/nook/internal/domain"
@@ -58,6 +60,35 @@ func TestDHCPRangeRepository_Save(t *testing.T) {
 	}
 }
 
+func TestDHCPRangeRepository_Save_OutsideSubnet(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestDHCPRangeRepository_Save_OutsideSubnet")
+	defer cleanup()
+
+	network, err := NewNetworkRepository(db).Save(context.Background(), domain.Network{Name: "test-network", Bridge: "br0", Subnet: "192.168.1.0/24"})
+	if err != nil {
+		t.Fatalf("Failed to create network: %v", err)
+	}
+	repo := NewDHCPRangeRepository(db)
+
+	_, err = repo.Save(context.Background(), domain.DHCPRange{NetworkID: network.ID, StartIP: "10.0.5.100", EndIP: "192.168.1.150", LeaseTime: "24h"})
+	if !errors.Is(err, ErrInvalidEntity) {
+		t.Fatalf("Expected ErrInvalidEntity, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "10.0.5.100") || !strings.Contains(err.Error(), "192.168.1.0/24") {
+		t.Errorf("Expected error to name the IP and subnet, got %q", err)
+	}
+
+	// Updates are checked the same way
+	saved, err := repo.Save(context.Background(), domain.DHCPRange{NetworkID: network.ID, StartIP: "192.168.1.100", EndIP: "192.168.1.150", LeaseTime: "24h"})
+	if err != nil {
+		t.Fatalf("Failed to create DHCP range: %v", err)
+	}
+	saved.EndIP = "192.168.2.10"
+	if _, err := repo.Save(context.Background(), saved); !errors.Is(err, ErrInvalidEntity) {
+		t.Errorf("Expected ErrInvalidEntity updating to an out-of-subnet end IP, got %v", err)
+	}
+}
+
 func TestDHCPRangeRepository_FindByID(t *testing.T) {
 	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestDHCPRangeRepository_FindByID")
 	defer cleanup()
@@ -238,8 +269,8 @@ func TestDHCPRangeRepository_DeleteByID(t *testing.T) {
 
 	// Verify it's deleted
 	_, err = repo.FindByID(context.Background(), saved.ID)
-	if err == nil {
-		t.Error("Expected error when finding deleted DHCP range")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound when finding deleted DHCP range, got %v", err)
 	}
 }
 
@@ -292,3 +323,140 @@ func TestDHCPRangeRepository_ExistsByID(t *testing.T) {
 		t.Error("Expected DHCP range to exist")
 	}
 }
+
+func TestDHCPRangeRepository_DeleteWithLeases(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestDHCPRangeRepository_DeleteWithLeases")
+	defer cleanup()
+
+	networkRepo := NewNetworkRepository(db)
+	savedNetwork, err := networkRepo.Save(context.Background(), domain.Network{Name: "test-network", Bridge: "br0", Subnet: "192.168.1.0/24"})
+	if err != nil {
+		t.Fatalf("Failed to save network: %v", err)
+	}
+
+	repo := NewDHCPRangeRepository(db)
+	inRange, err := repo.Save(context.Background(), domain.DHCPRange{NetworkID: savedNetwork.ID, StartIP: "192.168.1.100", EndIP: "192.168.1.101", LeaseTime: "24h"})
+	if err != nil {
+		t.Fatalf("Failed to save DHCP range: %v", err)
+	}
+
+	machineRepo := NewMachineRepository(db)
+	leaseRepo := NewIPLeaseRepository(db)
+	for _, name := range []string{"m1", "m2"} {
+		machine, err := machineRepo.Save(context.Background(), domain.Machine{Name: name, Hostname: name, NetworkID: &savedNetwork.ID})
+		if err != nil {
+			t.Fatalf("Failed to save machine: %v", err)
+		}
+		lease, err := leaseRepo.AllocateIPAddress(context.Background(), machine.ID, savedNetwork.ID)
+		if err != nil {
+			t.Fatalf("Failed to allocate IP: %v", err)
+		}
+		machine.IPv4 = lease.IPAddress
+		if _, err := machineRepo.Save(context.Background(), machine); err != nil {
+			t.Fatalf("Failed to update machine: %v", err)
+		}
+	}
+
+	// A lease outside the range on the same network must survive
+	outside, err := machineRepo.Save(context.Background(), domain.Machine{Name: "m3", Hostname: "m3", NetworkID: &savedNetwork.ID})
+	if err != nil {
+		t.Fatalf("Failed to save machine: %v", err)
+	}
+	if _, err := leaseRepo.Save(context.Background(), domain.IPAddressLease{MachineID: outside.ID, NetworkID: savedNetwork.ID, IPAddress: "192.168.1.200", LeaseTime: "24h"}); err != nil {
+		t.Fatalf("Failed to save lease: %v", err)
+	}
+
+	leases, err := repo.FindLeasesInRange(context.Background(), inRange.ID)
+	if err != nil {
+		t.Fatalf("Failed to find leases in range: %v", err)
+	}
+	if len(leases) != 2 {
+		t.Fatalf("Expected 2 leases in range, got %d", len(leases))
+	}
+
+	// With no other range the leased machines cannot be readdressed, so nothing changes
+	if _, err := repo.DeleteWithLeases(context.Background(), inRange.ID); !errors.Is(err, ErrInsufficientCapacity) {
+		t.Fatalf("Expected ErrInsufficientCapacity, got %v", err)
+	}
+	if _, err := repo.FindByID(context.Background(), inRange.ID); err != nil {
+		t.Errorf("Expected the range to survive a failed delete: %v", err)
+	}
+	if kept, _ := repo.FindLeasesInRange(context.Background(), inRange.ID); len(kept) != 2 {
+		t.Errorf("Expected both leases to survive a failed delete, got %d", len(kept))
+	}
+
+	if _, err := repo.Save(context.Background(), domain.DHCPRange{NetworkID: savedNetwork.ID, StartIP: "192.168.1.150", EndIP: "192.168.1.151", LeaseTime: "12h"}); err != nil {
+		t.Fatalf("Failed to save DHCP range: %v", err)
+	}
+	released, err := repo.DeleteWithLeases(context.Background(), inRange.ID)
+	if err != nil {
+		t.Fatalf("Failed to delete DHCP range with leases: %v", err)
+	}
+	if released != 2 {
+		t.Errorf("Expected 2 released leases, got %d", released)
+	}
+
+	remaining, err := leaseRepo.FindByNetworkID(context.Background(), savedNetwork.ID)
+	if err != nil {
+		t.Fatalf("Failed to list leases: %v", err)
+	}
+	addresses := map[string]bool{}
+	for _, lease := range remaining {
+		addresses[lease.IPAddress] = true
+	}
+	if len(remaining) != 3 || !addresses["192.168.1.200"] || !addresses["192.168.1.150"] || !addresses["192.168.1.151"] {
+		t.Errorf("Expected the out-of-range lease and two new leases, got %+v", remaining)
+	}
+
+	// The machines moved to their new leases
+	for _, name := range []string{"m1", "m2"} {
+		machine, err := machineRepo.FindByName(context.Background(), name)
+		if err != nil {
+			t.Fatalf("Failed to find machine: %v", err)
+		}
+		if machine.IPv4 != "192.168.1.150" && machine.IPv4 != "192.168.1.151" {
+			t.Errorf("Expected %s to be readdressed from the remaining range, got %q", name, machine.IPv4)
+		}
+	}
+}
+
+func TestDHCPRangeRepository_SaveAll(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestDHCPRangeRepository_SaveAll")
+	defer cleanup()
+
+	networkRepo := NewNetworkRepository(db)
+	repo := NewDHCPRangeRepository(db)
+
+	network, err := networkRepo.Save(context.Background(), domain.Network{Name: "bulk", Bridge: "br0", Subnet: "10.10.0.0/24"})
+	if err != nil {
+		t.Fatalf("Failed to save network: %v", err)
+	}
+
+	saved, err := repo.SaveAll(context.Background(), []domain.DHCPRange{
+		{NetworkID: network.ID, StartIP: "10.10.0.10", EndIP: "10.10.0.20", LeaseTime: "24h"},
+		{NetworkID: network.ID, StartIP: "10.10.0.30", EndIP: "10.10.0.40", LeaseTime: "24h"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to save ranges: %v", err)
+	}
+	if len(saved) != 2 || saved[0].ID == 0 || saved[1].ID == 0 {
+		t.Errorf("Expected two ranges with IDs, got %v", saved)
+	}
+
+	// An invalid entry rolls back the whole batch
+	_, err = repo.SaveAll(context.Background(), []domain.DHCPRange{
+		{NetworkID: network.ID, StartIP: "10.10.0.50", EndIP: "10.10.0.60", LeaseTime: "24h"},
+		{NetworkID: network.ID, StartIP: "10.10.0.70"},
+	})
+	if err == nil {
+		t.Fatal("Expected error for range without end IP")
+	}
+
+	ranges, err := repo.FindByNetworkID(context.Background(), network.ID)
+	if err != nil {
+		t.Fatalf("Failed to list ranges: %v", err)
+	}
+	if len(ranges) != 2 {
+		t.Errorf("Expected failed batch to be rolled back leaving 2 ranges, got %d", len(ranges))
+	}
+}
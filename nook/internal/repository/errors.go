@@ -1,6 +1,9 @@
 package repository
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 // Common repository errors that can be checked with errors.Is()
 var (
@@ -13,6 +16,23 @@ var (
 	// ErrInvalidEntity is returned when an entity fails validation
 	ErrInvalidEntity = errors.New("invalid entity")
 
+	// ErrInsufficientCapacity is returned when a network has too few free addresses for an allocation
+	ErrInsufficientCapacity = errors.New("insufficient capacity")
+
 	// ErrOperationNotSupported is returned when an operation is not supported
 	ErrOperationNotSupported = errors.New("operation not supported")
 )
+
+// BatchItemError reports which item of an all-or-nothing batch write failed
+type BatchItemError struct {
+	Index int   // Position of the failing item in the batch
+	Err   error // Why it failed
+}
+
+func (e *BatchItemError) Error() string {
+	return fmt.Sprintf("item %d: %v", e.Index, e.Err)
+}
+
+func (e *BatchItemError) Unwrap() error {
+	return e.Err
+}
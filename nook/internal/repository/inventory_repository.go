@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jbweber/homelab/nook/internal/domain"
+)
+
+// InventoryNetwork is a network to import together with its DHCP ranges
+type InventoryNetwork struct {
+	Network    domain.Network
+	DHCPRanges []domain.DHCPRange // NetworkID is set on import
+}
+
+// InventoryMachine is a machine to import together with its SSH keys. Network
+// names a network of the same import or an existing one, and replaces
+// Machine.NetworkID when set.
+type InventoryMachine struct {
+	Machine domain.Machine
+	Network string
+	SSHKeys []string
+}
+
+// InventoryRepository imports whole inventories at once
+type InventoryRepository interface {
+	// Import creates the networks and their DHCP ranges, then the machines and
+	// their SSH keys, inside a single transaction. A machine with a network but
+	// no IPv4 is leased the network's next free address. Nothing is written on
+	// any error.
+	Import(ctx context.Context, networks []InventoryNetwork, machines []InventoryMachine) error
+}
+
+type inventoryRepositoryImpl struct {
+	db     *sql.DB
+	sealer keyTextSealer // nil stores key text as given
+}
+
+// NewInventoryRepository creates a new inventory repository. Imported SSH keys
+// are stored the way sshKeys stores them, so they are encrypted when it encrypts.
+func NewInventoryRepository(db *sql.DB, sshKeys SSHKeyRepository) InventoryRepository {
+	r := &inventoryRepositoryImpl{db: db}
+	if sealer, ok := sshKeys.(keyTextSealer); ok {
+		r.sealer = sealer
+	}
+	return r
+}
+
+// Import implements InventoryRepository
+func (r *inventoryRepositoryImpl) Import(ctx context.Context, networks []InventoryNetwork, machines []InventoryMachine) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	for _, in := range networks {
+		n := in.Network
+		if n.Name == "" || n.Bridge == "" || n.Subnet == "" {
+			return fmt.Errorf("network name, bridge and subnet are required: %w", ErrInvalidEntity)
+		}
+		var count int
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM networks WHERE name = ?", n.Name).Scan(&count); err != nil {
+			return fmt.Errorf("failed to check for duplicate network name: %w", err)
+		}
+		if count > 0 {
+			return fmt.Errorf("network with name '%s': %w", n.Name, ErrDuplicate)
+		}
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO networks (name, bridge, subnet, gateway, dns_servers, description, allocation_strategy, mtu, dns_forwarders)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			n.Name, n.Bridge, n.Subnet, n.Gateway, n.DNSServers, n.Description, n.AllocationStrategy, n.MTU, n.DNSForwarders)
+		if err != nil {
+			return fmt.Errorf("failed to import network %q: %w", n.Name, err)
+		}
+		if n.ID, err = result.LastInsertId(); err != nil {
+			return fmt.Errorf("failed to get network ID: %w", err)
+		}
+
+		for _, d := range in.DHCPRanges {
+			d.NetworkID = n.ID
+			if err := checkDHCPRangeInSubnet(ctx, tx, d); err != nil {
+				return fmt.Errorf("failed to import DHCP range %s-%s for network %q: %w", d.StartIP, d.EndIP, n.Name, err)
+			}
+			if _, err := tx.ExecContext(ctx, "INSERT INTO dhcp_ranges (network_id, start_ip, end_ip, lease_time) VALUES (?, ?, ?, ?)",
+				d.NetworkID, d.StartIP, d.EndIP, d.LeaseTime); err != nil {
+				return fmt.Errorf("failed to import DHCP range %s-%s for network %q: %w", d.StartIP, d.EndIP, n.Name, err)
+			}
+		}
+	}
+
+	for _, in := range machines {
+		m := in.Machine
+		if in.Network != "" {
+			var networkID int64
+			err := tx.QueryRowContext(ctx, "SELECT id FROM networks WHERE name = ?", in.Network).Scan(&networkID)
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("machine %q references unknown network %q: %w", m.Name, in.Network, ErrNotFound)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to look up network %q: %w", in.Network, err)
+			}
+			m.NetworkID = &networkID
+		}
+
+		created, err := createMachineTx(ctx, tx, m)
+		if err != nil {
+			return fmt.Errorf("failed to import machine %q: %w", m.Name, err)
+		}
+
+		for _, key := range in.SSHKeys {
+			stored := key
+			if r.sealer != nil {
+				if stored, err = r.sealer.sealKeyText(key); err != nil {
+					return fmt.Errorf("failed to import SSH key for machine %q: %w", m.Name, err)
+				}
+			}
+			if _, err := tx.ExecContext(ctx, "INSERT INTO ssh_keys (machine_id, key_text) VALUES (?, ?)", created.ID, stored); err != nil {
+				return fmt.Errorf("failed to import SSH key for machine %q: %w", m.Name, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit import: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jbweber/homelab/nook/internal/domain"
+	"github.com/jbweber/homelab/nook/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInventoryRepository_Import(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestInventoryRepository_Import")
+	defer cleanup()
+
+	ctx := context.Background()
+	sshKeys, err := NewEncryptedSSHKeyRepository(db, []byte("0123456789abcdef0123456789abcdef"))
+	require.NoError(t, err)
+	repo := NewInventoryRepository(db, sshKeys)
+
+	keyText := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIHHWRsRoeU3xJXRngvR6Eavcr4HtOIkitq6kLNDWS8Z5 alice@lab"
+	err = repo.Import(ctx,
+		[]InventoryNetwork{{
+			Network:    domain.Network{Name: "lab", Bridge: "br0", Subnet: "192.168.1.0/24"},
+			DHCPRanges: []domain.DHCPRange{{StartIP: "192.168.1.100", EndIP: "192.168.1.110", LeaseTime: "12h"}},
+		}},
+		[]InventoryMachine{
+			{Machine: domain.Machine{Name: "static", Hostname: "static", IPv4: "192.168.1.5"}, SSHKeys: []string{keyText}},
+			{Machine: domain.Machine{Name: "dynamic", Hostname: "dynamic"}, Network: "lab"},
+		})
+	require.NoError(t, err)
+
+	dynamic, err := NewMachineRepository(db).FindByName(ctx, "dynamic")
+	require.NoError(t, err)
+	assert.Equal(t, "192.168.1.100", dynamic.IPv4)
+	leases, err := NewIPLeaseRepository(db).FindAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, leases, 1)
+	assert.Equal(t, dynamic.ID, leases[0].MachineID)
+
+	// SSH keys are sealed by the encrypting repository
+	keys, err := sshKeys.FindAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, keyText, keys[0].KeyText)
+	var stored string
+	require.NoError(t, db.QueryRow("SELECT key_text FROM ssh_keys").Scan(&stored))
+	assert.NotContains(t, stored, "alice@lab")
+}
+
+func TestInventoryRepository_Import_RollsBack(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestInventoryRepository_Import_RollsBack")
+	defer cleanup()
+
+	ctx := context.Background()
+	repo := NewInventoryRepository(db, NewSSHKeyRepository(db))
+
+	// The second machine references a network that does not exist
+	err := repo.Import(ctx,
+		[]InventoryNetwork{{Network: domain.Network{Name: "lab", Bridge: "br0", Subnet: "192.168.1.0/24"}}},
+		[]InventoryMachine{
+			{Machine: domain.Machine{Name: "first", Hostname: "first", IPv4: "192.168.1.5"}},
+			{Machine: domain.Machine{Name: "lost", Hostname: "lost"}, Network: "nowhere"},
+		})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	networks, err := NewNetworkRepository(db).FindAll(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, networks)
+	machines, err := NewMachineRepository(db).FindAll(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, machines)
+}
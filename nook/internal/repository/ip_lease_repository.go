@@ -1,10 +1,14 @@
 package repository
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"fmt"
+	"math/rand/v2"
 	"net"
+	"sort"
+	"strings"
 
 	"github.com/jbweber/homelab/nook/internal/domain"
 )
@@ -19,6 +23,11 @@ type IPLeaseRepository interface {
 	DeallocateIPAddress(ctx context.Context, machineID, networkID int64) error
 	IsIPAddressAvailable(ctx context.Context, networkID int64, ipAddress string) (bool, error)
 	ExistsByID(ctx context.Context, id int64) (bool, error)
+	MigrateNetwork(ctx context.Context, sourceNetworkID, targetNetworkID int64) (int, error)
+	FindIPUsage(ctx context.Context) ([]domain.IPUsage, error)
+	ReserveIPAddresses(ctx context.Context, networkID int64, count int, token string) ([]domain.IPReservation, error)
+	ReleaseIPReservations(ctx context.Context, networkID int64, token string) (int, error)
+	PinMachineLease(ctx context.Context, machineID int64, keepNetwork bool) (string, error)
 }
 
 // ipLeaseRepositoryImpl implements IPLeaseRepository
@@ -59,8 +68,8 @@ func (r *ipLeaseRepositoryImpl) createLease(lease domain.IPAddressLease) (domain
 		return domain.IPAddressLease{}, fmt.Errorf("invalid IP address format: %s", lease.IPAddress)
 	}
 
-	// Check if IP is already leased
-	available, err := r.IsIPAddressAvailable(context.Background(), lease.NetworkID, lease.IPAddress)
+	// Check if IP is already leased; the leasing machine's own static address is not a conflict
+	available, err := r.isIPAddressAvailableFor(context.Background(), lease.NetworkID, lease.IPAddress, lease.MachineID)
 	if err != nil {
 		return domain.IPAddressLease{}, fmt.Errorf("failed to check IP availability: %w", err)
 	}
@@ -271,44 +280,156 @@ func (r *ipLeaseRepositoryImpl) FindByIPAddress(ctx context.Context, ipAddress s
 	return &lease, nil
 }
 
-// AllocateIPAddress finds and allocates an available IP address for the given machine and network
+// maxAllocateAttempts bounds how often AllocateIPAddress re-scans after its
+// insert loses an address to another writer.
+const maxAllocateAttempts = 5
+
+// AllocateIPAddress finds and allocates an available IP address for the given
+// machine and network. The scan and the insert run in one BEGIN IMMEDIATE
+// transaction, so concurrent allocations serialize on the database write lock
+// instead of picking the same address. An insert that still hits the
+// ip_address UNIQUE constraint re-scans.
 func (r *ipLeaseRepositoryImpl) AllocateIPAddress(ctx context.Context, machineID, networkID int64) (*domain.IPAddressLease, error) {
 	if machineID == 0 {
 		return nil, fmt.Errorf("machine ID is required")
 	}
-	// Get all DHCP ranges for this network
-	dhcpRanges, err := r.getDHCPRangesForNetwork(ctx, networkID)
+	for attempt := 1; ; attempt++ {
+		lease, err := r.allocateIPAddressOnce(ctx, machineID, networkID)
+		if err == nil || !isLeasedIPConflict(err) || attempt == maxAllocateAttempts {
+			return lease, err
+		}
+	}
+}
+
+// allocateIPAddressOnce is a single AllocateIPAddress attempt. database/sql
+// cannot begin an IMMEDIATE transaction, so it drives one by hand on a
+// dedicated connection.
+func (r *ipLeaseRepositoryImpl) allocateIPAddressOnce(ctx context.Context, machineID, networkID int64) (_ *domain.IPAddressLease, err error) {
+	conn, err := r.db.Conn(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get DHCP ranges: %w", err)
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	// The connection's busy_timeout (see config.SQLiteDSN) waits for a concurrent
+	// allocation to commit rather than failing with SQLITE_BUSY
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer func() {
+		if err != nil {
+			_, _ = conn.ExecContext(context.Background(), "ROLLBACK")
+		}
+	}()
 
-	if len(dhcpRanges) == 0 {
+	var rangeCount int
+	if err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM dhcp_ranges WHERE network_id = ?", networkID).Scan(&rangeCount); err != nil {
+		return nil, fmt.Errorf("failed to get DHCP ranges: %w", err)
+	}
+	if rangeCount == 0 {
 		return nil, fmt.Errorf("no DHCP ranges configured for network %d", networkID)
 	}
 
-	// Try to find an available IP in each range
-	for _, dhcpRange := range dhcpRanges {
-		ip, err := r.findAvailableIPInRange(ctx, networkID, dhcpRange.StartIP, dhcpRange.EndIP)
-		if err != nil {
-			continue // Try next range
+	var strategy string
+	if err := conn.QueryRowContext(ctx, "SELECT allocation_strategy FROM networks WHERE id = ?", networkID).Scan(&strategy); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("network %d not found", networkID)
 		}
-		if ip != "" {
-			// Found available IP, create lease
-			lease := domain.IPAddressLease{
-				MachineID: machineID,
-				NetworkID: networkID,
-				IPAddress: ip,
-				LeaseTime: dhcpRange.LeaseTime,
-			}
-			createdLease, err := r.createLease(lease)
-			if err != nil {
-				return nil, err
-			}
-			return &createdLease, nil
+		return nil, fmt.Errorf("failed to get allocation strategy: %w", err)
+	}
+
+	// Sequential takes the lowest free address; random draws uniformly from all of
+	// them by counting the free addresses and walking to a random index
+	space, err := loadFreeSpace(ctx, conn, networkID)
+	if err != nil {
+		return nil, err
+	}
+	count := 0
+	space.walk(func(string, string) bool {
+		count++
+		return strategy == domain.AllocationStrategyRandom
+	})
+	if count == 0 {
+		return nil, fmt.Errorf("no available IP addresses in network %d: %w", networkID, ErrInsufficientCapacity)
+	}
+	pick := 0
+	if strategy == domain.AllocationStrategyRandom {
+		pick = rand.IntN(count)
+	}
+	lease := domain.IPAddressLease{MachineID: machineID, NetworkID: networkID}
+	space.walk(func(ip, leaseTime string) bool {
+		if pick > 0 {
+			pick--
+			return true
+		}
+		lease.IPAddress, lease.LeaseTime = ip, leaseTime
+		return false
+	})
+
+	result, err := conn.ExecContext(ctx, `
+		INSERT INTO ip_address_leases (machine_id, network_id, ip_address, lease_time)
+		VALUES (?, ?, ?, ?)`,
+		lease.MachineID, lease.NetworkID, lease.IPAddress, lease.LeaseTime)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create IP lease: %w", err)
+	}
+	if lease.ID, err = result.LastInsertId(); err != nil {
+		return nil, fmt.Errorf("failed to get lease ID: %w", err)
+	}
+
+	if _, err = conn.ExecContext(ctx, "COMMIT"); err != nil {
+		return nil, fmt.Errorf("failed to commit IP lease: %w", err)
+	}
+	return &lease, nil
+}
+
+// isLeasedIPConflict reports whether err is the ip_address UNIQUE constraint on
+// ip_address_leases, meaning another writer leased the address first.
+func isLeasedIPConflict(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed: ip_address_leases.ip_address")
+}
+
+// FindIPUsage lists every in-use address across the deployment, sorted by IP.
+// Leased addresses are reported once, as leases, even though the machine row
+// carries the same address.
+func (r *ipLeaseRepositoryImpl) FindIPUsage(ctx context.Context) ([]domain.IPUsage, error) {
+	query := `
+		SELECT l.ip_address, 'lease', m.id, m.name, l.network_id
+		FROM ip_address_leases l
+		JOIN machines m ON m.id = l.machine_id
+		UNION
+		SELECT m.ipv4, 'static', m.id, m.name, m.network_id
+		FROM machines m
+		WHERE m.ipv4 != ''
+		  AND NOT EXISTS (SELECT 1 FROM ip_address_leases l WHERE l.machine_id = m.id AND l.ip_address = m.ipv4)`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find IP usage: %w", err)
+	}
+	defer rows.Close()
+
+	var usage []domain.IPUsage
+	for rows.Next() {
+		var u domain.IPUsage
+		var networkID sql.NullInt64
+		if err := rows.Scan(&u.IPAddress, &u.Source, &u.MachineID, &u.MachineName, &networkID); err != nil {
+			return nil, fmt.Errorf("failed to scan IP usage: %w", err)
 		}
+		if networkID.Valid {
+			u.NetworkID = &networkID.Int64
+		}
+		usage = append(usage, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating IP usage: %w", err)
 	}
 
-	return nil, fmt.Errorf("no available IP addresses in network %d", networkID)
+	// Sort numerically; SQL would order the text form ("10.0.0.10" before "10.0.0.9")
+	sort.SliceStable(usage, func(i, j int) bool {
+		return bytes.Compare(net.ParseIP(usage[i].IPAddress).To16(), net.ParseIP(usage[j].IPAddress).To16()) < 0
+	})
+	return usage, nil
 }
 
 // DeallocateIPAddress removes the IP lease for a machine on a specific network
@@ -332,138 +453,333 @@ func (r *ipLeaseRepositoryImpl) DeallocateIPAddress(ctx context.Context, machine
 	return nil
 }
 
-// IsIPAddressAvailable checks if an IP address is available for leasing
-func (r *ipLeaseRepositoryImpl) IsIPAddressAvailable(ctx context.Context, networkID int64, ipAddress string) (bool, error) {
-	// Check if IP is already leased
-	leaseQuery := `
-		SELECT COUNT(*) FROM ip_address_leases
-		WHERE network_id = ? AND ip_address = ?`
-
-	var leaseCount int
-	err := r.db.QueryRowContext(ctx, leaseQuery, networkID, ipAddress).Scan(&leaseCount)
+// MigrateNetwork moves every machine on the source network to the target network,
+// giving each a fresh lease from the target's DHCP ranges and dropping its source
+// leases. Everything happens in one transaction: if the target cannot fit all the
+// machines, nothing changes and ErrInsufficientCapacity is returned. Returns the
+// number of machines migrated.
+func (r *ipLeaseRepositoryImpl) MigrateNetwork(ctx context.Context, sourceNetworkID, targetNetworkID int64) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
-		return false, fmt.Errorf("failed to check IP lease availability: %w", err)
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer func() {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil && rollbackErr != sql.ErrTxDone {
+			// Log error but don't fail if transaction is already committed
+		}
+	}()
 
-	// Check if IP is already assigned to a machine
-	machineQuery := `
-		SELECT COUNT(*) FROM machines
-		WHERE ipv4 = ?`
+	machineIDs, err := queryInt64s(ctx, tx, "SELECT id FROM machines WHERE network_id = ? ORDER BY id", sourceNetworkID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find machines on network %d: %w", sourceNetworkID, err)
+	}
+	if len(machineIDs) == 0 {
+		return 0, nil
+	}
 
-	var machineCount int
-	err = r.db.QueryRowContext(ctx, machineQuery, ipAddress).Scan(&machineCount)
+	// Pick one free address per machine, in range order
+	free, err := freeIPs(ctx, tx, targetNetworkID, len(machineIDs))
 	if err != nil {
-		return false, fmt.Errorf("failed to check machine IP availability: %w", err)
+		return 0, err
+	}
+	leases := make([]domain.IPAddressLease, len(free))
+	for i, f := range free {
+		leases[i] = domain.IPAddressLease{
+			MachineID: machineIDs[i],
+			NetworkID: targetNetworkID,
+			IPAddress: f.IPAddress,
+			LeaseTime: f.LeaseTime,
+		}
+	}
+	if len(leases) < len(machineIDs) {
+		return 0, fmt.Errorf("network %d has %d free addresses for %d machines: %w",
+			targetNetworkID, len(leases), len(machineIDs), ErrInsufficientCapacity)
 	}
 
-	return leaseCount == 0 && machineCount == 0, nil
+	for _, lease := range leases {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM ip_address_leases WHERE machine_id = ? AND network_id = ?", lease.MachineID, sourceNetworkID); err != nil {
+			return 0, fmt.Errorf("failed to release lease for machine %d: %w", lease.MachineID, err)
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO ip_address_leases (machine_id, network_id, ip_address, lease_time) VALUES (?, ?, ?, ?)",
+			lease.MachineID, lease.NetworkID, lease.IPAddress, lease.LeaseTime); err != nil {
+			return 0, fmt.Errorf("failed to lease %s for machine %d: %w", lease.IPAddress, lease.MachineID, err)
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE machines SET ipv4 = ?, network_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+			lease.IPAddress, targetNetworkID, lease.MachineID); err != nil {
+			return 0, fmt.Errorf("failed to update machine %d: %w", lease.MachineID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit network migration: %w", err)
+	}
+
+	return len(leases), nil
 }
 
-// Helper methods
+// ReserveIPAddresses sets aside count free addresses from the network's DHCP
+// ranges under token, in range order, in one transaction. If fewer than count
+// are free, nothing is reserved and ErrInsufficientCapacity is returned.
+func (r *ipLeaseRepositoryImpl) ReserveIPAddresses(ctx context.Context, networkID int64, count int, token string) ([]domain.IPReservation, error) {
+	if count <= 0 {
+		return nil, fmt.Errorf("reservation count must be positive: %w", ErrInvalidEntity)
+	}
+	if token == "" {
+		return nil, fmt.Errorf("reservation token is required: %w", ErrInvalidEntity)
+	}
 
-func (r *ipLeaseRepositoryImpl) getDHCPRangesForNetwork(ctx context.Context, networkID int64) ([]domain.DHCPRange, error) {
-	query := `
-		SELECT id, network_id, start_ip, end_ip, lease_time
-		FROM dhcp_ranges
-		WHERE network_id = ?
-		ORDER BY start_ip`
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil && rollbackErr != sql.ErrTxDone {
+			// Log error but don't fail if transaction is already committed
+		}
+	}()
 
-	rows, err := r.db.QueryContext(ctx, query, networkID)
+	free, err := freeIPs(ctx, tx, networkID, count)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get DHCP ranges: %w", err)
+		return nil, err
+	}
+	if len(free) < count {
+		return nil, fmt.Errorf("network %d has %d free addresses for %d reservations: %w",
+			networkID, len(free), count, ErrInsufficientCapacity)
 	}
-	defer rows.Close()
 
-	var ranges []domain.DHCPRange
-	for rows.Next() {
-		var dhcpRange domain.DHCPRange
-		err := rows.Scan(&dhcpRange.ID, &dhcpRange.NetworkID, &dhcpRange.StartIP, &dhcpRange.EndIP, &dhcpRange.LeaseTime)
+	reservations := make([]domain.IPReservation, 0, count)
+	for _, f := range free {
+		res, err := tx.ExecContext(ctx, "INSERT INTO ip_reservations (network_id, ip_address, token) VALUES (?, ?, ?)", networkID, f.IPAddress, token)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan DHCP range: %w", err)
+			return nil, fmt.Errorf("failed to reserve %s: %w", f.IPAddress, err)
 		}
-		ranges = append(ranges, dhcpRange)
+		id, err := res.LastInsertId()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get reservation ID: %w", err)
+		}
+		reservations = append(reservations, domain.IPReservation{ID: id, NetworkID: networkID, IPAddress: f.IPAddress, Token: token})
 	}
 
-	return ranges, nil
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit IP reservations: %w", err)
+	}
+	return reservations, nil
 }
 
-func (r *ipLeaseRepositoryImpl) findAvailableIPInRange(ctx context.Context, networkID int64, startIP, endIP string) (string, error) {
-	start := net.ParseIP(startIP)
-	end := net.ParseIP(endIP)
-	if start == nil || end == nil {
-		return "", fmt.Errorf("invalid IP range: %s - %s", startIP, endIP)
+// ReleaseIPReservations frees every address reserved on the network under token
+// and returns how many were released, or ErrNotFound if there were none.
+func (r *ipLeaseRepositoryImpl) ReleaseIPReservations(ctx context.Context, networkID int64, token string) (int, error) {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM ip_reservations WHERE network_id = ? AND token = ?", networkID, token)
+	if err != nil {
+		return 0, fmt.Errorf("failed to release IP reservations: %w", err)
+	}
+	released, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if released == 0 {
+		return 0, fmt.Errorf("reservations for token on network %d: %w", networkID, ErrNotFound)
 	}
+	return int(released), nil
+}
 
-	// Convert IPs to integers for iteration
-	startInt := ipToInt(start)
-	endInt := ipToInt(end)
+// PinMachineLease turns the machine's dynamic lease on its network into a static
+// address: the leased IP is written to the machine, the lease is removed and, unless
+// keepNetwork is set, the machine leaves the network. Everything happens in one
+// transaction. Returns the pinned address, or ErrNotFound if the machine does not
+// exist or holds no lease.
+func (r *ipLeaseRepositoryImpl) PinMachineLease(ctx context.Context, machineID int64, keepNetwork bool) (string, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil && rollbackErr != sql.ErrTxDone {
+			// Log error but don't fail if transaction is already committed
+		}
+	}()
 
-	// Get all leased IPs in this range for this network
-	leasedIPs, err := r.getLeasedIPsInRange(ctx, networkID, startInt, endInt)
+	var networkID sql.NullInt64
+	err = tx.QueryRowContext(ctx, "SELECT network_id FROM machines WHERE id = ?", machineID).Scan(&networkID)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("machine with ID %d: %w", machineID, ErrNotFound)
+	}
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("failed to get machine %d: %w", machineID, err)
+	}
+	if !networkID.Valid {
+		return "", fmt.Errorf("lease for machine %d, which has no network: %w", machineID, ErrNotFound)
 	}
 
-	// Find first available IP
-	for ipInt := startInt; ipInt <= endInt; ipInt++ {
-		ip := intToIP(ipInt).String()
-		if !containsIP(leasedIPs, ip) {
-			return ip, nil
-		}
+	var ipAddress string
+	err = tx.QueryRowContext(ctx, "SELECT ip_address FROM ip_address_leases WHERE machine_id = ? AND network_id = ?",
+		machineID, networkID.Int64).Scan(&ipAddress)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("lease for machine %d on network %d: %w", machineID, networkID.Int64, ErrNotFound)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get lease for machine %d: %w", machineID, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM ip_address_leases WHERE machine_id = ? AND network_id = ?", machineID, networkID.Int64); err != nil {
+		return "", fmt.Errorf("failed to release lease for machine %d: %w", machineID, err)
+	}
+	var newNetworkID interface{}
+	if keepNetwork {
+		newNetworkID = networkID.Int64
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE machines SET ipv4 = ?, network_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		ipAddress, newNetworkID, machineID); err != nil {
+		return "", fmt.Errorf("failed to update machine %d: %w", machineID, err)
 	}
 
-	return "", nil // No available IPs in this range
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit lease pin: %w", err)
+	}
+	return ipAddress, nil
 }
 
-func (r *ipLeaseRepositoryImpl) getLeasedIPsInRange(ctx context.Context, networkID int64, startInt, endInt uint32) ([]string, error) {
-	// Get IPs from leases
-	leaseQuery := `
-		SELECT ip_address FROM ip_address_leases
-		WHERE network_id = ?`
+// freeIPs returns up to limit addresses from the network's DHCP ranges, in range
+// order, that no lease, machine or reservation holds. Each carries its range's
+// lease time.
+func freeIPs(ctx context.Context, q queryer, networkID int64, limit int) ([]domain.IPAddressLease, error) {
+	space, err := loadFreeSpace(ctx, q, networkID)
+	if err != nil {
+		return nil, err
+	}
+	var free []domain.IPAddressLease
+	space.walk(func(ip, leaseTime string) bool {
+		free = append(free, domain.IPAddressLease{NetworkID: networkID, IPAddress: ip, LeaseTime: leaseTime})
+		return len(free) < limit
+	})
+	return free, nil
+}
 
-	leaseRows, err := r.db.QueryContext(ctx, leaseQuery, networkID)
+// freeSpace is a network's DHCP ranges together with the addresses taken in it
+type freeSpace struct {
+	used   map[string]bool
+	ranges []domain.DHCPRange // ordered by start address
+}
+
+// loadFreeSpace reads the network's DHCP ranges and the addresses already taken
+// in it, by leases, reservations or by any machine.
+func loadFreeSpace(ctx context.Context, q queryer, networkID int64) (freeSpace, error) {
+	space := freeSpace{used: make(map[string]bool)}
+	rows, err := q.QueryContext(ctx, `
+		SELECT ip_address FROM ip_address_leases WHERE network_id = ?1
+		UNION
+		SELECT ip_address FROM ip_reservations WHERE network_id = ?1
+		UNION
+		SELECT ipv4 FROM machines WHERE ipv4 != ''`, networkID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get leased IPs: %w", err)
+		return freeSpace{}, fmt.Errorf("failed to get used IPs: %w", err)
 	}
-	defer leaseRows.Close()
-
-	var leasedIPs []string
-	for leaseRows.Next() {
+	for rows.Next() {
 		var ip string
-		if err := leaseRows.Scan(&ip); err != nil {
-			return nil, fmt.Errorf("failed to scan leased IP: %w", err)
+		if err := rows.Scan(&ip); err != nil {
+			rows.Close()
+			return freeSpace{}, fmt.Errorf("failed to scan used IP: %w", err)
 		}
+		space.used[ip] = true
+	}
+	rows.Close()
+
+	rangeRows, err := q.QueryContext(ctx, "SELECT start_ip, end_ip, lease_time FROM dhcp_ranges WHERE network_id = ? ORDER BY start_ip", networkID)
+	if err != nil {
+		return freeSpace{}, fmt.Errorf("failed to get DHCP ranges: %w", err)
+	}
+	for rangeRows.Next() {
+		var d domain.DHCPRange
+		if err := rangeRows.Scan(&d.StartIP, &d.EndIP, &d.LeaseTime); err != nil {
+			rangeRows.Close()
+			return freeSpace{}, fmt.Errorf("failed to scan DHCP range: %w", err)
+		}
+		space.ranges = append(space.ranges, d)
+	}
+	rangeRows.Close()
+	return space, nil
+}
 
-		ipInt := ipToInt(net.ParseIP(ip))
-		if ipInt >= startInt && ipInt <= endInt {
-			leasedIPs = append(leasedIPs, ip)
+// walk calls fn with each free address and its range's lease time, in range
+// order, until fn returns false. An address covered by several ranges is
+// visited once. It allocates nothing per address, so it can count or index
+// into a large range without building a list of it.
+func (s freeSpace) walk(fn func(ip, leaseTime string) bool) {
+	var next uint32 // first address not yet visited by an earlier range
+	visited := false
+	for _, d := range s.ranges {
+		start, end := net.ParseIP(d.StartIP), net.ParseIP(d.EndIP)
+		if start == nil || end == nil || start.To4() == nil || end.To4() == nil {
+			continue
+		}
+		from, to := ipToInt(start), ipToInt(end)
+		if visited && from < next {
+			from = next
+		}
+		for ipInt := from; ipInt <= to; ipInt++ {
+			ip := intToIP(ipInt).String()
+			if !s.used[ip] && !fn(ip, d.LeaseTime) {
+				return
+			}
+		}
+		if !visited || to+1 > next {
+			next, visited = to+1, true
 		}
 	}
+}
+
+// IsIPAddressAvailable checks if an IP address is available for leasing
+func (r *ipLeaseRepositoryImpl) IsIPAddressAvailable(ctx context.Context, networkID int64, ipAddress string) (bool, error) {
+	return r.isIPAddressAvailableFor(ctx, networkID, ipAddress, 0)
+}
+
+// isIPAddressAvailableFor is IsIPAddressAvailable ignoring machineID's own ipv4,
+// so a machine can take a lease on the address it already holds statically.
+func (r *ipLeaseRepositoryImpl) isIPAddressAvailableFor(ctx context.Context, networkID int64, ipAddress string, machineID int64) (bool, error) {
+	// Check if IP is already leased or reserved
+	leaseQuery := `
+		SELECT (SELECT COUNT(*) FROM ip_address_leases WHERE network_id = ?1 AND ip_address = ?2)
+		     + (SELECT COUNT(*) FROM ip_reservations WHERE network_id = ?1 AND ip_address = ?2)`
+
+	var leaseCount int
+	err := r.db.QueryRowContext(ctx, leaseQuery, networkID, ipAddress).Scan(&leaseCount)
+	if err != nil {
+		return false, fmt.Errorf("failed to check IP lease availability: %w", err)
+	}
 
-	// Also get IPs from machines that have network_id set (dynamically assigned IPs)
+	// Check if IP is already assigned to a machine
 	machineQuery := `
-		SELECT ipv4 FROM machines
-		WHERE ipv4 != ''`
+		SELECT COUNT(*) FROM machines
+		WHERE ipv4 = ? AND id != ?`
 
-	machineRows, err := r.db.QueryContext(ctx, machineQuery)
+	var machineCount int
+	err = r.db.QueryRowContext(ctx, machineQuery, ipAddress, machineID).Scan(&machineCount)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get machine IPs: %w", err)
+		return false, fmt.Errorf("failed to check machine IP availability: %w", err)
 	}
-	defer machineRows.Close()
 
-	for machineRows.Next() {
-		var ip string
-		if err := machineRows.Scan(&ip); err != nil {
-			return nil, fmt.Errorf("failed to scan machine IP: %w", err)
-		}
+	return leaseCount == 0 && machineCount == 0, nil
+}
 
-		ipInt := ipToInt(net.ParseIP(ip))
-		if ipInt >= startInt && ipInt <= endInt {
-			leasedIPs = append(leasedIPs, ip)
-		}
+// Helper methods
+
+// queryInt64s runs a query returning a single integer column within a transaction
+func queryInt64s(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) ([]int64, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	return leasedIPs, nil
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
 }
 
 // IP conversion utilities
@@ -475,12 +791,3 @@ func ipToInt(ip net.IP) uint32 {
 func intToIP(ipInt uint32) net.IP {
 	return net.IPv4(byte(ipInt>>24), byte(ipInt>>16), byte(ipInt>>8), byte(ipInt))
 }
-
-func containsIP(ips []string, target string) bool {
-	for _, ip := range ips {
-		if ip == target {
-			return true
-		}
-	}
-	return false
-}
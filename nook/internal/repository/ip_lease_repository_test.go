@@ -2,6 +2,11 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
 	"testing"
 
 	"github.com/jbweber/homelab/nook/internal/domain"
@@ -337,6 +342,172 @@ func TestIPLeaseRepository_AllocateIPAddress(t *testing.T) {
 	}
 }
 
+func TestIPLeaseRepository_AllocateIPAddress_Concurrent(t *testing.T) {
+	// A file database: shared-cache memory databases use table locks, not the
+	// file locking that BEGIN IMMEDIATE serializes on
+	db := testutil.SetupFileTestDBWithMigrations(t)
+	ctx := context.Background()
+
+	network, err := NewNetworkRepository(db).Save(ctx, domain.Network{Name: "test-net", Bridge: "br0", Subnet: "192.168.1.0/24"})
+	if err != nil {
+		t.Fatalf("Failed to create network: %v", err)
+	}
+	const n = 10
+	if _, err := NewDHCPRangeRepository(db).Save(ctx, domain.DHCPRange{NetworkID: network.ID, StartIP: "192.168.1.100", EndIP: "192.168.1.109", LeaseTime: "24h"}); err != nil {
+		t.Fatalf("Failed to create DHCP range: %v", err)
+	}
+	machineRepo := NewMachineRepository(db)
+	machineIDs := make([]int64, n)
+	for i := range machineIDs {
+		name := "machine-" + strconv.Itoa(i)
+		m, err := machineRepo.Save(ctx, domain.Machine{Name: name, Hostname: name, IPv4: "10.0.0." + strconv.Itoa(i+1), NetworkID: &network.ID})
+		if err != nil {
+			t.Fatalf("Failed to create machine: %v", err)
+		}
+		machineIDs[i] = m.ID
+	}
+
+	repo := NewIPLeaseRepository(db)
+	ips := make([]string, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i, machineID := range machineIDs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lease, err := repo.AllocateIPAddress(ctx, machineID, network.ID)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			ips[i] = lease.IPAddress
+		}()
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for i, ip := range ips {
+		if errs[i] != nil {
+			t.Fatalf("Allocation %d failed: %v", i, errs[i])
+		}
+		if seen[ip] {
+			t.Errorf("IP %s allocated twice", ip)
+		}
+		seen[ip] = true
+	}
+	if len(seen) != n {
+		t.Errorf("Expected %d distinct IPs, got %d", n, len(seen))
+	}
+
+	if _, err := repo.AllocateIPAddress(ctx, machineIDs[0], network.ID); err == nil {
+		t.Error("Expected an error allocating from a full range")
+	}
+}
+
+func TestIPLeaseRepository_AllocateIPAddress_Strategy(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestIPLeaseRepository_AllocateIPAddress_Strategy")
+	defer cleanup()
+
+	ctx := context.Background()
+	networkRepo := NewNetworkRepository(db)
+	machineRepo := NewMachineRepository(db)
+	dhcpRepo := NewDHCPRangeRepository(db)
+	repo := NewIPLeaseRepository(db)
+
+	newNetwork := func(name, prefix, strategy string) domain.Network {
+		n, err := networkRepo.Save(ctx, domain.Network{Name: name, Bridge: name, Subnet: prefix + ".0/24", AllocationStrategy: strategy})
+		if err != nil {
+			t.Fatalf("Failed to create network: %v", err)
+		}
+		if _, err := dhcpRepo.Save(ctx, domain.DHCPRange{NetworkID: n.ID, StartIP: prefix + ".100", EndIP: prefix + ".119", LeaseTime: "24h"}); err != nil {
+			t.Fatalf("Failed to create DHCP range: %v", err)
+		}
+		return n
+	}
+	machines := 0
+	newMachine := func(name string, networkID int64) domain.Machine {
+		// Placeholder addresses sit outside the pools so they never collide with allocations
+		machines++
+		m, err := machineRepo.Save(ctx, domain.Machine{Name: name, Hostname: name, IPv4: "10.99.0." + strconv.Itoa(machines), NetworkID: &networkID})
+		if err != nil {
+			t.Fatalf("Failed to create machine: %v", err)
+		}
+		return m
+	}
+
+	// Lowest returns the smallest free address
+	lowest := newNetwork("lowest-net", "192.168.10", domain.AllocationStrategyLowest)
+	if _, err := machineRepo.Save(ctx, domain.Machine{Name: "static", Hostname: "static", IPv4: "192.168.10.100"}); err != nil {
+		t.Fatalf("Failed to create static machine: %v", err)
+	}
+	for _, want := range []string{"192.168.10.101", "192.168.10.102"} {
+		lease, err := repo.AllocateIPAddress(ctx, newMachine("lowest-"+want, lowest.ID).ID, lowest.ID)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if lease.IPAddress != want {
+			t.Errorf("Expected %s, got %s", want, lease.IPAddress)
+		}
+	}
+
+	// Random returns a free address within the range, never one already taken
+	random := newNetwork("random-net", "192.168.20", domain.AllocationStrategyRandom)
+	if _, err := machineRepo.Save(ctx, domain.Machine{Name: "static-random", Hostname: "static-random", IPv4: "192.168.20.100"}); err != nil {
+		t.Fatalf("Failed to create static machine: %v", err)
+	}
+	seen := map[string]bool{"192.168.20.100": true}
+	for i := 0; i < 19; i++ {
+		lease, err := repo.AllocateIPAddress(ctx, newMachine("random-"+strconv.Itoa(i), random.ID).ID, random.ID)
+		if err != nil {
+			t.Fatalf("Expected no error on allocation %d, got %v", i, err)
+		}
+		ip := net.ParseIP(lease.IPAddress).To4()
+		if ip == nil || ip[0] != 192 || ip[1] != 168 || ip[2] != 20 || ip[3] < 100 || ip[3] > 119 {
+			t.Errorf("Allocated %s outside 192.168.20.100-119", lease.IPAddress)
+		}
+		if seen[lease.IPAddress] {
+			t.Errorf("Allocated %s twice", lease.IPAddress)
+		}
+		seen[lease.IPAddress] = true
+	}
+
+	// The pool is now exhausted
+	if _, err := repo.AllocateIPAddress(ctx, newMachine("random-full", random.ID).ID, random.ID); err == nil {
+		t.Error("Expected error when the pool is exhausted")
+	}
+}
+
+func TestFreeSpace_Walk(t *testing.T) {
+	space := freeSpace{
+		used: map[string]bool{"10.0.0.2": true, "10.0.1.1": true},
+		ranges: []domain.DHCPRange{
+			{StartIP: "10.0.0.1", EndIP: "10.0.0.4", LeaseTime: "1h"},
+			{StartIP: "10.0.0.3", EndIP: "10.0.0.5", LeaseTime: "2h"}, // overlaps the first
+			{StartIP: "10.0.1.1", EndIP: "10.0.1.2", LeaseTime: "3h"},
+		},
+	}
+
+	var got []string
+	space.walk(func(ip, leaseTime string) bool {
+		got = append(got, ip+"/"+leaseTime)
+		return true
+	})
+	want := []string{"10.0.0.1/1h", "10.0.0.3/1h", "10.0.0.4/1h", "10.0.0.5/2h", "10.0.1.2/3h"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	// Returning false stops the walk
+	visits := 0
+	space.walk(func(string, string) bool {
+		visits++
+		return visits < 2
+	})
+	if visits != 2 {
+		t.Errorf("Expected the walk to stop after 2 addresses, got %d", visits)
+	}
+}
+
 func TestIPLeaseRepository_DeallocateIPAddress(t *testing.T) {
 	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestIPLeaseRepository_DeallocateIPAddress")
 	defer cleanup()
@@ -422,3 +593,209 @@ func TestIPLeaseRepository_IsIPAddressAvailable(t *testing.T) {
 		t.Error("Expected IP to be unavailable")
 	}
 }
+
+func TestIPLeaseRepository_MigrateNetwork(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestIPLeaseRepository_MigrateNetwork")
+	defer cleanup()
+
+	ctx := context.Background()
+	networkRepo := NewNetworkRepository(db)
+	dhcpRepo := NewDHCPRangeRepository(db)
+	machineRepo := NewMachineRepository(db)
+	repo := NewIPLeaseRepository(db)
+
+	saveNetwork := func(name, subnet, start, end string) domain.Network {
+		n, err := networkRepo.Save(ctx, domain.Network{Name: name, Bridge: "br-" + name, Subnet: subnet})
+		if err != nil {
+			t.Fatalf("Failed to save network: %v", err)
+		}
+		if _, err := dhcpRepo.Save(ctx, domain.DHCPRange{NetworkID: n.ID, StartIP: start, EndIP: end, LeaseTime: "24h"}); err != nil {
+			t.Fatalf("Failed to save DHCP range: %v", err)
+		}
+		return n
+	}
+	old := saveNetwork("old", "192.168.1.0/24", "192.168.1.100", "192.168.1.150")
+	small := saveNetwork("small", "10.0.1.0/24", "10.0.1.10", "10.0.1.10")
+	big := saveNetwork("big", "10.0.2.0/24", "10.0.2.10", "10.0.2.50")
+
+	var machineIDs []int64
+	for _, name := range []string{"a", "b"} {
+		m, err := machineRepo.Save(ctx, domain.Machine{Name: name, Hostname: name, NetworkID: &old.ID})
+		if err != nil {
+			t.Fatalf("Failed to save machine: %v", err)
+		}
+		lease, err := repo.AllocateIPAddress(ctx, m.ID, old.ID)
+		if err != nil {
+			t.Fatalf("Failed to allocate IP: %v", err)
+		}
+		m.IPv4 = lease.IPAddress
+		if _, err := machineRepo.Save(ctx, m); err != nil {
+			t.Fatalf("Failed to update machine: %v", err)
+		}
+		machineIDs = append(machineIDs, m.ID)
+	}
+
+	// One address is not enough for two machines; nothing changes
+	if _, err := repo.MigrateNetwork(ctx, old.ID, small.ID); !errors.Is(err, ErrInsufficientCapacity) {
+		t.Fatalf("Expected ErrInsufficientCapacity, got %v", err)
+	}
+	if leases, _ := repo.FindByNetworkID(ctx, small.ID); len(leases) != 0 {
+		t.Errorf("Expected no leases on the small network after rollback, got %d", len(leases))
+	}
+	if leases, _ := repo.FindByNetworkID(ctx, old.ID); len(leases) != 2 {
+		t.Errorf("Expected source leases to be kept after rollback, got %d", len(leases))
+	}
+
+	migrated, err := repo.MigrateNetwork(ctx, old.ID, big.ID)
+	if err != nil {
+		t.Fatalf("Failed to migrate network: %v", err)
+	}
+	if migrated != 2 {
+		t.Errorf("Expected 2 machines migrated, got %d", migrated)
+	}
+	if leases, _ := repo.FindByNetworkID(ctx, old.ID); len(leases) != 0 {
+		t.Errorf("Expected source leases to be released, got %d", len(leases))
+	}
+	for i, id := range machineIDs {
+		m, err := machineRepo.FindByID(ctx, id)
+		if err != nil {
+			t.Fatalf("Failed to find machine: %v", err)
+		}
+		if m.NetworkID == nil || *m.NetworkID != big.ID {
+			t.Errorf("Expected machine %d on network %d, got %v", id, big.ID, m.NetworkID)
+		}
+		expected := []string{"10.0.2.10", "10.0.2.11"}[i]
+		if m.IPv4 != expected {
+			t.Errorf("Expected machine %d to have IP %s, got %s", id, expected, m.IPv4)
+		}
+	}
+}
+
+func TestIPLeaseRepository_PinMachineLease(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestIPLeaseRepository_PinMachineLease")
+	defer cleanup()
+
+	ctx := context.Background()
+	network, err := NewNetworkRepository(db).Save(ctx, domain.Network{Name: "pin", Bridge: "br0", Subnet: "10.0.4.0/24"})
+	if err != nil {
+		t.Fatalf("Failed to save network: %v", err)
+	}
+	if _, err := NewDHCPRangeRepository(db).Save(ctx, domain.DHCPRange{NetworkID: network.ID, StartIP: "10.0.4.10", EndIP: "10.0.4.20", LeaseTime: "24h"}); err != nil {
+		t.Fatalf("Failed to save DHCP range: %v", err)
+	}
+	machineRepo := NewMachineRepository(db)
+	machine, err := machineRepo.Save(ctx, domain.Machine{Name: "m", Hostname: "m", NetworkID: &network.ID})
+	if err != nil {
+		t.Fatalf("Failed to save machine: %v", err)
+	}
+	repo := NewIPLeaseRepository(db)
+	lease, err := repo.AllocateIPAddress(ctx, machine.ID, network.ID)
+	if err != nil {
+		t.Fatalf("Failed to allocate IP: %v", err)
+	}
+
+	ip, err := repo.PinMachineLease(ctx, machine.ID, false)
+	if err != nil {
+		t.Fatalf("Failed to pin lease: %v", err)
+	}
+	if ip != lease.IPAddress {
+		t.Errorf("Expected pinned IP %s, got %s", lease.IPAddress, ip)
+	}
+	if leases, _ := repo.FindByMachineID(ctx, machine.ID); len(leases) != 0 {
+		t.Errorf("Expected the lease to be removed, got %d", len(leases))
+	}
+	pinned, err := machineRepo.FindByID(ctx, machine.ID)
+	if err != nil {
+		t.Fatalf("Failed to find machine: %v", err)
+	}
+	if pinned.IPv4 != lease.IPAddress {
+		t.Errorf("Expected machine to keep IP %s, got %s", lease.IPAddress, pinned.IPv4)
+	}
+	if pinned.NetworkID != nil {
+		t.Errorf("Expected network to be cleared, got %d", *pinned.NetworkID)
+	}
+
+	// The pinned address is no longer handed out
+	other, err := machineRepo.Save(ctx, domain.Machine{Name: "o", Hostname: "o", NetworkID: &network.ID})
+	if err != nil {
+		t.Fatalf("Failed to save machine: %v", err)
+	}
+	next, err := repo.AllocateIPAddress(ctx, other.ID, network.ID)
+	if err != nil {
+		t.Fatalf("Failed to allocate IP: %v", err)
+	}
+	if next.IPAddress == lease.IPAddress {
+		t.Errorf("Expected pinned IP %s not to be reallocated", lease.IPAddress)
+	}
+
+	if _, err := repo.PinMachineLease(ctx, machine.ID, false); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a machine without a lease, got %v", err)
+	}
+	if _, err := repo.PinMachineLease(ctx, 99999, false); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing machine, got %v", err)
+	}
+}
+
+func TestIPLeaseRepository_ReserveIPAddresses(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestIPLeaseRepository_ReserveIPAddresses")
+	defer cleanup()
+
+	ctx := context.Background()
+	network, err := NewNetworkRepository(db).Save(ctx, domain.Network{Name: "pool", Bridge: "br0", Subnet: "10.0.3.0/24"})
+	if err != nil {
+		t.Fatalf("Failed to save network: %v", err)
+	}
+	if _, err := NewDHCPRangeRepository(db).Save(ctx, domain.DHCPRange{NetworkID: network.ID, StartIP: "10.0.3.10", EndIP: "10.0.3.14", LeaseTime: "24h"}); err != nil {
+		t.Fatalf("Failed to save DHCP range: %v", err)
+	}
+	machine, err := NewMachineRepository(db).Save(ctx, domain.Machine{Name: "m", Hostname: "m", IPv4: "10.0.3.10"})
+	if err != nil {
+		t.Fatalf("Failed to save machine: %v", err)
+	}
+	repo := NewIPLeaseRepository(db)
+
+	// Three of the four free addresses, skipping the machine's
+	reserved, err := repo.ReserveIPAddresses(ctx, network.ID, 3, "batch-a")
+	if err != nil {
+		t.Fatalf("Failed to reserve: %v", err)
+	}
+	var ips []string
+	for _, res := range reserved {
+		ips = append(ips, res.IPAddress)
+		if res.Token != "batch-a" || res.NetworkID != network.ID {
+			t.Errorf("Unexpected reservation %+v", res)
+		}
+	}
+	if want := []string{"10.0.3.11", "10.0.3.12", "10.0.3.13"}; !slices.Equal(ips, want) {
+		t.Errorf("Expected %v, got %v", want, ips)
+	}
+
+	// Two more do not fit; none are reserved
+	if _, err := repo.ReserveIPAddresses(ctx, network.ID, 2, "batch-b"); !errors.Is(err, ErrInsufficientCapacity) {
+		t.Fatalf("Expected ErrInsufficientCapacity, got %v", err)
+	}
+	if _, err := repo.ReleaseIPReservations(ctx, network.ID, "batch-b"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected no batch-b reservations, got %v", err)
+	}
+
+	// Allocation skips reserved addresses
+	if available, _ := repo.IsIPAddressAvailable(ctx, network.ID, "10.0.3.11"); available {
+		t.Error("Expected reserved address to be unavailable")
+	}
+	lease, err := repo.AllocateIPAddress(ctx, machine.ID, network.ID)
+	if err != nil {
+		t.Fatalf("Failed to allocate: %v", err)
+	}
+	if lease.IPAddress != "10.0.3.14" {
+		t.Errorf("Expected allocation to skip reservations and get 10.0.3.14, got %s", lease.IPAddress)
+	}
+
+	// Releasing returns the batch to the pool
+	released, err := repo.ReleaseIPReservations(ctx, network.ID, "batch-a")
+	if err != nil || released != 3 {
+		t.Fatalf("Expected 3 released, got %d, %v", released, err)
+	}
+	if available, _ := repo.IsIPAddressAvailable(ctx, network.ID, "10.0.3.11"); !available {
+		t.Error("Expected released address to be available")
+	}
+}
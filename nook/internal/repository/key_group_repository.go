@@ -0,0 +1,339 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/jbweber/homelab/nook/internal/domain"
+)
+
+// KeyGroupRepository extends the generic Repository with key group keys and membership
+type KeyGroupRepository interface {
+	Repository[domain.KeyGroup, int64]
+
+	// Domain-specific operations
+	AddKey(ctx context.Context, groupID int64, keyText string) (domain.KeyGroupKey, error)
+	FindKeys(ctx context.Context, groupID int64) ([]domain.KeyGroupKey, error)
+	DeleteKey(ctx context.Context, groupID, keyID int64) error
+	AddMember(ctx context.Context, groupID, machineID int64) error
+	RemoveMember(ctx context.Context, groupID, machineID int64) error
+	FindMemberIDs(ctx context.Context, groupID int64) ([]int64, error)
+	FindKeysForMachine(ctx context.Context, machineID int64) ([]domain.KeyGroupKey, error)
+	FindGroupsForMachine(ctx context.Context, machineID int64) ([]domain.KeyGroup, error)
+	FindAllMemberKeys(ctx context.Context) (map[int64][]domain.KeyGroupKey, error)
+}
+
+// keyGroupRepositoryImpl implements KeyGroupRepository
+type keyGroupRepositoryImpl struct {
+	db     *sql.DB
+	sealer keyTextSealer // nil stores key text as given
+}
+
+// NewKeyGroupRepository creates a new key group repository. Group keys are
+// stored the way sshKeys stores them, so they are encrypted when it encrypts.
+func NewKeyGroupRepository(db *sql.DB, sshKeys SSHKeyRepository) KeyGroupRepository {
+	r := &keyGroupRepositoryImpl{db: db}
+	if sealer, ok := sshKeys.(keyTextSealer); ok {
+		r.sealer = sealer
+	}
+	return r
+}
+
+// Save creates a key group, or renames it when the ID is set
+func (r *keyGroupRepositoryImpl) Save(ctx context.Context, group domain.KeyGroup) (domain.KeyGroup, error) {
+	if group.Name == "" {
+		return domain.KeyGroup{}, fmt.Errorf("key group name is required: %w", ErrInvalidEntity)
+	}
+
+	var count int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM key_groups WHERE name = ? AND id != ?", group.Name, group.ID).Scan(&count)
+	if err != nil {
+		return domain.KeyGroup{}, fmt.Errorf("failed to check for duplicate key group name: %w", err)
+	}
+	if count > 0 {
+		return domain.KeyGroup{}, fmt.Errorf("key group with name '%s': %w", group.Name, ErrDuplicate)
+	}
+
+	if group.ID == 0 {
+		result, err := r.db.ExecContext(ctx, "INSERT INTO key_groups (name) VALUES (?)", group.Name)
+		if err != nil {
+			return domain.KeyGroup{}, fmt.Errorf("failed to create key group: %w", err)
+		}
+		if group.ID, err = result.LastInsertId(); err != nil {
+			return domain.KeyGroup{}, fmt.Errorf("failed to get key group ID: %w", err)
+		}
+		return group, nil
+	}
+
+	result, err := r.db.ExecContext(ctx, "UPDATE key_groups SET name = ? WHERE id = ?", group.Name, group.ID)
+	if err != nil {
+		return domain.KeyGroup{}, fmt.Errorf("failed to update key group: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return domain.KeyGroup{}, fmt.Errorf("failed to get rows affected: %w", err)
+	} else if rows == 0 {
+		return domain.KeyGroup{}, fmt.Errorf("key group %d: %w", group.ID, ErrNotFound)
+	}
+	return group, nil
+}
+
+// FindByID retrieves a key group by its ID
+func (r *keyGroupRepositoryImpl) FindByID(ctx context.Context, id int64) (domain.KeyGroup, error) {
+	var group domain.KeyGroup
+	err := r.db.QueryRowContext(ctx, "SELECT id, name FROM key_groups WHERE id = ?", id).Scan(&group.ID, &group.Name)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return domain.KeyGroup{}, fmt.Errorf("key group %d: %w", id, ErrNotFound)
+		}
+		return domain.KeyGroup{}, fmt.Errorf("failed to get key group: %w", err)
+	}
+	return group, nil
+}
+
+// FindAll retrieves all key groups ordered by name
+func (r *keyGroupRepositoryImpl) FindAll(ctx context.Context) ([]domain.KeyGroup, error) {
+	return r.queryGroups(ctx, "SELECT id, name FROM key_groups ORDER BY name")
+}
+
+// FindGroupsForMachine lists the groups a machine belongs to
+func (r *keyGroupRepositoryImpl) FindGroupsForMachine(ctx context.Context, machineID int64) ([]domain.KeyGroup, error) {
+	return r.queryGroups(ctx, `
+		SELECT g.id, g.name
+		FROM key_groups g
+		JOIN key_group_members m ON m.group_id = g.id
+		WHERE m.machine_id = ?
+		ORDER BY g.name`, machineID)
+}
+
+func (r *keyGroupRepositoryImpl) queryGroups(ctx context.Context, query string, args ...interface{}) ([]domain.KeyGroup, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list key groups: %w", err)
+	}
+	defer rows.Close()
+
+	groups := []domain.KeyGroup{}
+	for rows.Next() {
+		var group domain.KeyGroup
+		if err := rows.Scan(&group.ID, &group.Name); err != nil {
+			return nil, fmt.Errorf("failed to scan key group: %w", err)
+		}
+		groups = append(groups, group)
+	}
+	return groups, rows.Err()
+}
+
+// DeleteByID deletes a key group along with its keys and memberships
+func (r *keyGroupRepositoryImpl) DeleteByID(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM key_groups WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete key group: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("key group %d: %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// ExistsByID checks if a key group exists
+func (r *keyGroupRepositoryImpl) ExistsByID(ctx context.Context, id int64) (bool, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM key_groups WHERE id = ?", id).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to check key group existence: %w", err)
+	}
+	return count > 0, nil
+}
+
+// AddKey adds an SSH public key to a group
+func (r *keyGroupRepositoryImpl) AddKey(ctx context.Context, groupID int64, keyText string) (domain.KeyGroupKey, error) {
+	keyText = strings.TrimSpace(keyText)
+	if keyText == "" {
+		return domain.KeyGroupKey{}, fmt.Errorf("key text is required: %w", ErrInvalidEntity)
+	}
+	if err := r.requireGroup(ctx, groupID); err != nil {
+		return domain.KeyGroupKey{}, err
+	}
+
+	stored := keyText
+	if r.sealer != nil {
+		var err error
+		if stored, err = r.sealer.sealKeyText(keyText); err != nil {
+			return domain.KeyGroupKey{}, fmt.Errorf("failed to add key to group: %w", err)
+		}
+	}
+	result, err := r.db.ExecContext(ctx, "INSERT INTO key_group_keys (group_id, key_text) VALUES (?, ?)", groupID, stored)
+	if err != nil {
+		return domain.KeyGroupKey{}, fmt.Errorf("failed to add key to group: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return domain.KeyGroupKey{}, fmt.Errorf("failed to get key ID: %w", err)
+	}
+	return domain.KeyGroupKey{ID: id, GroupID: groupID, KeyText: keyText}, nil
+}
+
+// FindKeys lists the keys of a group
+func (r *keyGroupRepositoryImpl) FindKeys(ctx context.Context, groupID int64) ([]domain.KeyGroupKey, error) {
+	return r.queryKeys(ctx, "SELECT id, group_id, key_text FROM key_group_keys WHERE group_id = ? ORDER BY id", groupID)
+}
+
+// DeleteKey removes a key from a group
+func (r *keyGroupRepositoryImpl) DeleteKey(ctx context.Context, groupID, keyID int64) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM key_group_keys WHERE id = ? AND group_id = ?", keyID, groupID)
+	if err != nil {
+		return fmt.Errorf("failed to delete group key: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("key %d in group %d: %w", keyID, groupID, ErrNotFound)
+	}
+	return nil
+}
+
+// AddMember adds a machine to a group. Adding an existing member is a no-op.
+func (r *keyGroupRepositoryImpl) AddMember(ctx context.Context, groupID, machineID int64) error {
+	if err := r.requireGroup(ctx, groupID); err != nil {
+		return err
+	}
+	var count int
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM machines WHERE id = ?", machineID).Scan(&count); err != nil {
+		return fmt.Errorf("failed to check machine existence: %w", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("machine %d: %w", machineID, ErrNotFound)
+	}
+
+	_, err := r.db.ExecContext(ctx, "INSERT OR IGNORE INTO key_group_members (group_id, machine_id) VALUES (?, ?)", groupID, machineID)
+	if err != nil {
+		return fmt.Errorf("failed to add group member: %w", err)
+	}
+	return nil
+}
+
+// RemoveMember removes a machine from a group
+func (r *keyGroupRepositoryImpl) RemoveMember(ctx context.Context, groupID, machineID int64) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM key_group_members WHERE group_id = ? AND machine_id = ?", groupID, machineID)
+	if err != nil {
+		return fmt.Errorf("failed to remove group member: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("machine %d in group %d: %w", machineID, groupID, ErrNotFound)
+	}
+	return nil
+}
+
+// FindMemberIDs lists the IDs of the machines in a group
+func (r *keyGroupRepositoryImpl) FindMemberIDs(ctx context.Context, groupID int64) ([]int64, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT machine_id FROM key_group_members WHERE group_id = ? ORDER BY machine_id", groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list group members: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan group member: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// FindKeysForMachine lists the keys of every group the machine belongs to
+func (r *keyGroupRepositoryImpl) FindKeysForMachine(ctx context.Context, machineID int64) ([]domain.KeyGroupKey, error) {
+	return r.queryKeys(ctx, `
+		SELECT k.id, k.group_id, k.key_text
+		FROM key_group_keys k
+		JOIN key_group_members m ON m.group_id = k.group_id
+		WHERE m.machine_id = ?
+		ORDER BY k.group_id, k.id`, machineID)
+}
+
+// FindAllMemberKeys returns the group keys of every machine in at least one group,
+// keyed by machine ID, in a single query.
+func (r *keyGroupRepositoryImpl) FindAllMemberKeys(ctx context.Context) (map[int64][]domain.KeyGroupKey, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT m.machine_id, k.id, k.group_id, k.key_text
+		FROM key_group_keys k
+		JOIN key_group_members m ON m.group_id = k.group_id
+		ORDER BY m.machine_id, k.group_id, k.id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list member keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := make(map[int64][]domain.KeyGroupKey)
+	for rows.Next() {
+		var machineID int64
+		var key domain.KeyGroupKey
+		if err := rows.Scan(&machineID, &key.ID, &key.GroupID, &key.KeyText); err != nil {
+			return nil, fmt.Errorf("failed to scan member key: %w", err)
+		}
+		if err := r.openKey(&key); err != nil {
+			return nil, err
+		}
+		keys[machineID] = append(keys[machineID], key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *keyGroupRepositoryImpl) queryKeys(ctx context.Context, query string, arg int64) ([]domain.KeyGroupKey, error) {
+	rows, err := r.db.QueryContext(ctx, query, arg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list group keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []domain.KeyGroupKey{}
+	for rows.Next() {
+		var key domain.KeyGroupKey
+		if err := rows.Scan(&key.ID, &key.GroupID, &key.KeyText); err != nil {
+			return nil, fmt.Errorf("failed to scan group key: %w", err)
+		}
+		if err := r.openKey(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// openKey replaces the stored key text of key with the plaintext
+func (r *keyGroupRepositoryImpl) openKey(key *domain.KeyGroupKey) error {
+	if r.sealer == nil {
+		return nil
+	}
+	keyText, err := r.sealer.openKeyText(key.KeyText)
+	if err != nil {
+		return fmt.Errorf("group key %d: %w", key.ID, err)
+	}
+	key.KeyText = keyText
+	return nil
+}
+
+func (r *keyGroupRepositoryImpl) requireGroup(ctx context.Context, groupID int64) error {
+	exists, err := r.ExistsByID(ctx, groupID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("key group %d: %w", groupID, ErrNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jbweber/homelab/nook/internal/domain"
+	"github.com/jbweber/homelab/nook/internal/testutil"
+)
+
+func TestKeyGroupRepository_MembershipAndKeys(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestKeyGroupRepository_MembershipAndKeys")
+	defer cleanup()
+
+	repo := NewKeyGroupRepository(db, NewSSHKeyRepository(db))
+	machineRepo := NewMachineRepository(db)
+	ctx := context.Background()
+
+	machine, err := machineRepo.Save(ctx, domain.Machine{Name: "member", Hostname: "member", IPv4: "192.168.1.10"})
+	if err != nil {
+		t.Fatalf("Failed to save machine: %v", err)
+	}
+
+	group, err := repo.Save(ctx, domain.KeyGroup{Name: "ops"})
+	if err != nil {
+		t.Fatalf("Failed to save key group: %v", err)
+	}
+	if _, err := repo.Save(ctx, domain.KeyGroup{Name: "ops"}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Expected ErrDuplicate for repeated name, got %v", err)
+	}
+
+	if _, err := repo.AddKey(ctx, group.ID, "ssh-ed25519 AAAA ops@lab"); err != nil {
+		t.Fatalf("Failed to add key: %v", err)
+	}
+	if _, err := repo.AddKey(ctx, 9999, "ssh-ed25519 AAAA ops@lab"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for missing group, got %v", err)
+	}
+
+	// No keys until the machine joins the group
+	keys, err := repo.FindKeysForMachine(ctx, machine.ID)
+	if err != nil {
+		t.Fatalf("Failed to find keys for machine: %v", err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("Expected no keys before joining, got %d", len(keys))
+	}
+
+	if err := repo.AddMember(ctx, group.ID, machine.ID); err != nil {
+		t.Fatalf("Failed to add member: %v", err)
+	}
+	// Adding twice is a no-op
+	if err := repo.AddMember(ctx, group.ID, machine.ID); err != nil {
+		t.Fatalf("Failed to re-add member: %v", err)
+	}
+	if err := repo.AddMember(ctx, group.ID, 9999); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for missing machine, got %v", err)
+	}
+
+	groups, err := repo.FindGroupsForMachine(ctx, machine.ID)
+	if err != nil {
+		t.Fatalf("Failed to find groups for machine: %v", err)
+	}
+	if len(groups) != 1 || groups[0].Name != "ops" {
+		t.Errorf("Expected membership in ops, got %+v", groups)
+	}
+
+	members, err := repo.FindMemberIDs(ctx, group.ID)
+	if err != nil {
+		t.Fatalf("Failed to find members: %v", err)
+	}
+	if len(members) != 1 || members[0] != machine.ID {
+		t.Errorf("Expected members [%d], got %v", machine.ID, members)
+	}
+
+	keys, err = repo.FindKeysForMachine(ctx, machine.ID)
+	if err != nil {
+		t.Fatalf("Failed to find keys for machine: %v", err)
+	}
+	if len(keys) != 1 || keys[0].KeyText != "ssh-ed25519 AAAA ops@lab" {
+		t.Errorf("Expected the group key, got %+v", keys)
+	}
+	byMachine, err := repo.FindAllMemberKeys(ctx)
+	if err != nil {
+		t.Fatalf("Failed to find member keys: %v", err)
+	}
+	if len(byMachine) != 1 || len(byMachine[machine.ID]) != 1 {
+		t.Errorf("Expected one key for machine %d, got %+v", machine.ID, byMachine)
+	}
+
+	if err := repo.RemoveMember(ctx, group.ID, machine.ID); err != nil {
+		t.Fatalf("Failed to remove member: %v", err)
+	}
+	if err := repo.RemoveMember(ctx, group.ID, machine.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound removing a non-member, got %v", err)
+	}
+
+	// Deleting the group removes its keys
+	if err := repo.DeleteByID(ctx, group.ID); err != nil {
+		t.Fatalf("Failed to delete key group: %v", err)
+	}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM key_group_keys").Scan(&count); err != nil {
+		t.Fatalf("Failed to count keys: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected group keys to be deleted with the group, got %d", count)
+	}
+}
+
+func TestKeyGroupRepository_Encrypted(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestKeyGroupRepository_Encrypted")
+	defer cleanup()
+
+	sshKeys, err := NewEncryptedSSHKeyRepository(db, []byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("Failed to create encrypted SSH key repository: %v", err)
+	}
+	repo := NewKeyGroupRepository(db, sshKeys)
+	ctx := context.Background()
+
+	machine, err := NewMachineRepository(db).Save(ctx, domain.Machine{Name: "member", Hostname: "member", IPv4: "192.168.1.10"})
+	if err != nil {
+		t.Fatalf("Failed to save machine: %v", err)
+	}
+	group, err := repo.Save(ctx, domain.KeyGroup{Name: "ops"})
+	if err != nil {
+		t.Fatalf("Failed to save key group: %v", err)
+	}
+	if err := repo.AddMember(ctx, group.ID, machine.ID); err != nil {
+		t.Fatalf("Failed to add member: %v", err)
+	}
+
+	keyText := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIHHWRsRoeU3xJXRngvR6Eavcr4HtOIkitq6kLNDWS8Z5 ops@lab"
+	added, err := repo.AddKey(ctx, group.ID, keyText)
+	if err != nil {
+		t.Fatalf("Failed to add key: %v", err)
+	}
+	if added.KeyText != keyText {
+		t.Errorf("Expected the added key to be returned in plaintext, got %q", added.KeyText)
+	}
+
+	// The stored bytes differ from the plaintext
+	var stored string
+	if err := db.QueryRow("SELECT key_text FROM key_group_keys WHERE id = ?", added.ID).Scan(&stored); err != nil {
+		t.Fatalf("Failed to read stored key: %v", err)
+	}
+	if stored == keyText || strings.Contains(stored, "ops@lab") {
+		t.Errorf("Expected the key to be encrypted at rest, got %q", stored)
+	}
+
+	// Every read path returns the original key
+	keys, err := repo.FindKeys(ctx, group.ID)
+	if err != nil || len(keys) != 1 || keys[0].KeyText != keyText {
+		t.Errorf("FindKeys: expected the plaintext key, got %+v (err %v)", keys, err)
+	}
+	keys, err = repo.FindKeysForMachine(ctx, machine.ID)
+	if err != nil || len(keys) != 1 || keys[0].KeyText != keyText {
+		t.Errorf("FindKeysForMachine: expected the plaintext key, got %+v (err %v)", keys, err)
+	}
+	byMachine, err := repo.FindAllMemberKeys(ctx)
+	if err != nil || len(byMachine[machine.ID]) != 1 || byMachine[machine.ID][0].KeyText != keyText {
+		t.Errorf("FindAllMemberKeys: expected the plaintext key, got %+v (err %v)", byMachine, err)
+	}
+}
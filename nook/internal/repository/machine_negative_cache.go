@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jbweber/homelab/nook/internal/domain"
+)
+
+// maxNegativeCacheEntries bounds the miss cache so a flood of distinct unknown
+// addresses cannot grow it without limit.
+const maxNegativeCacheEntries = 4096
+
+// NegativeCachingMachineRepository wraps a MachineRepository and remembers
+// FindByIPv4 and FindByIPv6 misses for a TTL, so repeated metadata requests
+// from an unknown address skip the database. Any Save clears the cache, since a created or
+// updated machine may now own a cached address.
+type NegativeCachingMachineRepository struct {
+	MachineRepository
+	ttl time.Duration
+	now func() time.Time
+
+	mu     sync.Mutex
+	misses map[string]time.Time // Address -> expiry
+}
+
+// NewNegativeCachingMachineRepository wraps repo with a miss cache of the given TTL
+func NewNegativeCachingMachineRepository(repo MachineRepository, ttl time.Duration) *NegativeCachingMachineRepository {
+	return &NegativeCachingMachineRepository{
+		MachineRepository: repo,
+		ttl:               ttl,
+		now:               time.Now,
+		misses:            make(map[string]time.Time),
+	}
+}
+
+// FindByIPv4 answers ErrNotFound from the cache while a recent miss is fresh
+func (r *NegativeCachingMachineRepository) FindByIPv4(ctx context.Context, ipv4 string) (domain.Machine, error) {
+	if r.cachedMiss(ipv4) {
+		return domain.Machine{}, fmt.Errorf("machine with IPv4 %s: %w", ipv4, ErrNotFound)
+	}
+	m, err := r.MachineRepository.FindByIPv4(ctx, ipv4)
+	if errors.Is(err, ErrNotFound) {
+		r.recordMiss(ipv4)
+	}
+	return m, err
+}
+
+// FindByIPv6 answers ErrNotFound from the cache while a recent miss is fresh
+func (r *NegativeCachingMachineRepository) FindByIPv6(ctx context.Context, ipv6 string) (domain.Machine, error) {
+	if r.cachedMiss(ipv6) {
+		return domain.Machine{}, fmt.Errorf("machine with IPv6 %s: %w", ipv6, ErrNotFound)
+	}
+	m, err := r.MachineRepository.FindByIPv6(ctx, ipv6)
+	if errors.Is(err, ErrNotFound) {
+		r.recordMiss(ipv6)
+	}
+	return m, err
+}
+
+// Save saves the machine and clears all cached misses
+func (r *NegativeCachingMachineRepository) Save(ctx context.Context, m domain.Machine) (domain.Machine, error) {
+	saved, err := r.MachineRepository.Save(ctx, m)
+	r.Invalidate()
+	return saved, err
+}
+
+// CreateMachines creates the machines and clears all cached misses
+func (r *NegativeCachingMachineRepository) CreateMachines(ctx context.Context, machines []domain.Machine) ([]domain.Machine, error) {
+	created, err := r.MachineRepository.CreateMachines(ctx, machines)
+	r.Invalidate()
+	return created, err
+}
+
+// Invalidate drops every cached miss. Callers that change machine addresses
+// without going through Save use it to avoid serving stale misses.
+func (r *NegativeCachingMachineRepository) Invalidate() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	clear(r.misses)
+}
+
+func (r *NegativeCachingMachineRepository) cachedMiss(addr string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	expiry, ok := r.misses[addr]
+	if !ok {
+		return false
+	}
+	if !r.now().Before(expiry) {
+		delete(r.misses, addr)
+		return false
+	}
+	return true
+}
+
+func (r *NegativeCachingMachineRepository) recordMiss(addr string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	if len(r.misses) >= maxNegativeCacheEntries {
+		for ip, expiry := range r.misses {
+			if !now.Before(expiry) {
+				delete(r.misses, ip)
+			}
+		}
+		if len(r.misses) >= maxNegativeCacheEntries {
+			clear(r.misses)
+		}
+	}
+	r.misses[addr] = now.Add(r.ttl)
+}
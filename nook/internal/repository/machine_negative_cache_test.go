@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jbweber/homelab/nook/internal/domain"
+)
+
+// countingMachineRepository counts FindByIPv4 calls reaching the wrapped repository
+type countingMachineRepository struct {
+	MachineRepository
+	lookups int
+}
+
+func (r *countingMachineRepository) FindByIPv4(ctx context.Context, ipv4 string) (domain.Machine, error) {
+	r.lookups++
+	return r.MachineRepository.FindByIPv4(ctx, ipv4)
+}
+
+func TestNegativeCachingMachineRepository(t *testing.T) {
+	db, cleanup := setupTestDBWithMigrations(t, "TestNegativeCachingMachineRepository")
+	defer cleanup()
+
+	counting := &countingMachineRepository{MachineRepository: NewMachineRepository(db)}
+	repo := NewNegativeCachingMachineRepository(counting, time.Minute)
+	now := time.Now()
+	repo.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	// Repeated misses for the same unknown IP only reach the store once
+	for range 3 {
+		_, err := repo.FindByIPv4(ctx, "192.168.1.50")
+		assert.ErrorIs(t, err, ErrNotFound)
+	}
+	assert.Equal(t, 1, counting.lookups)
+
+	// The miss expires after the TTL
+	now = now.Add(time.Minute)
+	_, err := repo.FindByIPv4(ctx, "192.168.1.50")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, 2, counting.lookups)
+
+	// Creating a machine for the IP invalidates the cached miss
+	saved, err := repo.Save(ctx, domain.Machine{Name: "late", Hostname: "late", IPv4: "192.168.1.50"})
+	require.NoError(t, err)
+	found, err := repo.FindByIPv4(ctx, "192.168.1.50")
+	require.NoError(t, err)
+	assert.Equal(t, saved.ID, found.ID)
+	assert.Equal(t, 3, counting.lookups)
+
+	// Hits are never cached
+	_, err = repo.FindByIPv4(ctx, "192.168.1.50")
+	require.NoError(t, err)
+	assert.Equal(t, 4, counting.lookups)
+}
+
+func TestNegativeCachingMachineRepository_UpdateInvalidates(t *testing.T) {
+	db, cleanup := setupTestDBWithMigrations(t, "TestNegativeCachingMachineRepository_UpdateInvalidates")
+	defer cleanup()
+
+	repo := NewNegativeCachingMachineRepository(NewMachineRepository(db), time.Hour)
+	ctx := context.Background()
+
+	saved, err := repo.Save(ctx, domain.Machine{Name: "mover", Hostname: "mover", IPv4: "192.168.1.60"})
+	require.NoError(t, err)
+	_, err = repo.FindByIPv4(ctx, "192.168.1.61")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	saved.IPv4 = "192.168.1.61"
+	_, err = repo.Save(ctx, saved)
+	require.NoError(t, err)
+
+	found, err := repo.FindByIPv4(ctx, "192.168.1.61")
+	require.NoError(t, err)
+	assert.Equal(t, saved.ID, found.ID)
+}
+
+func TestNegativeCachingMachineRepository_Invalidate(t *testing.T) {
+	db, cleanup := setupTestDBWithMigrations(t, "TestNegativeCachingMachineRepository_Invalidate")
+	defer cleanup()
+
+	plain := NewMachineRepository(db)
+	var repo MachineRepository = NewNegativeCachingMachineRepository(plain, time.Hour)
+	ctx := context.Background()
+
+	_, err := repo.FindByIPv4(ctx, "192.168.1.70")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// A write that bypasses the cache leaves the miss in place until Invalidate
+	saved, err := plain.Save(ctx, domain.Machine{Name: "bypass", Hostname: "bypass", IPv4: "192.168.1.70"})
+	require.NoError(t, err)
+	_, err = repo.FindByIPv4(ctx, "192.168.1.70")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	repo.Invalidate()
+	found, err := repo.FindByIPv4(ctx, "192.168.1.70")
+	require.NoError(t, err)
+	assert.Equal(t, saved.ID, found.ID)
+
+	// The plain repository caches nothing, so Invalidate is a no-op
+	plain.Invalidate()
+}
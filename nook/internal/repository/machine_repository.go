@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 
 	"github.com/jbweber/homelab/nook/internal/domain"
@@ -13,6 +14,16 @@ type MachineRepository interface {
 	Repository[domain.Machine, int64]
 	FindByName(ctx context.Context, name string) (domain.Machine, error)
 	FindByIPv4(ctx context.Context, ipv4 string) (domain.Machine, error)
+	FindByIPv6(ctx context.Context, ipv6 string) (domain.Machine, error)
+	FindAllPaged(ctx context.Context, limit, offset int) ([]domain.Machine, error)
+	FindAllAfterID(ctx context.Context, afterID int64, limit int) ([]domain.Machine, error)
+	Count(ctx context.Context) (int, error)
+	FindByNetworkID(ctx context.Context, networkID int64) ([]domain.Machine, error)
+	CreateMachines(ctx context.Context, machines []domain.Machine) ([]domain.Machine, error)
+	SetMetadataEnabled(ctx context.Context, id int64, enabled bool) error
+	// Invalidate drops any cached lookups. Writers that change machine
+	// addresses without going through Save call it afterwards.
+	Invalidate()
 }
 
 // machineRepositoryImpl implements MachineRepository
@@ -52,16 +63,20 @@ func (r *machineRepositoryImpl) createMachine(m domain.Machine) (domain.Machine,
 	}
 
 	var res sql.Result
-	var err error
+
+	runCmd, err := encodeRunCmd(m.RunCmd)
+	if err != nil {
+		return domain.Machine{}, err
+	}
 
 	if m.NetworkID != nil {
 		// Insert with network_id
-		res, err = r.db.Exec("INSERT INTO machines (name, hostname, ipv4, network_id) VALUES (?, ?, ?, ?)",
-			m.Name, m.Hostname, m.IPv4, m.NetworkID)
+		res, err = r.db.Exec("INSERT INTO machines (name, hostname, ipv4, ipv6, network_id, availability_zone, mtu, runcmd, user_data, vendor_data) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			m.Name, m.Hostname, m.IPv4, m.IPv6, m.NetworkID, m.AvailabilityZone, m.MTU, runCmd, m.UserData, m.VendorData)
 	} else {
 		// Insert without network_id
-		res, err = r.db.Exec("INSERT INTO machines (name, hostname, ipv4) VALUES (?, ?, ?)",
-			m.Name, m.Hostname, m.IPv4)
+		res, err = r.db.Exec("INSERT INTO machines (name, hostname, ipv4, ipv6, availability_zone, mtu, runcmd, user_data, vendor_data) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			m.Name, m.Hostname, m.IPv4, m.IPv6, m.AvailabilityZone, m.MTU, runCmd, m.UserData, m.VendorData)
 	}
 
 	if err != nil {
@@ -75,6 +90,104 @@ func (r *machineRepositoryImpl) createMachine(m domain.Machine) (domain.Machine,
 	return m, nil
 }
 
+// CreateMachines inserts machines in one transaction, so either all are created
+// or none are. A machine with a network and no IPv4 is leased the network's next
+// free address in range order. A failure is a *BatchItemError wrapping
+// ErrInvalidEntity, ErrDuplicate, ErrInsufficientCapacity or a database error.
+func (r *machineRepositoryImpl) CreateMachines(ctx context.Context, machines []domain.Machine) ([]domain.Machine, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil && rollbackErr != sql.ErrTxDone {
+			// Log error but don't fail if transaction is already committed
+		}
+	}()
+
+	created := make([]domain.Machine, 0, len(machines))
+	for i, m := range machines {
+		saved, err := createMachineTx(ctx, tx, m)
+		if err != nil {
+			return nil, &BatchItemError{Index: i, Err: err}
+		}
+		created = append(created, saved)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit machine batch: %w", err)
+	}
+	return created, nil
+}
+
+// createMachineTx inserts one machine of a batch, leasing it an address first
+// when it has a network but no IPv4
+func createMachineTx(ctx context.Context, tx *sql.Tx, m domain.Machine) (domain.Machine, error) {
+	if m.Name == "" || m.Hostname == "" {
+		return domain.Machine{}, fmt.Errorf("machine name and hostname are required: %w", ErrInvalidEntity)
+	}
+	if m.IPv4 == "" && m.NetworkID == nil {
+		return domain.Machine{}, fmt.Errorf("machine IPv4 is required when no network_id is provided: %w", ErrInvalidEntity)
+	}
+
+	var count int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM machines WHERE name = ?", m.Name).Scan(&count); err != nil {
+		return domain.Machine{}, fmt.Errorf("failed to check machine name: %w", err)
+	}
+	if count > 0 {
+		return domain.Machine{}, fmt.Errorf("machine with name '%s': %w", m.Name, ErrDuplicate)
+	}
+
+	var lease *domain.IPAddressLease
+	if m.IPv4 == "" {
+		free, err := freeIPs(ctx, tx, *m.NetworkID, 1)
+		if err != nil {
+			return domain.Machine{}, err
+		}
+		if len(free) == 0 {
+			return domain.Machine{}, fmt.Errorf("no available IP addresses in network %d: %w", *m.NetworkID, ErrInsufficientCapacity)
+		}
+		lease = &free[0]
+		m.IPv4 = lease.IPAddress
+	} else {
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM machines WHERE ipv4 = ?", m.IPv4).Scan(&count); err != nil {
+			return domain.Machine{}, fmt.Errorf("failed to check machine IPv4: %w", err)
+		}
+		if count > 0 {
+			return domain.Machine{}, fmt.Errorf("machine with IPv4 %s: %w", m.IPv4, ErrDuplicate)
+		}
+	}
+	if m.IPv6 != "" {
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM machines WHERE ipv6 = ?", m.IPv6).Scan(&count); err != nil {
+			return domain.Machine{}, fmt.Errorf("failed to check machine IPv6: %w", err)
+		}
+		if count > 0 {
+			return domain.Machine{}, fmt.Errorf("machine with IPv6 %s: %w", m.IPv6, ErrDuplicate)
+		}
+	}
+
+	runCmd, err := encodeRunCmd(m.RunCmd)
+	if err != nil {
+		return domain.Machine{}, err
+	}
+	res, err := tx.ExecContext(ctx, "INSERT INTO machines (name, hostname, ipv4, ipv6, network_id, availability_zone, mtu, runcmd, user_data, vendor_data) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		m.Name, m.Hostname, m.IPv4, m.IPv6, m.NetworkID, m.AvailabilityZone, m.MTU, runCmd, m.UserData, m.VendorData)
+	if err != nil {
+		return domain.Machine{}, fmt.Errorf("failed to create machine: %w", err)
+	}
+	if m.ID, err = res.LastInsertId(); err != nil {
+		return domain.Machine{}, fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+
+	if lease != nil {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO ip_address_leases (machine_id, network_id, ip_address, lease_time) VALUES (?, ?, ?, ?)",
+			m.ID, *m.NetworkID, lease.IPAddress, lease.LeaseTime); err != nil {
+			return domain.Machine{}, fmt.Errorf("failed to lease %s for machine %d: %w", lease.IPAddress, m.ID, err)
+		}
+	}
+	return m, nil
+}
+
 // updateMachine updates an existing machine's details by ID
 func (r *machineRepositoryImpl) updateMachine(m domain.Machine) (domain.Machine, error) {
 	if m.ID == 0 {
@@ -91,15 +204,18 @@ func (r *machineRepositoryImpl) updateMachine(m domain.Machine) (domain.Machine,
 		return domain.Machine{}, fmt.Errorf("machine IPv4 is required when no network_id is provided")
 	}
 
-	var err error
+	runCmd, err := encodeRunCmd(m.RunCmd)
+	if err != nil {
+		return domain.Machine{}, err
+	}
 	if m.NetworkID != nil {
 		// Update with network_id
-		_, err = r.db.Exec("UPDATE machines SET name = ?, hostname = ?, ipv4 = ?, network_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
-			m.Name, m.Hostname, m.IPv4, m.NetworkID, m.ID)
+		_, err = r.db.Exec("UPDATE machines SET name = ?, hostname = ?, ipv4 = ?, ipv6 = ?, network_id = ?, availability_zone = ?, mtu = ?, runcmd = ?, user_data = ?, vendor_data = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+			m.Name, m.Hostname, m.IPv4, m.IPv6, m.NetworkID, m.AvailabilityZone, m.MTU, runCmd, m.UserData, m.VendorData, m.ID)
 	} else {
 		// Update without network_id
-		_, err = r.db.Exec("UPDATE machines SET name = ?, hostname = ?, ipv4 = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
-			m.Name, m.Hostname, m.IPv4, m.ID)
+		_, err = r.db.Exec("UPDATE machines SET name = ?, hostname = ?, ipv4 = ?, ipv6 = ?, availability_zone = ?, mtu = ?, runcmd = ?, user_data = ?, vendor_data = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+			m.Name, m.Hostname, m.IPv4, m.IPv6, m.AvailabilityZone, m.MTU, runCmd, m.UserData, m.VendorData, m.ID)
 	}
 
 	if err != nil {
@@ -113,7 +229,8 @@ func (r *machineRepositoryImpl) updateMachine(m domain.Machine) (domain.Machine,
 func (r *machineRepositoryImpl) FindByID(ctx context.Context, id int64) (domain.Machine, error) {
 	var m domain.Machine
 	var networkID sql.NullInt64
-	err := r.db.QueryRow("SELECT id, name, hostname, ipv4, network_id FROM machines WHERE id = ?", id).Scan(&m.ID, &m.Name, &m.Hostname, &m.IPv4, &networkID)
+	var runCmd string
+	err := r.db.QueryRow("SELECT id, name, hostname, ipv4, network_id, availability_zone, NOT metadata_enabled, mtu, runcmd, ipv6, user_data, vendor_data FROM machines WHERE id = ?", id).Scan(&m.ID, &m.Name, &m.Hostname, &m.IPv4, &networkID, &m.AvailabilityZone, &m.MetadataDisabled, &m.MTU, &runCmd, &m.IPv6, &m.UserData, &m.VendorData)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return domain.Machine{}, fmt.Errorf("machine with ID %d: %w", id, ErrNotFound)
@@ -123,15 +240,61 @@ func (r *machineRepositoryImpl) FindByID(ctx context.Context, id int64) (domain.
 	if networkID.Valid {
 		m.NetworkID = &networkID.Int64
 	}
+	if m.RunCmd, err = decodeRunCmd(runCmd); err != nil {
+		return domain.Machine{}, err
+	}
 	return m, nil
 }
 
 // FindAll retrieves all machines
 func (r *machineRepositoryImpl) FindAll(ctx context.Context) ([]domain.Machine, error) {
-	rows, err := r.db.Query("SELECT id, name, hostname, ipv4, network_id FROM machines")
+	rows, err := r.db.Query("SELECT id, name, hostname, ipv4, network_id, availability_zone, NOT metadata_enabled, mtu, runcmd, ipv6, user_data, vendor_data FROM machines")
 	if err != nil {
 		return nil, fmt.Errorf("failed to list machines: %w", err)
 	}
+	return scanMachines(rows)
+}
+
+// FindAllPaged retrieves up to limit machines ordered by ID, skipping the first offset
+func (r *machineRepositoryImpl) FindAllPaged(ctx context.Context, limit, offset int) ([]domain.Machine, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT id, name, hostname, ipv4, network_id, availability_zone, NOT metadata_enabled, mtu, runcmd, ipv6, user_data, vendor_data FROM machines ORDER BY id LIMIT ? OFFSET ?", limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list machines: %w", err)
+	}
+	return scanMachines(rows)
+}
+
+// FindAllAfterID retrieves up to limit machines with an ID above afterID, ordered
+// by ID. Unlike an offset, the position survives machines being added or removed
+// between calls, so walking the table this way never repeats or skips a machine.
+func (r *machineRepositoryImpl) FindAllAfterID(ctx context.Context, afterID int64, limit int) ([]domain.Machine, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT id, name, hostname, ipv4, network_id, availability_zone, NOT metadata_enabled, mtu, runcmd, ipv6, user_data, vendor_data FROM machines WHERE id > ? ORDER BY id LIMIT ?", afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list machines: %w", err)
+	}
+	return scanMachines(rows)
+}
+
+// FindByNetworkID retrieves the machines on a network ordered by ID
+func (r *machineRepositoryImpl) FindByNetworkID(ctx context.Context, networkID int64) ([]domain.Machine, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT id, name, hostname, ipv4, network_id, availability_zone, NOT metadata_enabled, mtu, runcmd, ipv6, user_data, vendor_data FROM machines WHERE network_id = ? ORDER BY id", networkID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list machines for network %d: %w", networkID, err)
+	}
+	return scanMachines(rows)
+}
+
+// Count returns the total number of machines
+func (r *machineRepositoryImpl) Count(ctx context.Context) (int, error) {
+	var count int
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM machines").Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count machines: %w", err)
+	}
+	return count, nil
+}
+
+// scanMachines reads every machine row from a machines query and closes rows
+func scanMachines(rows *sql.Rows) ([]domain.Machine, error) {
 	defer func() {
 		if closeErr := rows.Close(); closeErr != nil {
 			// Log error but don't fail the operation
@@ -142,14 +305,22 @@ func (r *machineRepositoryImpl) FindAll(ctx context.Context) ([]domain.Machine,
 	for rows.Next() {
 		var m domain.Machine
 		var networkID sql.NullInt64
-		if err := rows.Scan(&m.ID, &m.Name, &m.Hostname, &m.IPv4, &networkID); err != nil {
+		var runCmd string
+		if err := rows.Scan(&m.ID, &m.Name, &m.Hostname, &m.IPv4, &networkID, &m.AvailabilityZone, &m.MetadataDisabled, &m.MTU, &runCmd, &m.IPv6, &m.UserData, &m.VendorData); err != nil {
 			return nil, fmt.Errorf("failed to scan machine: %w", err)
 		}
 		if networkID.Valid {
 			m.NetworkID = &networkID.Int64
 		}
+		var err error
+		if m.RunCmd, err = decodeRunCmd(runCmd); err != nil {
+			return nil, err
+		}
 		machines = append(machines, m)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list machines: %w", err)
+	}
 	return machines, nil
 }
 
@@ -176,7 +347,8 @@ func (r *machineRepositoryImpl) ExistsByID(ctx context.Context, id int64) (bool,
 func (r *machineRepositoryImpl) FindByName(ctx context.Context, name string) (domain.Machine, error) {
 	var m domain.Machine
 	var networkID sql.NullInt64
-	err := r.db.QueryRow("SELECT id, name, hostname, ipv4, network_id FROM machines WHERE name = ?", name).Scan(&m.ID, &m.Name, &m.Hostname, &m.IPv4, &networkID)
+	var runCmd string
+	err := r.db.QueryRow("SELECT id, name, hostname, ipv4, network_id, availability_zone, NOT metadata_enabled, mtu, runcmd, ipv6, user_data, vendor_data FROM machines WHERE name = ?", name).Scan(&m.ID, &m.Name, &m.Hostname, &m.IPv4, &networkID, &m.AvailabilityZone, &m.MetadataDisabled, &m.MTU, &runCmd, &m.IPv6, &m.UserData, &m.VendorData)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return domain.Machine{}, fmt.Errorf("machine with name %s: %w", name, ErrNotFound)
@@ -186,6 +358,9 @@ func (r *machineRepositoryImpl) FindByName(ctx context.Context, name string) (do
 	if networkID.Valid {
 		m.NetworkID = &networkID.Int64
 	}
+	if m.RunCmd, err = decodeRunCmd(runCmd); err != nil {
+		return domain.Machine{}, err
+	}
 	return m, nil
 }
 
@@ -193,7 +368,8 @@ func (r *machineRepositoryImpl) FindByName(ctx context.Context, name string) (do
 func (r *machineRepositoryImpl) FindByIPv4(ctx context.Context, ipv4 string) (domain.Machine, error) {
 	var m domain.Machine
 	var networkID sql.NullInt64
-	err := r.db.QueryRow("SELECT id, name, hostname, ipv4, network_id FROM machines WHERE ipv4 = ?", ipv4).Scan(&m.ID, &m.Name, &m.Hostname, &m.IPv4, &networkID)
+	var runCmd string
+	err := r.db.QueryRow("SELECT id, name, hostname, ipv4, network_id, availability_zone, NOT metadata_enabled, mtu, runcmd, ipv6, user_data, vendor_data FROM machines WHERE ipv4 = ?", ipv4).Scan(&m.ID, &m.Name, &m.Hostname, &m.IPv4, &networkID, &m.AvailabilityZone, &m.MetadataDisabled, &m.MTU, &runCmd, &m.IPv6, &m.UserData, &m.VendorData)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return domain.Machine{}, fmt.Errorf("machine with IPv4 %s: %w", ipv4, ErrNotFound)
@@ -203,5 +379,74 @@ func (r *machineRepositoryImpl) FindByIPv4(ctx context.Context, ipv4 string) (do
 	if networkID.Valid {
 		m.NetworkID = &networkID.Int64
 	}
+	if m.RunCmd, err = decodeRunCmd(runCmd); err != nil {
+		return domain.Machine{}, err
+	}
+	return m, nil
+}
+
+// FindByIPv6 retrieves a machine by its IPv6 address
+func (r *machineRepositoryImpl) FindByIPv6(ctx context.Context, ipv6 string) (domain.Machine, error) {
+	var m domain.Machine
+	var networkID sql.NullInt64
+	var runCmd string
+	err := r.db.QueryRow("SELECT id, name, hostname, ipv4, network_id, availability_zone, NOT metadata_enabled, mtu, runcmd, ipv6, user_data, vendor_data FROM machines WHERE ipv6 = ? AND ipv6 != ''", ipv6).Scan(&m.ID, &m.Name, &m.Hostname, &m.IPv4, &networkID, &m.AvailabilityZone, &m.MetadataDisabled, &m.MTU, &runCmd, &m.IPv6, &m.UserData, &m.VendorData)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return domain.Machine{}, fmt.Errorf("machine with IPv6 %s: %w", ipv6, ErrNotFound)
+		}
+		return domain.Machine{}, fmt.Errorf("failed to find machine by IPv6: %w", err)
+	}
+	if networkID.Valid {
+		m.NetworkID = &networkID.Int64
+	}
+	if m.RunCmd, err = decodeRunCmd(runCmd); err != nil {
+		return domain.Machine{}, err
+	}
 	return m, nil
 }
+
+// SetMetadataEnabled turns metadata serving on or off for a machine. Save never
+// changes this flag, so a disabled machine stays disabled across updates.
+func (r *machineRepositoryImpl) SetMetadataEnabled(ctx context.Context, id int64, enabled bool) error {
+	result, err := r.db.ExecContext(ctx, "UPDATE machines SET metadata_enabled = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", enabled, id)
+	if err != nil {
+		return fmt.Errorf("failed to set machine metadata_enabled: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("machine with ID %d: %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// encodeRunCmd serializes a runcmd list for the machines.runcmd column. An
+// empty list is stored as the column default so it reads back as nil.
+func encodeRunCmd(cmds []string) (string, error) {
+	if len(cmds) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(cmds)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode machine runcmd: %w", err)
+	}
+	return string(data), nil
+}
+
+// decodeRunCmd parses the machines.runcmd column written by encodeRunCmd
+func decodeRunCmd(raw string) ([]string, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var cmds []string
+	if err := json.Unmarshal([]byte(raw), &cmds); err != nil {
+		return nil, fmt.Errorf("failed to decode machine runcmd: %w", err)
+	}
+	return cmds, nil
+}
+
+// Invalidate is a no-op; the plain repository caches nothing
+func (r *machineRepositoryImpl) Invalidate() {}
@@ -52,6 +52,125 @@ func TestMachineRepository_Save(t *testing.T) {
 	assert.Equal(t, "192.168.1.100", saved.IPv4)
 }
 
+func TestMachineRepository_AvailabilityZone(t *testing.T) {
+	db, cleanup := setupTestDBWithMigrations(t, "TestMachineRepository_AvailabilityZone")
+	defer cleanup()
+
+	repo := NewMachineRepository(db)
+	ctx := context.Background()
+
+	saved, err := repo.Save(ctx, domain.Machine{
+		Name:             "zoned-machine",
+		Hostname:         "zoned-host",
+		IPv4:             "192.168.1.101",
+		AvailabilityZone: "rack-a",
+	})
+	require.NoError(t, err)
+
+	found, err := repo.FindByID(ctx, saved.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "rack-a", found.AvailabilityZone)
+
+	found.AvailabilityZone = "rack-b"
+	_, err = repo.Save(ctx, found)
+	require.NoError(t, err)
+
+	found, err = repo.FindByIPv4(ctx, "192.168.1.101")
+	require.NoError(t, err)
+	assert.Equal(t, "rack-b", found.AvailabilityZone)
+}
+
+func TestMachineRepository_RunCmd(t *testing.T) {
+	db, cleanup := setupTestDBWithMigrations(t, "TestMachineRepository_RunCmd")
+	defer cleanup()
+
+	repo := NewMachineRepository(db)
+	ctx := context.Background()
+
+	saved, err := repo.Save(ctx, domain.Machine{
+		Name:     "runcmd-machine",
+		Hostname: "runcmd-host",
+		IPv4:     "192.168.1.102",
+		RunCmd:   []string{"apt-get update", "touch /tmp/done"},
+	})
+	require.NoError(t, err)
+
+	found, err := repo.FindByID(ctx, saved.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"apt-get update", "touch /tmp/done"}, found.RunCmd)
+
+	found.RunCmd = nil
+	_, err = repo.Save(ctx, found)
+	require.NoError(t, err)
+
+	found, err = repo.FindByName(ctx, "runcmd-machine")
+	require.NoError(t, err)
+	assert.Nil(t, found.RunCmd)
+}
+
+func TestMachineRepository_UserData(t *testing.T) {
+	db, cleanup := setupTestDBWithMigrations(t, "TestMachineRepository_UserData")
+	defer cleanup()
+
+	repo := NewMachineRepository(db)
+	ctx := context.Background()
+
+	saved, err := repo.Save(ctx, domain.Machine{
+		Name:     "userdata-machine",
+		Hostname: "userdata-host",
+		IPv4:     "192.168.1.103",
+		UserData: "#!/bin/sh\necho hi\n",
+	})
+	require.NoError(t, err)
+
+	found, err := repo.FindByID(ctx, saved.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "#!/bin/sh\necho hi\n", found.UserData)
+
+	found.UserData = ""
+	_, err = repo.Save(ctx, found)
+	require.NoError(t, err)
+
+	found, err = repo.FindByIPv4(ctx, "192.168.1.103")
+	require.NoError(t, err)
+	assert.Empty(t, found.UserData)
+}
+
+func TestMachineRepository_SetMetadataEnabled(t *testing.T) {
+	db, cleanup := setupTestDBWithMigrations(t, "TestMachineRepository_SetMetadataEnabled")
+	defer cleanup()
+
+	repo := NewMachineRepository(db)
+	ctx := context.Background()
+
+	saved, err := repo.Save(ctx, domain.Machine{Name: "toggle", Hostname: "toggle", IPv4: "192.168.1.30"})
+	require.NoError(t, err)
+	found, err := repo.FindByID(ctx, saved.ID)
+	require.NoError(t, err)
+	assert.False(t, found.MetadataDisabled, "metadata is enabled by default")
+
+	require.NoError(t, repo.SetMetadataEnabled(ctx, saved.ID, false))
+	found, err = repo.FindByIPv4(ctx, "192.168.1.30")
+	require.NoError(t, err)
+	assert.True(t, found.MetadataDisabled)
+
+	// Updating other fields leaves the flag alone
+	found.Hostname = "toggle-renamed"
+	_, err = repo.Save(ctx, found)
+	require.NoError(t, err)
+	found, err = repo.FindByID(ctx, saved.ID)
+	require.NoError(t, err)
+	assert.True(t, found.MetadataDisabled)
+
+	require.NoError(t, repo.SetMetadataEnabled(ctx, saved.ID, true))
+	found, err = repo.FindByID(ctx, saved.ID)
+	require.NoError(t, err)
+	assert.False(t, found.MetadataDisabled)
+
+	err = repo.SetMetadataEnabled(ctx, 99999, false)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
 func TestMachineRepository_FindByID(t *testing.T) {
 	db, cleanup := setupTestDBWithMigrations(t, "TestMachineRepository_FindByID")
 	defer cleanup()
@@ -143,6 +262,43 @@ func TestMachineRepository_FindByIPv4(t *testing.T) {
 	assert.ErrorIs(t, err, ErrNotFound)
 }
 
+func TestMachineRepository_FindByIPv6(t *testing.T) {
+	db, cleanup := setupTestDBWithMigrations(t, "TestMachineRepository_FindByIPv6")
+	defer cleanup()
+
+	repo := NewMachineRepository(db)
+	ctx := context.Background()
+
+	saved, err := repo.Save(ctx, domain.Machine{Name: "v6", Hostname: "v6-host", IPv4: "192.168.1.100", IPv6: "2001:db8::10"})
+	require.NoError(t, err)
+
+	found, err := repo.FindByIPv6(ctx, "2001:db8::10")
+	require.NoError(t, err)
+	assert.Equal(t, saved.ID, found.ID)
+	assert.Equal(t, "192.168.1.100", found.IPv4)
+	assert.Equal(t, "2001:db8::10", found.IPv6)
+
+	// IPv4 lookups still see the IPv6 address
+	found, err = repo.FindByIPv4(ctx, "192.168.1.100")
+	require.NoError(t, err)
+	assert.Equal(t, "2001:db8::10", found.IPv6)
+
+	// Machines without IPv6 neither match an empty lookup nor collide with each other
+	_, err = repo.Save(ctx, domain.Machine{Name: "a", Hostname: "a", IPv4: "192.168.1.101"})
+	require.NoError(t, err)
+	_, err = repo.Save(ctx, domain.Machine{Name: "b", Hostname: "b", IPv4: "192.168.1.102"})
+	require.NoError(t, err)
+	_, err = repo.FindByIPv6(ctx, "")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// A second machine cannot take the same IPv6 address
+	_, err = repo.Save(ctx, domain.Machine{Name: "dup", Hostname: "dup", IPv6: "2001:db8::10"})
+	assert.Error(t, err)
+
+	_, err = repo.FindByIPv6(ctx, "2001:db8::99")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
 func TestMachineRepository_FindAll(t *testing.T) {
 	db, cleanup := setupTestDBWithMigrations(t, "TestMachineRepository_FindAll")
 	defer cleanup()
@@ -181,6 +337,144 @@ func TestMachineRepository_FindAll(t *testing.T) {
 	assert.Contains(t, names, "machine2")
 }
 
+func TestMachineRepository_FindAllPaged(t *testing.T) {
+	db, cleanup := setupTestDBWithMigrations(t, "TestMachineRepository_FindAllPaged")
+	defer cleanup()
+
+	repo := NewMachineRepository(db)
+	ctx := context.Background()
+
+	for _, m := range []domain.Machine{
+		{Name: "a", Hostname: "a", IPv4: "192.168.1.10"},
+		{Name: "b", Hostname: "b", IPv4: "192.168.1.11"},
+		{Name: "c", Hostname: "c", IPv4: "192.168.1.12"},
+	} {
+		_, err := repo.Save(ctx, m)
+		require.NoError(t, err)
+	}
+
+	count, err := repo.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	page, err := repo.FindAllPaged(ctx, 2, 1)
+	require.NoError(t, err)
+	require.Len(t, page, 2)
+	assert.Equal(t, "b", page[0].Name)
+	assert.Equal(t, "c", page[1].Name)
+
+	page, err = repo.FindAllPaged(ctx, 2, 3)
+	require.NoError(t, err)
+	assert.Empty(t, page)
+}
+
+func TestMachineRepository_FindAllAfterID(t *testing.T) {
+	db, cleanup := setupTestDBWithMigrations(t, "TestMachineRepository_FindAllAfterID")
+	defer cleanup()
+
+	repo := NewMachineRepository(db)
+	ctx := context.Background()
+
+	var saved []domain.Machine
+	for _, m := range []domain.Machine{
+		{Name: "a", Hostname: "a", IPv4: "192.168.1.10"},
+		{Name: "b", Hostname: "b", IPv4: "192.168.1.11"},
+		{Name: "c", Hostname: "c", IPv4: "192.168.1.12"},
+	} {
+		m, err := repo.Save(ctx, m)
+		require.NoError(t, err)
+		saved = append(saved, m)
+	}
+
+	page, err := repo.FindAllAfterID(ctx, 0, 2)
+	require.NoError(t, err)
+	require.Len(t, page, 2)
+	assert.Equal(t, "a", page[0].Name)
+	assert.Equal(t, "b", page[1].Name)
+
+	// Removing a machine already read does not shift the next batch
+	require.NoError(t, repo.DeleteByID(ctx, saved[0].ID))
+	page, err = repo.FindAllAfterID(ctx, page[1].ID, 2)
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	assert.Equal(t, "c", page[0].Name)
+}
+
+func TestMachineRepository_FindByNetworkID(t *testing.T) {
+	db, cleanup := setupTestDBWithMigrations(t, "TestMachineRepository_FindByNetworkID")
+	defer cleanup()
+
+	repo := NewMachineRepository(db)
+	ctx := context.Background()
+	networkRepo := NewNetworkRepository(db)
+	lab, err := networkRepo.Save(ctx, domain.Network{Name: "lab", Bridge: "br0", Subnet: "10.10.0.0/24"})
+	require.NoError(t, err)
+	other, err := networkRepo.Save(ctx, domain.Network{Name: "other", Bridge: "br1", Subnet: "10.20.0.0/24"})
+	require.NoError(t, err)
+
+	_, err = repo.Save(ctx, domain.Machine{Name: "on-lab", Hostname: "on-lab", IPv4: "10.10.0.5", NetworkID: &lab.ID})
+	require.NoError(t, err)
+	_, err = repo.Save(ctx, domain.Machine{Name: "on-other", Hostname: "on-other", IPv4: "10.20.0.5", NetworkID: &other.ID})
+	require.NoError(t, err)
+	_, err = repo.Save(ctx, domain.Machine{Name: "static", Hostname: "static", IPv4: "10.30.0.5"})
+	require.NoError(t, err)
+
+	machines, err := repo.FindByNetworkID(ctx, lab.ID)
+	require.NoError(t, err)
+	require.Len(t, machines, 1)
+	assert.Equal(t, "on-lab", machines[0].Name)
+
+	machines, err = repo.FindByNetworkID(ctx, 999)
+	require.NoError(t, err)
+	assert.Empty(t, machines)
+}
+
+func TestMachineRepository_CreateMachines(t *testing.T) {
+	db, cleanup := setupTestDBWithMigrations(t, "TestMachineRepository_CreateMachines")
+	defer cleanup()
+
+	repo := NewMachineRepository(db)
+	ctx := context.Background()
+	network, err := NewNetworkRepository(db).Save(ctx, domain.Network{Name: "lab", Bridge: "br0", Subnet: "10.10.0.0/24"})
+	require.NoError(t, err)
+	_, err = NewDHCPRangeRepository(db).Save(ctx, domain.DHCPRange{NetworkID: network.ID, StartIP: "10.10.0.100", EndIP: "10.10.0.110", LeaseTime: "24h"})
+	require.NoError(t, err)
+
+	created, err := repo.CreateMachines(ctx, []domain.Machine{
+		{Name: "static", Hostname: "static", IPv4: "10.20.0.5"},
+		{Name: "leased-1", Hostname: "leased-1", NetworkID: &network.ID},
+		{Name: "leased-2", Hostname: "leased-2", NetworkID: &network.ID},
+	})
+	require.NoError(t, err)
+	require.Len(t, created, 3)
+	assert.Equal(t, "10.20.0.5", created[0].IPv4)
+	assert.Equal(t, "10.10.0.100", created[1].IPv4)
+	assert.Equal(t, "10.10.0.101", created[2].IPv4)
+	leases, err := NewIPLeaseRepository(db).FindByNetworkID(ctx, network.ID)
+	require.NoError(t, err)
+	assert.Len(t, leases, 2)
+
+	// A duplicate name mid-batch rolls back the machines and leases before it
+	_, err = repo.CreateMachines(ctx, []domain.Machine{
+		{Name: "fresh", Hostname: "fresh", NetworkID: &network.ID},
+		{Name: "static", Hostname: "again", IPv4: "10.20.0.6"},
+		{Name: "never", Hostname: "never", IPv4: "10.20.0.7"},
+	})
+	var itemErr *BatchItemError
+	require.ErrorAs(t, err, &itemErr)
+	assert.Equal(t, 1, itemErr.Index)
+	assert.ErrorIs(t, err, ErrDuplicate)
+
+	_, err = repo.FindByName(ctx, "fresh")
+	assert.ErrorIs(t, err, ErrNotFound)
+	count, err := repo.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+	leases, err = NewIPLeaseRepository(db).FindByNetworkID(ctx, network.ID)
+	require.NoError(t, err)
+	assert.Len(t, leases, 2)
+}
+
 func TestMachineRepository_DeleteByID(t *testing.T) {
 	db, cleanup := setupTestDBWithMigrations(t, "TestMachineRepository_DeleteByID")
 	defer cleanup()
@@ -4,6 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/jbweber/homelab/nook/internal/domain"
 )
@@ -14,6 +16,12 @@ type NetworkRepository interface {
 	FindByName(ctx context.Context, name string) (domain.Network, error)
 	FindByBridge(ctx context.Context, bridge string) (domain.Network, error)
 	GetDHCPRanges(ctx context.Context, networkID int64) ([]domain.DHCPRange, error)
+	GetTags(ctx context.Context, networkID int64) (map[string]string, error)
+	SetTags(ctx context.Context, networkID int64, tags map[string]string) error
+	FindByTags(ctx context.Context, tags map[string]string) ([]domain.Network, error)
+	GetMACReservations(ctx context.Context, networkID int64) ([]domain.MACReservation, error)
+	SaveMACReservation(ctx context.Context, reservation domain.MACReservation) (domain.MACReservation, error)
+	DeleteMACReservation(ctx context.Context, networkID, id int64) error
 }
 
 // networkRepositoryImpl implements NetworkRepository
@@ -30,6 +38,16 @@ func NewNetworkRepository(db *sql.DB) NetworkRepository {
 
 // Save creates or updates a network
 func (r *networkRepositoryImpl) Save(ctx context.Context, network domain.Network) (domain.Network, error) {
+	if !domain.ValidAllocationStrategy(network.AllocationStrategy) {
+		return domain.Network{}, fmt.Errorf("invalid allocation strategy %q", network.AllocationStrategy)
+	}
+	if !domain.ValidMTU(network.MTU) {
+		return domain.Network{}, fmt.Errorf("invalid MTU %d: must be between %d and %d", network.MTU, domain.MinMTU, domain.MaxMTU)
+	}
+	if network.AllocationStrategy == "" {
+		network.AllocationStrategy = domain.AllocationStrategyLowest
+	}
+
 	if network.ID == 0 {
 		// Create new network
 		return r.createNetwork(network)
@@ -58,13 +76,13 @@ func (r *networkRepositoryImpl) createNetwork(n domain.Network) (domain.Network,
 		return domain.Network{}, fmt.Errorf("failed to check for duplicate network name: %w", err)
 	}
 	if count > 0 {
-		return domain.Network{}, fmt.Errorf("network with name '%s' already exists", n.Name)
+		return domain.Network{}, fmt.Errorf("network with name '%s': %w", n.Name, ErrDuplicate)
 	}
 
 	result, err := r.db.Exec(`
-		INSERT INTO networks (name, bridge, subnet, gateway, dns_servers, description)
-		VALUES (?, ?, ?, ?, ?, ?)`,
-		n.Name, n.Bridge, n.Subnet, n.Gateway, n.DNSServers, n.Description)
+		INSERT INTO networks (name, bridge, subnet, gateway, dns_servers, description, allocation_strategy, mtu, dns_forwarders)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		n.Name, n.Bridge, n.Subnet, n.Gateway, n.DNSServers, n.Description, n.AllocationStrategy, n.MTU, n.DNSForwarders)
 	if err != nil {
 		return domain.Network{}, fmt.Errorf("failed to create network: %w", err)
 	}
@@ -97,14 +115,14 @@ func (r *networkRepositoryImpl) updateNetwork(n domain.Network) (domain.Network,
 		return domain.Network{}, fmt.Errorf("failed to check for duplicate network name: %w", err)
 	}
 	if count > 0 {
-		return domain.Network{}, fmt.Errorf("network with name '%s' already exists", n.Name)
+		return domain.Network{}, fmt.Errorf("network with name '%s': %w", n.Name, ErrDuplicate)
 	}
 
 	_, err = r.db.Exec(`
 		UPDATE networks
-		SET name = ?, bridge = ?, subnet = ?, gateway = ?, dns_servers = ?, description = ?, updated_at = CURRENT_TIMESTAMP
+		SET name = ?, bridge = ?, subnet = ?, gateway = ?, dns_servers = ?, description = ?, allocation_strategy = ?, mtu = ?, dns_forwarders = ?, updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?`,
-		n.Name, n.Bridge, n.Subnet, n.Gateway, n.DNSServers, n.Description, n.ID)
+		n.Name, n.Bridge, n.Subnet, n.Gateway, n.DNSServers, n.Description, n.AllocationStrategy, n.MTU, n.DNSForwarders, n.ID)
 	if err != nil {
 		return domain.Network{}, fmt.Errorf("failed to update network: %w", err)
 	}
@@ -116,10 +134,10 @@ func (r *networkRepositoryImpl) updateNetwork(n domain.Network) (domain.Network,
 func (r *networkRepositoryImpl) FindByID(ctx context.Context, id int64) (domain.Network, error) {
 	var network domain.Network
 	err := r.db.QueryRow(`
-		SELECT id, name, bridge, subnet, gateway, dns_servers, description
+		SELECT id, name, bridge, subnet, gateway, dns_servers, description, allocation_strategy, mtu, dns_forwarders
 		FROM networks WHERE id = ?`, id).Scan(
 		&network.ID, &network.Name, &network.Bridge, &network.Subnet,
-		&network.Gateway, &network.DNSServers, &network.Description)
+		&network.Gateway, &network.DNSServers, &network.Description, &network.AllocationStrategy, &network.MTU, &network.DNSForwarders)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return domain.Network{}, fmt.Errorf("network with ID %d not found", id)
@@ -133,13 +151,13 @@ func (r *networkRepositoryImpl) FindByID(ctx context.Context, id int64) (domain.
 func (r *networkRepositoryImpl) FindByName(ctx context.Context, name string) (domain.Network, error) {
 	var network domain.Network
 	err := r.db.QueryRow(`
-		SELECT id, name, bridge, subnet, gateway, dns_servers, description
+		SELECT id, name, bridge, subnet, gateway, dns_servers, description, allocation_strategy, mtu, dns_forwarders
 		FROM networks WHERE name = ?`, name).Scan(
 		&network.ID, &network.Name, &network.Bridge, &network.Subnet,
-		&network.Gateway, &network.DNSServers, &network.Description)
+		&network.Gateway, &network.DNSServers, &network.Description, &network.AllocationStrategy, &network.MTU, &network.DNSForwarders)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return domain.Network{}, fmt.Errorf("network with name '%s' not found", name)
+			return domain.Network{}, fmt.Errorf("network with name '%s': %w", name, ErrNotFound)
 		}
 		return domain.Network{}, fmt.Errorf("failed to find network: %w", err)
 	}
@@ -150,10 +168,10 @@ func (r *networkRepositoryImpl) FindByName(ctx context.Context, name string) (do
 func (r *networkRepositoryImpl) FindByBridge(ctx context.Context, bridge string) (domain.Network, error) {
 	var network domain.Network
 	err := r.db.QueryRow(`
-		SELECT id, name, bridge, subnet, gateway, dns_servers, description
+		SELECT id, name, bridge, subnet, gateway, dns_servers, description, allocation_strategy, mtu, dns_forwarders
 		FROM networks WHERE bridge = ?`, bridge).Scan(
 		&network.ID, &network.Name, &network.Bridge, &network.Subnet,
-		&network.Gateway, &network.DNSServers, &network.Description)
+		&network.Gateway, &network.DNSServers, &network.Description, &network.AllocationStrategy, &network.MTU, &network.DNSForwarders)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return domain.Network{}, fmt.Errorf("network with bridge '%s' not found", bridge)
@@ -166,7 +184,7 @@ func (r *networkRepositoryImpl) FindByBridge(ctx context.Context, bridge string)
 // FindAll finds all networks
 func (r *networkRepositoryImpl) FindAll(ctx context.Context) ([]domain.Network, error) {
 	rows, err := r.db.Query(`
-		SELECT id, name, bridge, subnet, gateway, dns_servers, description
+		SELECT id, name, bridge, subnet, gateway, dns_servers, description, allocation_strategy, mtu, dns_forwarders
 		FROM networks ORDER BY name`)
 	if err != nil {
 		return nil, fmt.Errorf("failed to find networks: %w", err)
@@ -178,7 +196,7 @@ func (r *networkRepositoryImpl) FindAll(ctx context.Context) ([]domain.Network,
 		var network domain.Network
 		err := rows.Scan(
 			&network.ID, &network.Name, &network.Bridge, &network.Subnet,
-			&network.Gateway, &network.DNSServers, &network.Description)
+			&network.Gateway, &network.DNSServers, &network.Description, &network.AllocationStrategy, &network.MTU, &network.DNSForwarders)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan network: %w", err)
 		}
@@ -249,3 +267,182 @@ func (r *networkRepositoryImpl) ExistsByID(ctx context.Context, id int64) (bool,
 	}
 	return count > 0, nil
 }
+
+// GetTags gets all tags for a network
+func (r *networkRepositoryImpl) GetTags(ctx context.Context, networkID int64) (map[string]string, error) {
+	rows, err := r.db.Query("SELECT key, value FROM network_tags WHERE network_id = ?", networkID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get network tags: %w", err)
+	}
+	defer rows.Close()
+
+	tags := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan network tag: %w", err)
+		}
+		tags[key] = value
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating network tags: %w", err)
+	}
+
+	return tags, nil
+}
+
+// SetTags replaces all tags for a network
+func (r *networkRepositoryImpl) SetTags(ctx context.Context, networkID int64, tags map[string]string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err := tx.Exec("DELETE FROM network_tags WHERE network_id = ?", networkID); err != nil {
+		return fmt.Errorf("failed to clear network tags: %w", err)
+	}
+
+	for key, value := range tags {
+		if key == "" {
+			return fmt.Errorf("network tag key is required")
+		}
+		if _, err := tx.Exec("INSERT INTO network_tags (network_id, key, value) VALUES (?, ?, ?)", networkID, key, value); err != nil {
+			return fmt.Errorf("failed to save network tag '%s': %w", key, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit network tags: %w", err)
+	}
+
+	return nil
+}
+
+// FindByTags finds all networks carrying every one of the given tags
+func (r *networkRepositoryImpl) FindByTags(ctx context.Context, tags map[string]string) ([]domain.Network, error) {
+	// Sort keys so the generated query is stable
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var conditions []string
+	var args []interface{}
+	for _, key := range keys {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM network_tags t WHERE t.network_id = n.id AND t.key = ? AND t.value = ?)")
+		args = append(args, key, tags[key])
+	}
+
+	query := `
+		SELECT n.id, n.name, n.bridge, n.subnet, n.gateway, n.dns_servers, n.description, n.allocation_strategy, n.mtu, n.dns_forwarders
+		FROM networks n`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY n.name"
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find networks by tags: %w", err)
+	}
+	defer rows.Close()
+
+	var networks []domain.Network
+	for rows.Next() {
+		var network domain.Network
+		err := rows.Scan(
+			&network.ID, &network.Name, &network.Bridge, &network.Subnet,
+			&network.Gateway, &network.DNSServers, &network.Description, &network.AllocationStrategy, &network.MTU, &network.DNSForwarders)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan network: %w", err)
+		}
+		networks = append(networks, network)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating networks: %w", err)
+	}
+
+	return networks, nil
+}
+
+// GetMACReservations gets all MAC reservations for a network, ordered by ID
+func (r *networkRepositoryImpl) GetMACReservations(ctx context.Context, networkID int64) ([]domain.MACReservation, error) {
+	rows, err := r.db.Query(`
+		SELECT id, network_id, mac, ip_address, hostname
+		FROM mac_reservations
+		WHERE network_id = ?
+		ORDER BY id`, networkID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get MAC reservations: %w", err)
+	}
+	defer rows.Close()
+
+	var reservations []domain.MACReservation
+	for rows.Next() {
+		var res domain.MACReservation
+		if err := rows.Scan(&res.ID, &res.NetworkID, &res.MAC, &res.IPAddress, &res.Hostname); err != nil {
+			return nil, fmt.Errorf("failed to scan MAC reservation: %w", err)
+		}
+		reservations = append(reservations, res)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating MAC reservations: %w", err)
+	}
+
+	return reservations, nil
+}
+
+// SaveMACReservation creates a MAC reservation
+func (r *networkRepositoryImpl) SaveMACReservation(ctx context.Context, res domain.MACReservation) (domain.MACReservation, error) {
+	if res.NetworkID == 0 {
+		return domain.MACReservation{}, fmt.Errorf("MAC reservation network ID is required")
+	}
+	if res.MAC == "" {
+		return domain.MACReservation{}, fmt.Errorf("MAC reservation MAC address is required")
+	}
+	if res.IPAddress == "" {
+		return domain.MACReservation{}, fmt.Errorf("MAC reservation IP address is required")
+	}
+
+	result, err := r.db.Exec(`
+		INSERT INTO mac_reservations (network_id, mac, ip_address, hostname)
+		VALUES (?, ?, ?, ?)`,
+		res.NetworkID, res.MAC, res.IPAddress, res.Hostname)
+	if err != nil {
+		return domain.MACReservation{}, fmt.Errorf("failed to create MAC reservation: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return domain.MACReservation{}, fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+
+	res.ID = id
+	return res, nil
+}
+
+// DeleteMACReservation deletes a MAC reservation belonging to a network
+func (r *networkRepositoryImpl) DeleteMACReservation(ctx context.Context, networkID, id int64) error {
+	result, err := r.db.Exec("DELETE FROM mac_reservations WHERE id = ? AND network_id = ?", id, networkID)
+	if err != nil {
+		return fmt.Errorf("failed to delete MAC reservation: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("MAC reservation with ID %d: %w", id, ErrNotFound)
+	}
+
+	return nil
+}
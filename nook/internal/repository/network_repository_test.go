@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/jbweber/homelab/nook/internal/domain"
@@ -48,6 +49,40 @@ func TestNetworkRepository_Save(t *testing.T) {
 	}
 }
 
+func TestNetworkRepository_Save_AllocationStrategy(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestNetworkRepository_Save_AllocationStrategy")
+	defer cleanup()
+
+	repo := NewNetworkRepository(db)
+	ctx := context.Background()
+
+	// Unset defaults to lowest
+	saved, err := repo.Save(ctx, domain.Network{Name: "default-net", Bridge: "br0", Subnet: "192.168.1.0/24"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	found, err := repo.FindByID(ctx, saved.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if found.AllocationStrategy != domain.AllocationStrategyLowest {
+		t.Errorf("Expected strategy %q, got %q", domain.AllocationStrategyLowest, found.AllocationStrategy)
+	}
+
+	found.AllocationStrategy = domain.AllocationStrategyRandom
+	if _, err := repo.Save(ctx, found); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	found, _ = repo.FindByID(ctx, saved.ID)
+	if found.AllocationStrategy != domain.AllocationStrategyRandom {
+		t.Errorf("Expected strategy %q, got %q", domain.AllocationStrategyRandom, found.AllocationStrategy)
+	}
+
+	if _, err := repo.Save(ctx, domain.Network{Name: "bad-net", Bridge: "br1", Subnet: "10.0.0.0/24", AllocationStrategy: "highest"}); err == nil {
+		t.Error("Expected error for unknown allocation strategy")
+	}
+}
+
 func TestNetworkRepository_FindByID(t *testing.T) {
 	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestNetworkRepository_FindByID")
 	defer cleanup()
@@ -250,3 +285,124 @@ func TestNetworkRepository_ExistsByID(t *testing.T) {
 		t.Error("Expected network to exist")
 	}
 }
+
+func TestNetworkRepository_Tags(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestNetworkRepository_Tags")
+	defer cleanup()
+
+	repo := NewNetworkRepository(db)
+	ctx := context.Background()
+
+	dmz, err := repo.Save(ctx, domain.Network{Name: "dmz", Bridge: "br0", Subnet: "192.168.1.0/24"})
+	if err != nil {
+		t.Fatalf("Failed to save network: %v", err)
+	}
+	lab, err := repo.Save(ctx, domain.Network{Name: "lab", Bridge: "br1", Subnet: "192.168.2.0/24"})
+	if err != nil {
+		t.Fatalf("Failed to save network: %v", err)
+	}
+
+	// New networks have no tags
+	tags, err := repo.GetTags(ctx, dmz.ID)
+	if err != nil {
+		t.Fatalf("Failed to get tags: %v", err)
+	}
+	if len(tags) != 0 {
+		t.Errorf("Expected no tags, got %v", tags)
+	}
+
+	if err := repo.SetTags(ctx, dmz.ID, map[string]string{"zone": "dmz", "tier": "edge"}); err != nil {
+		t.Fatalf("Failed to set tags: %v", err)
+	}
+	if err := repo.SetTags(ctx, lab.ID, map[string]string{"zone": "internal", "tier": "edge"}); err != nil {
+		t.Fatalf("Failed to set tags: %v", err)
+	}
+
+	// SetTags replaces rather than merges
+	if err := repo.SetTags(ctx, dmz.ID, map[string]string{"zone": "dmz"}); err != nil {
+		t.Fatalf("Failed to replace tags: %v", err)
+	}
+	tags, err = repo.GetTags(ctx, dmz.ID)
+	if err != nil {
+		t.Fatalf("Failed to get tags: %v", err)
+	}
+	if len(tags) != 1 || tags["zone"] != "dmz" {
+		t.Errorf("Expected only zone=dmz, got %v", tags)
+	}
+
+	// Filter by a single tag
+	found, err := repo.FindByTags(ctx, map[string]string{"zone": "dmz"})
+	if err != nil {
+		t.Fatalf("Failed to find by tags: %v", err)
+	}
+	if len(found) != 1 || found[0].ID != dmz.ID {
+		t.Errorf("Expected only dmz network, got %v", found)
+	}
+
+	// Multiple tags must all match
+	found, err = repo.FindByTags(ctx, map[string]string{"zone": "internal", "tier": "edge"})
+	if err != nil {
+		t.Fatalf("Failed to find by tags: %v", err)
+	}
+	if len(found) != 1 || found[0].ID != lab.ID {
+		t.Errorf("Expected only lab network, got %v", found)
+	}
+
+	// Tags are removed along with their network
+	if err := repo.DeleteByID(ctx, lab.ID); err != nil {
+		t.Fatalf("Failed to delete network: %v", err)
+	}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM network_tags WHERE network_id = ?", lab.ID).Scan(&count); err != nil {
+		t.Fatalf("Failed to count tags: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected tags to be cascade-deleted, found %d", count)
+	}
+}
+
+func TestNetworkRepository_MACReservations(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestNetworkRepository_MACReservations")
+	defer cleanup()
+
+	repo := NewNetworkRepository(db)
+	ctx := context.Background()
+
+	network, err := repo.Save(ctx, domain.Network{Name: "lab", Bridge: "br0", Subnet: "192.168.1.0/24"})
+	if err != nil {
+		t.Fatalf("Failed to save network: %v", err)
+	}
+
+	saved, err := repo.SaveMACReservation(ctx, domain.MACReservation{
+		NetworkID: network.ID,
+		MAC:       "52:54:00:12:34:56",
+		IPAddress: "192.168.1.20",
+		Hostname:  "printer",
+	})
+	if err != nil {
+		t.Fatalf("Failed to save MAC reservation: %v", err)
+	}
+	if saved.ID == 0 {
+		t.Error("Expected saved reservation to have an ID")
+	}
+
+	// The same MAC cannot be reserved twice in one network
+	if _, err := repo.SaveMACReservation(ctx, domain.MACReservation{NetworkID: network.ID, MAC: "52:54:00:12:34:56", IPAddress: "192.168.1.21"}); err == nil {
+		t.Error("Expected error for duplicate MAC reservation")
+	}
+
+	reservations, err := repo.GetMACReservations(ctx, network.ID)
+	if err != nil {
+		t.Fatalf("Failed to get MAC reservations: %v", err)
+	}
+	if len(reservations) != 1 || reservations[0] != saved {
+		t.Errorf("Expected [%+v], got %+v", saved, reservations)
+	}
+
+	if err := repo.DeleteMACReservation(ctx, network.ID, saved.ID); err != nil {
+		t.Fatalf("Failed to delete MAC reservation: %v", err)
+	}
+	if err := repo.DeleteMACReservation(ctx, network.ID, saved.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound deleting a missing reservation, got %v", err)
+	}
+}
@@ -1,6 +1,9 @@
 package repository
 
-import "context"
+import (
+	"context"
+	"database/sql"
+)
 
 // Repository defines the basic CRUD operations for any entity type.
 // This follows a similar pattern to Spring Data's Repository interface.
@@ -22,3 +25,10 @@ type Repository[T any, ID comparable] interface {
 	// ExistsByID checks if an entity exists by its ID
 	ExistsByID(ctx context.Context, id ID) (bool, error)
 }
+
+// queryer is the query surface shared by *sql.DB, *sql.Conn and *sql.Tx, for
+// helpers that run inside whichever of them the caller holds.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
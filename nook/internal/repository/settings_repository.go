@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Setting keys stored in the settings table
+const (
+	SettingMOTD = "motd" // Lab-wide message of the day written to /etc/motd via user-data
+)
+
+// SettingsRepository stores deployment-wide key/value settings
+type SettingsRepository interface {
+	// Get returns the value of a setting, or ErrNotFound if it has never been set
+	Get(ctx context.Context, key string) (string, error)
+
+	// Set creates or replaces the value of a setting
+	Set(ctx context.Context, key, value string) error
+}
+
+// settingsRepositoryImpl implements SettingsRepository
+type settingsRepositoryImpl struct {
+	db *sql.DB
+}
+
+// NewSettingsRepository creates a new settings repository
+func NewSettingsRepository(db *sql.DB) SettingsRepository {
+	return &settingsRepositoryImpl{
+		db: db,
+	}
+}
+
+// Get returns the value of a setting
+func (r *settingsRepositoryImpl) Get(ctx context.Context, key string) (string, error) {
+	var value string
+	err := r.db.QueryRowContext(ctx, "SELECT value FROM settings WHERE key = ?", key).Scan(&value)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("setting %q: %w", key, ErrNotFound)
+		}
+		return "", fmt.Errorf("failed to get setting %q: %w", key, err)
+	}
+	return value, nil
+}
+
+// Set creates or replaces the value of a setting
+func (r *settingsRepositoryImpl) Set(ctx context.Context, key, value string) error {
+	_, err := r.db.ExecContext(ctx,
+		"INSERT INTO settings (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value",
+		key, value)
+	if err != nil {
+		return fmt.Errorf("failed to set setting %q: %w", key, err)
+	}
+	return nil
+}
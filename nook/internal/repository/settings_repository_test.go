@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jbweber/homelab/nook/internal/testutil"
+)
+
+func TestSettingsRepository_GetSet(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestSettingsRepository_GetSet")
+	defer cleanup()
+
+	repo := NewSettingsRepository(db)
+	ctx := context.Background()
+
+	// Unset settings report ErrNotFound
+	_, err := repo.Get(ctx, SettingMOTD)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound for unset setting, got %v", err)
+	}
+
+	if err := repo.Set(ctx, SettingMOTD, "Welcome to the lab"); err != nil {
+		t.Fatalf("Failed to set setting: %v", err)
+	}
+	value, err := repo.Get(ctx, SettingMOTD)
+	if err != nil {
+		t.Fatalf("Failed to get setting: %v", err)
+	}
+	if value != "Welcome to the lab" {
+		t.Errorf("Expected %q, got %q", "Welcome to the lab", value)
+	}
+
+	// Setting again replaces the value
+	if err := repo.Set(ctx, SettingMOTD, "Maintenance tonight"); err != nil {
+		t.Fatalf("Failed to replace setting: %v", err)
+	}
+	value, err = repo.Get(ctx, SettingMOTD)
+	if err != nil {
+		t.Fatalf("Failed to get setting: %v", err)
+	}
+	if value != "Maintenance tonight" {
+		t.Errorf("Expected %q, got %q", "Maintenance tonight", value)
+	}
+}
@@ -0,0 +1,381 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jbweber/homelab/nook/internal/domain"
+)
+
+// Snapshot holds every row of the inventory tables with their database IDs intact.
+type Snapshot struct {
+	Networks        []domain.Network
+	NetworkTags     []NetworkTag
+	DHCPRanges      []domain.DHCPRange
+	MACReservations []domain.MACReservation
+	IPReservations  []domain.IPReservation
+	Machines        []domain.Machine
+	SSHKeys         []domain.SSHKey
+	Leases          []domain.IPAddressLease
+	KeyGroups       []domain.KeyGroup
+	KeyGroupKeys    []domain.KeyGroupKey
+	KeyGroupMembers []KeyGroupMember
+	Settings        map[string]string
+}
+
+// NetworkTag is one key/value tag row of a network
+type NetworkTag struct {
+	NetworkID int64
+	Key       string
+	Value     string
+}
+
+// KeyGroupMember is one machine's membership of a key group
+type KeyGroupMember struct {
+	GroupID   int64
+	MachineID int64
+}
+
+// SnapshotRepository takes and restores full Snapshots of the inventory tables.
+type SnapshotRepository interface {
+	// Take reads every row of the inventory tables inside a single read
+	// transaction, so the snapshot is consistent. SSH key text is returned as
+	// plaintext even when keys are encrypted at rest.
+	Take(ctx context.Context) (Snapshot, error)
+
+	// Restore inserts every row of s in dependency order inside a single
+	// transaction, preserving IDs. Returns ErrDuplicate if any inventory table
+	// already holds rows; nothing is written on any error.
+	Restore(ctx context.Context, s Snapshot) error
+}
+
+// keyTextSealer is implemented by SSH key repositories that may encrypt key text at rest.
+type keyTextSealer interface {
+	sealKeyText(keyText string) (string, error)
+	openKeyText(stored string) (string, error)
+}
+
+type snapshotRepositoryImpl struct {
+	db     *sql.DB
+	sealer keyTextSealer // nil stores key text as given
+}
+
+// NewSnapshotRepository creates a new snapshot repository. Restored SSH keys are
+// stored the way sshKeys stores them, so they stay encrypted when it encrypts.
+func NewSnapshotRepository(db *sql.DB, sshKeys SSHKeyRepository) SnapshotRepository {
+	r := &snapshotRepositoryImpl{db: db}
+	if sealer, ok := sshKeys.(keyTextSealer); ok {
+		r.sealer = sealer
+	}
+	return r
+}
+
+// snapshotTables lists the inventory tables a restore requires to be empty.
+var snapshotTables = []string{
+	"networks", "network_tags", "dhcp_ranges", "mac_reservations", "ip_reservations", "machines", "ssh_keys",
+	"ip_address_leases", "key_groups", "key_group_keys", "key_group_members", "settings",
+}
+
+// Take implements SnapshotRepository
+func (r *snapshotRepositoryImpl) Take(ctx context.Context) (Snapshot, error) {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	s := Snapshot{Settings: map[string]string{}}
+	err = queryEach(ctx, tx, "networks", `
+		SELECT id, name, bridge, subnet, gateway, dns_servers, description, allocation_strategy, mtu, dns_forwarders
+		FROM networks ORDER BY id`, func(rows *sql.Rows) error {
+		var n domain.Network
+		err := rows.Scan(&n.ID, &n.Name, &n.Bridge, &n.Subnet, &n.Gateway, &n.DNSServers, &n.Description, &n.AllocationStrategy, &n.MTU, &n.DNSForwarders)
+		s.Networks = append(s.Networks, n)
+		return err
+	})
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	err = queryEach(ctx, tx, "network tags", "SELECT network_id, key, value FROM network_tags ORDER BY network_id, key", func(rows *sql.Rows) error {
+		var t NetworkTag
+		err := rows.Scan(&t.NetworkID, &t.Key, &t.Value)
+		s.NetworkTags = append(s.NetworkTags, t)
+		return err
+	})
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	err = queryEach(ctx, tx, "DHCP ranges", "SELECT id, network_id, start_ip, end_ip, lease_time FROM dhcp_ranges ORDER BY id", func(rows *sql.Rows) error {
+		var d domain.DHCPRange
+		err := rows.Scan(&d.ID, &d.NetworkID, &d.StartIP, &d.EndIP, &d.LeaseTime)
+		s.DHCPRanges = append(s.DHCPRanges, d)
+		return err
+	})
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	err = queryEach(ctx, tx, "MAC reservations", "SELECT id, network_id, mac, ip_address, hostname FROM mac_reservations ORDER BY id", func(rows *sql.Rows) error {
+		var m domain.MACReservation
+		err := rows.Scan(&m.ID, &m.NetworkID, &m.MAC, &m.IPAddress, &m.Hostname)
+		s.MACReservations = append(s.MACReservations, m)
+		return err
+	})
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	err = queryEach(ctx, tx, "IP reservations", "SELECT id, network_id, ip_address, token, created_at FROM ip_reservations ORDER BY id", func(rows *sql.Rows) error {
+		var res domain.IPReservation
+		err := rows.Scan(&res.ID, &res.NetworkID, &res.IPAddress, &res.Token, &res.CreatedAt)
+		s.IPReservations = append(s.IPReservations, res)
+		return err
+	})
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, name, hostname, ipv4, network_id, availability_zone, NOT metadata_enabled, mtu, runcmd, ipv6, user_data, vendor_data FROM machines ORDER BY id")
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("failed to list machines: %w", err)
+	}
+	if s.Machines, err = scanMachines(rows); err != nil {
+		return Snapshot{}, err
+	}
+
+	err = queryEach(ctx, tx, "SSH keys", "SELECT id, machine_id, key_text FROM ssh_keys ORDER BY id", func(rows *sql.Rows) error {
+		var k domain.SSHKey
+		if err := rows.Scan(&k.ID, &k.MachineID, &k.KeyText); err != nil {
+			return err
+		}
+		if r.sealer != nil {
+			keyText, err := r.sealer.openKeyText(k.KeyText)
+			if err != nil {
+				return fmt.Errorf("SSH key %d: %w", k.ID, err)
+			}
+			k.KeyText = keyText
+		}
+		s.SSHKeys = append(s.SSHKeys, k)
+		return nil
+	})
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	err = queryEach(ctx, tx, "leases", `
+		SELECT id, machine_id, network_id, ip_address, lease_time, created_at, updated_at
+		FROM ip_address_leases ORDER BY id`, func(rows *sql.Rows) error {
+		var l domain.IPAddressLease
+		err := rows.Scan(&l.ID, &l.MachineID, &l.NetworkID, &l.IPAddress, &l.LeaseTime, &l.CreatedAt, &l.UpdatedAt)
+		s.Leases = append(s.Leases, l)
+		return err
+	})
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	err = queryEach(ctx, tx, "key groups", "SELECT id, name FROM key_groups ORDER BY id", func(rows *sql.Rows) error {
+		var g domain.KeyGroup
+		err := rows.Scan(&g.ID, &g.Name)
+		s.KeyGroups = append(s.KeyGroups, g)
+		return err
+	})
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	err = queryEach(ctx, tx, "key group keys", "SELECT id, group_id, key_text FROM key_group_keys ORDER BY id", func(rows *sql.Rows) error {
+		var k domain.KeyGroupKey
+		if err := rows.Scan(&k.ID, &k.GroupID, &k.KeyText); err != nil {
+			return err
+		}
+		if r.sealer != nil {
+			keyText, err := r.sealer.openKeyText(k.KeyText)
+			if err != nil {
+				return fmt.Errorf("key group key %d: %w", k.ID, err)
+			}
+			k.KeyText = keyText
+		}
+		s.KeyGroupKeys = append(s.KeyGroupKeys, k)
+		return nil
+	})
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	err = queryEach(ctx, tx, "key group members", "SELECT group_id, machine_id FROM key_group_members ORDER BY group_id, machine_id", func(rows *sql.Rows) error {
+		var m KeyGroupMember
+		err := rows.Scan(&m.GroupID, &m.MachineID)
+		s.KeyGroupMembers = append(s.KeyGroupMembers, m)
+		return err
+	})
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	err = queryEach(ctx, tx, "settings", "SELECT key, value FROM settings", func(rows *sql.Rows) error {
+		var key, value string
+		err := rows.Scan(&key, &value)
+		s.Settings[key] = value
+		return err
+	})
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	return s, nil
+}
+
+// queryEach runs query inside tx and calls scan for every row; what names the
+// rows in error messages.
+func queryEach(ctx context.Context, tx *sql.Tx, what, query string, scan func(*sql.Rows) error) error {
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to list %s: %w", what, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return fmt.Errorf("failed to scan %s: %w", what, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating %s: %w", what, err)
+	}
+	return nil
+}
+
+// Restore implements SnapshotRepository
+func (r *snapshotRepositoryImpl) Restore(ctx context.Context, s Snapshot) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	for _, table := range snapshotTables {
+		var count int
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table).Scan(&count); err != nil {
+			return fmt.Errorf("failed to count %s: %w", table, err)
+		}
+		if count > 0 {
+			return fmt.Errorf("table %s is not empty: %w", table, ErrDuplicate)
+		}
+	}
+
+	for _, n := range s.Networks {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO networks (id, name, bridge, subnet, gateway, dns_servers, description, allocation_strategy, mtu, dns_forwarders)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			n.ID, n.Name, n.Bridge, n.Subnet, n.Gateway, n.DNSServers, n.Description, n.AllocationStrategy, n.MTU, n.DNSForwarders); err != nil {
+			return fmt.Errorf("failed to restore network %d: %w", n.ID, err)
+		}
+	}
+
+	for _, t := range s.NetworkTags {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO network_tags (network_id, key, value) VALUES (?, ?, ?)", t.NetworkID, t.Key, t.Value); err != nil {
+			return fmt.Errorf("failed to restore tag %q of network %d: %w", t.Key, t.NetworkID, err)
+		}
+	}
+
+	for _, d := range s.DHCPRanges {
+		if err := checkDHCPRangeInSubnet(ctx, tx, d); err != nil {
+			return fmt.Errorf("failed to restore DHCP range %d: %w", d.ID, err)
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO dhcp_ranges (id, network_id, start_ip, end_ip, lease_time) VALUES (?, ?, ?, ?, ?)",
+			d.ID, d.NetworkID, d.StartIP, d.EndIP, d.LeaseTime); err != nil {
+			return fmt.Errorf("failed to restore DHCP range %d: %w", d.ID, err)
+		}
+	}
+
+	for _, m := range s.MACReservations {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO mac_reservations (id, network_id, mac, ip_address, hostname) VALUES (?, ?, ?, ?, ?)",
+			m.ID, m.NetworkID, m.MAC, m.IPAddress, m.Hostname); err != nil {
+			return fmt.Errorf("failed to restore MAC reservation %d: %w", m.ID, err)
+		}
+	}
+
+	for _, res := range s.IPReservations {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO ip_reservations (id, network_id, ip_address, token, created_at) VALUES (?, ?, ?, ?, ?)",
+			res.ID, res.NetworkID, res.IPAddress, res.Token, res.CreatedAt); err != nil {
+			return fmt.Errorf("failed to restore IP reservation %d: %w", res.ID, err)
+		}
+	}
+
+	for _, m := range s.Machines {
+		runCmd, err := encodeRunCmd(m.RunCmd)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO machines (id, name, hostname, ipv4, ipv6, network_id, availability_zone, metadata_enabled, mtu, runcmd, user_data, vendor_data)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			m.ID, m.Name, m.Hostname, m.IPv4, m.IPv6, m.NetworkID, m.AvailabilityZone, !m.MetadataDisabled, m.MTU, runCmd, m.UserData, m.VendorData); err != nil {
+			return fmt.Errorf("failed to restore machine %d: %w", m.ID, err)
+		}
+	}
+
+	for _, k := range s.SSHKeys {
+		stored := k.KeyText
+		if r.sealer != nil {
+			if stored, err = r.sealer.sealKeyText(k.KeyText); err != nil {
+				return fmt.Errorf("failed to restore SSH key %d: %w", k.ID, err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO ssh_keys (id, machine_id, key_text) VALUES (?, ?, ?)", k.ID, k.MachineID, stored); err != nil {
+			return fmt.Errorf("failed to restore SSH key %d: %w", k.ID, err)
+		}
+	}
+
+	for _, l := range s.Leases {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO ip_address_leases (id, machine_id, network_id, ip_address, lease_time, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			l.ID, l.MachineID, l.NetworkID, l.IPAddress, l.LeaseTime, l.CreatedAt, l.UpdatedAt); err != nil {
+			return fmt.Errorf("failed to restore lease %d: %w", l.ID, err)
+		}
+	}
+
+	for _, g := range s.KeyGroups {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO key_groups (id, name) VALUES (?, ?)", g.ID, g.Name); err != nil {
+			return fmt.Errorf("failed to restore key group %d: %w", g.ID, err)
+		}
+	}
+
+	for _, k := range s.KeyGroupKeys {
+		stored := k.KeyText
+		if r.sealer != nil {
+			if stored, err = r.sealer.sealKeyText(k.KeyText); err != nil {
+				return fmt.Errorf("failed to restore key group key %d: %w", k.ID, err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO key_group_keys (id, group_id, key_text) VALUES (?, ?, ?)", k.ID, k.GroupID, stored); err != nil {
+			return fmt.Errorf("failed to restore key group key %d: %w", k.ID, err)
+		}
+	}
+
+	for _, m := range s.KeyGroupMembers {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO key_group_members (group_id, machine_id) VALUES (?, ?)", m.GroupID, m.MachineID); err != nil {
+			return fmt.Errorf("failed to restore membership of machine %d in key group %d: %w", m.MachineID, m.GroupID, err)
+		}
+	}
+
+	for key, value := range s.Settings {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO settings (key, value) VALUES (?, ?)", key, value); err != nil {
+			return fmt.Errorf("failed to restore setting %q: %w", key, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit restore: %w", err)
+	}
+	return nil
+}
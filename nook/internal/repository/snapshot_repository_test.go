@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jbweber/homelab/nook/internal/domain"
+	"github.com/jbweber/homelab/nook/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotRepository_Restore(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestSnapshotRepository_Restore")
+	defer cleanup()
+
+	ctx := context.Background()
+	sshKeys, err := NewEncryptedSSHKeyRepository(db, []byte("0123456789abcdef0123456789abcdef"))
+	require.NoError(t, err)
+	repo := NewSnapshotRepository(db, sshKeys)
+
+	networkID := int64(7)
+	keyText := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIHHWRsRoeU3xJXRngvR6Eavcr4HtOIkitq6kLNDWS8Z5 alice@lab"
+	snapshot := Snapshot{
+		Networks:        []domain.Network{{ID: networkID, Name: "lab", Bridge: "br0", Subnet: "192.168.1.0/24", Gateway: "192.168.1.1", AllocationStrategy: domain.AllocationStrategyLowest}},
+		NetworkTags:     []NetworkTag{{NetworkID: networkID, Key: "env", Value: "lab"}},
+		DHCPRanges:      []domain.DHCPRange{{ID: 3, NetworkID: networkID, StartIP: "192.168.1.100", EndIP: "192.168.1.110", LeaseTime: "12h"}},
+		MACReservations: []domain.MACReservation{{ID: 4, NetworkID: networkID, MAC: "52:54:00:12:34:56", IPAddress: "192.168.1.50", Hostname: "printer"}},
+		IPReservations:  []domain.IPReservation{{ID: 6, NetworkID: networkID, IPAddress: "192.168.1.60", Token: "tok", CreatedAt: "2025-01-01T00:00:00Z"}},
+		Machines:        []domain.Machine{{ID: 42, Name: "vm1", Hostname: "vm1", IPv4: "192.168.1.100", NetworkID: &networkID, MetadataDisabled: true, RunCmd: []string{"echo hi"}}},
+		SSHKeys:         []domain.SSHKey{{ID: 9, MachineID: 42, KeyText: keyText}},
+		Leases:          []domain.IPAddressLease{{ID: 5, MachineID: 42, NetworkID: networkID, IPAddress: "192.168.1.100", LeaseTime: "12h", CreatedAt: "2025-01-01T00:00:00Z", UpdatedAt: "2025-01-02T00:00:00Z"}},
+		KeyGroups:       []domain.KeyGroup{{ID: 2, Name: "admins"}},
+		KeyGroupKeys:    []domain.KeyGroupKey{{ID: 8, GroupID: 2, KeyText: keyText}},
+		KeyGroupMembers: []KeyGroupMember{{GroupID: 2, MachineID: 42}},
+		Settings:        map[string]string{SettingMOTD: "hello"},
+	}
+	require.NoError(t, repo.Restore(ctx, snapshot))
+
+	// Taking a snapshot reads back exactly what was restored, with key text opened
+	taken, err := repo.Take(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, snapshot, taken)
+
+	// IDs and fields survive
+	machine, err := NewMachineRepository(db).FindByID(ctx, 42)
+	require.NoError(t, err)
+	assert.Equal(t, snapshot.Machines[0], machine)
+	rangeRow, err := NewDHCPRangeRepository(db).FindByID(ctx, 3)
+	require.NoError(t, err)
+	assert.Equal(t, snapshot.DHCPRanges[0], rangeRow)
+	leases, err := NewIPLeaseRepository(db).FindAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, leases, 1)
+	assert.Equal(t, int64(5), leases[0].ID)
+
+	// SSH keys and group keys are sealed by the encrypting repository
+	var stored string
+	require.NoError(t, db.QueryRow("SELECT key_text FROM ssh_keys WHERE id = 9").Scan(&stored))
+	assert.NotContains(t, stored, "alice@lab")
+	require.NoError(t, db.QueryRow("SELECT key_text FROM key_group_keys WHERE id = 8").Scan(&stored))
+	assert.NotContains(t, stored, "alice@lab")
+	key, err := sshKeys.FindByID(ctx, 9)
+	require.NoError(t, err)
+	assert.Equal(t, keyText, key.KeyText)
+
+	// A second restore is refused because the tables are no longer empty
+	err = repo.Restore(ctx, snapshot)
+	assert.ErrorIs(t, err, ErrDuplicate)
+}
+
+func TestSnapshotRepository_Restore_RollsBack(t *testing.T) {
+	db, cleanup := testutil.SetupTestDBWithMigrations(t, "TestSnapshotRepository_Restore_RollsBack")
+	defer cleanup()
+
+	ctx := context.Background()
+	repo := NewSnapshotRepository(db, NewSSHKeyRepository(db))
+
+	// The DHCP range lies outside its network, so nothing may be written
+	err := repo.Restore(ctx, Snapshot{
+		Networks:   []domain.Network{{ID: 1, Name: "lab", Subnet: "192.168.1.0/24"}},
+		DHCPRanges: []domain.DHCPRange{{ID: 1, NetworkID: 1, StartIP: "10.0.0.1", EndIP: "10.0.0.9", LeaseTime: "24h"}},
+	})
+	assert.ErrorIs(t, err, ErrInvalidEntity)
+
+	networks, err := NewNetworkRepository(db).FindAll(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, networks)
+}
@@ -2,8 +2,13 @@ package repository
 
 import (
 	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
 	"database/sql"
+	"encoding/base64"
 	"fmt"
+	"strings"
 
 	"github.com/jbweber/homelab/nook/internal/domain"
 )
@@ -15,11 +20,19 @@ type SSHKeyRepository interface {
 	// Domain-specific operations
 	FindByMachineID(ctx context.Context, machineID int64) ([]domain.SSHKey, error)
 	CreateForMachine(ctx context.Context, machineID int64, keyText string) (*domain.SSHKey, error)
+	DeleteByIDs(ctx context.Context, ids []int64) (int, error)
+	DeleteByMachineID(ctx context.Context, machineID int64) (int, error)
+	UpdateKeyText(ctx context.Context, id int64, keyText string) (*domain.SSHKey, error)
 }
 
+// encryptedKeyTextPrefix marks key_text values sealed with AES-GCM. Rows without
+// it are plaintext, so enabling encryption on an existing database still works.
+const encryptedKeyTextPrefix = "enc:v1:"
+
 // sshKeyRepositoryImpl implements SSHKeyRepository
 type sshKeyRepositoryImpl struct {
-	db *sql.DB
+	db   *sql.DB
+	aead cipher.AEAD // nil stores key text as plaintext
 }
 
 // NewSSHKeyRepository creates a new SSH key repository
@@ -29,6 +42,57 @@ func NewSSHKeyRepository(db *sql.DB) SSHKeyRepository {
 	}
 }
 
+// NewEncryptedSSHKeyRepository creates an SSH key repository that encrypts key text
+// at rest with AES-GCM and transparently decrypts it on read. The key must be 16,
+// 24 or 32 bytes long.
+func NewEncryptedSSHKeyRepository(db *sql.DB, key []byte) (SSHKeyRepository, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH key encryption key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize SSH key encryption: %w", err)
+	}
+	return &sshKeyRepositoryImpl{
+		db:   db,
+		aead: aead,
+	}, nil
+}
+
+// sealKeyText encrypts key text for storage when encryption is enabled
+func (r *sshKeyRepositoryImpl) sealKeyText(keyText string) (string, error) {
+	if r.aead == nil {
+		return keyText, nil
+	}
+	nonce := make([]byte, r.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := r.aead.Seal(nonce, nonce, []byte(keyText), nil)
+	return encryptedKeyTextPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openKeyText decrypts stored key text; plaintext rows are returned unchanged
+func (r *sshKeyRepositoryImpl) openKeyText(stored string) (string, error) {
+	if !strings.HasPrefix(stored, encryptedKeyTextPrefix) {
+		return stored, nil
+	}
+	if r.aead == nil {
+		return "", fmt.Errorf("SSH key is encrypted but no encryption key is configured")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, encryptedKeyTextPrefix))
+	if err != nil || len(sealed) < r.aead.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted SSH key")
+	}
+	nonce, ciphertext := sealed[:r.aead.NonceSize()], sealed[r.aead.NonceSize():]
+	plain, err := r.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt SSH key: %w", err)
+	}
+	return string(plain), nil
+}
+
 // Save creates or updates an SSH key
 func (r *sshKeyRepositoryImpl) Save(ctx context.Context, entity domain.SSHKey) (domain.SSHKey, error) {
 	// For SSH keys, we always create new ones (no updates)
@@ -49,6 +113,9 @@ func (r *sshKeyRepositoryImpl) FindByID(ctx context.Context, id int64) (domain.S
 		}
 		return domain.SSHKey{}, fmt.Errorf("failed to find SSH key: %w", err)
 	}
+	if k.KeyText, err = r.openKeyText(k.KeyText); err != nil {
+		return domain.SSHKey{}, fmt.Errorf("SSH key %d: %w", id, err)
+	}
 	return k, nil
 }
 
@@ -70,6 +137,11 @@ func (r *sshKeyRepositoryImpl) FindAll(ctx context.Context) ([]domain.SSHKey, er
 		if err := rows.Scan(&k.ID, &k.MachineID, &k.KeyText); err != nil {
 			return nil, fmt.Errorf("failed to scan SSH key: %w", err)
 		}
+		keyText, err := r.openKeyText(k.KeyText)
+		if err != nil {
+			return nil, fmt.Errorf("SSH key %d: %w", k.ID, err)
+		}
+		k.KeyText = keyText
 		keys = append(keys, k)
 	}
 	return keys, nil
@@ -84,6 +156,19 @@ func (r *sshKeyRepositoryImpl) DeleteByID(ctx context.Context, id int64) error {
 	return nil
 }
 
+// DeleteByMachineID removes every SSH key of a machine and returns how many were deleted
+func (r *sshKeyRepositoryImpl) DeleteByMachineID(ctx context.Context, machineID int64) (int, error) {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM ssh_keys WHERE machine_id = ?", machineID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete SSH keys for machine %d: %w", machineID, err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return int(deleted), nil
+}
+
 // ExistsByID checks if an SSH key exists by its ID
 func (r *sshKeyRepositoryImpl) ExistsByID(ctx context.Context, id int64) (bool, error) {
 	var count int
@@ -112,6 +197,11 @@ func (r *sshKeyRepositoryImpl) FindByMachineID(ctx context.Context, machineID in
 		if err := rows.Scan(&k.ID, &k.MachineID, &k.KeyText); err != nil {
 			return nil, fmt.Errorf("failed to scan SSH key: %w", err)
 		}
+		keyText, err := r.openKeyText(k.KeyText)
+		if err != nil {
+			return nil, fmt.Errorf("SSH key %d: %w", k.ID, err)
+		}
+		k.KeyText = keyText
 		keys = append(keys, k)
 	}
 	return keys, nil
@@ -119,7 +209,11 @@ func (r *sshKeyRepositoryImpl) FindByMachineID(ctx context.Context, machineID in
 
 // CreateForMachine creates a new SSH key for a specific machine
 func (r *sshKeyRepositoryImpl) CreateForMachine(ctx context.Context, machineID int64, keyText string) (*domain.SSHKey, error) {
-	res, err := r.db.Exec("INSERT INTO ssh_keys (machine_id, key_text) VALUES (?, ?)", machineID, keyText)
+	stored, err := r.sealKeyText(keyText)
+	if err != nil {
+		return nil, err
+	}
+	res, err := r.db.Exec("INSERT INTO ssh_keys (machine_id, key_text) VALUES (?, ?)", machineID, stored)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create SSH key for machine %d: %w", machineID, err)
 	}
@@ -135,6 +229,65 @@ func (r *sshKeyRepositoryImpl) CreateForMachine(ctx context.Context, machineID i
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve created SSH key: %w", err)
 	}
+	if k.KeyText, err = r.openKeyText(k.KeyText); err != nil {
+		return nil, fmt.Errorf("SSH key %d: %w", k.ID, err)
+	}
+
+	return &k, nil
+}
+
+// UpdateKeyText replaces the text of an existing SSH key, keeping its ID and machine
+func (r *sshKeyRepositoryImpl) UpdateKeyText(ctx context.Context, id int64, keyText string) (*domain.SSHKey, error) {
+	stored, err := r.sealKeyText(keyText)
+	if err != nil {
+		return nil, err
+	}
+	res, err := r.db.ExecContext(ctx, "UPDATE ssh_keys SET key_text = ? WHERE id = ?", stored, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update SSH key %d: %w", id, err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return nil, fmt.Errorf("SSH key with ID %d: %w", id, ErrNotFound)
+	}
 
+	k, err := r.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
 	return &k, nil
 }
+
+// DeleteByIDs deletes the given SSH keys in a single transaction. Returns the number of keys deleted.
+func (r *sshKeyRepositoryImpl) DeleteByIDs(ctx context.Context, ids []int64) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil && rollbackErr != sql.ErrTxDone {
+			// Log error but don't fail if transaction is already committed
+		}
+	}()
+
+	deleted := 0
+	for _, id := range ids {
+		result, err := tx.ExecContext(ctx, "DELETE FROM ssh_keys WHERE id = ?", id)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete SSH key %d: %w", id, err)
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		deleted += int(rowsAffected)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit SSH key deletion: %w", err)
+	}
+	return deleted, nil
+}
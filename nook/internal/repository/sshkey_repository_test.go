@@ -225,6 +225,71 @@ func TestSSHKeyRepository_DeleteByID(t *testing.T) {
 	assert.ErrorIs(t, err, ErrNotFound)
 }
 
+func TestSSHKeyRepository_DeleteByIDs(t *testing.T) {
+	db, cleanup := setupSSHKeyTestDBWithMigrations(t, "TestSSHKeyRepository_DeleteByIDs")
+	defer cleanup()
+
+	repo := NewSSHKeyRepository(db)
+	ctx := context.Background()
+
+	machine, err := NewMachineRepository(db).Save(ctx, domain.Machine{
+		Name:     "test-machine",
+		Hostname: "test-host",
+		IPv4:     "192.168.1.100",
+	})
+	require.NoError(t, err)
+
+	key1, err := repo.CreateForMachine(ctx, machine.ID, "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQCkey1")
+	require.NoError(t, err)
+	key2, err := repo.CreateForMachine(ctx, machine.ID, "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQCkey2")
+	require.NoError(t, err)
+	key3, err := repo.CreateForMachine(ctx, machine.ID, "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQCkey3")
+	require.NoError(t, err)
+
+	// Unknown IDs are ignored and not counted
+	deleted, err := repo.DeleteByIDs(ctx, []int64{key1.ID, key3.ID, 99999})
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+
+	remaining, err := repo.FindByMachineID(ctx, machine.ID)
+	require.NoError(t, err)
+	require.Len(t, remaining, 1)
+	assert.Equal(t, key2.ID, remaining[0].ID)
+}
+
+func TestSSHKeyRepository_DeleteByMachineID(t *testing.T) {
+	db, cleanup := setupSSHKeyTestDBWithMigrations(t, "TestSSHKeyRepository_DeleteByMachineID")
+	defer cleanup()
+
+	repo := NewSSHKeyRepository(db)
+	ctx := context.Background()
+	machineRepo := NewMachineRepository(db)
+
+	machine, err := machineRepo.Save(ctx, domain.Machine{Name: "rotated", Hostname: "rotated", IPv4: "192.168.1.100"})
+	require.NoError(t, err)
+	other, err := machineRepo.Save(ctx, domain.Machine{Name: "other", Hostname: "other", IPv4: "192.168.1.101"})
+	require.NoError(t, err)
+
+	_, err = repo.CreateForMachine(ctx, machine.ID, "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQCkey1")
+	require.NoError(t, err)
+	_, err = repo.CreateForMachine(ctx, machine.ID, "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQCkey2")
+	require.NoError(t, err)
+	kept, err := repo.CreateForMachine(ctx, other.ID, "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQCkey3")
+	require.NoError(t, err)
+
+	deleted, err := repo.DeleteByMachineID(ctx, machine.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+
+	remaining, err := repo.FindByMachineID(ctx, machine.ID)
+	require.NoError(t, err)
+	assert.Empty(t, remaining)
+	remaining, err = repo.FindByMachineID(ctx, other.ID)
+	require.NoError(t, err)
+	require.Len(t, remaining, 1)
+	assert.Equal(t, kept.ID, remaining[0].ID)
+}
+
 func TestSSHKeyRepository_ExistsByID(t *testing.T) {
 	db, cleanup := setupSSHKeyTestDBWithMigrations(t, "TestSSHKeyRepository_ExistsByID")
 	defer cleanup()
@@ -276,3 +341,67 @@ func TestSSHKeyRepository_ErrorHandling(t *testing.T) {
 	err = repo.DeleteByID(ctx, 99999)
 	assert.NoError(t, err) // SQLite DELETE on non-existent row doesn't error
 }
+
+func TestSSHKeyRepository_Encrypted(t *testing.T) {
+	db, cleanup := setupSSHKeyTestDBWithMigrations(t, "TestSSHKeyRepository_Encrypted")
+	defer cleanup()
+
+	ctx := context.Background()
+	encryptionKey := []byte("0123456789abcdef0123456789abcdef")
+	repo, err := NewEncryptedSSHKeyRepository(db, encryptionKey)
+	require.NoError(t, err)
+
+	machine, err := NewMachineRepository(db).Save(ctx, domain.Machine{Name: "test-machine", Hostname: "test-host", IPv4: "192.168.1.100"})
+	require.NoError(t, err)
+
+	keyText := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIHHWRsRoeU3xJXRngvR6Eavcr4HtOIkitq6kLNDWS8Z5 alice@lab"
+	created, err := repo.CreateForMachine(ctx, machine.ID, keyText)
+	require.NoError(t, err)
+	assert.Equal(t, keyText, created.KeyText)
+
+	// The stored bytes differ from the plaintext
+	var stored string
+	require.NoError(t, db.QueryRow("SELECT key_text FROM ssh_keys WHERE id = ?", created.ID).Scan(&stored))
+	assert.NotEqual(t, keyText, stored)
+	assert.NotContains(t, stored, "alice@lab")
+
+	// Every read path returns the original key
+	found, err := repo.FindByID(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, keyText, found.KeyText)
+	all, err := repo.FindAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	assert.Equal(t, keyText, all[0].KeyText)
+	byMachine, err := repo.FindByMachineID(ctx, machine.ID)
+	require.NoError(t, err)
+	require.Len(t, byMachine, 1)
+	assert.Equal(t, keyText, byMachine[0].KeyText)
+
+	// Updates are sealed too
+	relabeled := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIHHWRsRoeU3xJXRngvR6Eavcr4HtOIkitq6kLNDWS8Z5 alice@laptop"
+	updated, err := repo.UpdateKeyText(ctx, created.ID, relabeled)
+	require.NoError(t, err)
+	assert.Equal(t, relabeled, updated.KeyText)
+	require.NoError(t, db.QueryRow("SELECT key_text FROM ssh_keys WHERE id = ?", created.ID).Scan(&stored))
+	assert.NotContains(t, stored, "alice@laptop")
+	_, err = repo.UpdateKeyText(ctx, 9999, relabeled)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = repo.UpdateKeyText(ctx, created.ID, keyText)
+	require.NoError(t, err)
+
+	// Plaintext rows written before encryption was enabled are still readable
+	_, err = NewSSHKeyRepository(db).CreateForMachine(ctx, machine.ID, "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQClegacy")
+	require.NoError(t, err)
+	all, err = repo.FindAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.Equal(t, "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQClegacy", all[1].KeyText)
+
+	// Without the key, encrypted rows cannot be read
+	_, err = NewSSHKeyRepository(db).FindByID(ctx, created.ID)
+	assert.Error(t, err)
+
+	_, err = NewEncryptedSSHKeyRepository(db, []byte("short"))
+	assert.Error(t, err)
+}
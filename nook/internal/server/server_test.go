@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startBlockingServer runs a server whose only handler waits for release
+// before answering, and signals entered once a request is in flight.
+func startBlockingServer(t *testing.T, shutdownTimeout time.Duration) (url string, entered, release chan struct{}, cancel context.CancelFunc, done chan error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	entered = make(chan struct{})
+	release = make(chan struct{})
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+		_, _ = io.WriteString(w, "done")
+	})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done = make(chan error, 1)
+	go func() {
+		done <- Run(ctx, srv, ln, shutdownTimeout)
+	}()
+	return "http://" + ln.Addr().String(), entered, release, cancel, done
+}
+
+func TestRun_ShutdownWaitsForInFlightRequests(t *testing.T) {
+	url, entered, release, cancel, done := startBlockingServer(t, 5*time.Second)
+
+	type result struct {
+		body string
+		err  error
+	}
+	responses := make(chan result, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			responses <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		responses <- result{body: string(body), err: err}
+	}()
+
+	<-entered
+	cancel()
+
+	// Shutdown must not return while the request is still being handled
+	select {
+	case err := <-done:
+		t.Fatalf("Run returned before the in-flight request finished: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	res := <-responses
+	require.NoError(t, res.err)
+	assert.Equal(t, "done", res.body)
+	assert.NoError(t, <-done)
+
+	_, err := http.Get(url)
+	assert.Error(t, err, "the listener should be closed after shutdown")
+}
+
+func TestRun_ShutdownTimeout(t *testing.T) {
+	url, entered, release, cancel, done := startBlockingServer(t, 10*time.Millisecond)
+	defer close(release)
+
+	go func() {
+		if resp, err := http.Get(url); err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	<-entered
+	cancel()
+	err := <-done
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "expected a shutdown timeout, got %v", err)
+}
+
+func TestRun_ServeError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.NoError(t, ln.Close())
+
+	err = Run(context.Background(), &http.Server{}, ln, time.Second)
+	assert.Error(t, err)
+}
@@ -4,9 +4,11 @@ import (
 	"database/sql"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/jbweber/homelab/nook/internal/config"
 	"github.com/jbweber/homelab/nook/internal/migrations"
 	_ "modernc.org/sqlite"
 )
@@ -78,3 +80,34 @@ func SetupTestDBWithMigrations(t *testing.T, testName string) (*sql.DB, func())
 
 	return db, cleanup
 }
+
+// SetupFileTestDBWithMigrations creates a migrated WAL database file under
+// t.TempDir. Unlike the shared-cache in-memory databases it locks the way a
+// deployment does, so concurrent writers can be tested against it.
+func SetupFileTestDBWithMigrations(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", config.SQLiteDSN(filepath.Join(t.TempDir(), "nook.db")))
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	t.Cleanup(func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("Warning: failed to close test database: %v", closeErr)
+		}
+	})
+
+	for _, pragma := range []string{"PRAGMA journal_mode = WAL", "PRAGMA foreign_keys = ON"} {
+		if _, err := db.Exec(pragma); err != nil {
+			t.Fatalf("Failed to apply %q: %v", pragma, err)
+		}
+	}
+
+	migrator := migrations.NewMigrator(db)
+	for _, migration := range migrations.GetInitialMigrations() {
+		migrator.AddMigration(migration)
+	}
+	if err := migrator.RunMigrations(); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	return db
+}
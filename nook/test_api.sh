@@ -32,7 +32,7 @@ echo "Testing Nook Machine API..."
 
 # Start the server in background
 echo "Starting server..."
-./nook server --db-path ./test_nook.db --port 8081 &
+./nook server --db-path ./test_nook.db --port 8081 --trusted-proxies 127.0.0.1/32 &
 SERVER_PID=$!
 
 # Wait for server to start